@@ -1,43 +1,311 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"google.golang.org/grpc"
 
+	"logger/internal/fluent"
+	"logger/internal/format"
+	"logger/internal/gelf"
+	"logger/internal/grpcapi"
+	"logger/internal/grpcapi/ingestpb"
 	"logger/internal/httpapi"
+	"logger/internal/ingest"
+	"logger/internal/model"
+	"logger/internal/query"
 	"logger/internal/sink"
+	"logger/internal/syslog"
 )
 
+// sinkCloser is a sink that owns resources released on shutdown.
+type sinkCloser interface {
+	sink.Sink
+	Close() error
+}
+
+// shutdownTimeout bounds how long in-flight HTTP requests may take to finish on shutdown.
+const shutdownTimeout = 30 * time.Second
+
 func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run starts the service and blocks until SIGINT or SIGTERM. It returns instead of
+// exiting so that the deferred closes stop the listeners before the sinks drain.
+func run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	addr := normalizeAddr(os.Getenv("PORT"))
 	logDir := os.Getenv("LOG_DIR")
 	if logDir == "" {
 		logDir = "./logs"
 	}
 
-	fileSink, err := sink.NewFileSink(logDir)
+	formatter, err := formatterFromEnv("LOG_FORMAT", "LOG_TEMPLATE")
+	if err != nil {
+		return fmt.Errorf("invalid output format: %w", err)
+	}
+
+	paths := sink.DefaultPathTemplate(formatter.Extension())
+	if tmpl := strings.TrimSpace(os.Getenv("LOG_PATH_TEMPLATE")); tmpl != "" {
+		if paths, err = sink.ParsePathTemplate(tmpl); err != nil {
+			return fmt.Errorf("invalid LOG_PATH_TEMPLATE: %w", err)
+		}
+	}
+	maxOpenFiles, err := envInt("LOG_MAX_OPEN_FILES")
+	if err != nil {
+		return fmt.Errorf("invalid LOG_MAX_OPEN_FILES: %w", err)
+	}
+	maxFileBytes, err := envInt("LOG_MAX_FILE_BYTES")
+	if err != nil {
+		return fmt.Errorf("invalid LOG_MAX_FILE_BYTES: %w", err)
+	}
+	maxFileLines, err := envInt("LOG_MAX_FILE_LINES")
+	if err != nil {
+		return fmt.Errorf("invalid LOG_MAX_FILE_LINES: %w", err)
+	}
+
+	onDiskFull, err := diskFullPolicyFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid LOG_DISK_FULL_POLICY: %w", err)
+	}
+	var minFree int64
+	if v := strings.TrimSpace(os.Getenv("LOG_MIN_FREE")); v != "" {
+		if minFree, err = sink.ParseBytes(v); err != nil {
+			return fmt.Errorf("invalid LOG_MIN_FREE: %w", err)
+		}
+	}
+
+	fileSink, err := sink.NewFileSinkWithOptions(logDir, sink.FileSinkOptions{
+		Journal:      envBool("LOG_JOURNAL"),
+		JournalDir:   strings.TrimSpace(os.Getenv("LOG_JOURNAL_DIR")),
+		Paths:        paths,
+		MaxOpenFiles: maxOpenFiles,
+		MaxFileBytes: int64(maxFileBytes),
+		MaxFileLines: int64(maxFileLines),
+		OnDiskFull:   onDiskFull,
+		MinFreeBytes: minFree,
+		SpillDir:     strings.TrimSpace(os.Getenv("LOG_SPILL_DIR")),
+	})
 	if err != nil {
-		log.Fatalf("failed to initialise file sink: %v", err)
+		return fmt.Errorf("failed to initialise file sink: %w", err)
+	}
+
+	if c := strings.TrimSpace(os.Getenv("LOG_COMPRESS")); c != "" {
+		compression, err := sink.ParseCompression(c)
+		if err != nil {
+			return fmt.Errorf("invalid LOG_COMPRESS: %w", err)
+		}
+		interval, err := envDuration("LOG_COMPRESS_INTERVAL")
+		if err != nil {
+			return fmt.Errorf("invalid LOG_COMPRESS_INTERVAL: %w", err)
+		}
+		compactor := sink.NewCompactor(logDir, sink.CompactorConfig{
+			Compression: compression,
+			Paths:       paths,
+			Interval:    interval,
+		})
+		compactor.Start()
+		defer compactor.Close()
+	}
+
+	if spec := strings.TrimSpace(os.Getenv("LOG_RETENTION")); spec != "" {
+		rules, err := sink.ParseRetentionRules(spec)
+		if err != nil {
+			return fmt.Errorf("invalid LOG_RETENTION: %w", err)
+		}
+		interval, err := envDuration("LOG_RETENTION_INTERVAL")
+		if err != nil {
+			return fmt.Errorf("invalid LOG_RETENTION_INTERVAL: %w", err)
+		}
+		retention, err := sink.NewRetention(logDir, sink.RetentionConfig{
+			Rules:    rules,
+			Paths:    paths,
+			Interval: interval,
+		})
+		if err != nil {
+			return fmt.Errorf("invalid LOG_RETENTION: %w", err)
+		}
+		retention.Start()
+		defer retention.Close()
+	}
+
+	var s sinkCloser = fileSink
+	if envBool("LOG_ASYNC") {
+		cfg, err := asyncConfigFromEnv()
+		if err != nil {
+			return fmt.Errorf("invalid async sink configuration: %w", err)
+		}
+		s = sink.NewAsyncSink(fileSink, cfg)
+	}
+	var children []sink.Child
+	if envBool("LOG_STDOUT") {
+		minLevel, err := envLevel("LOG_STDOUT_MIN_LEVEL")
+		if err != nil {
+			return fmt.Errorf("invalid LOG_STDOUT_MIN_LEVEL: %w", err)
+		}
+		// The stdout child keeps the file format unless LOG_STDOUT_FORMAT is set.
+		stdoutFormatter := formatter
+		if os.Getenv("LOG_STDOUT_FORMAT") != "" {
+			if stdoutFormatter, err = formatterFromEnv("LOG_STDOUT_FORMAT", "LOG_STDOUT_TEMPLATE"); err != nil {
+				return fmt.Errorf("invalid stdout format: %w", err)
+			}
+		}
+		children = append(children, sink.Child{
+			Name:      "stdout",
+			Sink:      sink.NewWriterSink(os.Stdout),
+			Formatter: stdoutFormatter,
+			Filter:    sink.EntryFilter{MinLevel: minLevel},
+			OnFailure: sink.BestEffort,
+		})
+	}
+	if url := strings.TrimSpace(os.Getenv("LOG_FORWARD_URL")); url != "" {
+		cfg, err := forwardConfigFromEnv(url, logDir)
+		if err != nil {
+			return fmt.Errorf("invalid forward sink configuration: %w", err)
+		}
+		forward, err := sink.NewForwardSink(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to initialise forward sink: %w", err)
+		}
+		// Events are durably buffered before the request is answered.
+		children = append(children, sink.Child{Name: "forward", Sink: forward})
+	}
+	if len(children) > 0 {
+		s = sink.NewMultiSink(append([]sink.Child{{Name: "file", Sink: s, Formatter: formatter}}, children...)...)
 	}
 	defer func() {
-		if err := fileSink.Close(); err != nil {
+		if err := s.Close(); err != nil {
 			log.Printf("error closing file sink: %v", err)
 		}
 	}()
 
+	udpAddr, tcpAddr := strings.TrimSpace(os.Getenv("LOG_SYSLOG_UDP")), strings.TrimSpace(os.Getenv("LOG_SYSLOG_TCP"))
+	if udpAddr != "" || tcpAddr != "" {
+		maxMessage, err := envInt("LOG_SYSLOG_MAX_MESSAGE_BYTES")
+		if err != nil {
+			return fmt.Errorf("invalid LOG_SYSLOG_MAX_MESSAGE_BYTES: %w", err)
+		}
+		syslogServer := syslog.NewServer(ingest.NewPipeline(s, formatter), syslog.Config{
+			UDPAddr:         udpAddr,
+			TCPAddr:         tcpAddr,
+			MaxMessageBytes: maxMessage,
+		})
+		if err := syslogServer.Start(); err != nil {
+			return fmt.Errorf("failed to start syslog listeners: %w", err)
+		}
+		defer syslogServer.Close()
+		log.Printf("syslog listening on udp %q, tcp %q", udpAddr, tcpAddr)
+	}
+
+	gelfUDP, gelfTCP := strings.TrimSpace(os.Getenv("LOG_GELF_UDP")), strings.TrimSpace(os.Getenv("LOG_GELF_TCP"))
+	if gelfUDP != "" || gelfTCP != "" {
+		maxMessage, err := envInt("LOG_GELF_MAX_MESSAGE_BYTES")
+		if err != nil {
+			return fmt.Errorf("invalid LOG_GELF_MAX_MESSAGE_BYTES: %w", err)
+		}
+		gelfServer := gelf.NewServer(ingest.NewPipeline(s, formatter), gelf.Config{
+			UDPAddr:         gelfUDP,
+			TCPAddr:         gelfTCP,
+			MaxMessageBytes: maxMessage,
+		})
+		if err := gelfServer.Start(); err != nil {
+			return fmt.Errorf("failed to start gelf listeners: %w", err)
+		}
+		defer gelfServer.Close()
+		log.Printf("gelf listening on udp %q, tcp %q", gelfUDP, gelfTCP)
+	}
+
+	if fluentAddr := strings.TrimSpace(os.Getenv("LOG_FLUENT_ADDR")); fluentAddr != "" {
+		maxMessage, err := envInt("LOG_FLUENT_MAX_MESSAGE_BYTES")
+		if err != nil {
+			return fmt.Errorf("invalid LOG_FLUENT_MAX_MESSAGE_BYTES: %w", err)
+		}
+		fluentServer := fluent.NewServer(ingest.NewPipeline(s, formatter), fluent.Config{
+			Addr:            fluentAddr,
+			MaxMessageBytes: maxMessage,
+		})
+		if err := fluentServer.Start(); err != nil {
+			return fmt.Errorf("failed to start fluent forward listener: %w", err)
+		}
+		defer fluentServer.Close()
+		log.Printf("fluent forward listening on %q", fluentAddr)
+	}
+
+	if grpcAddr := strings.TrimSpace(os.Getenv("LOG_GRPC_ADDR")); grpcAddr != "" {
+		ln, err := net.Listen("tcp", grpcAddr)
+		if err != nil {
+			return fmt.Errorf("failed to start grpc listener: %w", err)
+		}
+		grpcServer := grpc.NewServer()
+		ingestpb.RegisterLogIngestServer(grpcServer, grpcapi.NewIngestServer(ingest.NewPipeline(s, formatter)))
+		go func() {
+			if err := grpcServer.Serve(ln); err != nil {
+				log.Printf("grpc server error: %v", err)
+			}
+		}()
+		defer grpcServer.GracefulStop()
+		log.Printf("grpc LogIngest listening on %q", grpcAddr)
+	}
+
 	r := chi.NewRouter()
-	handler := httpapi.NewLoggerHandler(fileSink)
+	handler := httpapi.NewLoggerHandlerWithFormat(s, formatter)
 
 	r.Post("/logs", handler.PostLog)
+	r.Post("/logs/batch", handler.PostLogBatch)
+	r.Post("/v1/logs", handler.PostOTLPLogs)
+	r.Post("/loki/api/v1/push", handler.PostLokiPush)
+	r.Get("/", handler.GetElasticInfo)
+	r.Head("/", handler.GetElasticInfo)
+	r.Post("/_bulk", handler.PostElasticBulk)
+	r.Post("/{index}/_bulk", handler.PostElasticBulk)
+	if tokens := strings.TrimSpace(os.Getenv("LOG_HEC_TOKENS")); tokens != "" {
+		hec := httpapi.NewHECHandler(handler.Sink, formatter, strings.Split(tokens, ","))
+		r.Post("/services/collector", hec.PostEvent)
+		r.Post("/services/collector/event", hec.PostEvent)
+		r.Post("/services/collector/raw", hec.PostRaw)
+		r.Post("/services/collector/ack", hec.PostAck)
+		r.Get("/services/collector/health", hec.GetHealth)
+	}
+	r.Get("/logs", httpapi.NewQueryHandler(query.NewReaderWithOptions(logDir, query.ReaderOptions{
+		Formatter: formatter,
+		Paths:     paths,
+	})).GetLogs)
 
+	srv := &http.Server{Addr: addr, Handler: r}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.ListenAndServe() }()
 	log.Printf("logging service listening on %s, writing to %s", addr, logDir)
-	if err := http.ListenAndServe(addr, r); err != nil {
-		log.Fatalf("server error: %v", err)
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("server error: %w", err)
+	case <-ctx.Done():
+	}
+	stop()
+	log.Printf("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("http shutdown: %w", err)
 	}
+	return nil
 }
 
 func normalizeAddr(port string) string {
@@ -51,3 +319,110 @@ func normalizeAddr(port string) string {
 	return ":" + port
 }
 
+// formatterFromEnv selects a line format from the formatVar variable (LOG_FORMAT for
+// the files). The template format reads its layout from templateVar, which is
+// validated here so mistakes fail at startup.
+func formatterFromEnv(formatVar, templateVar string) (format.Formatter, error) {
+	name := strings.ToLower(strings.TrimSpace(os.Getenv(formatVar)))
+	if name != "template" {
+		return format.New(name)
+	}
+	tmpl := os.Getenv(templateVar)
+	if tmpl == "" {
+		return nil, fmt.Errorf("%s=template requires %s", formatVar, templateVar)
+	}
+	return format.NewTemplateFormatter(tmpl)
+}
+
+// asyncConfigFromEnv reads the LOG_ASYNC_* variables. Unset variables keep the sink defaults.
+func asyncConfigFromEnv() (sink.AsyncConfig, error) {
+	var cfg sink.AsyncConfig
+	var err error
+
+	if cfg.QueueSize, err = envInt("LOG_ASYNC_QUEUE_SIZE"); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxBatch, err = envInt("LOG_ASYNC_MAX_BATCH"); err != nil {
+		return cfg, err
+	}
+	if cfg.FlushInterval, err = envDuration("LOG_ASYNC_FLUSH_INTERVAL"); err != nil {
+		return cfg, err
+	}
+	cfg.WaitForSync = envBool("LOG_ASYNC_WAIT_FOR_SYNC")
+
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("LOG_ASYNC_ON_FULL"))) {
+	case "", "block":
+		cfg.OnFull = sink.BlockWhenFull
+	case "reject":
+		cfg.OnFull = sink.RejectWhenFull
+	default:
+		return cfg, fmt.Errorf("LOG_ASYNC_ON_FULL must be block or reject")
+	}
+	return cfg, nil
+}
+
+// forwardConfigFromEnv reads the LOG_FORWARD_* variables. The buffer defaults to
+// <logDir>/.forward.
+func forwardConfigFromEnv(url, logDir string) (sink.ForwardConfig, error) {
+	cfg := sink.ForwardConfig{URL: url, BufferDir: strings.TrimSpace(os.Getenv("LOG_FORWARD_BUFFER_DIR"))}
+	if cfg.BufferDir == "" {
+		cfg.BufferDir = filepath.Join(logDir, ".forward")
+	}
+	var err error
+	if v := strings.TrimSpace(os.Getenv("LOG_FORWARD_MAX_BUFFER")); v != "" {
+		if cfg.MaxBufferBytes, err = sink.ParseBytes(v); err != nil {
+			return cfg, fmt.Errorf("LOG_FORWARD_MAX_BUFFER: %w", err)
+		}
+	}
+	if cfg.MaxBatch, err = envInt("LOG_FORWARD_MAX_BATCH"); err != nil {
+		return cfg, fmt.Errorf("LOG_FORWARD_MAX_BATCH: %w", err)
+	}
+	if cfg.FlushInterval, err = envDuration("LOG_FORWARD_FLUSH_INTERVAL"); err != nil {
+		return cfg, fmt.Errorf("LOG_FORWARD_FLUSH_INTERVAL: %w", err)
+	}
+	return cfg, nil
+}
+
+// diskFullPolicyFromEnv reads LOG_DISK_FULL_POLICY (default reject).
+func diskFullPolicyFromEnv() (sink.DiskFullPolicy, error) {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("LOG_DISK_FULL_POLICY"))) {
+	case "", "reject":
+		return sink.RejectWhenDiskFull, nil
+	case "drop-low":
+		return sink.DropLowWhenDiskFull, nil
+	case "spill":
+		return sink.SpillWhenDiskFull, nil
+	default:
+		return 0, fmt.Errorf("LOG_DISK_FULL_POLICY must be reject, drop-low or spill")
+	}
+}
+
+func envBool(name string) bool {
+	v, _ := strconv.ParseBool(strings.TrimSpace(os.Getenv(name)))
+	return v
+}
+
+func envInt(name string) (int, error) {
+	v := strings.TrimSpace(os.Getenv(name))
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(v)
+}
+
+// envLevel reads a log level; unset means no threshold.
+func envLevel(name string) (model.LogLevel, error) {
+	v := strings.TrimSpace(os.Getenv(name))
+	if v == "" {
+		return "", nil
+	}
+	return model.ParseLogLevel(v)
+}
+
+func envDuration(name string) (time.Duration, error) {
+	v := strings.TrimSpace(os.Getenv(name))
+	if v == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(v)
+}
@@ -0,0 +1,286 @@
+// Package fluent receives logs over the Fluent Forward protocol v1, as sent by the
+// forward outputs of Fluentd and Fluent Bit, and feeds them into the ingest pipeline.
+package fluent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+
+	"logger/internal/ingest"
+	"logger/internal/model"
+)
+
+// Entry is one event of a forward message.
+type Entry struct {
+	Time   time.Time
+	Record map[string]any
+}
+
+// Message is a decoded forward message in any of the four modes: Message,
+// Forward, PackedForward and CompressedPackedForward.
+type Message struct {
+	Tag     string
+	Entries []Entry
+	// Chunk is the chunk option: when set, the sender waits for it to be acknowledged.
+	Chunk string
+}
+
+// eventTime is the EventTime extension (type 0): seconds and nanoseconds as two
+// big-endian uint32s.
+type eventTime struct {
+	time.Time
+}
+
+func init() {
+	msgpack.RegisterExt(0, (*eventTime)(nil))
+}
+
+func (t *eventTime) MarshalMsgpack() ([]byte, error) {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint32(b, uint32(t.Unix()))
+	binary.BigEndian.PutUint32(b[4:], uint32(t.Nanosecond()))
+	return b, nil
+}
+
+func (t *eventTime) UnmarshalMsgpack(b []byte) error {
+	if len(b) != 8 {
+		return fmt.Errorf("invalid EventTime length %d", len(b))
+	}
+	t.Time = time.Unix(int64(binary.BigEndian.Uint32(b)), int64(binary.BigEndian.Uint32(b[4:]))).UTC()
+	return nil
+}
+
+// messageKeys are the record keys read as the message, in order of preference.
+var messageKeys = []string{"message", "log", "msg"}
+
+// levelKeys are the record keys read as the level.
+var levelKeys = []string{"level", "severity", "log_level", "lvl"}
+
+// decodeMessage reads one forward message from dec. Compressed entries are
+// inflated to at most maxBytes.
+func decodeMessage(dec *msgpack.Decoder, maxBytes int) (Message, error) {
+	v, err := dec.DecodeInterfaceLoose()
+	if err != nil {
+		return Message{}, err
+	}
+	arr, ok := v.([]any)
+	if !ok || len(arr) < 2 {
+		return Message{}, errors.New("forward message must be an array of at least two elements")
+	}
+	var m Message
+	if m.Tag, ok = arr[0].(string); !ok {
+		return Message{}, errors.New("forward message tag must be a string")
+	}
+
+	var option any
+	switch entries := arr[1].(type) {
+	case []any: // Forward: [tag, [[time, record], ...], option]
+		for _, e := range entries {
+			pair, ok := e.([]any)
+			if !ok || len(pair) != 2 {
+				return Message{}, errors.New("forward entry must be [time, record]")
+			}
+			entry, err := newEntry(pair[0], pair[1])
+			if err != nil {
+				return Message{}, err
+			}
+			m.Entries = append(m.Entries, entry)
+		}
+		option = optionAt(arr, 2)
+	case string, []byte: // PackedForward: [tag, <entries as msgpack stream>, option]
+		option = optionAt(arr, 2)
+		data, _ := entries.([]byte)
+		if s, ok := entries.(string); ok {
+			data = []byte(s)
+		}
+		opts, _ := option.(map[string]any)
+		if compressed, _ := opts["compressed"].(string); compressed != "" {
+			if compressed != "gzip" {
+				return Message{}, fmt.Errorf("unsupported compression %q", compressed)
+			}
+			if data, err = gunzip(data, maxBytes); err != nil {
+				return Message{}, err
+			}
+		}
+		if m.Entries, err = decodePacked(data); err != nil {
+			return Message{}, err
+		}
+	default: // Message: [tag, time, record, option]
+		if len(arr) < 3 {
+			return Message{}, errors.New("forward message must be [tag, time, record]")
+		}
+		entry, err := newEntry(arr[1], arr[2])
+		if err != nil {
+			return Message{}, err
+		}
+		m.Entries = []Entry{entry}
+		option = optionAt(arr, 3)
+	}
+
+	if opts, ok := option.(map[string]any); ok {
+		m.Chunk, _ = opts["chunk"].(string)
+	}
+	return m, nil
+}
+
+func optionAt(arr []any, i int) any {
+	if i < len(arr) {
+		return arr[i]
+	}
+	return nil
+}
+
+// decodePacked reads the concatenated [time, record] entries of a packed message.
+func decodePacked(data []byte) ([]Entry, error) {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	var entries []Entry
+	for {
+		v, err := dec.DecodeInterfaceLoose()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid packed entries: %w", err)
+		}
+		pair, ok := v.([]any)
+		if !ok || len(pair) != 2 {
+			return nil, errors.New("forward entry must be [time, record]")
+		}
+		entry, err := newEntry(pair[0], pair[1])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// gunzip inflates data, which may hold several gzip members, to at most maxBytes.
+func gunzip(data []byte, maxBytes int) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip entries: %w", err)
+	}
+	defer gz.Close()
+	out, err := io.ReadAll(io.LimitReader(gz, int64(maxBytes)+1))
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip entries: %w", err)
+	}
+	if len(out) > maxBytes {
+		return nil, errTooLarge
+	}
+	return out, nil
+}
+
+// newEntry reads an entry time (EventTime, or seconds as an integer or float) and record.
+func newEntry(t, record any) (Entry, error) {
+	var e Entry
+	switch t := t.(type) {
+	case *eventTime:
+		e.Time = t.Time
+	case eventTime:
+		e.Time = t.Time
+	case int64:
+		e.Time = time.Unix(t, 0).UTC()
+	case uint64:
+		if t > math.MaxInt64 {
+			return Entry{}, errors.New("invalid entry time")
+		}
+		e.Time = time.Unix(int64(t), 0).UTC()
+	case float64:
+		whole, frac := math.Modf(t)
+		e.Time = time.Unix(int64(whole), int64(math.Round(frac*1e6))*1e3).UTC()
+	default:
+		return Entry{}, fmt.Errorf("invalid entry time of type %T", t)
+	}
+	rec, ok := normalize(record).(map[string]any)
+	if !ok {
+		return Entry{}, errors.New("entry record must be a map")
+	}
+	e.Record = rec
+	return e, nil
+}
+
+// normalize turns decoded msgpack values into JSON-friendly ones: binary as
+// strings, maps keyed by strings and EventTimes as RFC 3339 strings.
+func normalize(v any) any {
+	switch v := v.(type) {
+	case []byte:
+		return string(v)
+	case *eventTime:
+		return v.Format(time.RFC3339Nano)
+	case eventTime:
+		return v.Format(time.RFC3339Nano)
+	case []any:
+		for i := range v {
+			v[i] = normalize(v[i])
+		}
+		return v
+	case map[string]any:
+		for k, x := range v {
+			v[k] = normalize(x)
+		}
+		return v
+	case map[any]any:
+		out := make(map[string]any, len(v))
+		for k, x := range v {
+			out[fmt.Sprint(normalize(k))] = normalize(x)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// Payload converts an entry into an event payload. The tag is the app; the first
+// of messageKeys holding a string is the message and the first of levelKeys
+// holding a known level name is the level (info otherwise). The other record keys
+// become fields. A record without a message key is the message itself, as JSON.
+func (e Entry) Payload(tag string) model.EventPayload {
+	fields := make(map[string]any, len(e.Record))
+	for k, v := range e.Record {
+		fields[k] = v
+	}
+
+	p := model.EventPayload{
+		Timestamp: e.Time.Format(time.RFC3339Nano),
+		Level:     string(model.LevelInfo),
+		App:       tag,
+	}
+	for _, k := range levelKeys {
+		if s, ok := fields[k].(string); ok {
+			if level, ok := ingest.ParseLevel(s); ok {
+				p.Level = string(level)
+				delete(fields, k)
+				break
+			}
+		}
+	}
+	found := false
+	for _, k := range messageKeys {
+		if s, ok := fields[k].(string); ok {
+			// Container runtimes keep the newline that ended the line.
+			p.Message = strings.TrimRight(s, "\r\n")
+			delete(fields, k)
+			found = true
+			break
+		}
+	}
+	if !found {
+		data, _ := json.Marshal(e.Record)
+		p.Message = string(data)
+	}
+	if len(fields) > 0 {
+		p.Fields = fields
+	}
+	return p
+}
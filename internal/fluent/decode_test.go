@@ -0,0 +1,104 @@
+package fluent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// encode marshals values as one msgpack stream.
+func encode(t *testing.T, values ...any) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	for _, v := range values {
+		if err := enc.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func decode(t *testing.T, data []byte) Message {
+	t.Helper()
+	m, err := decodeMessage(msgpack.NewDecoder(bytes.NewReader(data)), 1<<20)
+	if err != nil {
+		t.Fatalf("decodeMessage failed: %v", err)
+	}
+	return m
+}
+
+func TestDecodeMessage_Modes(t *testing.T) {
+	ts := time.Date(2026, 2, 9, 12, 0, 0, 123456789, time.UTC)
+	et := &eventTime{ts}
+	record := map[string]any{"log": "hello\n", "stream": "stdout"}
+	packed := encode(t, []any{et, record}, []any{ts.Unix(), map[string]any{"log": "second"}})
+
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(packed)
+	w.Close()
+
+	for name, data := range map[string][]byte{
+		"message":      encode(t, []any{"app", et, record, map[string]any{"chunk": "c1"}}),
+		"forward":      encode(t, []any{"app", []any{[]any{et, record}, []any{ts.Unix(), map[string]any{"log": "second"}}}, map[string]any{"chunk": "c1"}}),
+		"packed":       encode(t, []any{"app", packed, map[string]any{"chunk": "c1", "size": 2}}),
+		"packed str":   encode(t, []any{"app", string(packed), map[string]any{"chunk": "c1"}}),
+		"compressed":   encode(t, []any{"app", gz.Bytes(), map[string]any{"chunk": "c1", "compressed": "gzip"}}),
+		"no chunk opt": encode(t, []any{"app", et, record}),
+	} {
+		m := decode(t, data)
+		if m.Tag != "app" || len(m.Entries) == 0 {
+			t.Fatalf("%s: unexpected message %+v", name, m)
+		}
+		if wantChunk := name != "no chunk opt"; (m.Chunk == "c1") != wantChunk {
+			t.Fatalf("%s: unexpected chunk %q", name, m.Chunk)
+		}
+		if !m.Entries[0].Time.Equal(ts) || m.Entries[0].Record["log"] != "hello\n" {
+			t.Fatalf("%s: unexpected entry %+v", name, m.Entries[0])
+		}
+		if len(m.Entries) > 1 && !m.Entries[1].Time.Equal(ts.Truncate(time.Second)) {
+			t.Fatalf("%s: unexpected integer time %v", name, m.Entries[1].Time)
+		}
+	}
+}
+
+func TestDecodeMessage_Invalid(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"not an array":   encode(t, "app"),
+		"tag not string": encode(t, []any{1, 2, map[string]any{}}),
+		"bad time":       encode(t, []any{"app", "x", map[string]any{}}),
+		"bad record":     encode(t, []any{"app", 1, "not a map"}),
+		"bad entry":      encode(t, []any{"app", []any{[]any{1}}}),
+		"bad gzip":       encode(t, []any{"app", []byte("nope"), map[string]any{"compressed": "gzip"}}),
+		"unknown codec":  encode(t, []any{"app", []byte("nope"), map[string]any{"compressed": "zstd"}}),
+	} {
+		if _, err := decodeMessage(msgpack.NewDecoder(bytes.NewReader(data)), 1<<20); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestEntry_Payload(t *testing.T) {
+	ts := time.Date(2026, 2, 9, 12, 0, 0, 0, time.UTC)
+	p := Entry{Time: ts, Record: map[string]any{
+		"log":        "GET / 200\n",
+		"level":      "WARNING",
+		"stream":     "stdout",
+		"kubernetes": map[string]any{"pod_name": "web-1"},
+	}}.Payload("kube.web")
+	if p.App != "kube.web" || p.Level != "warn" || p.Message != "GET / 200" || p.Timestamp != "2026-02-09T12:00:00Z" {
+		t.Fatalf("unexpected payload %+v", p)
+	}
+	if p.Fields["stream"] != "stdout" || p.Fields["kubernetes"].(map[string]any)["pod_name"] != "web-1" || len(p.Fields) != 2 {
+		t.Fatalf("unexpected fields %v", p.Fields)
+	}
+
+	p = Entry{Time: ts, Record: map[string]any{"cpu": 0.5, "level": "verbose"}}.Payload("metrics")
+	if p.Message != `{"cpu":0.5,"level":"verbose"}` || p.Level != "info" || p.Fields["level"] != "verbose" {
+		t.Fatalf("unexpected payload for a record without message %+v", p)
+	}
+}
@@ -0,0 +1,162 @@
+package fluent
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+
+	"logger/internal/ingest"
+	"logger/internal/sink"
+)
+
+// Config configures a Server. Zero values select the defaults.
+type Config struct {
+	// Addr is the TCP address to listen on, e.g. ":24224".
+	Addr string
+	// MaxMessageBytes bounds a single forward message, and its entries after
+	// decompression (default 16 MiB). A connection sending a longer one is closed.
+	MaxMessageBytes int
+	// IdleTimeout closes connections that send nothing for this long (default 5m).
+	IdleTimeout time.Duration
+}
+
+const (
+	defaultMaxMessageBytes = 16 << 20
+	defaultIdleTimeout     = 5 * time.Minute
+)
+
+// errTooLarge reports a message over MaxMessageBytes.
+var errTooLarge = errors.New("forward message too large")
+
+// Server receives forward messages and writes them through an ingest pipeline.
+//
+// A message carrying the chunk option is acknowledged once its entries are
+// durably written (see sink.WithDurableWrite), which gives senders that require
+// acks at-least-once delivery. Entries that fail validation are logged and
+// dropped, and the chunk is still acknowledged: resending it would not help. When
+// the sink fails, the chunk is not acknowledged and the connection is closed so
+// the sender retries.
+type Server struct {
+	pipeline *ingest.Pipeline
+	cfg      Config
+	ln       *ingest.Listener
+}
+
+// NewServer creates a Server writing to p. Start opens the listener.
+func NewServer(p *ingest.Pipeline, cfg Config) *Server {
+	if cfg.MaxMessageBytes <= 0 {
+		cfg.MaxMessageBytes = defaultMaxMessageBytes
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = defaultIdleTimeout
+	}
+	return &Server{pipeline: p, cfg: cfg, ln: ingest.NewListener("fluent")}
+}
+
+// Start opens the listener and serves it in the background.
+func (s *Server) Start() error {
+	return s.ln.ListenTCP(s.cfg.Addr, s.handleConn)
+}
+
+// Addr returns the address of the listener.
+func (s *Server) Addr() net.Addr {
+	return s.ln.TCPAddr()
+}
+
+// handleConn reads forward messages until the connection ends. Each message is
+// written as one batch, and acknowledged when it asks to be.
+func (s *Server) handleConn(conn net.Conn) {
+	r := &limitedReader{r: bufio.NewReaderSize(conn, 64<<10), max: s.cfg.MaxMessageBytes}
+	dec := msgpack.NewDecoder(r)
+	enc := msgpack.NewEncoder(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(s.cfg.IdleTimeout))
+		r.n = 0
+		m, err := decodeMessage(dec, s.cfg.MaxMessageBytes)
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				log.Printf("fluent: connection from %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		records := make([]sink.EventRecord, 0, len(m.Entries))
+		for _, e := range m.Entries {
+			rec, err := s.pipeline.Record(e.Payload(m.Tag))
+			if err != nil {
+				log.Printf("fluent: dropped entry with tag %q: %v", m.Tag, err)
+				continue
+			}
+			records = append(records, rec)
+		}
+		ctx := context.Background()
+		if m.Chunk != "" {
+			// The sender drops the chunk once it is acknowledged.
+			ctx = sink.WithDurableWrite(ctx)
+		}
+		if err := s.pipeline.Write(ctx, records); err != nil {
+			log.Printf("fluent: failed to write %d entries, closing connection from %s: %v", len(records), conn.RemoteAddr(), err)
+			return
+		}
+
+		if m.Chunk != "" {
+			conn.SetWriteDeadline(time.Now().Add(s.cfg.IdleTimeout))
+			if err := enc.Encode(map[string]string{"ack": m.Chunk}); err != nil {
+				log.Printf("fluent: ack to %s: %v", conn.RemoteAddr(), err)
+				return
+			}
+		}
+	}
+}
+
+// limitedReader fails once more than max bytes have been read since n was last
+// reset, so one message cannot exhaust memory. It implements io.ByteScanner so
+// the decoder reads through it without buffering of its own.
+type limitedReader struct {
+	r   *bufio.Reader
+	n   int
+	max int
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n >= l.max {
+		return 0, errTooLarge
+	}
+	if len(p) > l.max-l.n {
+		p = p[:l.max-l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n += n
+	return n, err
+}
+
+func (l *limitedReader) ReadByte() (byte, error) {
+	if l.n >= l.max {
+		return 0, errTooLarge
+	}
+	b, err := l.r.ReadByte()
+	if err == nil {
+		l.n++
+	}
+	return b, err
+}
+
+func (l *limitedReader) UnreadByte() error {
+	err := l.r.UnreadByte()
+	if err == nil {
+		l.n--
+	}
+	return err
+}
+
+// Close stops the listener, closes open connections and waits for messages being
+// handled to be written.
+func (s *Server) Close() error {
+	return s.ln.Close()
+}
@@ -0,0 +1,120 @@
+package fluent
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+
+	"logger/internal/format"
+	"logger/internal/ingest"
+	"logger/internal/ingest/ingesttest"
+	"logger/internal/sink"
+)
+
+func startServer(t *testing.T, fs *ingesttest.Sink) *Server {
+	t.Helper()
+	s := NewServer(&ingest.Pipeline{Sink: fs, Formatter: format.JSONFormatter{}}, Config{Addr: "127.0.0.1:0", MaxMessageBytes: 4096})
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func dial(t *testing.T, s *Server) (net.Conn, *msgpack.Encoder, *msgpack.Decoder) {
+	t.Helper()
+	conn, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn, msgpack.NewEncoder(conn), msgpack.NewDecoder(conn)
+}
+
+func TestServer_AcksChunks(t *testing.T) {
+	fs := &ingesttest.Sink{}
+	s := startServer(t, fs)
+	_, enc, dec := dial(t, s)
+
+	now := &eventTime{time.Now().UTC()}
+	stale := time.Now().AddDate(0, 0, -5).Unix()
+	enc.Encode([]any{"web", now, map[string]any{"message": "no ack wanted"}})
+	enc.Encode([]any{"web", []any{
+		[]any{now, map[string]any{"log": "one", "level": "error"}},
+		[]any{stale, map[string]any{"log": "stale"}}, // rejected by validation, still acked
+	}, map[string]any{"chunk": "Y2h1bmsx"}})
+
+	var ack map[string]string
+	if err := dec.Decode(&ack); err != nil {
+		t.Fatalf("expected an ack: %v", err)
+	}
+	if ack["ack"] != "Y2h1bmsx" {
+		t.Fatalf("unexpected ack %v", ack)
+	}
+	got := fs.Messages()
+	want := []string{"info:web:no ack wanted", "error:web:one"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestServer_AcksWaitForAsyncWrites(t *testing.T) {
+	dir := t.TempDir()
+	fs, err := sink.NewFileSink(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	as := sink.NewAsyncSink(fs, sink.AsyncConfig{FlushInterval: 50 * time.Millisecond})
+	defer as.Close()
+	s := NewServer(ingest.NewPipeline(as, format.JSONFormatter{}), Config{Addr: "127.0.0.1:0"})
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Close()
+	_, enc, dec := dial(t, s)
+
+	// The sink has no journal, so the chunk may only be acknowledged once the entry is on disk.
+	enc.Encode([]any{"web", &eventTime{time.Now()}, map[string]any{"message": "acked"}, map[string]any{"chunk": "c1"}})
+	var ack map[string]string
+	if err := dec.Decode(&ack); err != nil || ack["ack"] != "c1" {
+		t.Fatalf("expected an ack, got %v, %v", ack, err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, time.Now().UTC().Format("2006-01-02")+".log"))
+	if err != nil || !strings.Contains(string(content), "acked") {
+		t.Fatalf("expected the acknowledged entry on disk, got %q, %v", content, err)
+	}
+}
+
+func TestServer_NoAckWhenSinkFails(t *testing.T) {
+	fs := &ingesttest.Sink{Err: fmt.Errorf("disk on fire")}
+	s := startServer(t, fs)
+	_, enc, dec := dial(t, s)
+
+	enc.Encode([]any{"web", &eventTime{time.Now()}, map[string]any{"message": "x"}, map[string]any{"chunk": "c1"}})
+	var ack map[string]string
+	if err := dec.Decode(&ack); err == nil {
+		t.Fatalf("expected the connection to close without an ack, got %v", ack)
+	}
+}
+
+func TestServer_ClosesOversizedMessages(t *testing.T) {
+	fs := &ingesttest.Sink{}
+	s := startServer(t, fs)
+	_, enc, dec := dial(t, s)
+
+	enc.Encode([]any{"web", &eventTime{time.Now()}, map[string]any{"message": string(make([]byte, 8192))}, map[string]any{"chunk": "c1"}})
+	var ack map[string]string
+	if err := dec.Decode(&ack); err == nil {
+		t.Fatalf("expected the connection to close, got %v", ack)
+	}
+	if len(fs.Messages()) != 0 {
+		t.Fatalf("expected nothing written, got %q", fs.Messages())
+	}
+}
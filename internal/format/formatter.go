@@ -0,0 +1,215 @@
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"logger/internal/model"
+)
+
+// Formatter renders events as single lines and reads those lines back.
+type Formatter interface {
+	// Format renders e as one line, without a trailing newline.
+	Format(e model.Event) (string, error)
+	// Parse reads a line produced by Format back into an Event.
+	Parse(line string) (model.Event, error)
+	// Extension is the file extension, including the dot, for files in this format.
+	Extension() string
+}
+
+// New returns the Formatter registered under name: "text" (the default when name
+// is empty), "json" (JSON Lines) or "logfmt". Template formatters are created
+// with NewTemplateFormatter.
+func New(name string) (Formatter, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "text":
+		return TextFormatter{Version: CurrentVersion}, nil
+	case "json", "jsonl":
+		return JSONFormatter{}, nil
+	case "logfmt":
+		return LogfmtFormatter{}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q: must be text, json or logfmt", name)
+	}
+}
+
+// TextFormatter writes the bracketed human-readable layout of FormatEvent.
+type TextFormatter struct {
+	// Version selects the layout version written; zero means CurrentVersion.
+	Version Version
+}
+
+// Format renders e with FormatEventVersion.
+func (f TextFormatter) Format(e model.Event) (string, error) {
+	v := f.Version
+	if v == 0 {
+		v = CurrentVersion
+	}
+	return FormatEventVersion(e, v)
+}
+
+// Parse reads a line of any text layout version with ParseLine.
+func (TextFormatter) Parse(line string) (model.Event, error) {
+	return ParseLine(line)
+}
+
+// Extension returns ".log".
+func (TextFormatter) Extension() string { return ".log" }
+
+// JSONFormatter writes JSON Lines: one object per event in the same shape as the
+// HTTP payload, with Fields kept as typed JSON values.
+type JSONFormatter struct{}
+
+// Format renders e as a single-line JSON object.
+func (JSONFormatter) Format(e model.Event) (string, error) {
+	payload := model.EventPayload{
+		Timestamp: e.Timestamp.Format(time.RFC3339Nano),
+		Level:     string(e.Level),
+		Message:   e.Message,
+		User:      e.User,
+		App:       e.App,
+		Fields:    e.Fields,
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(payload); err != nil {
+		return "", fmt.Errorf("encode event: %w", err)
+	}
+	// The encoder escapes control characters, so the object is always one line.
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// Parse decodes a JSON line; numbers in Fields are kept as json.Number.
+func (JSONFormatter) Parse(line string) (model.Event, error) {
+	var ev model.Event
+
+	dec := json.NewDecoder(strings.NewReader(line))
+	dec.UseNumber()
+	var payload model.EventPayload
+	if err := dec.Decode(&payload); err != nil {
+		return ev, fmt.Errorf("invalid JSON line: %w", err)
+	}
+
+	ts, err := time.Parse(time.RFC3339Nano, payload.Timestamp)
+	if err != nil {
+		return ev, fmt.Errorf("invalid timestamp: %w", err)
+	}
+	ev = model.Event{
+		Timestamp: ts,
+		Level:     model.LogLevel(strings.ToLower(payload.Level)),
+		Message:   payload.Message,
+		User:      payload.User,
+		App:       payload.App,
+		Fields:    payload.Fields,
+	}
+	if ev.Fields == nil {
+		ev.Fields = make(map[string]any)
+	}
+	return ev, nil
+}
+
+// Extension returns ".jsonl".
+func (JSONFormatter) Extension() string { return ".jsonl" }
+
+// LogfmtFormatter writes logfmt: ts, level, app, user and msg in that order,
+// followed by the fields in sorted key order, quoted as in V2 text lines.
+type LogfmtFormatter struct{}
+
+// Format renders e as logfmt pairs.
+func (LogfmtFormatter) Format(e model.Event) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "ts=%s level=%s", e.Timestamp.Format(time.RFC3339), quoteIfNeeded(string(e.Level)))
+	if e.App != "" {
+		b.WriteString(" app=" + quoteIfNeeded(e.App))
+	}
+	if e.User != "" {
+		b.WriteString(" user=" + quoteIfNeeded(e.User))
+	}
+	b.WriteString(" msg=" + quoteIfNeeded(e.Message))
+	if len(e.Fields) > 0 {
+		b.WriteByte(' ')
+		b.WriteString(formatFieldsV2(e.Fields))
+	}
+	return b.String(), nil
+}
+
+// Parse reads logfmt pairs. The event attributes are recognised by position, so
+// fields named like them (for example a field "app" after msg) stay fields.
+func (LogfmtFormatter) Parse(line string) (model.Event, error) {
+	var ev model.Event
+	ev.Fields = make(map[string]any)
+
+	rest := line
+	next := func() (string, any, error) {
+		if rest == "" {
+			return "", nil, fmt.Errorf("unexpected end of line")
+		}
+		k, v, after, err := cutPair(rest)
+		if err != nil {
+			return "", nil, err
+		}
+		rest = after
+		return k, v, nil
+	}
+
+	k, v, err := next()
+	if err != nil || k != "ts" {
+		return ev, fmt.Errorf("missing ts")
+	}
+	if ev.Timestamp, err = time.Parse(time.RFC3339, attrString(v)); err != nil {
+		return ev, fmt.Errorf("invalid timestamp: %w", err)
+	}
+
+	if k, v, err = next(); err != nil || k != "level" {
+		return ev, fmt.Errorf("missing level")
+	}
+	ev.Level = model.LogLevel(strings.ToLower(attrString(v)))
+
+	for {
+		if k, v, err = next(); err != nil {
+			return ev, fmt.Errorf("missing msg")
+		}
+		switch {
+		case k == "app" && ev.App == "" && ev.User == "":
+			ev.App = attrString(v)
+			continue
+		case k == "user" && ev.User == "":
+			ev.User = attrString(v)
+			continue
+		case k == "msg":
+			ev.Message = attrString(v)
+		default:
+			return ev, fmt.Errorf("missing msg")
+		}
+		break
+	}
+
+	for rest != "" {
+		if k, v, err = next(); err != nil {
+			return ev, err
+		}
+		if _, dup := ev.Fields[k]; dup {
+			return ev, fmt.Errorf("duplicate field %q", k)
+		}
+		ev.Fields[k] = v
+	}
+	return ev, nil
+}
+
+// Extension returns ".logfmt", so switching between text and logfmt never leaves
+// files of one format where the other is read.
+func (LogfmtFormatter) Extension() string { return ".logfmt" }
+
+// attrString returns the text of an attribute that cutPair may have decoded as a
+// JSON literal (for example an app named "123").
+func attrString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return formatValueV2(v)
+}
@@ -0,0 +1,133 @@
+package format
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"logger/internal/model"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name string
+		ext  string
+	}{
+		{"", ".log"},
+		{"text", ".log"},
+		{"JSON", ".jsonl"},
+		{"logfmt", ".logfmt"},
+	}
+	for _, tt := range tests {
+		f, err := New(tt.name)
+		if err != nil {
+			t.Fatalf("New(%q) returned error: %v", tt.name, err)
+		}
+		if f.Extension() != tt.ext {
+			t.Fatalf("New(%q).Extension(): expected %q, got %q", tt.name, tt.ext, f.Extension())
+		}
+	}
+
+	if _, err := New("xml"); err == nil {
+		t.Fatalf("expected error for unknown format")
+	}
+}
+
+func formatterTestEvent() model.Event {
+	return model.Event{
+		Timestamp: time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC),
+		Level:     model.LevelWarn,
+		Message:   `disk "almost" full | 91%`,
+		App:       "billing",
+		User:      "42",
+		Fields: map[string]any{
+			"count": json.Number("3"),
+			"ok":    true,
+			"path":  "/var/log app",
+			"tags":  []any{"a", "b"},
+		},
+	}
+}
+
+func TestFormatters_RoundTrip(t *testing.T) {
+	formatters := map[string]Formatter{
+		"text":   TextFormatter{},
+		"json":   JSONFormatter{},
+		"logfmt": LogfmtFormatter{},
+	}
+
+	for name, f := range formatters {
+		ev := formatterTestEvent()
+		line, err := f.Format(ev)
+		if err != nil {
+			t.Fatalf("%s: Format returned error: %v", name, err)
+		}
+		got, err := f.Parse(line)
+		if err != nil {
+			t.Fatalf("%s: Parse(%q) returned error: %v", name, line, err)
+		}
+		if !got.Timestamp.Equal(ev.Timestamp) || got.Level != ev.Level || got.Message != ev.Message ||
+			got.App != ev.App || got.User != ev.User {
+			t.Fatalf("%s: round trip of %q returned %+v", name, line, got)
+		}
+		if !reflect.DeepEqual(got.Fields, ev.Fields) {
+			t.Fatalf("%s: expected fields %#v, got %#v", name, ev.Fields, got.Fields)
+		}
+	}
+}
+
+func TestJSONFormatter_Format(t *testing.T) {
+	ev := model.Event{
+		Timestamp: time.Date(2026, 3, 1, 12, 30, 0, 500, time.UTC),
+		Level:     model.LevelInfo,
+		Message:   "a <b>\nc",
+		Fields:    map[string]any{"n": 1.5},
+	}
+	line, err := JSONFormatter{}.Format(ev)
+	if err != nil {
+		t.Fatalf("Format returned error: %v", err)
+	}
+
+	expected := `{"timestamp":"2026-03-01T12:30:00.0000005Z","level":"info","message":"a <b>\nc","fields":{"n":1.5}}`
+	if line != expected {
+		t.Fatalf("expected %s, got %s", expected, line)
+	}
+}
+
+func TestLogfmtFormatter_Format(t *testing.T) {
+	line, err := LogfmtFormatter{}.Format(formatterTestEvent())
+	if err != nil {
+		t.Fatalf("Format returned error: %v", err)
+	}
+
+	expected := `ts=2026-03-01T12:30:00Z level=warn app=billing user=42 msg="disk \"almost\" full | 91%" count=3 ok=true path="/var/log app" tags=["a","b"]`
+	if line != expected {
+		t.Fatalf("expected %s, got %s", expected, line)
+	}
+}
+
+func TestLogfmtFormatter_ParseAttributeNamedFields(t *testing.T) {
+	ev, err := LogfmtFormatter{}.Parse(`ts=2026-03-01T12:30:00Z level=info msg=hello app=other user=x`)
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	if ev.App != "" || ev.User != "" {
+		t.Fatalf("expected no app or user, got %q and %q", ev.App, ev.User)
+	}
+	if ev.Fields["app"] != "other" || ev.Fields["user"] != "x" {
+		t.Fatalf("expected app and user fields, got %#v", ev.Fields)
+	}
+
+	for _, line := range []string{
+		``,
+		`level=info ts=2026-03-01T12:30:00Z msg=x`,
+		`ts=2026-03-01T12:30:00Z level=info`,
+		`ts=2026-03-01T12:30:00Z level=info other=1 msg=x`,
+		`ts=2026-03-01T12:30:00Z level=info msg=x a=1 a=2`,
+	} {
+		if _, err := (LogfmtFormatter{}).Parse(line); err == nil {
+			t.Fatalf("expected error for %q", line)
+		}
+	}
+}
@@ -10,6 +10,21 @@ import (
 	"logger/internal/model"
 )
 
+// Version identifies a revision of the text line layout.
+type Version int
+
+const (
+	// V1 writes field keys and values raw. A value such as "a b=c" or a message
+	// containing " | " cannot always be told apart from the surrounding fields.
+	V1 Version = 1
+	// V2 quotes keys and string values that contain spaces, "=", quotes, "|" or
+	// control characters (logfmt style), escapes "|" and a leading "[" in messages,
+	// and writes an empty app segment "[]" for events with a user but no app.
+	V2 Version = 2
+	// CurrentVersion is the version written by FormatEvent.
+	CurrentVersion = V2
+)
+
 // sanitizeString replaces newlines with tabs to keep one-event-per-line.
 func sanitizeString(s string) string {
 	s = strings.ReplaceAll(s, "\n", "\t")
@@ -48,18 +63,32 @@ func levelFormatted(level model.LogLevel) string {
 	return abbr
 }
 
-// FormatEvent renders an Event into a single log line according to the spec.
+// FormatEvent renders an Event into a single log line according to the spec,
+// using CurrentVersion.
 func FormatEvent(e model.Event) (string, error) {
+	return FormatEventVersion(e, CurrentVersion)
+}
+
+// FormatEventVersion renders an Event using the given version of the layout.
+func FormatEventVersion(e model.Event, v Version) (string, error) {
+	if v != V1 && v != V2 {
+		return "", fmt.Errorf("unsupported format version: %d", v)
+	}
+
 	timestamp := e.Timestamp.Format(time.RFC3339)
 	level := levelFormatted(e.Level)
 	message := sanitizeString(e.Message)
+	if v >= V2 {
+		message = escapeMessage(message)
+	}
 
 	var b strings.Builder
 	// [timestamp] [LEVEL] [app] [user] message
 	// Level field is 7 chars total (with padding after bracket for shorter levels)
 	fmt.Fprintf(&b, "[%s] %s", timestamp, level)
 
-	if e.App != "" {
+	// V2 keeps an empty app slot before a user, so a lone segment is always the app.
+	if e.App != "" || v >= V2 && e.User != "" {
 		fmt.Fprintf(&b, " [%s]", sanitizeString(e.App))
 	}
 
@@ -73,14 +102,22 @@ func FormatEvent(e model.Event) (string, error) {
 		return b.String(), nil
 	}
 
-	// Append extra fields in deterministic (sorted) order.
-	keys := make([]string, 0, len(e.Fields))
-	for k := range e.Fields {
-		keys = append(keys, k)
+	b.WriteString(" | ")
+	if v >= V2 {
+		b.WriteString(formatFieldsV2(e.Fields))
+	} else {
+		b.WriteString(formatFields(e.Fields))
 	}
-	sort.Strings(keys)
 
-	b.WriteString(" | ")
+	return b.String(), nil
+}
+
+// formatFields renders fields as space-separated key=value pairs in sorted key order (V1).
+func formatFields(fields map[string]any) string {
+	// Append extra fields in deterministic (sorted) order.
+	keys := sortedKeys(fields)
+
+	var b strings.Builder
 	first := true
 	for _, k := range keys {
 		if !first {
@@ -88,14 +125,25 @@ func FormatEvent(e model.Event) (string, error) {
 		}
 		first = false
 
-		v := e.Fields[k]
+		v := fields[k]
 		valueStr := formatValue(v)
 		valueStr = sanitizeString(valueStr)
 
-		fmt.Fprintf(&b, "%s=%s", k, valueStr)
+		// Keys are sanitised too, so no field can break the one-line guarantee.
+		fmt.Fprintf(&b, "%s=%s", sanitizeString(k), valueStr)
 	}
 
-	return b.String(), nil
+	return b.String()
+}
+
+// sortedKeys returns the keys of fields in sorted order.
+func sortedKeys(fields map[string]any) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 func formatValue(v any) string {
@@ -61,10 +61,17 @@ func TestFormatEvent_WithUser(t *testing.T) {
 		t.Fatalf("FormatEvent returned error: %v", err)
 	}
 
-	expected := "[2026-02-09T12:34:56Z] [INFO]  [alice] Something happened"
+	// An empty app segment keeps the user from being read back as the app.
+	expected := "[2026-02-09T12:34:56Z] [INFO]  [] [alice] Something happened"
 	if line != expected {
 		t.Fatalf("expected %q, got %q", expected, line)
 	}
+
+	line, _ = FormatEventVersion(ev, V1)
+	expected = "[2026-02-09T12:34:56Z] [INFO]  [alice] Something happened"
+	if line != expected {
+		t.Fatalf("V1: expected %q, got %q", expected, line)
+	}
 }
 
 func TestFormatEvent_WithAppAndUser(t *testing.T) {
@@ -104,8 +111,8 @@ func TestFormatEvent_WithFieldsAndNewlines(t *testing.T) {
 		t.Fatalf("FormatEvent returned error: %v", err)
 	}
 
-	// Keys should be sorted: ip then user_id.
-	expected := "[2026-02-09T12:34:56Z] [ERROR] Line1\tLine2 | ip=203.0.113.42 user_id=123"
+	// Keys should be sorted: ip then user_id. The string "123" is quoted so it is not read back as a number.
+	expected := "[2026-02-09T12:34:56Z] [ERROR] Line1\tLine2 | ip=203.0.113.42 user_id=\"123\""
 	if line != expected {
 		t.Fatalf("expected %q, got %q", expected, line)
 	}
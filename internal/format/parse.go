@@ -0,0 +1,414 @@
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"logger/internal/model"
+)
+
+// fieldSeparator separates the message from the key=value fields.
+const fieldSeparator = " | "
+
+// ParseLine parses a line produced by FormatEvent back into an Event.
+// Lines are read as V2 when they are valid V2 and as V1 otherwise, so files
+// written before V2 stay readable. Use ParseLineVersion when the version is known.
+func ParseLine(line string) (model.Event, error) {
+	if ev, err := ParseLineVersion(line, V2); err == nil {
+		return ev, nil
+	}
+	return ParseLineVersion(line, V1)
+}
+
+// ParseLineVersion parses a line written with the given version of the layout.
+//
+// Where a line is ambiguous, ParseLineVersion chooses an interpretation that
+// FormatEventVersion renders back to the same line:
+//   - In V1, a single bracketed segment after the level is taken as the app. Up to
+//     two segments are read (app, then user); further brackets belong to the
+//     message. A segment ends at the first "] " after its first character, and an
+//     empty "[]" is message text.
+//   - In V2, the message never starts with an unescaped "[", so the segments end
+//     where the message can start; see parseBodyV2. Only an app or user that
+//     contains "] " can be read back differently.
+//   - Values are decoded as JSON only when re-encoding reproduces them exactly;
+//     numbers are kept as json.Number. Everything else is a string.
+//
+// In V1 the fields segment starts at the last " | " whose remainder re-renders
+// exactly as key=value pairs (trying at most the last maxFieldSplits); otherwise
+// the whole remainder is the message. A token without "=" continues the previous
+// value. In V2 the message has no unescaped "|", so the first " | " starts the
+// fields, and quoted keys and values are unquoted.
+//
+// Consequently FormatEventVersion(ParseLineVersion(line, v), v) == line for every
+// line FormatEventVersion produces. Sanitised newlines (tabs) in messages cannot be
+// told apart from real tabs. Lines with a lowercase, unpadded level (the
+// pre-2026-02-12 layout) are accepted.
+func ParseLineVersion(line string, v Version) (model.Event, error) {
+	ev, rest, err := parseHeader(line)
+	if err != nil {
+		return ev, err
+	}
+
+	switch v {
+	case V1:
+		ev.App, ev.User, rest = cutSegmentsV1(rest)
+		ev.Message, ev.Fields = splitFields(rest)
+	case V2:
+		err = parseBodyV2(&ev, rest)
+	default:
+		return ev, fmt.Errorf("unsupported format version: %d", v)
+	}
+	return ev, err
+}
+
+// parseHeader parses the timestamp and level segments and returns the remaining
+// segments, message and fields text.
+func parseHeader(line string) (model.Event, string, error) {
+	var ev model.Event
+
+	ts, rest, ok := cutBracket(line)
+	if !ok {
+		return ev, "", fmt.Errorf("missing timestamp segment")
+	}
+	parsed, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		return ev, "", fmt.Errorf("invalid timestamp: %w", err)
+	}
+	ev.Timestamp = parsed
+
+	rest, ok = strings.CutPrefix(rest, " ")
+	if !ok {
+		return ev, "", fmt.Errorf("missing level segment")
+	}
+	level, rest, ok := cutBracket(rest)
+	if !ok {
+		return ev, "", fmt.Errorf("missing level segment")
+	}
+	ev.Level = model.LogLevel(strings.ToLower(level))
+	// Levels shorter than 7 characters (with brackets) carry one padding space.
+	if len(level)+2 < 7 && strings.HasPrefix(rest, "  ") {
+		rest = rest[1:]
+	}
+
+	// Every remaining segment, including the message, is preceded by one space.
+	rest, ok = strings.CutPrefix(rest, " ")
+	if !ok {
+		return ev, "", fmt.Errorf("missing message segment")
+	}
+
+	return ev, rest, nil
+}
+
+// cutSegmentsV1 reads up to two optional bracketed segments of a V1 line: app,
+// then user.
+func cutSegmentsV1(s string) (app, user, rest string) {
+	segments := make([]string, 0, 2)
+	for len(segments) < 2 {
+		seg, after, ok := cutSegment(s)
+		if !ok {
+			break
+		}
+		segments = append(segments, seg)
+		s = after
+	}
+	if len(segments) > 0 {
+		app = segments[0]
+	}
+	if len(segments) > 1 {
+		user = segments[1]
+	}
+	return app, user, s
+}
+
+// cutBracket splits "[x]rest" into x and rest, ending x at the first "]".
+func cutBracket(s string) (inner, rest string, ok bool) {
+	if !strings.HasPrefix(s, "[") {
+		return "", s, false
+	}
+	end := strings.Index(s, "]")
+	if end < 0 {
+		return "", s, false
+	}
+	return s[1:end], s[end+1:], true
+}
+
+// cutSegment splits "[x] rest" into x and rest. x is non-empty, since FormatEvent
+// omits empty app and user segments, and ends at the first "] " after its first
+// character, so an app such as "] " is read back.
+func cutSegment(s string) (inner, rest string, ok bool) {
+	if !strings.HasPrefix(s, "[") || len(s) < 2 {
+		return "", s, false
+	}
+	end := strings.Index(s[2:], "] ")
+	if end < 0 {
+		return "", s, false
+	}
+	end += 2
+	return s[1:end], s[end+2:], true
+}
+
+// maxSegmentSplits bounds how many ends of the app and user segments parseBodyV2
+// tries. Only an app or user containing "] " needs more than one.
+const maxSegmentSplits = 16
+
+// parseBodyV2 reads the segments, message and fields of a V2 line. The message
+// never starts with an unescaped "[", so a leading "[" opens the segments, which
+// end at a "] " (after at least one character) where the rest parses as message
+// and fields. As an app or user may contain "] " itself, candidate ends are tried
+// earliest first.
+func parseBodyV2(ev *model.Event, s string) error {
+	if !strings.HasPrefix(s, "[") {
+		return parseMessageV2(ev, s)
+	}
+	err := fmt.Errorf("unterminated app or user segment")
+	for from, tries := 2, 0; from <= len(s) && tries < maxSegmentSplits; tries++ {
+		i := strings.Index(s[from:], "] ")
+		if i < 0 {
+			break
+		}
+		end := from + i
+		if err = parseMessageV2(ev, s[end+2:]); err == nil {
+			ev.App, ev.User = splitSegmentsV2(s[1:end])
+			return nil
+		}
+		from = end + 1
+	}
+	return err
+}
+
+// splitSegmentsV2 splits the text between the outer brackets of the V2 segments
+// into app and user. FormatEventVersion joins them with "] [", writing an empty
+// app before a user, so the user starts after the first "] [" that leaves it
+// non-empty.
+func splitSegmentsV2(inner string) (app, user string) {
+	if j := strings.Index(inner, "] ["); j >= 0 && j+3 < len(inner) {
+		return inner[:j], inner[j+3:]
+	}
+	return inner, ""
+}
+
+// parseMessageV2 reads a V2 message and its fields. The message has no unescaped
+// "|", so the first " | " starts the fields.
+func parseMessageV2(ev *model.Event, s string) error {
+	msg, fieldsStr, hasFields := strings.Cut(s, fieldSeparator)
+	message, err := unescapeMessage(msg)
+	if err != nil {
+		return err
+	}
+	fields := make(map[string]any)
+	if hasFields {
+		if fields, err = parseFieldsV2(fieldsStr); err != nil {
+			return err
+		}
+	}
+	ev.Message, ev.Fields = message, fields
+	return nil
+}
+
+// maxFieldSplits bounds how many " | " positions splitFields tries, keeping parsing
+// linear for lines with many separators. Past the limit the text stays in the message,
+// which still renders back to the same line.
+const maxFieldSplits = 16
+
+// splitFields separates a V1 message from its key=value fields.
+func splitFields(s string) (string, map[string]any) {
+	end := len(s)
+	for tries := 0; tries < maxFieldSplits; tries++ {
+		i := strings.LastIndex(s[:end], fieldSeparator)
+		if i < 0 {
+			break
+		}
+		if fields, ok := parseFields(s[i+len(fieldSeparator):]); ok {
+			return s[:i], fields
+		}
+		// Allow an earlier separator to overlap this one (" | | ").
+		end = i + len(fieldSeparator) - 1
+	}
+	return s, make(map[string]any)
+}
+
+// parseFields parses a V1 fields segment and reports whether it re-renders exactly:
+// keys must be strictly ascending (FormatEvent sorts them) and every pair must
+// render back to its own text.
+func parseFields(s string) (map[string]any, bool) {
+	fields := make(map[string]any)
+
+	// key and the bounds of its value in s; the value grows by whole tokens.
+	var key string
+	valStart, valEnd := -1, -1
+	finish := func() bool {
+		value := s[valStart:valEnd]
+		v := parseValue(value)
+		if sanitizeString(key) != key || sanitizeString(formatValue(v)) != value {
+			return false
+		}
+		fields[key] = v
+		return true
+	}
+
+	for pos := 0; pos <= len(s); {
+		end := strings.IndexByte(s[pos:], ' ')
+		if end < 0 {
+			end = len(s)
+		} else {
+			end += pos
+		}
+		tok := s[pos:end]
+
+		k, _, isPair := strings.Cut(tok, "=")
+		switch {
+		case !isPair && valStart < 0:
+			return nil, false
+		case !isPair:
+			valEnd = end
+		default:
+			if valStart >= 0 && (k <= key || !finish()) {
+				return nil, false
+			}
+			key = k
+			valStart, valEnd = pos+len(k)+1, end
+		}
+		pos = end + 1
+	}
+	if valStart < 0 || !finish() {
+		return nil, false
+	}
+	return fields, true
+}
+
+// parseValue reverses formatValue: JSON values are decoded when re-encoding them
+// reproduces s, everything else is a string.
+func parseValue(s string) any {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return s
+	}
+	if _, isString := v.(string); isString {
+		// A quoted value was written as a raw string, quotes included.
+		return s
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(true)
+	if err := enc.Encode(v); err != nil || strings.TrimSuffix(buf.String(), "\n") != s {
+		return s
+	}
+	return v
+}
+
+// parseFieldsV2 parses a V2 fields segment. Keys and string values may be quoted;
+// objects and arrays are compact JSON; any other value runs to the next space.
+func parseFieldsV2(s string) (map[string]any, error) {
+	if s == "" {
+		return nil, fmt.Errorf("empty fields segment")
+	}
+
+	fields := make(map[string]any)
+	for s != "" {
+		key, value, rest, err := cutPair(s)
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := fields[key]; dup {
+			return nil, fmt.Errorf("duplicate field %q", key)
+		}
+		fields[key] = value
+		s = rest
+	}
+	return fields, nil
+}
+
+// cutPair reads one V2 key=value pair from the start of s and returns the text
+// after it, without the separating space.
+func cutPair(s string) (key string, value any, rest string, err error) {
+	key, rest, err = cutFieldToken(s, "=", needsQuoting)
+	if err != nil {
+		return "", nil, s, fmt.Errorf("invalid field key: %w", err)
+	}
+	rest, ok := strings.CutPrefix(rest, "=")
+	if !ok {
+		return "", nil, s, fmt.Errorf("missing %q after field key %q", "=", key)
+	}
+
+	if strings.HasPrefix(rest, "{") || strings.HasPrefix(rest, "[") {
+		value, rest, err = cutJSONValue(rest)
+	} else {
+		quoted := strings.HasPrefix(rest, `"`)
+		var str string
+		str, rest, err = cutFieldToken(rest, " ", needsValueQuoting)
+		value = str
+		if !quoted {
+			value = parseValue(str)
+		}
+	}
+	if err != nil {
+		return "", nil, s, fmt.Errorf("invalid value for field %q: %w", key, err)
+	}
+
+	if rest == "" {
+		return key, value, "", nil
+	}
+	if rest, ok = strings.CutPrefix(rest, " "); !ok || rest == "" {
+		return "", nil, s, fmt.Errorf("malformed fields after %q", key)
+	}
+	return key, value, rest, nil
+}
+
+// cutFieldToken reads a quoted string, or the raw text up to stop, from the start
+// of s. Only the canonical form written by quoteIfNeeded or quoteValueIfNeeded is
+// accepted, which keeps V1 lines from being mistaken for V2: a quoted string must
+// be one that mustQuote (needsQuoting or needsValueQuoting) says needs quoting.
+func cutFieldToken(s, stop string, mustQuote func(string) bool) (string, string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		i := strings.Index(s, stop)
+		if i < 0 {
+			i = len(s)
+		}
+		if needsQuoting(s[:i]) {
+			return "", s, fmt.Errorf("token %q must be quoted", s[:i])
+		}
+		return s[:i], s[i:], nil
+	}
+	quoted, err := strconv.QuotedPrefix(s)
+	if err != nil {
+		return "", s, err
+	}
+	unquoted, err := strconv.Unquote(quoted)
+	if err != nil {
+		return "", s, err
+	}
+	if !mustQuote(unquoted) || strconv.Quote(unquoted) != quoted {
+		return "", s, fmt.Errorf("token %s is not canonically quoted", quoted)
+	}
+	return unquoted, s[len(quoted):], nil
+}
+
+// cutJSONValue decodes the JSON object or array at the start of s. The value is
+// kept raw when decoding and re-encoding would not reproduce it exactly.
+func cutJSONValue(s string) (any, string, error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		return nil, s, err
+	}
+	n := int(dec.InputOffset())
+	text, rest := s[:n], s[n:]
+	if strings.TrimSpace(text) != text {
+		return nil, s, fmt.Errorf("unexpected whitespace around JSON value")
+	}
+	v := parseValue(text)
+	if _, kept := v.(string); kept {
+		return raw, rest, nil
+	}
+	return v, rest, nil
+}
@@ -0,0 +1,325 @@
+package format
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"logger/internal/model"
+)
+
+func TestParseLine_AllSegments(t *testing.T) {
+	line := "[2026-02-09T12:34:56Z] [WARN]  [myservice] [alice] Disk almost full | disk=sda pct=91"
+
+	ev, err := ParseLine(line)
+	if err != nil {
+		t.Fatalf("ParseLine returned error: %v", err)
+	}
+
+	if !ev.Timestamp.Equal(time.Date(2026, 2, 9, 12, 34, 56, 0, time.UTC)) {
+		t.Fatalf("unexpected timestamp: %v", ev.Timestamp)
+	}
+	if ev.Level != model.LevelWarn || ev.App != "myservice" || ev.User != "alice" {
+		t.Fatalf("unexpected segments: %+v", ev)
+	}
+	if ev.Message != "Disk almost full" {
+		t.Fatalf("unexpected message: %q", ev.Message)
+	}
+	if ev.Fields["disk"] != "sda" || ev.Fields["pct"] != json.Number("91") {
+		t.Fatalf("unexpected fields: %#v", ev.Fields)
+	}
+}
+
+func TestParseLine_MinimalLine(t *testing.T) {
+	ev, err := ParseLine("[2026-02-09T12:34:56Z] [DEBUG] plain message")
+	if err != nil {
+		t.Fatalf("ParseLine returned error: %v", err)
+	}
+	if ev.Level != model.LevelDebug || ev.App != "" || ev.User != "" || ev.Message != "plain message" {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+	if ev.Fields == nil || len(ev.Fields) != 0 {
+		t.Fatalf("expected empty fields, got %#v", ev.Fields)
+	}
+}
+
+func TestParseLine_Segments(t *testing.T) {
+	tests := []struct {
+		line    string
+		app     string
+		user    string
+		message string
+	}{
+		// A single bracket is the app, never the user.
+		{"[2026-02-09T12:34:56Z] [INFO]  [alice] hi", "alice", "", "hi"},
+		// A V2 message escapes its leading bracket.
+		{"[2026-02-09T12:34:56Z] [INFO]  [a] [u] \\[tag] hi", "a", "u", "[tag] hi"},
+		// Empty brackets are message text.
+		{"[2026-02-09T12:34:56Z] [INFO]  [] hi", "", "", "[] hi"},
+		// A segment ends at the first "] ".
+		{"[2026-02-09T12:34:56Z] [INFO]  [a]b] hi", "a]b", "", "hi"},
+		// Leading spaces in the message survive the level padding.
+		{"[2026-02-09T12:34:56Z] [ERROR]   indented", "", "", "  indented"},
+		// Legacy lowercase, unpadded level.
+		{"[2026-02-09T12:34:56Z] [info] legacy", "", "", "legacy"},
+	}
+
+	for _, tt := range tests {
+		ev, err := ParseLine(tt.line)
+		if err != nil {
+			t.Fatalf("%q: ParseLine returned error: %v", tt.line, err)
+		}
+		if ev.App != tt.app || ev.User != tt.user || ev.Message != tt.message {
+			t.Fatalf("%q: expected app=%q user=%q message=%q, got %+v", tt.line, tt.app, tt.user, tt.message, ev)
+		}
+	}
+}
+
+func TestParseLineVersion_V1Segments(t *testing.T) {
+	// In V1, brackets beyond app and user belong to the message.
+	ev, err := ParseLineVersion("[2026-02-09T12:34:56Z] [INFO]  [a] [u] [tag] hi", V1)
+	if err != nil {
+		t.Fatalf("ParseLineVersion returned error: %v", err)
+	}
+	if ev.App != "a" || ev.User != "u" || ev.Message != "[tag] hi" {
+		t.Fatalf("unexpected V1 segments: %+v", ev)
+	}
+}
+
+func TestParseLine_InvertsFormatEventSegments(t *testing.T) {
+	for _, ev := range []model.Event{
+		{User: "alice", Message: "user only"},
+		{App: "svc", Message: "[x] hi"},
+		{User: "alice", Message: "[x] [y] hi"},
+		{App: "svc", User: "alice", Message: "[] hi"},
+		{Message: "[svc] not an app"},
+	} {
+		ev.Timestamp = time.Date(2026, 2, 9, 12, 34, 56, 0, time.UTC)
+		ev.Level = model.LevelInfo
+		line, err := FormatEvent(ev)
+		if err != nil {
+			t.Fatalf("FormatEvent returned error: %v", err)
+		}
+		parsed, err := ParseLine(line)
+		if err != nil {
+			t.Fatalf("ParseLine(%q) returned error: %v", line, err)
+		}
+		if parsed.App != ev.App || parsed.User != ev.User || parsed.Message != ev.Message {
+			t.Fatalf("%q: expected app=%q user=%q message=%q, got %+v", line, ev.App, ev.User, ev.Message, parsed)
+		}
+	}
+
+	line, _ := FormatEvent(model.Event{Timestamp: time.Date(2026, 2, 9, 12, 34, 56, 0, time.UTC), Level: model.LevelInfo, User: "alice", Message: "hi"})
+	if want := "[2026-02-09T12:34:56Z] [INFO]  [] [alice] hi"; line != want {
+		t.Fatalf("expected %q, got %q", want, line)
+	}
+}
+
+func TestParseLine_EmptyMessageBeforeFields(t *testing.T) {
+	for _, ev := range []model.Event{
+		{App: "svc", User: "alice", Fields: map[string]any{"k": "v"}},
+		{App: "0", Message: "[0]", Fields: map[string]any{"0": "0"}},
+		{Fields: map[string]any{"k": "v"}},
+	} {
+		ev.Timestamp = time.Date(2026, 2, 9, 12, 34, 56, 0, time.UTC)
+		ev.Level = model.LevelDebug
+		line, _ := FormatEvent(ev)
+		parsed, err := ParseLineVersion(line, V2)
+		if err != nil {
+			t.Fatalf("ParseLineVersion(%q) returned error: %v", line, err)
+		}
+		if parsed.App != ev.App || parsed.Message != ev.Message || parsed.Fields["k"] != ev.Fields["k"] {
+			t.Fatalf("%q: unexpected event %+v", line, parsed)
+		}
+	}
+}
+
+func TestParseLine_FieldValues(t *testing.T) {
+	line := `[2026-02-09T12:34:56Z] [INFO]  msg | a=hello world b={"x":1,"y":[true,null]} c=1.50 d="quoted" e=false`
+
+	ev, err := ParseLine(line)
+	if err != nil {
+		t.Fatalf("ParseLine returned error: %v", err)
+	}
+
+	if ev.Fields["a"] != "hello world" {
+		t.Fatalf("expected value with space, got %#v", ev.Fields["a"])
+	}
+	obj, ok := ev.Fields["b"].(map[string]any)
+	if !ok || obj["x"] != json.Number("1") {
+		t.Fatalf("expected decoded JSON object, got %#v", ev.Fields["b"])
+	}
+	if ev.Fields["c"] != json.Number("1.50") {
+		t.Fatalf("expected number to keep its representation, got %#v", ev.Fields["c"])
+	}
+	if ev.Fields["d"] != `"quoted"` {
+		t.Fatalf("expected raw quoted string, got %#v", ev.Fields["d"])
+	}
+	if ev.Fields["e"] != false {
+		t.Fatalf("expected boolean, got %#v", ev.Fields["e"])
+	}
+}
+
+func TestParseLine_MessageWithSeparator(t *testing.T) {
+	// The remainder after the last " | " is not valid fields, so it stays in the message.
+	ev, err := ParseLine("[2026-02-09T12:34:56Z] [INFO]  a | b | k=v")
+	if err != nil {
+		t.Fatalf("ParseLine returned error: %v", err)
+	}
+	if ev.Message != "a | b" || ev.Fields["k"] != "v" {
+		t.Fatalf("unexpected split: %+v", ev)
+	}
+
+	ev, err = ParseLine("[2026-02-09T12:34:56Z] [INFO]  just | a pipe")
+	if err != nil {
+		t.Fatalf("ParseLine returned error: %v", err)
+	}
+	if ev.Message != "just | a pipe" || len(ev.Fields) != 0 {
+		t.Fatalf("unexpected split: %+v", ev)
+	}
+}
+
+func TestParseLine_Invalid(t *testing.T) {
+	for _, line := range []string{
+		"",
+		"plain text",
+		"[not a time] [INFO]  message",
+		"[2026-02-09T12:34:56Z] message without level",
+		"[2026-02-09T12:34:56Z] [INFO]",
+	} {
+		if _, err := ParseLine(line); err == nil {
+			t.Fatalf("expected error for %q", line)
+		}
+	}
+}
+
+func TestParseLineVersion_V2QuotedFields(t *testing.T) {
+	ev := model.Event{
+		Timestamp: time.Date(2026, 2, 9, 12, 34, 56, 0, time.UTC),
+		Level:     model.LevelInfo,
+		Message:   "piped | message",
+		Fields: map[string]any{
+			"k":          "a b=c",
+			"empty":      "",
+			"multi":      "line1\nline2",
+			"obj":        map[string]any{"note": "x | y z"},
+			"pipe":       "|",
+			"spaced key": 1,
+		},
+	}
+
+	line, err := FormatEvent(ev)
+	if err != nil {
+		t.Fatalf("FormatEvent returned error: %v", err)
+	}
+
+	parsed, err := ParseLine(line)
+	if err != nil {
+		t.Fatalf("ParseLine(%q) returned error: %v", line, err)
+	}
+	if parsed.Message != ev.Message {
+		t.Fatalf("expected message %q, got %q", ev.Message, parsed.Message)
+	}
+	for _, k := range []string{"k", "empty", "multi", "pipe"} {
+		if parsed.Fields[k] != ev.Fields[k] {
+			t.Fatalf("field %q: expected %q, got %#v (line %q)", k, ev.Fields[k], parsed.Fields[k], line)
+		}
+	}
+	if parsed.Fields["spaced key"] != json.Number("1") {
+		t.Fatalf("expected quoted key to parse, got %#v", parsed.Fields)
+	}
+	obj, ok := parsed.Fields["obj"].(map[string]any)
+	if !ok || obj["note"] != "x | y z" {
+		t.Fatalf("expected JSON object with separator inside, got %#v", parsed.Fields["obj"])
+	}
+}
+
+func TestParseLine_ReadsV1Lines(t *testing.T) {
+	// Written before V2: raw value with a space and a raw quoted string.
+	line := `[2026-02-09T12:34:56Z] [INFO]  msg | a=hello world d="quoted"`
+
+	if _, err := ParseLineVersion(line, V2); err == nil {
+		t.Fatalf("expected V1 line to be rejected as V2")
+	}
+	ev, err := ParseLine(line)
+	if err != nil {
+		t.Fatalf("ParseLine returned error: %v", err)
+	}
+	if ev.Fields["a"] != "hello world" || ev.Fields["d"] != `"quoted"` {
+		t.Fatalf("unexpected V1 fields: %#v", ev.Fields)
+	}
+}
+
+func FuzzParseLine_RoundTrip(f *testing.F) {
+	f.Add(int64(1770640496), uint8(1), "User logged in", "", "", "", "")
+	f.Add(int64(1770640496), uint8(3), "Line1\nLine2", "svc", "alice", "ip", "203.0.113.42")
+	f.Add(int64(1770640496), uint8(0), "[tag] a | b", "", "[x]", "k", "v | w=x")
+	f.Add(int64(0), uint8(2), `C:\dir\| \\|`, "a] [b", "", "a b", `{"n":1}`)
+	f.Add(int64(1770640496), uint8(1), "literals", "", "", "s", "true")
+	f.Add(int64(1770640496), uint8(1), "literals", "", "", "n", "null")
+	f.Add(int64(1770640496), uint8(1), "literals", "", "", "x", "42")
+	f.Add(int64(1770640496), uint8(1), "literals", "", "", "f", "-1.5e3")
+
+	levels := []model.LogLevel{model.LevelDebug, model.LevelInfo, model.LevelWarn, model.LevelError}
+
+	f.Fuzz(func(t *testing.T, sec int64, level uint8, message, app, user, key, value string) {
+		// Stay within years RFC3339 can represent.
+		if sec < 0 || sec > 253402300799 {
+			t.Skip()
+		}
+		ev := model.Event{
+			Timestamp: time.Unix(sec, 0).UTC(),
+			Level:     levels[int(level)%len(levels)],
+			Message:   message,
+			App:       app,
+			User:      user,
+			Fields:    map[string]any{},
+		}
+		if key != "" || value != "" {
+			ev.Fields[key] = value
+		}
+
+		for _, v := range []Version{V1, V2} {
+			line, err := FormatEventVersion(ev, v)
+			if err != nil {
+				t.Fatalf("FormatEventVersion returned error: %v", err)
+			}
+			parsed, err := ParseLineVersion(line, v)
+			if err != nil {
+				t.Fatalf("V%d: ParseLineVersion(%q) returned error: %v", v, line, err)
+			}
+			again, err := FormatEventVersion(parsed, v)
+			if err != nil {
+				t.Fatalf("FormatEventVersion returned error: %v", err)
+			}
+			if again != line {
+				t.Fatalf("V%d round trip mismatch:\n  line:  %q\n  again: %q\n  event: %+v", v, line, again, parsed)
+			}
+			if !parsed.Timestamp.Equal(ev.Timestamp) || parsed.Level != ev.Level {
+				t.Fatalf("timestamp or level changed: %+v", parsed)
+			}
+		}
+
+		// V2 is unambiguous for the message and for string values.
+		line, _ := FormatEvent(ev)
+		parsed, err := ParseLine(line)
+		if err != nil {
+			t.Fatalf("ParseLine(%q) returned error: %v", line, err)
+		}
+		// Only an app or user containing "] " can be split differently.
+		if !strings.Contains(app+user, "] ") {
+			if parsed.Message != sanitizeString(message) {
+				t.Fatalf("message changed: %q -> %q (line %q)", message, parsed.Message, line)
+			}
+			if parsed.App != sanitizeString(app) || parsed.User != sanitizeString(user) {
+				t.Fatalf("app or user changed: %q, %q -> %q, %q (line %q)", app, user, parsed.App, parsed.User, line)
+			}
+		}
+		if len(ev.Fields) > 0 {
+			if got, isString := parsed.Fields[key].(string); !isString || got != value {
+				t.Fatalf("value changed: %q -> %#v (line %q)", value, parsed.Fields[key], line)
+			}
+		}
+	})
+}
@@ -0,0 +1,157 @@
+package format
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// escapeMessage escapes every "|" in a V2 message as "\|", doubling any backslashes
+// directly before it, so the message can never contain the " | " field separator.
+// A "[" starting the message is escaped the same way, so it cannot be read as an
+// app or user segment.
+func escapeMessage(s string) string {
+	if !strings.Contains(s, "|") && !startsWithBracket(s) {
+		return s
+	}
+	var b strings.Builder
+	run := 0 // backslashes seen directly before the current position
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\':
+			run++
+			b.WriteByte(c)
+			continue
+		case c == '|', c == '[' && i == run:
+			b.WriteString(strings.Repeat(`\`, run+1))
+		}
+		run = 0
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// startsWithBracket reports whether s is a "[" after any number of backslashes.
+func startsWithBracket(s string) bool {
+	return strings.HasPrefix(strings.TrimLeft(s, `\`), "[")
+}
+
+// unescapeMessage reverses escapeMessage. It fails if s holds an unescaped "|" or
+// starts with an unescaped "[", which means s was not written as a V2 message.
+func unescapeMessage(s string) (string, error) {
+	if !strings.Contains(s, "|") && !startsWithBracket(s) {
+		return s, nil
+	}
+	var b strings.Builder
+	run := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' {
+			run++
+			continue
+		}
+		if c == '|' || c == '[' && i == run {
+			if run%2 == 0 {
+				return "", fmt.Errorf("unescaped %q in message", string(c))
+			}
+			run /= 2
+		}
+		b.WriteString(strings.Repeat(`\`, run))
+		run = 0
+		b.WriteByte(c)
+	}
+	b.WriteString(strings.Repeat(`\`, run))
+	return b.String(), nil
+}
+
+// needsQuoting reports whether a V2 key or string value must be quoted to be
+// read back unambiguously.
+func needsQuoting(s string) bool {
+	if s == "" || s[0] == '{' || s[0] == '[' || !utf8.ValidString(s) {
+		return true
+	}
+	for _, r := range s {
+		if r == ' ' || r == '=' || r == '"' || r == '|' || !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// needsValueQuoting reports whether a V2 string value must be quoted: besides the
+// cases of needsQuoting, when it would read back as a JSON literal or number, so
+// that the string "true" is not written like the bool true.
+func needsValueQuoting(s string) bool {
+	if needsQuoting(s) {
+		return true
+	}
+	_, isString := parseValue(s).(string)
+	return !isString
+}
+
+// quoteValueIfNeeded quotes s with Go string escapes when needsValueQuoting says so.
+func quoteValueIfNeeded(s string) string {
+	if needsValueQuoting(s) {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// quoteIfNeeded quotes s with Go string escapes when needsQuoting says so.
+// Escapes keep control characters on one line without losing them.
+func quoteIfNeeded(s string) string {
+	if needsQuoting(s) {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// formatFieldsV2 renders fields as space-separated key=value pairs in sorted key
+// order. Keys and string values are quoted when needed; other values are written
+// as compact JSON, which never contains raw spaces outside of its strings.
+func formatFieldsV2(fields map[string]any) string {
+	var b strings.Builder
+	for i, k := range sortedKeys(fields) {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(quoteIfNeeded(k))
+		b.WriteByte('=')
+		b.WriteString(formatValueV2(fields[k]))
+	}
+	return b.String()
+}
+
+// formatValueV2 renders a single V2 field value.
+func formatValueV2(v any) string {
+	switch val := v.(type) {
+	case string:
+		return quoteValueIfNeeded(val)
+	case json.Number:
+		return val.String()
+	case fmt.Stringer:
+		return quoteValueIfNeeded(val.String())
+	default:
+		if data, err := json.Marshal(v); err == nil {
+			return string(data)
+		}
+		return quoteValueIfNeeded(fmt.Sprintf("%v", v))
+	}
+}
+
+// FieldString renders a field value as it is compared in filters: strings as they
+// are, any other value in its JSON encoding.
+func FieldString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
@@ -0,0 +1,123 @@
+package format
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"logger/internal/model"
+)
+
+func TestEscapeMessage_RoundTrip(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"no pipes here", "no pipes here"},
+		{"a | b", `a \| b`},
+		{`C:\dir\file`, `C:\dir\file`},
+		{`back\|slash`, `back\\\|slash`},
+		{`trailing\`, `trailing\`},
+		{"[tag] msg", `\[tag] msg`},
+		{`\[tag]`, `\\\[tag]`},
+		{"not [at] start", "not [at] start"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		escaped := escapeMessage(tt.in)
+		if escaped != tt.out {
+			t.Fatalf("escapeMessage(%q): expected %q, got %q", tt.in, tt.out, escaped)
+		}
+		back, err := unescapeMessage(escaped)
+		if err != nil {
+			t.Fatalf("unescapeMessage(%q) returned error: %v", escaped, err)
+		}
+		if back != tt.in {
+			t.Fatalf("round trip of %q returned %q", tt.in, back)
+		}
+	}
+
+	if _, err := unescapeMessage("raw | pipe"); err == nil {
+		t.Fatalf("expected error for unescaped pipe")
+	}
+	if _, err := unescapeMessage("[raw] bracket"); err == nil {
+		t.Fatalf("expected error for unescaped leading bracket")
+	}
+}
+
+func TestQuoteIfNeeded(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"plain", "plain"},
+		{"203.0.113.42", "203.0.113.42"},
+		{"", `""`},
+		{"a b", `"a b"`},
+		{"a=b", `"a=b"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{"x|y", `"x|y"`},
+		{"tab\there", `"tab\there"`},
+		{"line1\nline2", `"line1\nline2"`},
+		{"{not json", `"{not json"`},
+	}
+
+	for _, tt := range tests {
+		if got := quoteIfNeeded(tt.in); got != tt.out {
+			t.Fatalf("quoteIfNeeded(%q): expected %q, got %q", tt.in, tt.out, got)
+		}
+	}
+}
+
+func TestFieldString(t *testing.T) {
+	tests := []struct {
+		in  any
+		out string
+	}{
+		{"42", "42"},
+		{"a b", "a b"},
+		{json.Number("12345678901234567890"), "12345678901234567890"},
+		{float64(1.5), "1.5"},
+		{true, "true"},
+		{nil, "null"},
+		{map[string]any{"k": "v"}, `{"k":"v"}`},
+	}
+	for _, tt := range tests {
+		if got := FieldString(tt.in); got != tt.out {
+			t.Fatalf("FieldString(%#v): expected %q, got %q", tt.in, tt.out, got)
+		}
+	}
+}
+
+func TestFormatEvent_V2QuotesAmbiguousValues(t *testing.T) {
+	ev := model.Event{
+		Timestamp: time.Date(2026, 2, 9, 12, 34, 56, 0, time.UTC),
+		Level:     model.LevelInfo,
+		Message:   "a | b",
+		Fields: map[string]any{
+			"k":    "a b=c",
+			"n":    42,
+			"obj":  map[string]any{"x": "y z"},
+			"text": "line1\nline2",
+		},
+	}
+
+	line, err := FormatEvent(ev)
+	if err != nil {
+		t.Fatalf("FormatEvent returned error: %v", err)
+	}
+	expected := `[2026-02-09T12:34:56Z] [INFO]  a \| b | k="a b=c" n=42 obj={"x":"y z"} text="line1\nline2"`
+	if line != expected {
+		t.Fatalf("expected %q, got %q", expected, line)
+	}
+
+	v1, err := FormatEventVersion(ev, V1)
+	if err != nil {
+		t.Fatalf("FormatEventVersion returned error: %v", err)
+	}
+	expectedV1 := "[2026-02-09T12:34:56Z] [INFO]  a | b | k=a b=c n=42 obj={\"x\":\"y z\"} text=line1\tline2"
+	if v1 != expectedV1 {
+		t.Fatalf("expected %q, got %q", expectedV1, v1)
+	}
+}
@@ -0,0 +1,498 @@
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"logger/internal/model"
+)
+
+// TemplateFormatter renders events with an operator-defined layout.
+//
+// A template is literal text with placeholders:
+//
+//	{timestamp}              RFC3339 in UTC
+//	{timestamp:LAYOUT}       Go time layout, or rfc3339, rfc3339nano or datetime
+//	{timestamp:LAYOUT@ZONE}  the same in an IANA time zone, e.g. @Europe/Berlin
+//	{level}                  uppercase (INFO); {level:padded} pads to 5 characters,
+//	                         {level:lower} is lowercase and {level:letter} is one letter
+//	{app} {user} {message}
+//	{field:NAME}             a promoted field, left out of {fields}
+//	{fields}                 the remaining fields as quoted key=value pairs (V2 rules);
+//	                         {fields:json} writes them as a JSON object
+//
+// A group {?...} is written only when every placeholder inside it is non-empty,
+// e.g. "{?[{app}] }". "{{" and "}}" write literal braces. Newlines in columns are
+// replaced with tabs, as in the text layout.
+//
+// Templates must contain {timestamp} and {message}, and each placeholder at most once.
+// Timestamp layouts must include the full date, so lines parse back to their day.
+type TemplateFormatter struct {
+	template string
+	nodes    []templateNode
+	promoted map[string]bool
+
+	// Parse matches lines against re; captures lists the placeholders in group order.
+	re       *regexp.Regexp
+	captures []templateNode
+}
+
+type templateKind int
+
+const (
+	tmplLiteral templateKind = iota
+	tmplTimestamp
+	tmplLevel
+	tmplApp
+	tmplUser
+	tmplMessage
+	tmplField
+	tmplFields
+	tmplGroup
+)
+
+// templateNode is literal text, a placeholder or an optional group.
+type templateNode struct {
+	kind     templateKind
+	text     string // literal text, or the name of a promoted field
+	style    string // level or fields style
+	layout   string
+	loc      *time.Location
+	children []templateNode // group contents
+}
+
+// logfmtPairPattern matches one key=value pair written by formatFieldsV2.
+const logfmtPairPattern = `(?:"(?:[^"\\]|\\.)*"|[^\s"=])+=(?:"(?:[^"\\]|\\.)*"|[^\s"])+`
+
+// timestampLayouts are the named layouts accepted by {timestamp:NAME}.
+var timestampLayouts = map[string]string{
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+	"datetime":    time.DateTime,
+}
+
+// NewTemplateFormatter parses and validates a template.
+func NewTemplateFormatter(template string) (*TemplateFormatter, error) {
+	nodes, rest, err := parseTemplate(template, false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("invalid template: unmatched %q", "}")
+	}
+
+	f := &TemplateFormatter{template: template, nodes: nodes, promoted: make(map[string]bool)}
+	seen := make(map[string]bool)
+	var pattern strings.Builder
+	if err := f.compile(nodes, seen, &pattern); err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	for _, required := range []string{"timestamp", "message"} {
+		if !seen[required] {
+			return nil, fmt.Errorf("invalid template: missing {%s}", required)
+		}
+	}
+	f.re, err = regexp.Compile("^" + pattern.String() + "$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	return f, nil
+}
+
+// parseTemplate parses nodes up to the end of s or, inside a group, up to its
+// closing "}". It returns the text after the nodes.
+func parseTemplate(s string, inGroup bool) ([]templateNode, string, error) {
+	var nodes []templateNode
+	var lit strings.Builder
+	flush := func() {
+		if lit.Len() > 0 {
+			nodes = append(nodes, templateNode{kind: tmplLiteral, text: lit.String()})
+			lit.Reset()
+		}
+	}
+
+	for s != "" {
+		switch {
+		case strings.HasPrefix(s, "{{"):
+			lit.WriteByte('{')
+			s = s[2:]
+		case strings.HasPrefix(s, "}}"):
+			lit.WriteByte('}')
+			s = s[2:]
+		case strings.HasPrefix(s, "{?"):
+			flush()
+			children, rest, err := parseTemplate(s[2:], true)
+			if err != nil {
+				return nil, s, err
+			}
+			if !strings.HasPrefix(rest, "}") {
+				return nil, s, fmt.Errorf("unterminated group %q", s)
+			}
+			nodes = append(nodes, templateNode{kind: tmplGroup, children: children})
+			s = rest[1:]
+		case s[0] == '{':
+			flush()
+			end := strings.IndexByte(s, '}')
+			if end < 0 {
+				return nil, s, fmt.Errorf("unterminated placeholder %q", s)
+			}
+			n, err := parsePlaceholder(s[1:end])
+			if err != nil {
+				return nil, s, err
+			}
+			nodes = append(nodes, n)
+			s = s[end+1:]
+		case s[0] == '}':
+			if inGroup {
+				flush()
+				return nodes, s, nil
+			}
+			return nil, s, fmt.Errorf("unmatched %q", "}")
+		default:
+			_, size := utf8.DecodeRuneInString(s)
+			lit.WriteString(s[:size])
+			s = s[size:]
+		}
+	}
+	flush()
+	return nodes, "", nil
+}
+
+// dateProbe has a year, month and day that no layout element can confuse.
+var dateProbe = time.Date(2031, time.November, 23, 14, 5, 6, 0, time.UTC)
+
+// keepsDate reports whether a timestamp rendered with layout parses back to
+// the same calendar day. Layouts without a year, month or day would parse as
+// year 0 and place lines in the wrong day file.
+func keepsDate(layout string) bool {
+	ts, err := time.Parse(layout, dateProbe.Format(layout))
+	if err != nil {
+		return false
+	}
+	y, m, d := ts.Date()
+	return y == dateProbe.Year() && m == dateProbe.Month() && d == dateProbe.Day()
+}
+
+// parsePlaceholder parses the text between "{" and "}".
+func parsePlaceholder(s string) (templateNode, error) {
+	name, arg, hasArg := strings.Cut(s, ":")
+	switch name {
+	case "timestamp":
+		n := templateNode{kind: tmplTimestamp, layout: time.RFC3339, loc: time.UTC}
+		if !hasArg {
+			return n, nil
+		}
+		layout, zone, hasZone := arg, "", false
+		if i := strings.LastIndexByte(arg, '@'); i >= 0 {
+			layout, zone, hasZone = arg[:i], arg[i+1:], true
+		}
+		if named, ok := timestampLayouts[strings.ToLower(layout)]; ok {
+			layout = named
+		}
+		if layout == "" || time.Unix(0, 0).UTC().Format(layout) == layout {
+			return n, fmt.Errorf("timestamp layout %q has no time elements", layout)
+		}
+		if !keepsDate(layout) {
+			return n, fmt.Errorf("timestamp layout %q does not contain a full date", layout)
+		}
+		n.layout = layout
+		if hasZone {
+			loc, err := time.LoadLocation(zone)
+			if err != nil {
+				return n, fmt.Errorf("timestamp time zone %q: %w", zone, err)
+			}
+			n.loc = loc
+		}
+		return n, nil
+	case "level":
+		switch arg {
+		case "", "upper", "padded", "lower", "letter":
+			return templateNode{kind: tmplLevel, style: arg}, nil
+		}
+		return templateNode{}, fmt.Errorf("unknown level style %q: must be upper, padded, lower or letter", arg)
+	case "fields":
+		switch arg {
+		case "", "logfmt", "json":
+			return templateNode{kind: tmplFields, style: arg}, nil
+		}
+		return templateNode{}, fmt.Errorf("unknown fields style %q: must be logfmt or json", arg)
+	case "field":
+		if arg == "" {
+			return templateNode{}, fmt.Errorf("{field} needs a name, e.g. {field:request_id}")
+		}
+		return templateNode{kind: tmplField, text: arg}, nil
+	case "app", "user", "message":
+		if hasArg {
+			return templateNode{}, fmt.Errorf("{%s} takes no options", name)
+		}
+		kind := map[string]templateKind{"app": tmplApp, "user": tmplUser, "message": tmplMessage}[name]
+		return templateNode{kind: kind}, nil
+	default:
+		return templateNode{}, fmt.Errorf("unknown placeholder {%s}", s)
+	}
+}
+
+// compile checks placeholder uniqueness, records promoted fields and builds the
+// pattern Parse matches lines against.
+func (f *TemplateFormatter) compile(nodes []templateNode, seen map[string]bool, pattern *strings.Builder) error {
+	for _, n := range nodes {
+		if n.kind == tmplLiteral {
+			pattern.WriteString(regexp.QuoteMeta(n.text))
+			continue
+		}
+		if n.kind == tmplGroup {
+			pattern.WriteString("(?:")
+			placeholders := len(f.captures)
+			if err := f.compile(n.children, seen, pattern); err != nil {
+				return err
+			}
+			if len(f.captures) == placeholders {
+				return fmt.Errorf("group without placeholders")
+			}
+			pattern.WriteString(")?")
+			continue
+		}
+
+		key := n.key()
+		if seen[key] {
+			return fmt.Errorf("placeholder {%s} used more than once", key)
+		}
+		seen[key] = true
+		if n.kind == tmplField {
+			f.promoted[n.text] = true
+		}
+		f.captures = append(f.captures, n)
+		pattern.WriteString(n.pattern())
+	}
+	return nil
+}
+
+// key names a placeholder for uniqueness checks and error messages.
+func (n templateNode) key() string {
+	switch n.kind {
+	case tmplTimestamp:
+		return "timestamp"
+	case tmplLevel:
+		return "level"
+	case tmplApp:
+		return "app"
+	case tmplUser:
+		return "user"
+	case tmplMessage:
+		return "message"
+	case tmplField:
+		return "field:" + n.text
+	default:
+		return "fields"
+	}
+}
+
+// pattern is the capturing regular expression matching a rendered placeholder.
+func (n templateNode) pattern() string {
+	switch n.kind {
+	case tmplTimestamp:
+		// Timestamps may contain spaces; match as many words as the layout renders.
+		words := len(strings.Fields(time.Unix(0, 0).UTC().Format(n.layout)))
+		return fmt.Sprintf(`(\S+(?: +\S+){%d})`, max(words-1, 0))
+	case tmplLevel:
+		if n.style == "padded" {
+			return `(\S*) *`
+		}
+		return `(\S*)`
+	case tmplFields:
+		// Match only text shaped like fields, so a lazy message before them does
+		// not end at the first space.
+		if n.style == "json" {
+			return `(\{".*\})`
+		}
+		return `(` + logfmtPairPattern + `(?: ` + logfmtPairPattern + `)*)`
+	default:
+		return `(.*?)`
+	}
+}
+
+// Format renders e with the template.
+func (f *TemplateFormatter) Format(e model.Event) (string, error) {
+	var b strings.Builder
+	if _, err := f.render(&b, f.nodes, e); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// render writes nodes to b and reports whether every placeholder was non-empty.
+func (f *TemplateFormatter) render(b *strings.Builder, nodes []templateNode, e model.Event) (bool, error) {
+	complete := true
+	for _, n := range nodes {
+		switch n.kind {
+		case tmplLiteral:
+			b.WriteString(n.text)
+		case tmplGroup:
+			var group strings.Builder
+			ok, err := f.render(&group, n.children, e)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				b.WriteString(group.String())
+			}
+		default:
+			s, err := f.value(n, e)
+			if err != nil {
+				return false, err
+			}
+			if s == "" {
+				complete = false
+			}
+			b.WriteString(s)
+		}
+	}
+	return complete, nil
+}
+
+// value renders one placeholder.
+func (f *TemplateFormatter) value(n templateNode, e model.Event) (string, error) {
+	switch n.kind {
+	case tmplTimestamp:
+		return e.Timestamp.In(n.loc).Format(n.layout), nil
+	case tmplLevel:
+		return formatLevelStyle(e.Level, n.style), nil
+	case tmplApp:
+		return sanitizeString(e.App), nil
+	case tmplUser:
+		return sanitizeString(e.User), nil
+	case tmplMessage:
+		return sanitizeString(e.Message), nil
+	case tmplField:
+		v, ok := e.Fields[n.text]
+		if !ok {
+			return "", nil
+		}
+		return sanitizeString(formatValue(v)), nil
+	default:
+		rest := make(map[string]any, len(e.Fields))
+		for k, v := range e.Fields {
+			if !f.promoted[k] {
+				rest[k] = v
+			}
+		}
+		if len(rest) == 0 {
+			return "", nil
+		}
+		if n.style != "json" {
+			return formatFieldsV2(rest), nil
+		}
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(rest); err != nil {
+			return "", fmt.Errorf("encode fields: %w", err)
+		}
+		return strings.TrimSuffix(buf.String(), "\n"), nil
+	}
+}
+
+// formatLevelStyle renders a level in one of the {level} styles.
+func formatLevelStyle(level model.LogLevel, style string) string {
+	upper := strings.ToUpper(string(level))
+	switch style {
+	case "padded":
+		return fmt.Sprintf("%-5s", upper)
+	case "lower":
+		return strings.ToLower(string(level))
+	case "letter":
+		if upper == "" {
+			return ""
+		}
+		_, size := utf8.DecodeRuneInString(upper)
+		return upper[:size]
+	default:
+		return upper
+	}
+}
+
+// parseLevelStyle reverses formatLevelStyle.
+func parseLevelStyle(s, style string) model.LogLevel {
+	if style == "letter" {
+		for _, l := range []model.LogLevel{model.LevelDebug, model.LevelInfo, model.LevelWarn, model.LevelError} {
+			if formatLevelStyle(l, style) == s {
+				return l
+			}
+		}
+	}
+	return model.LogLevel(strings.ToLower(s))
+}
+
+// Parse matches line against the template and reads the columns back. It is
+// best-effort: a column containing the literal text that follows it in the
+// template (for example a message containing the fields separator) may be split
+// in the wrong place, in which case the line is rejected or read differently.
+func (f *TemplateFormatter) Parse(line string) (model.Event, error) {
+	ev := model.Event{Fields: make(map[string]any)}
+
+	m := f.re.FindStringSubmatch(line)
+	if m == nil {
+		return ev, fmt.Errorf("line does not match template")
+	}
+	for i, n := range f.captures {
+		s := m[i+1]
+		switch n.kind {
+		case tmplTimestamp:
+			ts, err := time.ParseInLocation(n.layout, s, n.loc)
+			if err != nil {
+				return ev, fmt.Errorf("invalid timestamp: %w", err)
+			}
+			ev.Timestamp = ts
+		case tmplLevel:
+			ev.Level = parseLevelStyle(s, n.style)
+		case tmplApp:
+			ev.App = s
+		case tmplUser:
+			ev.User = s
+		case tmplMessage:
+			ev.Message = s
+		case tmplField:
+			if s != "" {
+				ev.Fields[n.text] = parseValue(s)
+			}
+		case tmplFields:
+			if s == "" {
+				continue
+			}
+			fields, err := parseTemplateFields(s, n.style)
+			if err != nil {
+				return ev, err
+			}
+			for k, v := range fields {
+				ev.Fields[k] = v
+			}
+		}
+	}
+	return ev, nil
+}
+
+// parseTemplateFields reads a {fields} column in the given style.
+func parseTemplateFields(s, style string) (map[string]any, error) {
+	if style != "json" {
+		return parseFieldsV2(s)
+	}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var fields map[string]any
+	if err := dec.Decode(&fields); err != nil {
+		return nil, fmt.Errorf("invalid fields: %w", err)
+	}
+	return fields, nil
+}
+
+// Extension returns ".tmpl.log", so template files are never read as text files
+// and the other way round.
+func (f *TemplateFormatter) Extension() string { return ".tmpl.log" }
+
+// String returns the template text.
+func (f *TemplateFormatter) String() string { return f.template }
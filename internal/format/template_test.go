@@ -0,0 +1,150 @@
+package format
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"logger/internal/model"
+)
+
+func templateTestEvent() model.Event {
+	return model.Event{
+		Timestamp: time.Date(2026, 3, 1, 12, 30, 5, 0, time.UTC),
+		Level:     model.LevelInfo,
+		Message:   "user logged in",
+		App:       "auth",
+		User:      "alice",
+		Fields: map[string]any{
+			"request_id": "r-1",
+			"ip":         "203.0.113.42",
+			"latency":    json.Number("12"),
+		},
+	}
+}
+
+func TestTemplateFormatter_Format(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		ev       func(*model.Event)
+		want     string
+	}{
+		{
+			name:     "pre-2026-02-12 order",
+			template: "[{timestamp}] {?[{app}] }{?[{user}] }[{level:lower}] {message}{? | {fields}}",
+			want:     "[2026-03-01T12:30:05Z] [auth] [alice] [info] user logged in | ip=203.0.113.42 latency=12 request_id=r-1",
+		},
+		{
+			name:     "optional groups left out",
+			template: "[{timestamp}] {?[{app}] }{?[{user}] }[{level:lower}] {message}{? | {fields}}",
+			ev: func(e *model.Event) {
+				e.App, e.User, e.Fields = "", "", nil
+			},
+			want: "[2026-03-01T12:30:05Z] [info] user logged in",
+		},
+		{
+			name:     "promoted field, zone and letter level",
+			template: "{timestamp:datetime@Europe/Berlin} {level:letter} {field:request_id} {message} {fields:json}",
+			want:     `2026-03-01 13:30:05 I r-1 user logged in {"ip":"203.0.113.42","latency":12}`,
+		},
+		{
+			name:     "padded level and literal braces",
+			template: "{{{timestamp:2006-01-02 15:04:05}}} {level:padded}|{message}",
+			ev: func(e *model.Event) {
+				e.Message = "line1\nline2"
+			},
+			want: "{2026-03-01 12:30:05} INFO |line1\tline2",
+		},
+	}
+
+	for _, tt := range tests {
+		f, err := NewTemplateFormatter(tt.template)
+		if err != nil {
+			t.Fatalf("%s: NewTemplateFormatter returned error: %v", tt.name, err)
+		}
+		ev := templateTestEvent()
+		if tt.ev != nil {
+			tt.ev(&ev)
+		}
+		got, err := f.Format(ev)
+		if err != nil {
+			t.Fatalf("%s: Format returned error: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Fatalf("%s:\nexpected %s\ngot      %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestTemplateFormatter_Parse(t *testing.T) {
+	templates := []string{
+		"[{timestamp}] {?[{app}] }{?[{user}] }[{level:lower}] {message}{? | {fields}}",
+		"{timestamp:datetime@Europe/Berlin} {level:letter} {?{app}/{user} }{field:request_id} {message} {fields:json}",
+		"{level:padded} {timestamp:rfc3339nano} app={app} user={user} {message}{? -- {fields}}",
+	}
+
+	for _, tmpl := range templates {
+		f, err := NewTemplateFormatter(tmpl)
+		if err != nil {
+			t.Fatalf("NewTemplateFormatter(%q) returned error: %v", tmpl, err)
+		}
+		ev := templateTestEvent()
+		line, err := f.Format(ev)
+		if err != nil {
+			t.Fatalf("Format returned error: %v", err)
+		}
+		got, err := f.Parse(line)
+		if err != nil {
+			t.Fatalf("Parse(%q) returned error: %v", line, err)
+		}
+		if !got.Timestamp.Equal(ev.Timestamp) || got.Level != ev.Level || got.Message != ev.Message ||
+			got.App != ev.App || got.User != ev.User || !reflect.DeepEqual(got.Fields, ev.Fields) {
+			t.Fatalf("round trip of %q returned %+v", line, got)
+		}
+	}
+}
+
+func TestTemplateFormatter_Extension(t *testing.T) {
+	f, err := NewTemplateFormatter("{timestamp} {message}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ext, text := f.Extension(), (TextFormatter{}).Extension(); ext != ".tmpl.log" || ext == text {
+		t.Fatalf("expected .tmpl.log, distinct from the text extension %q, got %q", text, ext)
+	}
+}
+
+func TestNewTemplateFormatter_Invalid(t *testing.T) {
+	tests := []struct {
+		template string
+		errPart  string
+	}{
+		{"{message}", "missing {timestamp}"},
+		{"{timestamp}", "missing {message}"},
+		{"{timestamp} {msg}", "unknown placeholder {msg}"},
+		{"{timestamp} {message", "unterminated placeholder"},
+		{"{timestamp} {message} }", "unmatched"},
+		{"{timestamp} {?[{app}] {message}", "unterminated group"},
+		{"{timestamp} {?static} {message}", "group without placeholders"},
+		{"{timestamp} {message} {message}", "used more than once"},
+		{"{timestamp:nonsense} {message}", "no time elements"},
+		{"{timestamp:15:04} {message}", "full date"},
+		{"{timestamp:Jan 2 15:04:05} {message}", "full date"},
+		{"{timestamp:2006-01 15:04} {message}", "full date"},
+		{"{timestamp:rfc3339@Mars/Olympus} {message}", "time zone"},
+		{"{timestamp} {level:fancy} {message}", "unknown level style"},
+		{"{timestamp} {message} {fields:xml}", "unknown fields style"},
+		{"{timestamp} {field:} {message}", "needs a name"},
+		{"{timestamp} {app:x} {message}", "takes no options"},
+	}
+
+	for _, tt := range tests {
+		_, err := NewTemplateFormatter(tt.template)
+		if err == nil || !strings.Contains(err.Error(), tt.errPart) {
+			t.Fatalf("NewTemplateFormatter(%q): expected error containing %q, got %v", tt.template, tt.errPart, err)
+		}
+	}
+}
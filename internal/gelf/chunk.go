@@ -0,0 +1,143 @@
+package gelf
+
+import (
+	"bytes"
+	"errors"
+	"time"
+)
+
+const (
+	// chunkHeaderLen is the magic bytes, the 8-byte message ID, the sequence
+	// number and the sequence count.
+	chunkHeaderLen = 12
+	// maxChunks is the most chunks of one message, as the specification limits.
+	maxChunks = 128
+)
+
+// chunkMagic starts every chunked GELF datagram.
+var chunkMagic = []byte{0x1e, 0x0f}
+
+// isChunk reports whether a datagram is a chunk of a larger message.
+func isChunk(data []byte) bool {
+	return bytes.HasPrefix(data, chunkMagic)
+}
+
+// chunkSet collects the chunks of one message.
+type chunkSet struct {
+	chunks   [][]byte
+	received int
+	size     int
+	first    time.Time
+}
+
+// assembler reassembles chunked messages. It holds at most maxSets incomplete
+// messages of at most maxBytes each, and at most maxTotal bytes across them; the
+// oldest sets are dropped to make room for a new set or chunk, and sets not
+// completed within timeout are dropped.
+type assembler struct {
+	maxSets   int
+	maxBytes  int
+	maxTotal  int
+	timeout   time.Duration
+	sets      map[[8]byte]*chunkSet
+	total     int // bytes buffered across sets
+	lastSweep time.Time
+
+	// dropped counts the incomplete messages evicted or timed out so far.
+	dropped int
+}
+
+// newAssembler creates an assembler. maxTotal is raised to maxBytes if it is
+// smaller, so that a single message always fits.
+func newAssembler(maxSets, maxBytes, maxTotal int, timeout time.Duration) *assembler {
+	maxTotal = max(maxTotal, maxBytes)
+	return &assembler{maxSets: maxSets, maxBytes: maxBytes, maxTotal: maxTotal, timeout: timeout, sets: make(map[[8]byte]*chunkSet)}
+}
+
+// add stores one chunk and returns the message once all of its chunks have arrived.
+// Duplicate chunks are ignored. It is not safe for concurrent use.
+func (a *assembler) add(data []byte, now time.Time) ([]byte, error) {
+	if len(data) < chunkHeaderLen {
+		return nil, errors.New("truncated gelf chunk header")
+	}
+	var id [8]byte
+	copy(id[:], data[2:10])
+	seq, count := int(data[10]), int(data[11])
+	if count == 0 || count > maxChunks || seq >= count {
+		return nil, errors.New("invalid gelf chunk sequence")
+	}
+	payload := data[chunkHeaderLen:]
+
+	a.sweep(now)
+	set, ok := a.sets[id]
+	if !ok {
+		if len(a.sets) >= a.maxSets {
+			a.evictOldest(id)
+		}
+		set = &chunkSet{chunks: make([][]byte, count), first: now}
+		a.sets[id] = set
+	}
+	if len(set.chunks) != count {
+		a.remove(id)
+		return nil, errors.New("gelf chunks disagree on the sequence count")
+	}
+	if set.chunks[seq] != nil {
+		return nil, nil
+	}
+	if set.size+len(payload) > a.maxBytes {
+		a.remove(id)
+		return nil, errTooLarge
+	}
+	// The set itself is within maxBytes, so evicting the others always makes room.
+	for a.total+len(payload) > a.maxTotal {
+		a.evictOldest(id)
+	}
+	set.chunks[seq] = append(make([]byte, 0, len(payload)), payload...)
+	set.received++
+	set.size += len(payload)
+	a.total += len(payload)
+	if set.received < count {
+		return nil, nil
+	}
+
+	a.remove(id)
+	return bytes.Join(set.chunks, nil), nil
+}
+
+// sweep drops the sets older than timeout, at most once per half timeout.
+func (a *assembler) sweep(now time.Time) {
+	if now.Sub(a.lastSweep) < a.timeout/2 {
+		return
+	}
+	a.lastSweep = now
+	for id, set := range a.sets {
+		if now.Sub(set.first) > a.timeout {
+			a.remove(id)
+			a.dropped++
+		}
+	}
+}
+
+// evictOldest drops the oldest set other than keep.
+func (a *assembler) evictOldest(keep [8]byte) {
+	var oldest [8]byte
+	var oldestTime time.Time
+	found := false
+	for id, set := range a.sets {
+		if id != keep && (!found || set.first.Before(oldestTime)) {
+			oldest, oldestTime, found = id, set.first, true
+		}
+	}
+	if found {
+		a.remove(oldest)
+		a.dropped++
+	}
+}
+
+// remove drops the set with the given ID and releases its bytes.
+func (a *assembler) remove(id [8]byte) {
+	if set, ok := a.sets[id]; ok {
+		a.total -= set.size
+		delete(a.sets, id)
+	}
+}
@@ -0,0 +1,105 @@
+package gelf
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// chunk builds one chunked datagram.
+func chunk(id byte, seq, count int, payload string) []byte {
+	return append([]byte{0x1e, 0x0f, id, 0, 0, 0, 0, 0, 0, 0, byte(seq), byte(count)}, payload...)
+}
+
+func TestAssembler_ReassemblesOutOfOrder(t *testing.T) {
+	a := newAssembler(4, 1024, 4096, time.Second)
+	now := time.Now()
+
+	for _, c := range [][]byte{chunk(1, 2, 3, "c"), chunk(2, 0, 2, "x"), chunk(1, 0, 3, "a"), chunk(1, 0, 3, "dup")} {
+		if out, err := a.add(c, now); out != nil || err != nil {
+			t.Fatalf("expected no message yet, got %q, %v", out, err)
+		}
+	}
+	out, err := a.add(chunk(1, 1, 3, "b"), now)
+	if err != nil || !bytes.Equal(out, []byte("abc")) {
+		t.Fatalf("expected abc, got %q, %v", out, err)
+	}
+	if len(a.sets) != 1 {
+		t.Fatalf("expected only the incomplete set to remain, got %d", len(a.sets))
+	}
+}
+
+func TestAssembler_Bounds(t *testing.T) {
+	a := newAssembler(2, 4, 16, time.Second)
+	now := time.Now()
+
+	// Too many incomplete sets: the oldest is evicted.
+	a.add(chunk(1, 0, 2, "a"), now)
+	a.add(chunk(2, 0, 2, "a"), now.Add(time.Millisecond))
+	a.add(chunk(3, 0, 2, "a"), now.Add(2*time.Millisecond))
+	if len(a.sets) != 2 || a.dropped != 1 {
+		t.Fatalf("expected 2 sets and 1 dropped, got %d and %d", len(a.sets), a.dropped)
+	}
+	if out, _ := a.add(chunk(1, 1, 2, "b"), now); out != nil {
+		t.Fatalf("expected the evicted set to be gone, got %q", out)
+	}
+
+	// Incomplete sets time out.
+	a = newAssembler(8, 4, 32, time.Second)
+	a.add(chunk(1, 0, 2, "a"), now)
+	a.add(chunk(2, 0, 2, "a"), now.Add(2*time.Second))
+	if len(a.sets) != 1 || a.dropped != 1 {
+		t.Fatalf("expected the stale set to time out, got %d sets, %d dropped", len(a.sets), a.dropped)
+	}
+
+	// Oversized messages and bad headers are rejected.
+	if _, err := a.add(chunk(3, 0, 2, "toolong"), now.Add(2*time.Second)); err != errTooLarge {
+		t.Fatalf("expected errTooLarge, got %v", err)
+	}
+	for _, bad := range [][]byte{chunk(4, 0, 0, "x"), chunk(4, 2, 2, "x"), chunk(4, 0, 129, "x"), {0x1e, 0x0f, 1}} {
+		if _, err := a.add(bad, now.Add(2*time.Second)); err == nil {
+			t.Fatalf("expected %v to be rejected", bad)
+		}
+	}
+	if _, err := a.add(chunk(2, 1, 3, "b"), now.Add(2*time.Second)); err == nil {
+		t.Fatal("expected a mismatched sequence count to be rejected")
+	}
+}
+
+func TestAssembler_TotalBytesBound(t *testing.T) {
+	a := newAssembler(100, 8, 10, time.Second)
+	now := time.Now()
+
+	// Three sets of 4 bytes each exceed the 10-byte budget: the oldest goes.
+	for i := 1; i <= 3; i++ {
+		if _, err := a.add(chunk(byte(i), 0, 3, "aaaa"), now.Add(time.Duration(i)*time.Millisecond)); err != nil {
+			t.Fatal(err)
+		}
+		if a.total > a.maxTotal {
+			t.Fatalf("buffered %d bytes, over the %d-byte budget", a.total, a.maxTotal)
+		}
+	}
+	if len(a.sets) != 2 || a.dropped != 1 || a.total != 8 {
+		t.Fatalf("expected 2 sets of 8 bytes and 1 dropped, got %d sets, %d bytes, %d dropped", len(a.sets), a.total, a.dropped)
+	}
+	if _, ok := a.sets[[8]byte{1}]; ok {
+		t.Fatal("expected the oldest set to be evicted")
+	}
+
+	// Growing the newest set evicts the older one rather than the set itself.
+	if _, err := a.add(chunk(3, 1, 3, "bbbb"), now); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.sets) != 1 || a.total != 8 {
+		t.Fatalf("expected only set 3 with 8 bytes, got %d sets, %d bytes", len(a.sets), a.total)
+	}
+
+	// Completing a message releases its bytes.
+	out, err := a.add(chunk(4, 0, 1, "cc"), now)
+	if err != nil || string(out) != "cc" {
+		t.Fatalf("expected cc, got %q, %v", out, err)
+	}
+	if a.total != 8 {
+		t.Fatalf("expected 8 bytes after completing a message, got %d", a.total)
+	}
+}
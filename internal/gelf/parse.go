@@ -0,0 +1,152 @@
+// Package gelf receives Graylog Extended Log Format (GELF 1.1) messages over UDP,
+// chunked and compressed, and TCP, and feeds them into the ingest pipeline.
+package gelf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"logger/internal/ingest"
+	"logger/internal/model"
+)
+
+// Message is a parsed GELF message.
+type Message struct {
+	Host         string
+	ShortMessage string
+	FullMessage  string
+	Timestamp    time.Time // zero when the message carries none
+	// Level is the syslog severity, 0 (emergency) to 7 (debug); -1 when absent.
+	Level int
+	// Fields are the additional fields, without their leading underscore.
+	Fields map[string]any
+}
+
+// errTooLarge reports a message over the allowed size, as sent or once inflated.
+var errTooLarge = fmt.Errorf("gelf %w", ingest.ErrFrameTooLarge)
+
+// Decompress inflates a gzip or zlib payload, recognised by its magic bytes, and
+// returns other payloads unchanged. The result is limited to maxBytes.
+func Decompress(data []byte, maxBytes int) ([]byte, error) {
+	var r io.ReadCloser
+	var err error
+	switch {
+	case len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b:
+		r, err = gzip.NewReader(bytes.NewReader(data))
+	case len(data) >= 2 && data[0] == 0x78 && (uint16(data[0])<<8|uint16(data[1]))%31 == 0:
+		r, err = zlib.NewReader(bytes.NewReader(data))
+	default:
+		if len(data) > maxBytes {
+			return nil, errTooLarge
+		}
+		return data, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid compressed gelf payload: %w", err)
+	}
+	defer r.Close()
+	out, err := io.ReadAll(io.LimitReader(r, int64(maxBytes)+1))
+	if err != nil {
+		return nil, fmt.Errorf("invalid compressed gelf payload: %w", err)
+	}
+	if len(out) > maxBytes {
+		return nil, errTooLarge
+	}
+	return out, nil
+}
+
+// Parse reads a GELF JSON message. short_message is required (full_message stands in
+// for it when it is missing); the version is not checked, so GELF 1.0 senders work.
+func Parse(data []byte) (Message, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var raw map[string]any
+	if err := dec.Decode(&raw); err != nil {
+		return Message{}, fmt.Errorf("invalid gelf JSON: %v", err)
+	}
+
+	m := Message{Level: -1, Fields: map[string]any{}}
+	m.Host, _ = raw["host"].(string)
+	m.ShortMessage, _ = raw["short_message"].(string)
+	m.FullMessage, _ = raw["full_message"].(string)
+	if m.ShortMessage == "" {
+		m.ShortMessage = m.FullMessage
+	}
+	if strings.TrimSpace(m.ShortMessage) == "" {
+		return Message{}, errors.New("missing short_message")
+	}
+
+	if v, ok := raw["timestamp"].(json.Number); ok {
+		secs, err := v.Float64()
+		if err != nil || secs < 0 || secs > math.MaxInt64/1e9 {
+			return Message{}, fmt.Errorf("invalid timestamp %s", v)
+		}
+		whole, frac := math.Modf(secs)
+		// GELF timestamps carry milliseconds at most; round away float noise.
+		m.Timestamp = time.Unix(int64(whole), int64(math.Round(frac*1e6))*1e3).UTC()
+	}
+	if v, ok := raw["level"].(json.Number); ok {
+		level, err := v.Int64()
+		if err != nil || level < 0 || level > 7 {
+			return Message{}, fmt.Errorf("invalid level %s", v)
+		}
+		m.Level = int(level)
+	}
+
+	for k, v := range raw {
+		// _id is reserved by the specification and dropped.
+		if len(k) > 1 && k[0] == '_' && k != "_id" {
+			m.Fields[k[1:]] = v
+		}
+	}
+	return m, nil
+}
+
+// LogLevel maps the syslog level to a log level: 0-3 are error, 4 is warn, 5 and 6
+// are info and 7 is debug. Messages without a level are info.
+func (m Message) LogLevel() model.LogLevel {
+	switch {
+	case m.Level < 0:
+		return model.LevelInfo
+	case m.Level <= 3:
+		return model.LevelError
+	case m.Level == 4:
+		return model.LevelWarn
+	case m.Level == 7:
+		return model.LevelDebug
+	default:
+		return model.LevelInfo
+	}
+}
+
+// Payload converts the message into an event payload. short_message is the message
+// and host the app; full_message and the additional fields become fields. Messages
+// without a timestamp are stamped with received.
+func (m Message) Payload(received time.Time) model.EventPayload {
+	ts := m.Timestamp
+	if ts.IsZero() {
+		ts = received
+	}
+	fields := make(map[string]any, len(m.Fields)+1)
+	for k, v := range m.Fields {
+		fields[k] = v
+	}
+	if m.FullMessage != "" && m.FullMessage != m.ShortMessage {
+		fields["full_message"] = m.FullMessage
+	}
+	return model.EventPayload{
+		Timestamp: ts.Format(time.RFC3339Nano),
+		Level:     string(m.LogLevel()),
+		Message:   m.ShortMessage,
+		App:       m.Host,
+		Fields:    fields,
+	}
+}
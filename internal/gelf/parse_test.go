@@ -0,0 +1,86 @@
+package gelf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParse_DockerMessage(t *testing.T) {
+	data := []byte(`{"version":"1.1","host":"docker-1","short_message":"GET /health 200","full_message":"GET /health 200\nstack",
+		"timestamp":1770638400.125,"level":4,"_container_name":"web","_tag":"abc123","_id":"reserved","_retries":3}`)
+	m, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if !m.Timestamp.Equal(time.Date(2026, 2, 9, 12, 0, 0, 125e6, time.UTC)) {
+		t.Fatalf("unexpected timestamp %v", m.Timestamp)
+	}
+
+	p := m.Payload(time.Now())
+	if p.App != "docker-1" || p.Level != "warn" || p.Message != "GET /health 200" {
+		t.Fatalf("unexpected payload: %+v", p)
+	}
+	if p.Fields["container_name"] != "web" || p.Fields["tag"] != "abc123" || p.Fields["full_message"] != "GET /health 200\nstack" {
+		t.Fatalf("unexpected fields: %v", p.Fields)
+	}
+	if p.Fields["retries"] != json.Number("3") {
+		t.Fatalf("expected numbers to be kept, got %#v", p.Fields["retries"])
+	}
+	if _, ok := p.Fields["id"]; ok {
+		t.Fatalf("expected the reserved _id to be dropped, got %v", p.Fields)
+	}
+}
+
+func TestParse_Levels(t *testing.T) {
+	for in, want := range map[string]string{
+		`{"short_message":"x","level":0}`: "error",
+		`{"short_message":"x","level":3}`: "error",
+		`{"short_message":"x","level":5}`: "info",
+		`{"short_message":"x","level":7}`: "debug",
+		`{"short_message":"x"}`:           "info",
+		`{"full_message":"only full"}`:    "info",
+	} {
+		m, err := Parse([]byte(in))
+		if err != nil {
+			t.Fatalf("%s: %v", in, err)
+		}
+		if got := string(m.LogLevel()); got != want {
+			t.Errorf("%s: expected %s, got %s", in, want, got)
+		}
+	}
+
+	for _, bad := range []string{`not json`, `{"host":"h"}`, `{"short_message":" "}`, `{"short_message":"x","level":9}`, `{"short_message":"x","timestamp":-1}`} {
+		if _, err := Parse([]byte(bad)); err == nil {
+			t.Errorf("expected %s to be rejected", bad)
+		}
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	msg := []byte(`{"short_message":"compressed"}`)
+
+	var gz, zl bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(msg)
+	w.Close()
+	z := zlib.NewWriter(&zl)
+	z.Write(msg)
+	z.Close()
+
+	for name, data := range map[string][]byte{"plain": msg, "gzip": gz.Bytes(), "zlib": zl.Bytes()} {
+		out, err := Decompress(data, 1024)
+		if err != nil || !bytes.Equal(out, msg) {
+			t.Fatalf("%s: got %q, %v", name, out, err)
+		}
+		if _, err := Decompress(data, 10); err != errTooLarge {
+			t.Fatalf("%s: expected errTooLarge over the limit, got %v", name, err)
+		}
+	}
+	if _, err := Decompress([]byte{0x1f, 0x8b, 0, 0}, 1024); err == nil {
+		t.Fatal("expected a corrupt gzip payload to be rejected")
+	}
+}
@@ -0,0 +1,182 @@
+package gelf
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	"logger/internal/ingest"
+	"logger/internal/model"
+)
+
+// Config configures a Server. Zero values select the defaults.
+type Config struct {
+	// UDPAddr and TCPAddr are the addresses to listen on, e.g. ":12201". An empty
+	// address disables that transport.
+	UDPAddr string
+	TCPAddr string
+	// MaxMessageBytes bounds a message after reassembly and decompression
+	// (default 1 MiB). Longer messages are dropped.
+	MaxMessageBytes int
+	// ChunkTimeout is how long the chunks of a message may take to arrive (default 5s).
+	ChunkTimeout time.Duration
+	// MaxChunkSets bounds the messages being reassembled at once (default 1024).
+	MaxChunkSets int
+	// MaxChunkBytes bounds the bytes buffered across all messages being reassembled
+	// (default 4 × MaxMessageBytes). The oldest messages are dropped to stay below it.
+	MaxChunkBytes int
+	// IdleTimeout closes TCP connections that send nothing for this long (default 5m).
+	IdleTimeout time.Duration
+}
+
+const (
+	defaultMaxMessageBytes = 1 << 20
+	defaultChunkTimeout    = 5 * time.Second
+	defaultMaxChunkSets    = 1024
+	defaultIdleTimeout     = 5 * time.Minute
+	// maxDatagramBytes is the largest UDP payload.
+	maxDatagramBytes = 65535
+)
+
+// Server receives GELF messages and writes them through an ingest pipeline.
+// Messages that fail to parse or validate are logged and dropped: GELF has no way
+// to report them to the sender.
+type Server struct {
+	pipeline  *ingest.Pipeline
+	cfg       Config
+	ln        *ingest.Listener
+	assembler *assembler
+}
+
+// NewServer creates a Server writing to p. Start opens the listeners.
+func NewServer(p *ingest.Pipeline, cfg Config) *Server {
+	if cfg.MaxMessageBytes <= 0 {
+		cfg.MaxMessageBytes = defaultMaxMessageBytes
+	}
+	if cfg.ChunkTimeout <= 0 {
+		cfg.ChunkTimeout = defaultChunkTimeout
+	}
+	if cfg.MaxChunkSets <= 0 {
+		cfg.MaxChunkSets = defaultMaxChunkSets
+	}
+	if cfg.MaxChunkBytes <= 0 {
+		cfg.MaxChunkBytes = 4 * cfg.MaxMessageBytes
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = defaultIdleTimeout
+	}
+	return &Server{
+		pipeline:  p,
+		cfg:       cfg,
+		ln:        ingest.NewListener("gelf"),
+		assembler: newAssembler(cfg.MaxChunkSets, cfg.MaxMessageBytes, cfg.MaxChunkBytes, cfg.ChunkTimeout),
+	}
+}
+
+// Start opens the configured listeners and serves them in the background.
+func (s *Server) Start() error {
+	if s.cfg.UDPAddr != "" {
+		if err := s.ln.ListenUDP(s.cfg.UDPAddr, maxDatagramBytes, s.handleDatagram); err != nil {
+			return err
+		}
+	}
+	if s.cfg.TCPAddr != "" {
+		if err := s.ln.ListenTCP(s.cfg.TCPAddr, s.handleConn); err != nil {
+			s.ln.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+// UDPAddr returns the address of the UDP listener, or nil when it is disabled.
+func (s *Server) UDPAddr() net.Addr {
+	return s.ln.UDPAddr()
+}
+
+// TCPAddr returns the address of the TCP listener, or nil when it is disabled.
+func (s *Server) TCPAddr() net.Addr {
+	return s.ln.TCPAddr()
+}
+
+// handleDatagram handles a datagram holding a whole message or one chunk of it.
+// Datagrams are handled one at a time, so only one goroutine uses the assembler.
+func (s *Server) handleDatagram(data []byte) {
+	if isChunk(data) {
+		dropped := s.assembler.dropped
+		var err error
+		data, err = s.assembler.add(data, time.Now())
+		if d := s.assembler.dropped - dropped; d > 0 {
+			log.Printf("gelf: dropped %d incomplete chunked messages", d)
+		}
+		if err != nil {
+			log.Printf("gelf: dropped udp chunk: %v", err)
+			return
+		}
+		if data == nil {
+			return // waiting for more chunks
+		}
+	}
+	data, err := Decompress(data, s.cfg.MaxMessageBytes)
+	if err != nil {
+		log.Printf("gelf: dropped udp message: %v", err)
+		return
+	}
+	s.ln.WriteMessage(s.pipeline, data, "udp", decode)
+}
+
+// handleConn reads null-byte terminated messages until the connection ends.
+func (s *Server) handleConn(conn net.Conn) {
+	s.ln.ServeFramed(conn, s.pipeline, ingest.Framing{
+		Read:        readFrame,
+		MaxBytes:    s.cfg.MaxMessageBytes,
+		IdleTimeout: s.cfg.IdleTimeout,
+		Decode:      decode,
+	})
+}
+
+// readFrame reads one message terminated by a null byte; see ingest.FrameReader.
+// The last message may lack its terminator.
+func readFrame(r *bufio.Reader, maxBytes int) ([]byte, error) {
+	var msg []byte
+	tooLong := false
+	for {
+		chunk, err := r.ReadSlice(0)
+		if !tooLong {
+			msg = append(msg, chunk...)
+			if len(msg) > maxBytes+1 {
+				msg, tooLong = nil, true
+			}
+		}
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF && len(bytes.TrimSpace(msg)) > 0:
+			return bytes.TrimSpace(msg), nil
+		case err != nil:
+			return nil, err
+		case tooLong:
+			return nil, errTooLarge
+		default:
+			return bytes.TrimSpace(bytes.TrimSuffix(msg, []byte{0})), nil
+		}
+	}
+}
+
+// decode is the ingest.Decoder of GELF messages.
+func decode(msg []byte, now time.Time) (model.EventPayload, error) {
+	m, err := Parse(msg)
+	if err != nil {
+		return model.EventPayload{}, err
+	}
+	return m.Payload(now), nil
+}
+
+// Close stops the listeners, closes open connections and waits for messages being
+// handled to be written.
+func (s *Server) Close() error {
+	return s.ln.Close()
+}
@@ -0,0 +1,87 @@
+package gelf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"logger/internal/format"
+	"logger/internal/ingest"
+	"logger/internal/ingest/ingesttest"
+)
+
+func startServer(t *testing.T) (*Server, *ingesttest.Sink) {
+	t.Helper()
+	fs := &ingesttest.Sink{}
+	s := NewServer(&ingest.Pipeline{Sink: fs, Formatter: format.JSONFormatter{}}, Config{UDPAddr: "127.0.0.1:0", TCPAddr: "127.0.0.1:0", MaxMessageBytes: 4096})
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, fs
+}
+
+func gelfMessage(level int, msg string) string {
+	return fmt.Sprintf(`{"version":"1.1","host":"docker-1","short_message":%q,"timestamp":%d,"level":%d,"_container_name":"web"}`, msg, time.Now().Unix(), level)
+}
+
+func TestServer_UDP(t *testing.T) {
+	s, fs := startServer(t)
+	conn, err := net.Dial("udp", s.UDPAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// A zlib-compressed message split into three chunks, sent out of order.
+	var zl bytes.Buffer
+	z := zlib.NewWriter(&zl)
+	z.Write([]byte(gelfMessage(3, "chunked "+strings.Repeat("x", 100))))
+	z.Close()
+	compressed := zl.Bytes()
+	third := len(compressed) / 3
+	parts := [][]byte{compressed[:third], compressed[third : 2*third], compressed[2*third:]}
+
+	datagrams := [][]byte{[]byte(gelfMessage(6, "plain"))}
+	for _, seq := range []int{2, 0, 1} {
+		datagrams = append(datagrams, append([]byte{0x1e, 0x0f, 1, 2, 3, 4, 5, 6, 7, 8, byte(seq), 3}, parts[seq]...))
+	}
+	datagrams = append(datagrams, []byte(`{"host":"h"}`)) // no short_message: dropped
+	for _, d := range datagrams {
+		if _, err := conn.Write(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := fs.WaitForMessages(t, 2)
+	want := []string{"info:docker-1:plain", "error:docker-1:chunked " + strings.Repeat("x", 100)}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestServer_TCP(t *testing.T) {
+	s, fs := startServer(t)
+	conn, err := net.Dial("tcp", s.TCPAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := gelfMessage(6, "one") + "\x00" +
+		gelfMessage(7, "two") + "\x00\x00" +
+		gelfMessage(6, strings.Repeat("y", 5000)) + "\x00" + // too long: skipped
+		gelfMessage(4, "last")
+	if _, err := conn.Write([]byte(stream)); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	got := fs.WaitForMessages(t, 3)
+	want := []string{"info:docker-1:one", "debug:docker-1:two", "warn:docker-1:last"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
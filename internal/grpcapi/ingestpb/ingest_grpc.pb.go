@@ -0,0 +1,205 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: logger/ingest/v1/ingest.proto
+
+package ingestpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	LogIngest_Write_FullMethodName       = "/logger.ingest.v1.LogIngest/Write"
+	LogIngest_WriteStream_FullMethodName = "/logger.ingest.v1.LogIngest/WriteStream"
+	LogIngest_WriteAcked_FullMethodName  = "/logger.ingest.v1.LogIngest/WriteAcked"
+)
+
+// LogIngestClient is the client API for LogIngest service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// LogIngest writes log events through the same validation, formatting and sinks
+// as POST /logs. Events failing validation are reported per event; sink failures
+// end the call with UNAVAILABLE (queue full), RESOURCE_EXHAUSTED (storage full)
+// or INTERNAL.
+type LogIngestClient interface {
+	// Write validates a batch of events and writes the valid ones together.
+	Write(ctx context.Context, in *WriteRequest, opts ...grpc.CallOption) (*WriteSummary, error)
+	// WriteStream writes events as they arrive and answers with a summary once the
+	// client closes its side of the stream.
+	WriteStream(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[Event, WriteSummary], error)
+	// WriteAcked writes events as they arrive and acknowledges each one, echoing its
+	// id, once it has been written or rejected.
+	WriteAcked(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[AckedEvent, Ack], error)
+}
+
+type logIngestClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewLogIngestClient(cc grpc.ClientConnInterface) LogIngestClient {
+	return &logIngestClient{cc}
+}
+
+func (c *logIngestClient) Write(ctx context.Context, in *WriteRequest, opts ...grpc.CallOption) (*WriteSummary, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(WriteSummary)
+	err := c.cc.Invoke(ctx, LogIngest_Write_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logIngestClient) WriteStream(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[Event, WriteSummary], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &LogIngest_ServiceDesc.Streams[0], LogIngest_WriteStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[Event, WriteSummary]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type LogIngest_WriteStreamClient = grpc.ClientStreamingClient[Event, WriteSummary]
+
+func (c *logIngestClient) WriteAcked(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[AckedEvent, Ack], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &LogIngest_ServiceDesc.Streams[1], LogIngest_WriteAcked_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[AckedEvent, Ack]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type LogIngest_WriteAckedClient = grpc.BidiStreamingClient[AckedEvent, Ack]
+
+// LogIngestServer is the server API for LogIngest service.
+// All implementations must embed UnimplementedLogIngestServer
+// for forward compatibility.
+//
+// LogIngest writes log events through the same validation, formatting and sinks
+// as POST /logs. Events failing validation are reported per event; sink failures
+// end the call with UNAVAILABLE (queue full), RESOURCE_EXHAUSTED (storage full)
+// or INTERNAL.
+type LogIngestServer interface {
+	// Write validates a batch of events and writes the valid ones together.
+	Write(context.Context, *WriteRequest) (*WriteSummary, error)
+	// WriteStream writes events as they arrive and answers with a summary once the
+	// client closes its side of the stream.
+	WriteStream(grpc.ClientStreamingServer[Event, WriteSummary]) error
+	// WriteAcked writes events as they arrive and acknowledges each one, echoing its
+	// id, once it has been written or rejected.
+	WriteAcked(grpc.BidiStreamingServer[AckedEvent, Ack]) error
+	mustEmbedUnimplementedLogIngestServer()
+}
+
+// UnimplementedLogIngestServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedLogIngestServer struct{}
+
+func (UnimplementedLogIngestServer) Write(context.Context, *WriteRequest) (*WriteSummary, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Write not implemented")
+}
+func (UnimplementedLogIngestServer) WriteStream(grpc.ClientStreamingServer[Event, WriteSummary]) error {
+	return status.Errorf(codes.Unimplemented, "method WriteStream not implemented")
+}
+func (UnimplementedLogIngestServer) WriteAcked(grpc.BidiStreamingServer[AckedEvent, Ack]) error {
+	return status.Errorf(codes.Unimplemented, "method WriteAcked not implemented")
+}
+func (UnimplementedLogIngestServer) mustEmbedUnimplementedLogIngestServer() {}
+func (UnimplementedLogIngestServer) testEmbeddedByValue()                   {}
+
+// UnsafeLogIngestServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to LogIngestServer will
+// result in compilation errors.
+type UnsafeLogIngestServer interface {
+	mustEmbedUnimplementedLogIngestServer()
+}
+
+func RegisterLogIngestServer(s grpc.ServiceRegistrar, srv LogIngestServer) {
+	// If the following call pancis, it indicates UnimplementedLogIngestServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&LogIngest_ServiceDesc, srv)
+}
+
+func _LogIngest_Write_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WriteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogIngestServer).Write(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LogIngest_Write_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogIngestServer).Write(ctx, req.(*WriteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LogIngest_WriteStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(LogIngestServer).WriteStream(&grpc.GenericServerStream[Event, WriteSummary]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type LogIngest_WriteStreamServer = grpc.ClientStreamingServer[Event, WriteSummary]
+
+func _LogIngest_WriteAcked_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(LogIngestServer).WriteAcked(&grpc.GenericServerStream[AckedEvent, Ack]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type LogIngest_WriteAckedServer = grpc.BidiStreamingServer[AckedEvent, Ack]
+
+// LogIngest_ServiceDesc is the grpc.ServiceDesc for LogIngest service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var LogIngest_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "logger.ingest.v1.LogIngest",
+	HandlerType: (*LogIngestServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Write",
+			Handler:    _LogIngest_Write_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WriteStream",
+			Handler:       _LogIngest_WriteStream_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "WriteAcked",
+			Handler:       _LogIngest_WriteAcked_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "logger/ingest/v1/ingest.proto",
+}
@@ -0,0 +1,166 @@
+// Package grpcapi serves the LogIngest gRPC service defined in
+// proto/logger/ingest/v1/ingest.proto.
+package grpcapi
+
+//go:generate protoc -I ../../proto --go_out=../.. --go_opt=module=logger --go-grpc_out=../.. --go-grpc_opt=module=logger logger/ingest/v1/ingest.proto
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"logger/internal/grpcapi/ingestpb"
+	"logger/internal/ingest"
+	"logger/internal/model"
+	"logger/internal/sink"
+)
+
+// IngestServer implements the LogIngest service on top of an ingest pipeline.
+type IngestServer struct {
+	ingestpb.UnimplementedLogIngestServer
+
+	pipeline *ingest.Pipeline
+}
+
+// NewIngestServer creates an IngestServer writing to p.
+func NewIngestServer(p *ingest.Pipeline) *IngestServer {
+	return &IngestServer{pipeline: p}
+}
+
+// Write validates the events of the request and writes the valid ones together.
+func (s *IngestServer) Write(ctx context.Context, req *ingestpb.WriteRequest) (*ingestpb.WriteSummary, error) {
+	if len(req.GetEvents()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "batch must contain at least one event")
+	}
+
+	summary := &ingestpb.WriteSummary{}
+	records := make([]sink.EventRecord, 0, len(req.GetEvents()))
+	for i, ev := range req.GetEvents() {
+		rec, err := s.pipeline.Record(payload(ev))
+		if err != nil {
+			summary.Errors = append(summary.Errors, &ingestpb.EventError{Index: int64(i), Error: err.Error()})
+			continue
+		}
+		records = append(records, rec)
+	}
+	if err := s.pipeline.Write(ctx, records); err != nil {
+		return nil, sinkError(err)
+	}
+	summary.Accepted = int64(len(records))
+	summary.Rejected = int64(len(summary.Errors))
+	return summary, nil
+}
+
+// WriteStream writes each event as soon as it is received, like NDJSON streaming
+// on POST /logs, and answers with a summary when the client closes the stream.
+// When the sink fails the call ends with an error; the events before the failing
+// one were written.
+func (s *IngestServer) WriteStream(stream ingestpb.LogIngest_WriteStreamServer) error {
+	summary := &ingestpb.WriteSummary{}
+	for index := int64(0); ; index++ {
+		ev, err := stream.Recv()
+		if err == io.EOF {
+			summary.Rejected = int64(len(summary.Errors))
+			return stream.SendAndClose(summary)
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.write(stream.Context(), ev); err != nil {
+			if isRejected(err) {
+				summary.Errors = append(summary.Errors, &ingestpb.EventError{Index: index, Error: err.Error()})
+				continue
+			}
+			return err
+		}
+		summary.Accepted++
+	}
+}
+
+// WriteAcked writes each event as soon as it is received and acknowledges it with
+// its id: accepted once durable (see sink.WithDurableWrite), or with the reason it
+// was rejected. When the
+// sink fails the call ends with an error and the event is not acknowledged, so
+// clients resend the events they hold no Ack for.
+func (s *IngestServer) WriteAcked(stream ingestpb.LogIngest_WriteAckedServer) error {
+	// The client drops its copy of an event once it is acknowledged.
+	ctx := sink.WithDurableWrite(stream.Context())
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		ack := &ingestpb.Ack{Id: req.GetId(), Accepted: true}
+		if err := s.write(ctx, req.GetEvent()); err != nil {
+			if !isRejected(err) {
+				return err
+			}
+			ack.Accepted, ack.Error = false, err.Error()
+		}
+		if err := stream.Send(ack); err != nil {
+			return err
+		}
+	}
+}
+
+// rejectedError is an event failing validation, as opposed to a sink failure.
+type rejectedError struct {
+	err error
+}
+
+func (e rejectedError) Error() string { return e.err.Error() }
+
+func isRejected(err error) bool {
+	var r rejectedError
+	return errors.As(err, &r)
+}
+
+// write validates and writes one event. It returns a rejectedError when the event
+// is invalid and a gRPC status error when the sink fails.
+func (s *IngestServer) write(ctx context.Context, ev *ingestpb.Event) error {
+	rec, err := s.pipeline.Record(payload(ev))
+	if err != nil {
+		return rejectedError{err}
+	}
+	if err := s.pipeline.Write(ctx, []sink.EventRecord{rec}); err != nil {
+		return sinkError(err)
+	}
+	return nil
+}
+
+// payload converts an Event message to the payload validated by ToEvent.
+func payload(ev *ingestpb.Event) model.EventPayload {
+	p := model.EventPayload{
+		Timestamp: ev.GetTimestamp(),
+		Level:     ev.GetLevel(),
+		Message:   ev.GetMessage(),
+		User:      ev.GetUser(),
+		App:       ev.GetApp(),
+	}
+	if f := ev.GetFields(); len(f.GetFields()) > 0 {
+		p.Fields = f.AsMap()
+	}
+	return p
+}
+
+// sinkError maps a sink write error to a gRPC status, as sinkErrorStatus does to
+// HTTP statuses: a full queue is UNAVAILABLE, so clients retry, full storage is
+// RESOURCE_EXHAUSTED and anything else INTERNAL.
+func sinkError(err error) error {
+	switch {
+	case errors.Is(err, sink.ErrQueueFull):
+		return status.Error(codes.Unavailable, "log queue is full, retry later")
+	case errors.Is(err, sink.ErrDiskFull):
+		return status.Error(codes.ResourceExhausted, "log storage is full")
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	default:
+		return status.Error(codes.Internal, "failed to write log")
+	}
+}
@@ -0,0 +1,184 @@
+package grpcapi
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"logger/internal/format"
+	"logger/internal/grpcapi/ingestpb"
+	"logger/internal/ingest"
+	"logger/internal/ingest/ingesttest"
+	"logger/internal/sink"
+)
+
+func newClient(t *testing.T, s sink.EventSink) ingestpb.LogIngestClient {
+	t.Helper()
+	ln := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	ingestpb.RegisterLogIngestServer(gs, NewIngestServer(&ingest.Pipeline{Sink: s, Formatter: format.JSONFormatter{}}))
+	go gs.Serve(ln)
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ln.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return ingestpb.NewLogIngestClient(conn)
+}
+
+func event(msg string, age time.Duration) *ingestpb.Event {
+	return &ingestpb.Event{Timestamp: time.Now().Add(-age).UTC().Format(time.RFC3339), Level: "info", Message: msg, App: "svc"}
+}
+
+func TestIngestServer_Write(t *testing.T) {
+	fs := &ingesttest.Sink{}
+	client := newClient(t, fs)
+
+	fields, _ := structpb.NewStruct(map[string]any{"attempt": 3, "tags": []any{"a", "b"}, "ok": true})
+	first := event("typed fields", 0)
+	first.Fields, first.User, first.Level = fields, "alice", "warn"
+
+	summary, err := client.Write(context.Background(), &ingestpb.WriteRequest{Events: []*ingestpb.Event{
+		first,
+		event("stale", 5*24*time.Hour),
+		{Timestamp: time.Now().UTC().Format(time.RFC3339), Level: "loud", Message: "x"},
+	}})
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if summary.Accepted != 1 || summary.Rejected != 2 || summary.Errors[0].Index != 1 || summary.Errors[1].Index != 2 {
+		t.Fatalf("unexpected summary %v", summary)
+	}
+	if !strings.Contains(summary.Errors[0].Error, "3-day window") || !strings.Contains(summary.Errors[1].Error, "level") {
+		t.Fatalf("unexpected errors %v", summary.Errors)
+	}
+
+	lines := fs.Lines()
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 line, got %q", lines)
+	}
+	for _, want := range []string{`"level":"warn"`, `"user":"alice"`, `"app":"svc"`, `"attempt":3`, `"tags":["a","b"]`, `"ok":true`} {
+		if !strings.Contains(lines[0], want) {
+			t.Fatalf("expected %s in %s", want, lines[0])
+		}
+	}
+
+	if _, err := client.Write(context.Background(), &ingestpb.WriteRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for an empty batch, got %v", err)
+	}
+}
+
+func TestIngestServer_WriteStream(t *testing.T) {
+	fs := &ingesttest.Sink{}
+	client := newClient(t, fs)
+
+	stream, err := client.WriteStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ev := range []*ingestpb.Event{event("one", 0), event("stale", 5*24*time.Hour), event("two", 0)} {
+		if err := stream.Send(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	summary, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("WriteStream failed: %v", err)
+	}
+	if summary.Accepted != 2 || summary.Rejected != 1 || summary.Errors[0].Index != 1 {
+		t.Fatalf("unexpected summary %v", summary)
+	}
+	if len(fs.Lines()) != 2 {
+		t.Fatalf("expected 2 lines, got %q", fs.Lines())
+	}
+}
+
+func TestIngestServer_WriteAcked(t *testing.T) {
+	fs := &ingesttest.Sink{}
+	client := newClient(t, fs)
+
+	stream, err := client.WriteAcked(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, ev := range []*ingestpb.Event{event("one", 0), event("stale", 5*24*time.Hour)} {
+		if err := stream.Send(&ingestpb.AckedEvent{Id: uint64(100 + id), Event: ev}); err != nil {
+			t.Fatal(err)
+		}
+		ack, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		if ack.Id != uint64(100+id) || ack.Accepted != (id == 0) || (id == 1 && ack.Error == "") {
+			t.Fatalf("unexpected ack %v", ack)
+		}
+	}
+	stream.CloseSend()
+	if _, err := stream.Recv(); err == nil {
+		t.Fatal("expected the stream to end")
+	}
+}
+
+func TestIngestServer_WriteAckedWaitsForAsyncWrites(t *testing.T) {
+	dir := t.TempDir()
+	fs, err := sink.NewFileSink(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	as := sink.NewAsyncSink(fs, sink.AsyncConfig{FlushInterval: 50 * time.Millisecond})
+	defer as.Close()
+
+	stream, err := newClient(t, sink.AsEventSink(as, format.JSONFormatter{})).WriteAcked(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The sink has no journal, so the event may only be acknowledged once it is on disk.
+	if err := stream.Send(&ingestpb.AckedEvent{Id: 1, Event: event("acked", 0)}); err != nil {
+		t.Fatal(err)
+	}
+	if ack, err := stream.Recv(); err != nil || !ack.Accepted {
+		t.Fatalf("expected an accepted ack, got %v, %v", ack, err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, time.Now().UTC().Format("2006-01-02")+".log"))
+	if err != nil || !strings.Contains(string(content), "acked") {
+		t.Fatalf("expected the acknowledged event on disk, got %q, %v", content, err)
+	}
+}
+
+func TestIngestServer_SinkErrors(t *testing.T) {
+	for sinkErr, want := range map[error]codes.Code{
+		sink.ErrQueueFull:          codes.Unavailable,
+		sink.ErrDiskFull:           codes.ResourceExhausted,
+		fmt.Errorf("disk on fire"): codes.Internal,
+	} {
+		client := newClient(t, &ingesttest.Sink{Err: sinkErr})
+		if _, err := client.Write(context.Background(), &ingestpb.WriteRequest{Events: []*ingestpb.Event{event("x", 0)}}); status.Code(err) != want {
+			t.Fatalf("%v: expected %v, got %v", sinkErr, want, err)
+		}
+
+		stream, err := client.WriteAcked(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream.Send(&ingestpb.AckedEvent{Id: 1, Event: event("x", 0)})
+		if ack, err := stream.Recv(); status.Code(err) != want {
+			t.Fatalf("%v: expected the stream to end with %v, got %v, %v", sinkErr, want, ack, err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package httpapi
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxBodyBytes bounds a request body of the bulk ingest endpoints, both as sent
+// and after decompression, so a small gzip body cannot expand without limit.
+const maxBodyBytes = 64 << 20
+
+// errBodyTooLarge is returned by reads past maxBodyBytes of decompressed body.
+var errBodyTooLarge = fmt.Errorf("request body larger than %d bytes", maxBodyBytes)
+
+// requestBody caps r.Body at maxBodyBytes and returns a reader of the body,
+// decompressed when gzipped is set. The error is that of gzip.NewReader. Reads past
+// the limit fail, which isBodyTooLarge recognises.
+func requestBody(w http.ResponseWriter, r *http.Request, gzipped bool) (io.Reader, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	if !gzipped {
+		return r.Body, nil
+	}
+	gz, err := gzip.NewReader(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &limitedReader{r: gz, n: maxBodyBytes}, nil
+}
+
+// isBodyTooLarge reports whether err comes from reading past maxBodyBytes.
+func isBodyTooLarge(err error) bool {
+	var tooLarge *http.MaxBytesError
+	return errors.Is(err, errBodyTooLarge) || errors.As(err, &tooLarge)
+}
+
+// limitedReader reads at most n bytes from r, like io.LimitReader, but fails with
+// errBodyTooLarge instead of ending quietly when r holds more.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	// Read one byte past the limit to tell a body of exactly n bytes from a longer one.
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n + int(l.n), errBodyTooLarge
+	}
+	return n, err
+}
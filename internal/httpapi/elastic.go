@@ -0,0 +1,292 @@
+package httpapi
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"logger/internal/ingest"
+	"logger/internal/model"
+	"logger/internal/sink"
+)
+
+// elasticVersion is the Elasticsearch version reported by GetElasticInfo. Beats
+// and the 8.x clients refuse to send to a server reporting an older major version.
+const elasticVersion = "8.11.0"
+
+// bulkAction is the metadata of one action line of an Elasticsearch bulk request.
+type bulkAction struct {
+	Index string `json:"_index"`
+	ID    string `json:"_id"`
+}
+
+// bulkItemError is the error object of a failed bulk item.
+type bulkItemError struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// bulkItem is the outcome of one action, keyed by its action name in the response.
+type bulkItem struct {
+	Index       string         `json:"_index"`
+	ID          string         `json:"_id"`
+	Status      int            `json:"status"`
+	Result      string         `json:"result,omitempty"`
+	Version     int            `json:"_version,omitempty"`
+	SeqNo       *int           `json:"_seq_no,omitempty"`
+	PrimaryTerm int            `json:"_primary_term,omitempty"`
+	Error       *bulkItemError `json:"error,omitempty"`
+}
+
+// bulkResponse is the response body of the bulk API.
+type bulkResponse struct {
+	Took   int64                 `json:"took"`
+	Errors bool                  `json:"errors"`
+	Items  []map[string]bulkItem `json:"items"`
+}
+
+// PostElasticBulk handles POST /_bulk and POST /{index}/_bulk, the Elasticsearch
+// bulk API used by Beats and Logstash. The body is NDJSON: an action line followed,
+// for index and create, by the document. Documents are mapped to events (see
+// elasticPayload) and written together; like Elasticsearch, the server answers 200
+// with a status per item, and items that fail validation are reported there.
+// update and delete actions are rejected per item: the store is append-only.
+func (h *LoggerHandler) PostElasticBulk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer r.Body.Close()
+	start := time.Now()
+
+	body, err := requestBody(w, r, strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip"))
+	if err != nil {
+		writeElasticError(w, http.StatusBadRequest, "parse_exception", "invalid gzip body")
+		return
+	}
+	defaultIndex := strings.Trim(strings.TrimSuffix(r.URL.Path, "/_bulk"), "/")
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxNDJSONLineBytes)
+	nextLine := func() ([]byte, bool) {
+		for scanner.Scan() {
+			if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+				return line, true
+			}
+		}
+		return nil, false
+	}
+	// tooLarge answers 413 when the body ended because it exceeded maxBodyBytes.
+	tooLarge := func() bool {
+		if err := scanner.Err(); isBodyTooLarge(err) {
+			writeElasticError(w, http.StatusRequestEntityTooLarge, "content_too_long_exception", err.Error())
+			return true
+		}
+		return false
+	}
+
+	p := &ingest.Pipeline{Sink: h.Sink, Formatter: h.Formatter}
+	resp := bulkResponse{Items: []map[string]bulkItem{}}
+	var records []sink.EventRecord
+	var written []int // indexes into resp.Items of the records
+	for {
+		line, ok := nextLine()
+		if !ok {
+			break
+		}
+		var action map[string]bulkAction
+		if err := json.Unmarshal(line, &action); err != nil || len(action) != 1 {
+			writeElasticError(w, http.StatusBadRequest, "illegal_argument_exception", fmt.Sprintf("Malformed action/metadata line [%d], expected a single action object", len(resp.Items)+1))
+			return
+		}
+		var name string
+		var meta bulkAction
+		for n, m := range action {
+			name, meta = n, m
+		}
+		if meta.Index == "" {
+			meta.Index = defaultIndex
+		}
+		if meta.ID == "" {
+			meta.ID = newBulkID()
+		}
+		item := bulkItem{Index: meta.Index, ID: meta.ID}
+
+		switch name {
+		case "index", "create", "update":
+			doc, ok := nextLine()
+			if !ok {
+				if tooLarge() {
+					return
+				}
+				writeElasticError(w, http.StatusBadRequest, "illegal_argument_exception", "The bulk request must be terminated by a newline [\\n]")
+				return
+			}
+			if name == "update" {
+				item.Status, item.Error = http.StatusBadRequest, &bulkItemError{Type: "illegal_argument_exception", Reason: "update is not supported: events are append-only"}
+				break
+			}
+			var fields map[string]any
+			dec := json.NewDecoder(bytes.NewReader(doc))
+			dec.UseNumber()
+			if err := dec.Decode(&fields); err != nil {
+				item.Status, item.Error = http.StatusBadRequest, &bulkItemError{Type: "document_parsing_exception", Reason: "failed to parse document: " + err.Error()}
+				break
+			}
+			payload := elasticPayload(fields)
+			applyQueryApp(&payload, r)
+			rec, err := p.Record(payload)
+			if err != nil {
+				item.Status, item.Error = http.StatusBadRequest, &bulkItemError{Type: "document_parsing_exception", Reason: err.Error()}
+				break
+			}
+			records = append(records, rec)
+			written = append(written, len(resp.Items))
+		case "delete":
+			item.Status, item.Error = http.StatusBadRequest, &bulkItemError{Type: "illegal_argument_exception", Reason: "delete is not supported: events are append-only"}
+		default:
+			writeElasticError(w, http.StatusBadRequest, "illegal_argument_exception", fmt.Sprintf("Malformed action/metadata line [%d], expected one of [create, delete, index, update] but found [%s]", len(resp.Items)+1, name))
+			return
+		}
+		if item.Error != nil {
+			resp.Errors = true
+		}
+		resp.Items = append(resp.Items, map[string]bulkItem{name: item})
+	}
+	if tooLarge() {
+		return
+	}
+	if err := scanner.Err(); err != nil {
+		writeElasticError(w, http.StatusBadRequest, "parse_exception", "failed to read bulk body: "+err.Error())
+		return
+	}
+	if len(resp.Items) == 0 {
+		writeElasticError(w, http.StatusBadRequest, "action_request_validation_exception", "Validation Failed: 1: no requests added;")
+		return
+	}
+
+	// Nothing is written when the sink fails, so the whole request can be retried.
+	if err := p.Write(r.Context(), records); err != nil {
+		status, msg := sinkErrorStatus(err)
+		if status == http.StatusServiceUnavailable {
+			status = http.StatusTooManyRequests // what Beats and Logstash back off on
+		}
+		writeElasticError(w, status, "es_rejected_execution_exception", msg)
+		return
+	}
+	for seq, i := range written {
+		for name, item := range resp.Items[i] {
+			item.Status, item.Result, item.Version, item.SeqNo, item.PrimaryTerm = http.StatusCreated, "created", 1, &seq, 1
+			resp.Items[i][name] = item
+		}
+	}
+
+	resp.Took = time.Since(start).Milliseconds()
+	writeElastic(w, http.StatusOK, resp)
+}
+
+// GetElasticInfo handles GET / and HEAD /, the info request with which Beats,
+// Logstash and the Elasticsearch clients check the server before sending bulk
+// requests. It reports elasticVersion; like every Elasticsearch response it carries
+// X-Elastic-Product, which the 8.x clients require.
+func (h *LoggerHandler) GetElasticInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodHead {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	writeElastic(w, http.StatusOK, map[string]any{
+		"name":         "logger",
+		"cluster_name": "logger",
+		"version": map[string]any{
+			"number":                              elasticVersion,
+			"build_flavor":                        "default",
+			"minimum_wire_compatibility_version":  "7.17.0",
+			"minimum_index_compatibility_version": "7.0.0",
+		},
+		"tagline": "You Know, for Search",
+	})
+}
+
+// elasticPayload maps an ECS document to an event payload: @timestamp, log.level,
+// message, service.name and user.name, each either dotted or nested, become the
+// payload fields, and the remaining keys the event fields. A numeric @timestamp is
+// read as epoch milliseconds; a missing level is info.
+func elasticPayload(doc map[string]any) model.EventPayload {
+	var p model.EventPayload
+	switch ts := takeElasticField(doc, "@timestamp").(type) {
+	case string:
+		p.Timestamp = ts
+	case json.Number:
+		if ms, err := ts.Int64(); err == nil {
+			p.Timestamp = time.UnixMilli(ms).UTC().Format(time.RFC3339Nano)
+		} else {
+			p.Timestamp = ts.String()
+		}
+	}
+	p.Level = string(model.LevelInfo)
+	if s, ok := takeElasticField(doc, "log.level").(string); ok {
+		p.Level = s
+		if level, ok := ingest.ParseLevel(s); ok {
+			p.Level = string(level)
+		}
+	}
+	p.Message, _ = takeElasticField(doc, "message").(string)
+	p.App, _ = takeElasticField(doc, "service.name").(string)
+	p.User, _ = takeElasticField(doc, "user.name").(string)
+	if len(doc) > 0 {
+		p.Fields = doc
+	}
+	return p
+}
+
+// takeElasticField removes the value at path from doc and returns it. The path is
+// looked up as a dotted key first, then through nested objects; objects left empty
+// by the removal are removed too.
+func takeElasticField(doc map[string]any, path string) any {
+	if v, ok := doc[path]; ok {
+		delete(doc, path)
+		return v
+	}
+	head, rest, ok := strings.Cut(path, ".")
+	if !ok {
+		return nil
+	}
+	child, ok := doc[head].(map[string]any)
+	if !ok {
+		return nil
+	}
+	v := takeElasticField(child, rest)
+	if len(child) == 0 {
+		delete(doc, head)
+	}
+	return v
+}
+
+// newBulkID returns a random document ID in the style of Elasticsearch's.
+func newBulkID() string {
+	var b [15]byte
+	_, _ = rand.Read(b[:])
+	return base64.RawURLEncoding.EncodeToString(b[:])
+}
+
+// writeElastic writes an Elasticsearch response body with the product header.
+func writeElastic(w http.ResponseWriter, status int, payload any) {
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+	writeJSON(w, status, payload)
+}
+
+// writeElasticError writes an Elasticsearch request-level error.
+func writeElasticError(w http.ResponseWriter, status int, errType, reason string) {
+	writeElastic(w, status, map[string]any{
+		"error":  bulkItemError{Type: errType, Reason: reason},
+		"status": status,
+	})
+}
@@ -0,0 +1,178 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"logger/internal/format"
+)
+
+func postBulk(h *LoggerHandler, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	rr := httptest.NewRecorder()
+	h.PostElasticBulk(rr, req)
+	return rr
+}
+
+func TestPostElasticBulk_MapsECSDocuments(t *testing.T) {
+	fs := &fakeSink{}
+	h := NewLoggerHandlerWithFormat(fs, format.JSONFormatter{})
+
+	now := time.Now().UTC()
+	body := fmt.Sprintf(`{"index":{"_id":"a1"}}
+{"@timestamp":%q,"log":{"level":"WARNING","logger":"db"},"message":"slow query","service":{"name":"orders"},"user":{"name":"alice"},"host":{"name":"web-1"}}
+{"create":{"_index":"other"}}
+{"@timestamp":%d,"log.level":"error","message":"boom","service.name":"billing"}
+`, now.Format(time.RFC3339Nano), now.UnixMilli())
+
+	rr := postBulk(h, "/logs-app/_bulk", body)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp bulkResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Errors || len(resp.Items) != 2 {
+		t.Fatalf("unexpected response %s", rr.Body.String())
+	}
+	first, second := resp.Items[0]["index"], resp.Items[1]["create"]
+	if first.Status != http.StatusCreated || first.ID != "a1" || first.Index != "logs-app" || first.Result != "created" {
+		t.Fatalf("unexpected first item %+v", first)
+	}
+	if second.Status != http.StatusCreated || second.Index != "other" || second.ID == "" {
+		t.Fatalf("unexpected second item %+v", second)
+	}
+
+	if len(fs.lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", fs.lines)
+	}
+	for _, want := range []string{`"level":"warn"`, `"message":"slow query"`, `"app":"orders"`, `"user":"alice"`, `"log":{"logger":"db"}`, `"host":{"name":"web-1"}`} {
+		if !strings.Contains(fs.lines[0], want) {
+			t.Fatalf("expected %s in %s", want, fs.lines[0])
+		}
+	}
+	if strings.Contains(fs.lines[0], `"service"`) || strings.Contains(fs.lines[0], `"user":{`) {
+		t.Fatalf("expected mapped keys to be removed from the fields, got %s", fs.lines[0])
+	}
+	for _, want := range []string{`"level":"error"`, `"app":"billing"`} {
+		if !strings.Contains(fs.lines[1], want) {
+			t.Fatalf("expected %s in %s", want, fs.lines[1])
+		}
+	}
+	if !fs.timestamps[1].Equal(time.UnixMilli(now.UnixMilli()).UTC()) {
+		t.Fatalf("expected the epoch-millis timestamp to be read, got %v", fs.timestamps[1])
+	}
+}
+
+func TestPostElasticBulk_PerItemErrors(t *testing.T) {
+	fs := &fakeSink{}
+	h := NewLoggerHandler(fs)
+
+	body := fmt.Sprintf(`{"index":{}}
+{"@timestamp":%q,"message":"ok"}
+{"index":{}}
+{"@timestamp":%q,"message":"stale"}
+{"index":{}}
+not json
+{"delete":{"_id":"x"}}
+{"update":{"_id":"y"}}
+{"doc":{"message":"changed"}}
+`, time.Now().UTC().Format(time.RFC3339), time.Now().AddDate(0, 0, -5).UTC().Format(time.RFC3339))
+
+	rr := postBulk(h, "/_bulk", body)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp bulkResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Errors || len(resp.Items) != 5 {
+		t.Fatalf("unexpected response %s", rr.Body.String())
+	}
+	wantStatus := []int{201, 400, 400, 400, 400}
+	for i, item := range resp.Items {
+		for _, it := range item {
+			if it.Status != wantStatus[i] {
+				t.Fatalf("item %d: expected status %d, got %+v", i, wantStatus[i], it)
+			}
+			if it.Status != http.StatusCreated && (it.Error == nil || it.Error.Reason == "") {
+				t.Fatalf("item %d: expected an error, got %+v", i, it)
+			}
+		}
+	}
+	if len(fs.lines) != 1 {
+		t.Fatalf("expected only the valid document to be written, got %q", fs.lines)
+	}
+}
+
+func TestPostElasticBulk_RequestErrors(t *testing.T) {
+	h := NewLoggerHandler(&fakeSink{})
+	for name, body := range map[string]string{
+		"empty":          "",
+		"bad action":     "{\"index\":{}\n",
+		"unknown action": "{\"upsert\":{}}\n{}\n",
+		"missing doc":    "{\"index\":{}}\n",
+	} {
+		if rr := postBulk(h, "/_bulk", body); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), `"status":400`) {
+			t.Fatalf("%s: expected an Elasticsearch 400 error, got %d: %s", name, rr.Code, rr.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/_bulk", bytes.NewReader(gzipBomb()))
+	req.Header.Set("Content-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	h.PostElasticBulk(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge || !strings.Contains(rr.Body.String(), `"status":413`) {
+		t.Fatalf("expected an Elasticsearch 413 error, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	h = NewLoggerHandler(&fakeSink{err: fmt.Errorf("disk on fire")})
+	body := fmt.Sprintf("{\"index\":{}}\n{\"@timestamp\":%q,\"message\":\"x\"}\n", time.Now().UTC().Format(time.RFC3339))
+	if rr := postBulk(h, "/_bulk", body); rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rr.Code)
+	}
+}
+
+func TestGetElasticInfo(t *testing.T) {
+	h := NewLoggerHandler(&fakeSink{})
+
+	rr := httptest.NewRecorder()
+	h.GetElasticInfo(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if got := rr.Header().Get("X-Elastic-Product"); got != "Elasticsearch" {
+		t.Fatalf("expected the X-Elastic-Product header, got %q", got)
+	}
+	var info struct {
+		Version struct {
+			Number string `json:"number"`
+		} `json:"version"`
+		Tagline string `json:"tagline"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &info); err != nil {
+		t.Fatalf("invalid response %s: %v", rr.Body.String(), err)
+	}
+	if !strings.HasPrefix(info.Version.Number, "8.") || info.Tagline == "" {
+		t.Fatalf("expected an 8.x version and a tagline, got %s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	h.GetElasticInfo(rr, httptest.NewRequest(http.MethodHead, "/", nil))
+	if rr.Code != http.StatusOK || rr.Body.Len() != 0 || rr.Header().Get("X-Elastic-Product") != "Elasticsearch" {
+		t.Fatalf("expected an empty 200 with the product header, got %d %q %v", rr.Code, rr.Body.String(), rr.Header())
+	}
+
+	if rr := postBulk(h, "/_bulk", ""); rr.Header().Get("X-Elastic-Product") != "Elasticsearch" {
+		t.Fatalf("expected the product header on bulk responses, got %v", rr.Header())
+	}
+}
@@ -2,6 +2,7 @@ package httpapi
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 
@@ -12,15 +13,28 @@ import (
 
 // LoggerHandler handles log ingestion over HTTP.
 type LoggerHandler struct {
-	Sink sink.Sink
+	Sink sink.EventSink
+	// Formatter pre-renders accepted events, so that formatting errors are
+	// reported before anything is written. Sinks formatting with the same
+	// formatter write the pre-rendered lines; others format events themselves.
+	Formatter format.Formatter
 }
 
-// NewLoggerHandler constructs a LoggerHandler.
+// NewLoggerHandler constructs a LoggerHandler that writes the text format.
 func NewLoggerHandler(s sink.Sink) *LoggerHandler {
-	return &LoggerHandler{Sink: s}
+	return NewLoggerHandlerWithFormat(s, format.TextFormatter{})
+}
+
+// NewLoggerHandlerWithFormat constructs a LoggerHandler that pre-renders events
+// with f. Line-based sinks are wrapped with sink.AsEventSink, so they write f's
+// format.
+func NewLoggerHandlerWithFormat(s sink.Sink, f format.Formatter) *LoggerHandler {
+	return &LoggerHandler{Sink: sink.AsEventSink(s, f), Formatter: f}
 }
 
 // PostLog handles POST /logs.
+// A Content-Type of application/x-ndjson switches to streaming mode, where the body
+// is a sequence of newline-delimited events (see postLogStream).
 func (h *LoggerHandler) PostLog(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -28,8 +42,12 @@ func (h *LoggerHandler) PostLog(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ct := r.Header.Get("Content-Type")
+	if isNDJSON(ct) {
+		h.postLogStream(w, r)
+		return
+	}
 	if ct == "" || !strings.HasPrefix(strings.ToLower(ct), "application/json") {
-		writeJSONError(w, http.StatusBadRequest, "Content-Type must be application/json")
+		writeJSONError(w, http.StatusBadRequest, "Content-Type must be application/json or application/x-ndjson")
 		return
 	}
 
@@ -41,13 +59,7 @@ func (h *LoggerHandler) PostLog(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// If app is not in the JSON body, try to get it from the query parameter
-	if payload.App == "" {
-		queryApp := strings.TrimSpace(r.URL.Query().Get("app"))
-		if queryApp != "" {
-			payload.App = queryApp
-		}
-	}
+	applyQueryApp(&payload, r)
 
 	ev, err := payload.ToEvent()
 	if err != nil {
@@ -55,21 +67,132 @@ func (h *LoggerHandler) PostLog(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	line, err := format.FormatEvent(ev)
+	line, err := h.Formatter.Format(ev)
 	if err != nil {
 		writeJSONError(w, http.StatusInternalServerError, "failed to format event")
 		return
 	}
 
-	// Pass the timestamp to the sink for message-timestamp-based routing
-	if err := h.Sink.WriteLine(r.Context(), line, ev.Timestamp); err != nil {
-		writeJSONError(w, http.StatusInternalServerError, "failed to write log")
+	if err := h.Sink.WriteEvents(r.Context(), []sink.EventRecord{h.eventRecord(ev, line)}); err != nil {
+		status, msg := sinkErrorStatus(err)
+		writeJSONError(w, status, msg)
 		return
 	}
 
 	writeJSON(w, http.StatusAccepted, map[string]string{"status": "ok"})
 }
 
+// batchError describes a single rejected event within a batch.
+type batchError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// batchResult is the response body for POST /logs/batch.
+type batchResult struct {
+	Accepted int          `json:"accepted"`
+	Rejected int          `json:"rejected"`
+	Errors   []batchError `json:"errors,omitempty"`
+}
+
+// PostLogBatch handles POST /logs/batch.
+// The body is a JSON array of events; each event is validated independently.
+// Valid events are written to the sink in one pass, and the response lists the
+// index and error of every rejected event (207 Multi-Status if any were rejected).
+func (h *LoggerHandler) PostLogBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ct := r.Header.Get("Content-Type")
+	if ct == "" || !strings.HasPrefix(strings.ToLower(ct), "application/json") {
+		writeJSONError(w, http.StatusBadRequest, "Content-Type must be application/json")
+		return
+	}
+
+	defer r.Body.Close()
+
+	// Decode elements lazily so a malformed event rejects only itself.
+	var raw []json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body: expected an array of events")
+		return
+	}
+	if len(raw) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "batch must contain at least one event")
+		return
+	}
+
+	result := batchResult{}
+	records := make([]sink.EventRecord, 0, len(raw))
+	for i, msg := range raw {
+		var payload model.EventPayload
+		if err := json.Unmarshal(msg, &payload); err != nil {
+			result.Errors = append(result.Errors, batchError{Index: i, Error: "invalid JSON event"})
+			continue
+		}
+		applyQueryApp(&payload, r)
+
+		ev, err := payload.ToEvent()
+		if err != nil {
+			result.Errors = append(result.Errors, batchError{Index: i, Error: err.Error()})
+			continue
+		}
+
+		line, err := h.Formatter.Format(ev)
+		if err != nil {
+			result.Errors = append(result.Errors, batchError{Index: i, Error: "failed to format event"})
+			continue
+		}
+		records = append(records, h.eventRecord(ev, line))
+	}
+
+	if len(records) > 0 {
+		if err := h.Sink.WriteEvents(r.Context(), records); err != nil {
+			status, msg := sinkErrorStatus(err)
+			writeJSONError(w, status, msg)
+			return
+		}
+	}
+
+	result.Accepted = len(records)
+	result.Rejected = len(result.Errors)
+
+	status := http.StatusAccepted
+	if result.Rejected > 0 {
+		status = http.StatusMultiStatus
+	}
+	writeJSON(w, status, result)
+}
+
+// applyQueryApp fills payload.App from the ?app= query parameter when the body has none.
+func applyQueryApp(payload *model.EventPayload, r *http.Request) {
+	if payload.App != "" {
+		return
+	}
+	queryApp := strings.TrimSpace(r.URL.Query().Get("app"))
+	if queryApp != "" {
+		payload.App = queryApp
+	}
+}
+
+// eventRecord pairs an event with the line h.Formatter rendered for it.
+func (h *LoggerHandler) eventRecord(ev model.Event, line string) sink.EventRecord {
+	return sink.EventRecord{Event: ev, Rendered: []byte(line), RenderedBy: h.Formatter}
+}
+
+// sinkErrorStatus maps a sink write error to an HTTP status and client-facing message.
+func sinkErrorStatus(err error) (int, string) {
+	if errors.Is(err, sink.ErrQueueFull) {
+		return http.StatusServiceUnavailable, "log queue is full, retry later"
+	}
+	if errors.Is(err, sink.ErrDiskFull) {
+		return http.StatusInsufficientStorage, "log storage is full"
+	}
+	return http.StatusInternalServerError, "failed to write log"
+}
+
 func writeJSON(w http.ResponseWriter, status int, payload any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
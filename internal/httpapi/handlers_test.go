@@ -3,10 +3,14 @@ package httpapi
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
+
+	"logger/internal/format"
+	"logger/internal/sink"
 )
 
 type fakeSink struct {
@@ -149,3 +153,138 @@ func TestPostLog_OutsideWindow(t *testing.T) {
 	}
 }
 
+
+func TestPostLogBatch_PartialSuccess(t *testing.T) {
+	fs := &fakeSink{}
+	h := NewLoggerHandler(fs)
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	body := []byte(`[
+		{"timestamp": "` + now + `", "level": "info", "message": "first"},
+		{"timestamp": "` + now + `", "level": "bogus", "message": "bad level"},
+		{"timestamp": "` + now + `", "level": "warn", "message": "second"},
+		"not an event"
+	]`)
+
+	req := httptest.NewRequest(http.MethodPost, "/logs/batch?app=batchapp", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	h.PostLogBatch(rr, req)
+
+	if rr.Code != http.StatusMultiStatus {
+		t.Fatalf("expected status %d, got %d", http.StatusMultiStatus, rr.Code)
+	}
+
+	var result batchResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if result.Accepted != 2 || result.Rejected != 2 {
+		t.Fatalf("expected 2 accepted and 2 rejected, got %+v", result)
+	}
+	if result.Errors[0].Index != 1 || result.Errors[1].Index != 3 {
+		t.Fatalf("unexpected error indexes: %+v", result.Errors)
+	}
+
+	if len(fs.lines) != 2 {
+		t.Fatalf("expected 2 lines written, got %d", len(fs.lines))
+	}
+	if !bytes.Contains([]byte(fs.lines[0]), []byte("[batchapp]")) {
+		t.Fatalf("expected app [batchapp] in line, got: %s", fs.lines[0])
+	}
+}
+
+func TestPostLogBatch_AllAccepted(t *testing.T) {
+	fs := &fakeSink{}
+	h := NewLoggerHandler(fs)
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	body := []byte(`[{"timestamp": "` + now + `", "level": "info", "message": "only"}]`)
+
+	req := httptest.NewRequest(http.MethodPost, "/logs/batch", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	h.PostLogBatch(rr, req)
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d", http.StatusAccepted, rr.Code)
+	}
+	if len(fs.lines) != 1 {
+		t.Fatalf("expected 1 line written, got %d", len(fs.lines))
+	}
+}
+
+func TestPostLogBatch_NotAnArray(t *testing.T) {
+	fs := &fakeSink{}
+	h := NewLoggerHandler(fs)
+
+	req := httptest.NewRequest(http.MethodPost, "/logs/batch", bytes.NewReader([]byte(`{"level": "info"}`)))
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	h.PostLogBatch(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestPostLog_QueueFull(t *testing.T) {
+	fs := &fakeSink{err: sink.ErrQueueFull}
+	h := NewLoggerHandler(fs)
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	body := []byte(`{"timestamp": "` + now + `", "level": "info", "message": "ok"}`)
+
+	req := httptest.NewRequest(http.MethodPost, "/logs", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	h.PostLog(rr, req)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+}
+
+func TestPostLog_DiskFull(t *testing.T) {
+	fs := &fakeSink{err: sink.ErrDiskFull}
+	h := NewLoggerHandler(fs)
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	body := []byte(`{"timestamp": "` + now + `", "level": "info", "message": "ok"}`)
+
+	req := httptest.NewRequest(http.MethodPost, "/logs", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	h.PostLog(rr, req)
+
+	if rr.Code != http.StatusInsufficientStorage {
+		t.Fatalf("expected status %d, got %d", http.StatusInsufficientStorage, rr.Code)
+	}
+}
+
+func TestPostLog_JSONFormatter(t *testing.T) {
+	fs := &fakeSink{}
+	h := NewLoggerHandlerWithFormat(fs, format.JSONFormatter{})
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	body := []byte(`{"timestamp": "` + now + `", "level": "INFO", "message": "ok", "fields": {"n": 2}}`)
+
+	req := httptest.NewRequest(http.MethodPost, "/logs", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	h.PostLog(rr, req)
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d", http.StatusAccepted, rr.Code)
+	}
+	expected := `{"timestamp":"` + now + `","level":"info","message":"ok","fields":{"n":2}}`
+	if len(fs.lines) != 1 || fs.lines[0] != expected {
+		t.Fatalf("expected line %s, got %v", expected, fs.lines)
+	}
+}
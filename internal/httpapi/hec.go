@@ -0,0 +1,529 @@
+package httpapi
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"logger/internal/format"
+	"logger/internal/ingest"
+	"logger/internal/model"
+	"logger/internal/sink"
+)
+
+// HEC response codes, as documented for the Splunk HTTP Event Collector.
+const (
+	hecCodeSuccess        = 0
+	hecCodeTokenRequired  = 2
+	hecCodeInvalidAuth    = 3
+	hecCodeInvalidToken   = 4
+	hecCodeNoData         = 5
+	hecCodeInvalidFormat  = 6
+	hecCodeInternalError  = 8
+	hecCodeServerBusy     = 9
+	hecCodeChannelMissing = 10
+	hecCodeInvalidChannel = 11
+	hecCodeEventRequired  = 12
+	hecCodeEventBlank     = 13
+	hecCodeHealthy        = 17
+)
+
+const (
+	hecChannelHeader = "X-Splunk-Request-Channel"
+	// defaultHECChannelIdle is how long a channel is kept without requests.
+	defaultHECChannelIdle = 10 * time.Minute
+	maxHECChannels        = 10000
+	maxHECChannelLength   = 128
+	maxHECAckQuery        = 10000
+)
+
+// hecResponse is the body of every HEC response.
+type hecResponse struct {
+	Text               string  `json:"text"`
+	Code               int     `json:"code"`
+	AckID              *uint64 `json:"ackId,omitempty"`
+	InvalidEventNumber *int    `json:"invalid-event-number,omitempty"`
+}
+
+// hecEvent is one event of the /services/collector/event body.
+type hecEvent struct {
+	Time       json.RawMessage `json:"time"`
+	Host       string          `json:"host"`
+	Source     string          `json:"source"`
+	SourceType string          `json:"sourcetype"`
+	Index      string          `json:"index"`
+	Event      json.RawMessage `json:"event"`
+	Fields     map[string]any  `json:"fields"`
+}
+
+// HECHandler serves a Splunk HTTP Event Collector compatible API: /services/collector/event,
+// /services/collector/raw, the indexer acknowledgement endpoint /services/collector/ack and
+// /services/collector/health.
+//
+// Requests authenticate with "Authorization: Splunk <token>" (or basic auth with the
+// token as password). A request that names a channel, in the X-Splunk-Request-Channel
+// header or the channel query parameter, is answered with an ackId. Its events are
+// written with sink.WithDurableWrite before the response, so that ackId reports true
+// as soon as it is queried.
+type HECHandler struct {
+	Sink      sink.EventSink
+	Formatter format.Formatter
+
+	tokens [][]byte
+	acks   *hecAcks
+}
+
+// NewHECHandler constructs an HECHandler writing to s that accepts the given tokens.
+func NewHECHandler(s sink.EventSink, f format.Formatter, tokens []string) *HECHandler {
+	h := &HECHandler{Sink: s, Formatter: f, acks: newHECAcks(defaultHECChannelIdle)}
+	for _, t := range tokens {
+		if t = strings.TrimSpace(t); t != "" {
+			h.tokens = append(h.tokens, []byte(t))
+		}
+	}
+	return h
+}
+
+// PostEvent handles POST /services/collector/event. The body is a sequence of JSON
+// event objects, optionally separated by whitespace. sourcetype becomes the app;
+// source, host, index and the "fields" object become fields. A string event is the
+// message; an object event contributes its "message" (or "msg") as the message,
+// its "level" (or "severity") as the level and its other keys as fields, and is
+// the message itself, as JSON, when it has no message key.
+func (h *HECHandler) PostEvent(w http.ResponseWriter, r *http.Request) {
+	body, ok := h.open(w, r)
+	if !ok {
+		return
+	}
+	data, err := io.ReadAll(body)
+	if isBodyTooLarge(err) {
+		writeHECTooLarge(w)
+		return
+	}
+	if err != nil {
+		writeHEC(w, http.StatusBadRequest, hecResponse{Text: "Invalid data format", Code: hecCodeInvalidFormat})
+		return
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		writeHEC(w, http.StatusBadRequest, hecResponse{Text: "No data", Code: hecCodeNoData})
+		return
+	}
+
+	// The body is decoded completely first: when an event is malformed, nothing is written.
+	var payloads []model.EventPayload
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	for n := 0; ; n++ {
+		var ev hecEvent
+		if err := dec.Decode(&ev); err == io.EOF {
+			break
+		} else if err != nil {
+			writeHEC(w, http.StatusBadRequest, hecResponse{Text: "Invalid data format", Code: hecCodeInvalidFormat, InvalidEventNumber: &n})
+			return
+		}
+		payload, code := hecPayload(ev, r)
+		if code != hecCodeSuccess {
+			text := "Event field is required"
+			if code == hecCodeEventBlank {
+				text = "Event field cannot be blank"
+			}
+			writeHEC(w, http.StatusBadRequest, hecResponse{Text: text, Code: code, InvalidEventNumber: &n})
+			return
+		}
+		payloads = append(payloads, payload)
+	}
+	h.write(w, r, payloads)
+}
+
+// PostRaw handles POST /services/collector/raw. Every non-blank line of the body is
+// one event, stamped with the receive time (or the time query parameter). The
+// sourcetype, source, host and index query parameters apply to all of them.
+func (h *HECHandler) PostRaw(w http.ResponseWriter, r *http.Request) {
+	body, ok := h.open(w, r)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	ts := time.Now().UTC()
+	if v := q.Get("time"); v != "" {
+		t, ok := hecTime(json.RawMessage(strconv.Quote(v)))
+		if !ok {
+			writeHEC(w, http.StatusBadRequest, hecResponse{Text: "Invalid data format", Code: hecCodeInvalidFormat})
+			return
+		}
+		ts = t
+	}
+
+	var payloads []model.EventPayload
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxNDJSONLineBytes)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := map[string]any{}
+		hecMetadata(fields, q.Get("source"), q.Get("host"), q.Get("index"))
+		payloads = append(payloads, model.EventPayload{
+			Timestamp: ts.Format(time.RFC3339Nano),
+			Level:     string(model.LevelInfo),
+			Message:   line,
+			App:       q.Get("sourcetype"),
+			Fields:    fields,
+		})
+	}
+	if err := scanner.Err(); isBodyTooLarge(err) {
+		writeHECTooLarge(w)
+		return
+	} else if err != nil {
+		writeHEC(w, http.StatusBadRequest, hecResponse{Text: "Invalid data format", Code: hecCodeInvalidFormat})
+		return
+	}
+	if len(payloads) == 0 {
+		writeHEC(w, http.StatusBadRequest, hecResponse{Text: "No data", Code: hecCodeNoData})
+		return
+	}
+	h.write(w, r, payloads)
+}
+
+// PostAck handles POST /services/collector/ack: the body {"acks": [ids]} is answered
+// with {"acks": {"id": status}} for the request's channel.
+func (h *HECHandler) PostAck(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+	defer r.Body.Close()
+	channel := hecChannel(r)
+	if channel == "" {
+		writeHEC(w, http.StatusBadRequest, hecResponse{Text: "Data channel is missing", Code: hecCodeChannelMissing})
+		return
+	}
+	var req struct {
+		Acks []uint64 `json:"acks"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Acks) > maxHECAckQuery {
+		writeHEC(w, http.StatusBadRequest, hecResponse{Text: "Invalid data format", Code: hecCodeInvalidFormat})
+		return
+	}
+	status, ok := h.acks.status(channel, req.Acks)
+	if !ok {
+		writeHEC(w, http.StatusBadRequest, hecResponse{Text: "Invalid data channel", Code: hecCodeInvalidChannel})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]map[string]bool{"acks": status})
+}
+
+// GetHealth handles GET /services/collector/health.
+func (h *HECHandler) GetHealth(w http.ResponseWriter, r *http.Request) {
+	writeHEC(w, http.StatusOK, hecResponse{Text: "HEC is healthy", Code: hecCodeHealthy})
+}
+
+// open authorizes the request and returns its body, decompressed when gzipped and
+// limited to maxBodyBytes.
+func (h *HECHandler) open(w http.ResponseWriter, r *http.Request) (io.Reader, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	if !h.authorize(w, r) {
+		return nil, false
+	}
+	body, err := requestBody(w, r, strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip"))
+	if err != nil {
+		writeHEC(w, http.StatusBadRequest, hecResponse{Text: "Invalid data format", Code: hecCodeInvalidFormat})
+		return nil, false
+	}
+	return body, true
+}
+
+// authorize checks the HEC token, answering 401 or 403 when it is missing or wrong.
+func (h *HECHandler) authorize(w http.ResponseWriter, r *http.Request) bool {
+	auth := strings.TrimSpace(r.Header.Get("Authorization"))
+	if auth == "" {
+		writeHEC(w, http.StatusUnauthorized, hecResponse{Text: "Token is required", Code: hecCodeTokenRequired})
+		return false
+	}
+	var token string
+	if scheme, rest, ok := strings.Cut(auth, " "); ok && strings.EqualFold(scheme, "Splunk") {
+		token = strings.TrimSpace(rest)
+	} else if _, password, ok := r.BasicAuth(); ok {
+		token = password
+	} else {
+		writeHEC(w, http.StatusUnauthorized, hecResponse{Text: "Invalid authorization", Code: hecCodeInvalidAuth})
+		return false
+	}
+	for _, t := range h.tokens {
+		if subtle.ConstantTimeCompare(t, []byte(token)) == 1 {
+			return true
+		}
+	}
+	writeHEC(w, http.StatusForbidden, hecResponse{Text: "Invalid token", Code: hecCodeInvalidToken})
+	return false
+}
+
+// write validates the payloads and writes the valid ones. The response is a success,
+// with an ackId when the request names a channel, unless an event was rejected: then
+// it is "Invalid data format" with the number of the first rejected event.
+func (h *HECHandler) write(w http.ResponseWriter, r *http.Request, payloads []model.EventPayload) {
+	channel := hecChannel(r)
+	if len(channel) > maxHECChannelLength {
+		writeHEC(w, http.StatusBadRequest, hecResponse{Text: "Invalid data channel", Code: hecCodeInvalidChannel})
+		return
+	}
+
+	p := &ingest.Pipeline{Sink: h.Sink, Formatter: h.Formatter}
+	records := make([]sink.EventRecord, 0, len(payloads))
+	invalid := -1
+	for i, payload := range payloads {
+		rec, err := p.Record(payload)
+		if err != nil {
+			if invalid < 0 {
+				invalid = i
+			}
+			continue
+		}
+		records = append(records, rec)
+	}
+
+	ctx := r.Context()
+	if channel != "" {
+		// The client drops its copy once the ackId is acknowledged.
+		ctx = sink.WithDurableWrite(ctx)
+	}
+	if err := p.Write(ctx, records); err != nil {
+		if errors.Is(err, sink.ErrQueueFull) {
+			writeHEC(w, http.StatusServiceUnavailable, hecResponse{Text: "Server is busy", Code: hecCodeServerBusy})
+			return
+		}
+		status, msg := sinkErrorStatus(err)
+		writeHEC(w, status, hecResponse{Text: msg, Code: hecCodeInternalError})
+		return
+	}
+	if invalid >= 0 {
+		writeHEC(w, http.StatusBadRequest, hecResponse{Text: "Invalid data format", Code: hecCodeInvalidFormat, InvalidEventNumber: &invalid})
+		return
+	}
+
+	resp := hecResponse{Text: "Success", Code: hecCodeSuccess}
+	if channel != "" {
+		id := h.acks.issue(channel)
+		resp.AckID = &id
+	}
+	writeHEC(w, http.StatusOK, resp)
+}
+
+// hecPayload maps an event object to an event payload. It returns a HEC error code
+// when the event field is missing or blank.
+func hecPayload(ev hecEvent, r *http.Request) (model.EventPayload, int) {
+	raw := bytes.TrimSpace(ev.Event)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return model.EventPayload{}, hecCodeEventRequired
+	}
+
+	q := r.URL.Query()
+	p := model.EventPayload{Level: string(model.LevelInfo), App: ev.SourceType}
+	if p.App == "" {
+		p.App = q.Get("sourcetype")
+	}
+	ts, ok := hecTime(ev.Time)
+	if !ok {
+		ts = time.Now().UTC()
+	}
+	p.Timestamp = ts.Format(time.RFC3339Nano)
+
+	fields := make(map[string]any, len(ev.Fields)+3)
+	for k, v := range ev.Fields {
+		fields[k] = v
+	}
+	source, host, index := ev.Source, ev.Host, ev.Index
+	if source == "" {
+		source = q.Get("source")
+	}
+	if host == "" {
+		host = q.Get("host")
+	}
+	if index == "" {
+		index = q.Get("index")
+	}
+	hecMetadata(fields, source, host, index)
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var event any
+	if err := dec.Decode(&event); err != nil {
+		return model.EventPayload{}, hecCodeEventRequired
+	}
+	switch v := event.(type) {
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return model.EventPayload{}, hecCodeEventBlank
+		}
+		p.Message = v
+	case map[string]any:
+		message, hasMessage := takeString(v, "message", "msg")
+		if level, ok := takeString(v, "level", "severity"); ok {
+			if l, ok := ingest.ParseLevel(level); ok {
+				p.Level = string(l)
+			} else {
+				fields["level"] = level
+			}
+		}
+		if hasMessage {
+			p.Message = message
+			for k, value := range v {
+				fields[k] = value
+			}
+		} else {
+			p.Message = string(raw)
+		}
+	default:
+		p.Message = string(raw)
+	}
+	if len(fields) > 0 {
+		p.Fields = fields
+	}
+	return p, hecCodeSuccess
+}
+
+// hecMetadata adds the non-empty source, host and index to fields.
+func hecMetadata(fields map[string]any, source, host, index string) {
+	for k, v := range map[string]string{"source": source, "host": host, "index": index} {
+		if v != "" {
+			fields[k] = v
+		}
+	}
+}
+
+// takeString removes the first of keys holding a string from obj and returns it.
+func takeString(obj map[string]any, keys ...string) (string, bool) {
+	for _, k := range keys {
+		if s, ok := obj[k].(string); ok {
+			delete(obj, k)
+			return s, true
+		}
+	}
+	return "", false
+}
+
+// hecTime reads a HEC time: epoch seconds with optional fraction, as a number or a
+// string. It reports false when the time is absent or invalid.
+func hecTime(raw json.RawMessage) (time.Time, bool) {
+	s := strings.Trim(strings.TrimSpace(string(raw)), `"`)
+	if s == "" || s == "null" {
+		return time.Time{}, false
+	}
+	secs, err := strconv.ParseFloat(s, 64)
+	if err != nil || secs < 0 || secs > math.MaxInt64/1e9 {
+		return time.Time{}, false
+	}
+	whole, frac := math.Modf(secs)
+	// Round the fraction to microseconds: float64 cannot carry more for current epochs.
+	return time.Unix(int64(whole), int64(math.Round(frac*1e6))*1e3).UTC(), true
+}
+
+// hecChannel returns the channel named by the request, if any.
+func hecChannel(r *http.Request) string {
+	if c := strings.TrimSpace(r.Header.Get(hecChannelHeader)); c != "" {
+		return c
+	}
+	return strings.TrimSpace(r.URL.Query().Get("channel"))
+}
+
+func writeHEC(w http.ResponseWriter, status int, resp hecResponse) {
+	writeJSON(w, status, resp)
+}
+
+// writeHECTooLarge answers a body larger than maxBodyBytes.
+func writeHECTooLarge(w http.ResponseWriter) {
+	writeHEC(w, http.StatusRequestEntityTooLarge, hecResponse{Text: "Content too large", Code: hecCodeInvalidFormat})
+}
+
+// hecAcks issues ackIds per channel. Every issued ackId belongs to a request whose
+// events were durably written, so only the next ackId of each channel is kept: lower ones
+// are acknowledged. Channels unused for idle are forgotten.
+type hecAcks struct {
+	mu        sync.Mutex
+	idle      time.Duration
+	channels  map[string]*hecAckChannel
+	lastSweep time.Time
+}
+
+type hecAckChannel struct {
+	next     uint64
+	lastUsed time.Time
+}
+
+func newHECAcks(idle time.Duration) *hecAcks {
+	return &hecAcks{idle: idle, channels: make(map[string]*hecAckChannel)}
+}
+
+// issue returns the next ackId of channel, creating the channel if needed.
+func (a *hecAcks) issue(channel string) uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	c, ok := a.channels[channel]
+	if !ok {
+		a.sweep(now)
+		if len(a.channels) >= maxHECChannels {
+			a.evictOldest()
+		}
+		c = &hecAckChannel{}
+		a.channels[channel] = c
+	}
+	c.lastUsed = now
+	id := c.next
+	c.next++
+	return id
+}
+
+// status reports whether each ackId of channel was acknowledged. It reports false
+// when the channel is unknown or has expired.
+func (a *hecAcks) status(channel string, ids []uint64) (map[string]bool, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	c, ok := a.channels[channel]
+	if !ok {
+		return nil, false
+	}
+	c.lastUsed = time.Now()
+	out := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		out[strconv.FormatUint(id, 10)] = id < c.next
+	}
+	return out, true
+}
+
+// sweep forgets idle channels, at most once per half idle period.
+func (a *hecAcks) sweep(now time.Time) {
+	if now.Sub(a.lastSweep) < a.idle/2 {
+		return
+	}
+	a.lastSweep = now
+	for name, c := range a.channels {
+		if now.Sub(c.lastUsed) > a.idle {
+			delete(a.channels, name)
+		}
+	}
+}
+
+func (a *hecAcks) evictOldest() {
+	var oldest string
+	var oldestTime time.Time
+	for name, c := range a.channels {
+		if oldest == "" || c.lastUsed.Before(oldestTime) {
+			oldest, oldestTime = name, c.lastUsed
+		}
+	}
+	delete(a.channels, oldest)
+}
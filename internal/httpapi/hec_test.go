@@ -0,0 +1,231 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"logger/internal/format"
+	"logger/internal/sink"
+)
+
+func newTestHEC(fs *fakeSink) *HECHandler {
+	return NewHECHandler(sink.AsEventSink(fs, format.JSONFormatter{}), format.JSONFormatter{}, []string{"secret", " other "})
+}
+
+func postHEC(h *HECHandler, handle http.HandlerFunc, path, token, channel, body string) (*httptest.ResponseRecorder, hecResponse) {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Splunk "+token)
+	}
+	if channel != "" {
+		req.Header.Set(hecChannelHeader, channel)
+	}
+	rr := httptest.NewRecorder()
+	handle(rr, req)
+	var resp hecResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+	return rr, resp
+}
+
+func TestHECHandler_Event(t *testing.T) {
+	fs := &fakeSink{}
+	h := newTestHEC(fs)
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	epoch := fmt.Sprintf("%d.%03d", now.Unix(), now.Nanosecond()/1e6)
+	body := fmt.Sprintf(`{"time":%s,"host":"fw-1","source":"/var/log/fw","sourcetype":"firewall","event":"connection dropped","fields":{"zone":"dmz"}}
+{"time":"%s","sourcetype":"firewall","event":{"message":"rule updated","level":"WARNING","rule":42}}{"event":{"action":"login"}}`, epoch, epoch)
+
+	rr, resp := postHEC(h, h.PostEvent, "/services/collector/event", "secret", "", body)
+	if rr.Code != http.StatusOK || resp.Code != hecCodeSuccess || resp.Text != "Success" || resp.AckID != nil {
+		t.Fatalf("unexpected response %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(fs.lines) != 3 {
+		t.Fatalf("expected 3 lines, got %q", fs.lines)
+	}
+	for _, want := range []string{`"app":"firewall"`, `"message":"connection dropped"`, `"host":"fw-1"`, `"source":"/var/log/fw"`, `"zone":"dmz"`, `"level":"info"`} {
+		if !strings.Contains(fs.lines[0], want) {
+			t.Fatalf("expected %s in %s", want, fs.lines[0])
+		}
+	}
+	if !fs.timestamps[0].Equal(now) {
+		t.Fatalf("expected timestamp %v, got %v", now, fs.timestamps[0])
+	}
+	for _, want := range []string{`"message":"rule updated"`, `"level":"warn"`, `"rule":42`} {
+		if !strings.Contains(fs.lines[1], want) {
+			t.Fatalf("expected %s in %s", want, fs.lines[1])
+		}
+	}
+	if !strings.Contains(fs.lines[2], `"message":"{\"action\":\"login\"}"`) {
+		t.Fatalf("expected an object without message to be the message, got %s", fs.lines[2])
+	}
+}
+
+func TestHECHandler_Raw(t *testing.T) {
+	fs := &fakeSink{}
+	h := newTestHEC(fs)
+
+	rr, resp := postHEC(h, h.PostRaw, "/services/collector/raw?sourcetype=appliance&host=box", "other", "", "first line\r\n\nsecond line\n")
+	if rr.Code != http.StatusOK || resp.Code != hecCodeSuccess {
+		t.Fatalf("unexpected response %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(fs.lines) != 2 || !strings.Contains(fs.lines[0], `"message":"first line"`) || !strings.Contains(fs.lines[1], `"app":"appliance"`) || !strings.Contains(fs.lines[1], `"host":"box"`) {
+		t.Fatalf("unexpected lines %q", fs.lines)
+	}
+}
+
+func TestHECHandler_Auth(t *testing.T) {
+	h := newTestHEC(&fakeSink{})
+	body := `{"event":"x"}`
+
+	if rr, resp := postHEC(h, h.PostEvent, "/services/collector/event", "", "", body); rr.Code != http.StatusUnauthorized || resp.Code != hecCodeTokenRequired {
+		t.Fatalf("expected 401 code 2, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr, resp := postHEC(h, h.PostEvent, "/services/collector/event", "wrong", "", body); rr.Code != http.StatusForbidden || resp.Code != hecCodeInvalidToken {
+		t.Fatalf("expected 403 code 4, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/services/collector/event", strings.NewReader(fmt.Sprintf(`{"time":%d,"event":"x"}`, time.Now().Unix())))
+	req.SetBasicAuth("x", "secret")
+	rr := httptest.NewRecorder()
+	h.PostEvent(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected basic auth with the token as password to pass, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHECHandler_Errors(t *testing.T) {
+	fs := &fakeSink{}
+	h := newTestHEC(fs)
+	stale := time.Now().AddDate(0, 0, -5).Unix()
+
+	for _, tc := range []struct {
+		body    string
+		code    int
+		invalid int
+	}{
+		{"", hecCodeNoData, -1},
+		{`{"event":"a"} {"host":"x"}`, hecCodeEventRequired, 1},
+		{`{"event":"  "}`, hecCodeEventBlank, 0},
+		{`{"event":"a"} {"event":`, hecCodeInvalidFormat, 1},
+	} {
+		rr, resp := postHEC(h, h.PostEvent, "/services/collector/event", "secret", "", tc.body)
+		if rr.Code != http.StatusBadRequest || resp.Code != tc.code {
+			t.Fatalf("%q: expected 400 code %d, got %d: %s", tc.body, tc.code, rr.Code, rr.Body.String())
+		}
+		if tc.invalid >= 0 && (resp.InvalidEventNumber == nil || *resp.InvalidEventNumber != tc.invalid) {
+			t.Fatalf("%q: expected invalid-event-number %d, got %s", tc.body, tc.invalid, rr.Body.String())
+		}
+	}
+	if len(fs.lines) != 0 {
+		t.Fatalf("expected malformed requests to write nothing, got %q", fs.lines)
+	}
+
+	// Events failing validation are reported, but the valid ones are written.
+	body := fmt.Sprintf(`{"time":%d,"event":"stale"}{"event":"fresh"}`, stale)
+	rr, resp := postHEC(h, h.PostEvent, "/services/collector/event", "secret", "chan-1", body)
+	if rr.Code != http.StatusBadRequest || resp.Code != hecCodeInvalidFormat || *resp.InvalidEventNumber != 0 || resp.AckID != nil {
+		t.Fatalf("expected 400 code 6 for event 0, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(fs.lines) != 1 || !strings.Contains(fs.lines[0], "fresh") {
+		t.Fatalf("expected the valid event to be written, got %q", fs.lines)
+	}
+
+	for _, handle := range []http.HandlerFunc{h.PostEvent, h.PostRaw} {
+		req := httptest.NewRequest(http.MethodPost, "/services/collector", bytes.NewReader(gzipBomb()))
+		req.Header.Set("Authorization", "Splunk secret")
+		req.Header.Set("Content-Encoding", "gzip")
+		rr := httptest.NewRecorder()
+		handle(rr, req)
+		if rr.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("expected 413 for a body over the limit, got %d: %s", rr.Code, rr.Body.String())
+		}
+	}
+
+	h = NewHECHandler(sink.AsEventSink(&fakeSink{err: sink.ErrQueueFull}, format.JSONFormatter{}), format.JSONFormatter{}, []string{"secret"})
+	if rr, resp := postHEC(h, h.PostEvent, "/services/collector/event", "secret", "", `{"event":"x"}`); rr.Code != http.StatusServiceUnavailable || resp.Code != hecCodeServerBusy {
+		t.Fatalf("expected 503 code 9, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHECHandler_Acks(t *testing.T) {
+	h := newTestHEC(&fakeSink{})
+	const channel = "11111111-2222-3333-4444-555555555555"
+
+	for want := uint64(0); want < 2; want++ {
+		rr, resp := postHEC(h, h.PostEvent, "/services/collector/event", "secret", channel, `{"event":"x"}`)
+		if rr.Code != http.StatusOK || resp.AckID == nil || *resp.AckID != want {
+			t.Fatalf("expected ackId %d, got %d: %s", want, rr.Code, rr.Body.String())
+		}
+	}
+	// The channel may also be given as a query parameter.
+	rr, resp := postHEC(h, h.PostRaw, "/services/collector/raw?channel="+channel, "secret", "", "line")
+	if rr.Code != http.StatusOK || resp.AckID == nil || *resp.AckID != 2 {
+		t.Fatalf("expected ackId 2, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr, _ = postHEC(h, h.PostAck, "/services/collector/ack", "secret", channel, `{"acks":[0,2,3]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var acks struct {
+		Acks map[string]bool `json:"acks"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &acks); err != nil {
+		t.Fatal(err)
+	}
+	if !acks.Acks["0"] || !acks.Acks["2"] || acks.Acks["3"] || len(acks.Acks) != 3 {
+		t.Fatalf("unexpected ack status %v", acks.Acks)
+	}
+
+	if rr, resp := postHEC(h, h.PostAck, "/services/collector/ack", "secret", "", `{"acks":[0]}`); rr.Code != http.StatusBadRequest || resp.Code != hecCodeChannelMissing {
+		t.Fatalf("expected 400 code 10, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr, resp := postHEC(h, h.PostAck, "/services/collector/ack", "secret", "unknown", `{"acks":[0]}`); rr.Code != http.StatusBadRequest || resp.Code != hecCodeInvalidChannel {
+		t.Fatalf("expected 400 code 11, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHECHandler_AcksWaitForAsyncWrites(t *testing.T) {
+	dir := t.TempDir()
+	fs, err := sink.NewFileSink(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	as := sink.NewAsyncSink(fs, sink.AsyncConfig{FlushInterval: 50 * time.Millisecond})
+	defer as.Close()
+	h := NewHECHandler(sink.AsEventSink(as, format.JSONFormatter{}), format.JSONFormatter{}, []string{"secret"})
+
+	// The sink has no journal, so the ackId may only be issued once the line is on disk.
+	rr, resp := postHEC(h, h.PostEvent, "/services/collector/event", "secret", "chan-1", `{"event":"acked"}`)
+	if rr.Code != http.StatusOK || resp.AckID == nil {
+		t.Fatalf("expected an ackId, got %d: %s", rr.Code, rr.Body.String())
+	}
+	content, err := os.ReadFile(filepath.Join(dir, time.Now().UTC().Format("2006-01-02")+".log"))
+	if err != nil || !strings.Contains(string(content), "acked") {
+		t.Fatalf("expected the acknowledged event on disk, got %q, %v", content, err)
+	}
+}
+
+func TestHECAcks_ForgetsIdleChannels(t *testing.T) {
+	a := newHECAcks(time.Minute)
+	a.issue("old")
+	a.channels["old"].lastUsed = time.Now().Add(-2 * time.Minute)
+	a.lastSweep = time.Time{}
+
+	a.issue("new")
+	if _, ok := a.status("old", []uint64{0}); ok {
+		t.Fatal("expected the idle channel to be forgotten")
+	}
+	if status, ok := a.status("new", []uint64{0}); !ok || !status["0"] {
+		t.Fatalf("expected the new channel to acknowledge 0, got %v, %v", status, ok)
+	}
+}
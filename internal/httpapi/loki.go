@@ -0,0 +1,399 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"logger/internal/ingest"
+	"logger/internal/model"
+	"logger/internal/sink"
+)
+
+// lokiAppLabels are the stream labels used as the app, in order of preference.
+var lokiAppLabels = []string{"app", "service_name", "job"}
+
+// lokiLevelLabels are the labels and structured metadata read as the level.
+var lokiLevelLabels = []string{"level", "detected_level", "severity", "lvl"}
+
+// maxLokiErrors bounds how many entry errors a 400 response lists.
+const maxLokiErrors = 5
+
+// lokiStream is one stream of a push request: its labels and entries.
+type lokiStream struct {
+	labels  map[string]string
+	entries []lokiEntry
+}
+
+// lokiEntry is one log line with its timestamp and structured metadata.
+type lokiEntry struct {
+	ts       time.Time
+	line     string
+	metadata map[string]string
+}
+
+// PostLokiPush handles POST /loki/api/v1/push, the Grafana Loki push API used by
+// promtail and Grafana Agent. The body is a snappy-compressed protobuf PushRequest
+// (Content-Type application/x-protobuf) or its JSON form (application/json,
+// optionally gzipped). Like Loki, it answers 204 No Content when every entry was
+// written, and 400 Bad Request with a plain-text reason when some entries were
+// rejected; the valid entries are written either way.
+func (h *LoggerHandler) PostLokiPush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer r.Body.Close()
+
+	body, err := requestBody(w, r, strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip"))
+	if err != nil {
+		http.Error(w, "invalid gzip body", http.StatusBadRequest)
+		return
+	}
+	data, err := io.ReadAll(body)
+	if isBodyTooLarge(err) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	var streams []lokiStream
+	ct := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Type")))
+	switch {
+	case strings.HasPrefix(ct, "application/json"):
+		streams, err = decodeLokiJSON(data)
+	case ct == "" || strings.HasPrefix(ct, "application/x-protobuf"):
+		streams, err = decodeLokiProtobuf(data)
+	default:
+		http.Error(w, "Content-Type must be application/x-protobuf or application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	if isBodyTooLarge(err) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p := &ingest.Pipeline{Sink: h.Sink, Formatter: h.Formatter}
+	var records []sink.EventRecord
+	var errs []string
+	rejected := 0
+	for _, s := range streams {
+		for _, e := range s.entries {
+			rec, err := p.Record(lokiPayload(s.labels, e))
+			if err != nil {
+				rejected++
+				if len(errs) < maxLokiErrors {
+					errs = append(errs, fmt.Sprintf("entry with timestamp %s: %v", e.ts.Format(time.RFC3339Nano), err))
+				}
+				continue
+			}
+			records = append(records, rec)
+		}
+	}
+
+	if err := p.Write(r.Context(), records); err != nil {
+		status, msg := sinkErrorStatus(err)
+		http.Error(w, msg, status)
+		return
+	}
+	if rejected > 0 {
+		http.Error(w, fmt.Sprintf("%d entries rejected: %s", rejected, strings.Join(errs, "; ")), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lokiPayload maps an entry to an event payload. The first of lokiAppLabels present
+// becomes the app and the level is read from lokiLevelLabels (info when absent);
+// the other labels and the structured metadata become fields.
+func lokiPayload(labels map[string]string, e lokiEntry) model.EventPayload {
+	fields := make(map[string]any, len(labels)+len(e.metadata))
+	for k, v := range labels {
+		fields[k] = v
+	}
+	for k, v := range e.metadata {
+		fields[k] = v
+	}
+
+	var app string
+	for _, name := range lokiAppLabels {
+		if v, ok := labels[name]; ok && v != "" {
+			app = v
+			delete(fields, name)
+			break
+		}
+	}
+	level := model.LevelInfo
+	for _, name := range lokiLevelLabels {
+		if v, ok := fields[name].(string); ok {
+			if l, ok := ingest.ParseLevel(v); ok {
+				level = l
+				delete(fields, name)
+				break
+			}
+		}
+	}
+
+	return model.EventPayload{
+		Timestamp: e.ts.UTC().Format(time.RFC3339Nano),
+		Level:     string(level),
+		Message:   e.line,
+		App:       app,
+		Fields:    fields,
+	}
+}
+
+// decodeLokiJSON reads {"streams": [{"stream": {labels}, "values": [["<unix ns>",
+// "<line>", {metadata}], ...]}]}.
+func decodeLokiJSON(data []byte) ([]lokiStream, error) {
+	var req struct {
+		Streams []struct {
+			Stream map[string]string   `json:"stream"`
+			Values [][]json.RawMessage `json:"values"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("invalid JSON push request: %v", err)
+	}
+
+	streams := make([]lokiStream, 0, len(req.Streams))
+	for _, s := range req.Streams {
+		stream := lokiStream{labels: s.Stream}
+		for _, v := range s.Values {
+			if len(v) < 2 || len(v) > 3 {
+				return nil, errors.New("invalid JSON push request: values must be [timestamp, line] or [timestamp, line, metadata]")
+			}
+			var tsStr string
+			var e lokiEntry
+			if err := json.Unmarshal(v[0], &tsStr); err != nil {
+				return nil, errors.New("invalid JSON push request: timestamp must be a string of Unix nanoseconds")
+			}
+			ns, err := strconv.ParseInt(tsStr, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid JSON push request: invalid timestamp %q", tsStr)
+			}
+			e.ts = time.Unix(0, ns)
+			if err := json.Unmarshal(v[1], &e.line); err != nil {
+				return nil, errors.New("invalid JSON push request: line must be a string")
+			}
+			if len(v) == 3 {
+				if err := json.Unmarshal(v[2], &e.metadata); err != nil {
+					return nil, errors.New("invalid JSON push request: structured metadata must be an object of strings")
+				}
+			}
+			stream.entries = append(stream.entries, e)
+		}
+		streams = append(streams, stream)
+	}
+	return streams, nil
+}
+
+// Field numbers of Loki's logproto.PushRequest and the messages it contains.
+const (
+	lokiPushStreams      = 1 // PushRequest.streams
+	lokiStreamLabels     = 1 // StreamAdapter.labels
+	lokiStreamEntries    = 2 // StreamAdapter.entries
+	lokiEntryTimestamp   = 1 // EntryAdapter.timestamp (google.protobuf.Timestamp)
+	lokiEntryLine        = 2 // EntryAdapter.line
+	lokiEntryMetadata    = 3 // EntryAdapter.structuredMetadata
+	lokiLabelName        = 1 // LabelPairAdapter.name
+	lokiLabelValue       = 2 // LabelPairAdapter.value
+	protoTimestampSecs   = 1 // google.protobuf.Timestamp.seconds
+	protoTimestampNanos  = 2 // google.protobuf.Timestamp.nanos
+	maxLokiDecodedLength = maxBodyBytes
+)
+
+// decodeLokiProtobuf reads a snappy-compressed (block format) logproto.PushRequest.
+func decodeLokiProtobuf(data []byte) ([]lokiStream, error) {
+	n, err := snappy.DecodedLen(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snappy body: %v", err)
+	}
+	if n > maxLokiDecodedLength {
+		return nil, errBodyTooLarge
+	}
+	raw, err := snappy.Decode(nil, data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snappy body: %v", err)
+	}
+
+	var streams []lokiStream
+	err = protoFields(raw, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num != lokiPushStreams || typ != protowire.BytesType {
+			return nil
+		}
+		s, err := decodeLokiStream(v)
+		if err != nil {
+			return err
+		}
+		streams = append(streams, s)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid protobuf push request: %v", err)
+	}
+	return streams, nil
+}
+
+func decodeLokiStream(data []byte) (lokiStream, error) {
+	var s lokiStream
+	err := protoFields(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case lokiStreamLabels:
+			labels, err := parseLokiLabels(string(v))
+			if err != nil {
+				return err
+			}
+			s.labels = labels
+		case lokiStreamEntries:
+			e, err := decodeLokiEntry(v)
+			if err != nil {
+				return err
+			}
+			s.entries = append(s.entries, e)
+		}
+		return nil
+	})
+	return s, err
+}
+
+func decodeLokiEntry(data []byte) (lokiEntry, error) {
+	var e lokiEntry
+	var secs, nanos int64
+	err := protoFields(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case lokiEntryTimestamp:
+			return protoFields(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				if typ != protowire.VarintType {
+					return nil
+				}
+				x, _ := protowire.ConsumeVarint(v)
+				switch num {
+				case protoTimestampSecs:
+					secs = int64(x)
+				case protoTimestampNanos:
+					nanos = int64(int32(x))
+				}
+				return nil
+			})
+		case lokiEntryLine:
+			e.line = string(v)
+		case lokiEntryMetadata:
+			var name, value string
+			if err := protoFields(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				switch {
+				case typ != protowire.BytesType:
+				case num == lokiLabelName:
+					name = string(v)
+				case num == lokiLabelValue:
+					value = string(v)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			if e.metadata == nil {
+				e.metadata = map[string]string{}
+			}
+			e.metadata[name] = value
+		}
+		return nil
+	})
+	e.ts = time.Unix(secs, nanos)
+	return e, err
+}
+
+// protoFields calls fn for every field of a protobuf message. For varints v holds
+// the encoded varint; for length-delimited fields, their contents. Fixed-width
+// and group fields are skipped.
+func protoFields(data []byte, fn func(num protowire.Number, typ protowire.Type, v []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		var v []byte
+		switch typ {
+		case protowire.VarintType:
+			_, n = protowire.ConsumeVarint(data)
+			if n >= 0 {
+				v = data[:n]
+			}
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if v != nil || typ == protowire.BytesType {
+			if err := fn(num, typ, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseLokiLabels reads a label set in Prometheus syntax: {name="value", ...},
+// with values quoted as Go strings.
+func parseLokiLabels(s string) (map[string]string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+		return nil, fmt.Errorf("invalid labels %q", s)
+	}
+	rest := strings.TrimSpace(s[1 : len(s)-1])
+	labels := map[string]string{}
+	for rest != "" {
+		eq := strings.IndexByte(rest, '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("invalid labels %q", s)
+		}
+		name := strings.TrimSpace(rest[:eq])
+		rest = strings.TrimSpace(rest[eq+1:])
+
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid labels %q", s)
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, fmt.Errorf("invalid labels %q", s)
+		}
+		labels[name] = value
+
+		rest = strings.TrimSpace(rest[len(quoted):])
+		if rest != "" {
+			if rest[0] != ',' {
+				return nil, fmt.Errorf("invalid labels %q", s)
+			}
+			rest = strings.TrimSpace(rest[1:])
+		}
+	}
+	return labels, nil
+}
@@ -0,0 +1,169 @@
+package httpapi
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"logger/internal/format"
+)
+
+type lokiTestEntry struct {
+	ts       time.Time
+	line     string
+	metadata [][2]string
+}
+
+// lokiProtobuf encodes a snappy-compressed logproto.PushRequest with one stream.
+func lokiProtobuf(labels string, entries ...lokiTestEntry) []byte {
+	var stream []byte
+	stream = protowire.AppendTag(stream, lokiStreamLabels, protowire.BytesType)
+	stream = protowire.AppendString(stream, labels)
+	for _, e := range entries {
+		var ts []byte
+		ts = protowire.AppendTag(ts, protoTimestampSecs, protowire.VarintType)
+		ts = protowire.AppendVarint(ts, uint64(e.ts.Unix()))
+		ts = protowire.AppendTag(ts, protoTimestampNanos, protowire.VarintType)
+		ts = protowire.AppendVarint(ts, uint64(e.ts.Nanosecond()))
+
+		var entry []byte
+		entry = protowire.AppendTag(entry, lokiEntryTimestamp, protowire.BytesType)
+		entry = protowire.AppendBytes(entry, ts)
+		entry = protowire.AppendTag(entry, lokiEntryLine, protowire.BytesType)
+		entry = protowire.AppendString(entry, e.line)
+		for _, kv := range e.metadata {
+			var pair []byte
+			pair = protowire.AppendTag(pair, lokiLabelName, protowire.BytesType)
+			pair = protowire.AppendString(pair, kv[0])
+			pair = protowire.AppendTag(pair, lokiLabelValue, protowire.BytesType)
+			pair = protowire.AppendString(pair, kv[1])
+			entry = protowire.AppendTag(entry, lokiEntryMetadata, protowire.BytesType)
+			entry = protowire.AppendBytes(entry, pair)
+		}
+		stream = protowire.AppendTag(stream, lokiStreamEntries, protowire.BytesType)
+		stream = protowire.AppendBytes(stream, entry)
+	}
+
+	var req []byte
+	req = protowire.AppendTag(req, lokiPushStreams, protowire.BytesType)
+	req = protowire.AppendBytes(req, stream)
+	return snappy.Encode(nil, req)
+}
+
+func postLoki(h *LoggerHandler, contentType string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/loki/api/v1/push", bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	rr := httptest.NewRecorder()
+	h.PostLokiPush(rr, req)
+	return rr
+}
+
+func TestPostLokiPush_Protobuf(t *testing.T) {
+	fs := &fakeSink{}
+	h := NewLoggerHandlerWithFormat(fs, format.JSONFormatter{})
+
+	now := time.Now()
+	body := lokiProtobuf(`{job="varlogs", level="warning", filename="/var/log/app.log"}`,
+		lokiTestEntry{ts: now, line: "disk almost full", metadata: [][2]string{{"trace_id", "abc123"}}},
+		lokiTestEntry{ts: now.Add(time.Millisecond), line: "second"},
+	)
+
+	rr := postLoki(h, "application/x-protobuf", body)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(fs.lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", fs.lines)
+	}
+	for _, want := range []string{`"level":"warn"`, `"app":"varlogs"`, `"message":"disk almost full"`, `"filename":"/var/log/app.log"`, `"trace_id":"abc123"`} {
+		if !strings.Contains(fs.lines[0], want) {
+			t.Fatalf("expected %s in %s", want, fs.lines[0])
+		}
+	}
+	if strings.Contains(fs.lines[0], `"job"`) || strings.Contains(fs.lines[0], `"level":"warning"`) {
+		t.Fatalf("expected the app and level labels to be consumed, got %s", fs.lines[0])
+	}
+	if !fs.timestamps[0].Equal(now.UTC()) {
+		t.Fatalf("expected timestamp %v, got %v", now.UTC(), fs.timestamps[0])
+	}
+}
+
+func TestPostLokiPush_JSONPartialRejection(t *testing.T) {
+	fs := &fakeSink{}
+	h := NewLoggerHandlerWithFormat(fs, format.JSONFormatter{})
+
+	body := fmt.Sprintf(`{"streams":[{"stream":{"service_name":"api","env":"prod"},"values":[
+		["%d","request served",{"status":"200"}],
+		["%d","stale"]
+	]}]}`, time.Now().UnixNano(), time.Now().AddDate(0, 0, -5).UnixNano())
+
+	rr := postLoki(h, "application/json", []byte(body))
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "1 entries rejected") {
+		t.Fatalf("expected 400 naming the rejected entry, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(fs.lines) != 1 {
+		t.Fatalf("expected the valid entry to be written, got %q", fs.lines)
+	}
+	for _, want := range []string{`"level":"info"`, `"app":"api"`, `"env":"prod"`, `"status":"200"`} {
+		if !strings.Contains(fs.lines[0], want) {
+			t.Fatalf("expected %s in %s", want, fs.lines[0])
+		}
+	}
+}
+
+func TestPostLokiPush_Errors(t *testing.T) {
+	h := NewLoggerHandler(&fakeSink{})
+
+	if rr := postLoki(h, "text/plain", []byte("x")); rr.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415, got %d", rr.Code)
+	}
+	if rr := postLoki(h, "application/x-protobuf", []byte("not snappy")); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a bad snappy body, got %d", rr.Code)
+	}
+	if rr := postLoki(h, "application/x-protobuf", lokiProtobuf(`{job=varlogs}`)); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for malformed labels, got %d", rr.Code)
+	}
+	if rr := postLoki(h, "application/json", []byte(`{"streams":[{"stream":{},"values":[["now","x"]]}]}`)); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a bad timestamp, got %d", rr.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/loki/api/v1/push", bytes.NewReader(gzipBomb()))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	h.PostLokiPush(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for a body that inflates past the limit, got %d", rr.Code)
+	}
+
+	h = NewLoggerHandler(&fakeSink{err: fmt.Errorf("disk on fire")})
+	body := lokiProtobuf(`{app="x"}`, lokiTestEntry{ts: time.Now(), line: "x"})
+	if rr := postLoki(h, "application/x-protobuf", body); rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rr.Code)
+	}
+}
+
+func TestParseLokiLabels(t *testing.T) {
+	labels, err := parseLokiLabels(`{app="web", msg="say \"hi\", then go"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labels["app"] != "web" || labels["msg"] != `say "hi", then go` || len(labels) != 2 {
+		t.Fatalf("unexpected labels %v", labels)
+	}
+	if labels, err := parseLokiLabels("{}"); err != nil || len(labels) != 0 {
+		t.Fatalf("expected an empty label set, got %v, %v", labels, err)
+	}
+	for _, bad := range []string{`app="web"`, `{app=web}`, `{app="web" env="x"}`, `{="x"}`} {
+		if _, err := parseLokiLabels(bad); err == nil {
+			t.Fatalf("expected an error for %s", bad)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package httpapi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"logger/internal/model"
+	"logger/internal/sink"
+)
+
+// ndjsonContentType selects the streaming mode of POST /logs.
+const ndjsonContentType = "application/x-ndjson"
+
+// maxNDJSONLineBytes bounds a single event line so one request cannot exhaust memory.
+const maxNDJSONLineBytes = 1 << 20
+
+// streamError describes a rejected line within an NDJSON stream (1-based line numbers).
+type streamError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// streamResult is the summary returned once an NDJSON stream has been consumed.
+type streamResult struct {
+	Accepted int           `json:"accepted"`
+	Rejected int           `json:"rejected"`
+	Errors   []streamError `json:"errors,omitempty"`
+	// Error is set when the stream was aborted before the body was fully consumed.
+	Error string `json:"error,omitempty"`
+}
+
+// isNDJSON reports whether the Content-Type header selects NDJSON streaming.
+func isNDJSON(ct string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(ct)), ndjsonContentType)
+}
+
+// postLogStream consumes newline-delimited JSON events from the request body.
+// Each line is validated, formatted and written to the sink as soon as it is read,
+// so a long-lived chunked request never buffers more than one event at a time.
+// Blank lines are ignored. The response summarises accepted and rejected lines.
+func (h *LoggerHandler) postLogStream(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	result := streamResult{}
+	reject := func(lineNo int, msg string) {
+		result.Errors = append(result.Errors, streamError{Line: lineNo, Error: msg})
+	}
+
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxNDJSONLineBytes)
+
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		var payload model.EventPayload
+		if err := json.Unmarshal(data, &payload); err != nil {
+			reject(lineNo, "invalid JSON event")
+			continue
+		}
+		applyQueryApp(&payload, r)
+
+		ev, err := payload.ToEvent()
+		if err != nil {
+			reject(lineNo, err.Error())
+			continue
+		}
+
+		line, err := h.Formatter.Format(ev)
+		if err != nil {
+			reject(lineNo, "failed to format event")
+			continue
+		}
+
+		if err := h.Sink.WriteEvents(r.Context(), []sink.EventRecord{h.eventRecord(ev, line)}); err != nil {
+			// The sink is unusable; stop consuming and report what was written so far.
+			status, msg := sinkErrorStatus(err)
+			result.Rejected = len(result.Errors)
+			result.Error = msg
+			writeJSON(w, status, result)
+			return
+		}
+		result.Accepted++
+	}
+	if err := scanner.Err(); err != nil {
+		// Oversized line or broken body: the rest of the stream cannot be framed.
+		reject(lineNo+1, "failed to read stream: "+err.Error())
+	}
+
+	result.Rejected = len(result.Errors)
+
+	status := http.StatusAccepted
+	if result.Rejected > 0 {
+		status = http.StatusMultiStatus
+	}
+	writeJSON(w, status, result)
+}
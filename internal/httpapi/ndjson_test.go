@@ -0,0 +1,92 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPostLog_NDJSONStream(t *testing.T) {
+	fs := &fakeSink{}
+	h := NewLoggerHandler(fs)
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	body := strings.Join([]string{
+		`{"timestamp": "` + now + `", "level": "info", "message": "first"}`,
+		``,
+		`{"timestamp": "` + now + `", "level": "info"}`,
+		`not json`,
+		`{"timestamp": "` + now + `", "level": "error", "message": "second", "app": "own"}`,
+	}, "\n")
+
+	req := httptest.NewRequest(http.MethodPost, "/logs?app=streamapp", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	rr := httptest.NewRecorder()
+	h.PostLog(rr, req)
+
+	if rr.Code != http.StatusMultiStatus {
+		t.Fatalf("expected status %d, got %d", http.StatusMultiStatus, rr.Code)
+	}
+
+	var result streamResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if result.Accepted != 2 || result.Rejected != 2 {
+		t.Fatalf("expected 2 accepted and 2 rejected, got %+v", result)
+	}
+	if result.Errors[0].Line != 3 || result.Errors[1].Line != 4 {
+		t.Fatalf("unexpected error line numbers: %+v", result.Errors)
+	}
+
+	if len(fs.lines) != 2 {
+		t.Fatalf("expected 2 lines written, got %d", len(fs.lines))
+	}
+	if !strings.Contains(fs.lines[0], "[streamapp]") || !strings.Contains(fs.lines[1], "[own]") {
+		t.Fatalf("unexpected apps in lines: %q", fs.lines)
+	}
+}
+
+func TestPostLog_NDJSONAllAccepted(t *testing.T) {
+	fs := &fakeSink{}
+	h := NewLoggerHandler(fs)
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	body := `{"timestamp": "` + now + `", "level": "info", "message": "only"}` + "\n"
+
+	req := httptest.NewRequest(http.MethodPost, "/logs", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	rr := httptest.NewRecorder()
+	h.PostLog(rr, req)
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d", http.StatusAccepted, rr.Code)
+	}
+	if len(fs.lines) != 1 {
+		t.Fatalf("expected 1 line written, got %d", len(fs.lines))
+	}
+}
+
+func TestPostLog_NDJSONSinkFailure(t *testing.T) {
+	fs := &fakeSink{err: errors.New("disk gone")}
+	h := NewLoggerHandler(fs)
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	body := `{"timestamp": "` + now + `", "level": "info", "message": "lost"}`
+
+	req := httptest.NewRequest(http.MethodPost, "/logs", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	rr := httptest.NewRecorder()
+	h.PostLog(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status %d, got %d", http.StatusInternalServerError, rr.Code)
+	}
+}
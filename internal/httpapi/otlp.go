@@ -0,0 +1,332 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"logger/internal/ingest"
+	"logger/internal/model"
+	"logger/internal/sink"
+)
+
+const (
+	otlpProtobufContentType = "application/x-protobuf"
+	otlpJSONContentType     = "application/json"
+	// maxOTLPErrors bounds how many record errors the partial-success message lists.
+	maxOTLPErrors = 5
+)
+
+// PostOTLPLogs handles POST /v1/logs, the OTLP/HTTP logs endpoint. The body is an
+// ExportLogsServiceRequest encoded as protobuf or JSON (optionally gzipped), and
+// the response is an ExportLogsServiceResponse in the same encoding. Records that
+// fail validation are counted in its partial_success; the rest are written.
+func (h *LoggerHandler) PostOTLPLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer r.Body.Close()
+
+	ct := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Type")))
+	isJSON := strings.HasPrefix(ct, otlpJSONContentType)
+	if !isJSON && !strings.HasPrefix(ct, otlpProtobufContentType) {
+		writeOTLPError(w, false, http.StatusUnsupportedMediaType, "Content-Type must be application/x-protobuf or application/json")
+		return
+	}
+
+	var gzipped bool
+	switch strings.ToLower(r.Header.Get("Content-Encoding")) {
+	case "", "identity":
+	case "gzip":
+		gzipped = true
+	default:
+		writeOTLPError(w, isJSON, http.StatusUnsupportedMediaType, "unsupported Content-Encoding")
+		return
+	}
+	body, err := requestBody(w, r, gzipped)
+	if err != nil {
+		writeOTLPError(w, isJSON, http.StatusBadRequest, "invalid gzip body")
+		return
+	}
+	data, err := io.ReadAll(body)
+	if isBodyTooLarge(err) {
+		writeOTLPError(w, isJSON, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	if err != nil {
+		writeOTLPError(w, isJSON, http.StatusBadRequest, "failed to read body")
+		return
+	}
+
+	req := &collogspb.ExportLogsServiceRequest{}
+	if isJSON {
+		err = unmarshalOTLPJSON(data, req)
+	} else {
+		err = proto.Unmarshal(data, req)
+	}
+	if err != nil {
+		writeOTLPError(w, isJSON, http.StatusBadRequest, "invalid ExportLogsServiceRequest: "+err.Error())
+		return
+	}
+
+	p := &ingest.Pipeline{Sink: h.Sink, Formatter: h.Formatter}
+	queryApp := strings.TrimSpace(r.URL.Query().Get("app"))
+	var records []sink.EventRecord
+	var rejected int64
+	var errs []string
+	index := 0
+	for _, rl := range req.GetResourceLogs() {
+		app, resourceFields := otlpResource(rl.GetResource().GetAttributes())
+		if app == "" {
+			app = queryApp
+		}
+		for _, sl := range rl.GetScopeLogs() {
+			for _, lr := range sl.GetLogRecords() {
+				rec, err := p.Record(otlpPayload(lr, app, resourceFields))
+				index++
+				if err != nil {
+					rejected++
+					if len(errs) < maxOTLPErrors {
+						errs = append(errs, fmt.Sprintf("log record %d: %v", index-1, err))
+					}
+					continue
+				}
+				records = append(records, rec)
+			}
+		}
+	}
+
+	if err := p.Write(r.Context(), records); err != nil {
+		status, msg := sinkErrorStatus(err)
+		writeOTLPError(w, isJSON, status, msg)
+		return
+	}
+
+	resp := &collogspb.ExportLogsServiceResponse{}
+	if rejected > 0 {
+		resp.PartialSuccess = &collogspb.ExportLogsPartialSuccess{
+			RejectedLogRecords: rejected,
+			ErrorMessage:       strings.Join(errs, "; "),
+		}
+	}
+	writeOTLP(w, isJSON, http.StatusOK, resp)
+}
+
+// unmarshalOTLPJSON decodes the OTLP JSON encoding. It differs from the standard
+// protobuf JSON mapping in one respect: trace and span IDs are hex, not base64.
+// Numbers are kept as written, so unquoted nanosecond timestamps and intValues
+// are not rounded to float64 on the way through.
+func unmarshalOTLPJSON(data []byte, req *collogspb.ExportLogsServiceRequest) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("unexpected data after the JSON document")
+	}
+	for _, rl := range jsonList(doc, "resourceLogs", "resource_logs") {
+		for _, sl := range jsonList(rl, "scopeLogs", "scope_logs") {
+			for _, lr := range jsonList(sl, "logRecords", "log_records") {
+				for _, key := range []string{"traceId", "trace_id", "spanId", "span_id"} {
+					if s, ok := lr[key].(string); ok {
+						id, err := hex.DecodeString(s)
+						if err != nil {
+							return fmt.Errorf("invalid %s %q", key, s)
+						}
+						lr[key] = base64.StdEncoding.EncodeToString(id)
+					}
+				}
+			}
+		}
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, req)
+}
+
+// jsonList returns the objects in the array under the first of keys present in obj.
+func jsonList(obj map[string]any, keys ...string) []map[string]any {
+	for _, key := range keys {
+		items, ok := obj[key].([]any)
+		if !ok {
+			continue
+		}
+		var out []map[string]any
+		for _, item := range items {
+			if m, ok := item.(map[string]any); ok {
+				out = append(out, m)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// otlpResource returns the service.name attribute as the app and the other
+// resource attributes as fields.
+func otlpResource(attrs []*commonpb.KeyValue) (string, map[string]any) {
+	var app string
+	fields := map[string]any{}
+	for _, kv := range attrs {
+		if kv.GetKey() == "service.name" {
+			app = kv.GetValue().GetStringValue()
+			continue
+		}
+		fields[kv.GetKey()] = otlpValue(kv.GetValue())
+	}
+	return app, fields
+}
+
+// otlpPayload maps a log record to an event payload. Record attributes take
+// precedence over resource attributes of the same name.
+func otlpPayload(lr *logspb.LogRecord, app string, resourceFields map[string]any) model.EventPayload {
+	nanos := lr.GetTimeUnixNano()
+	if nanos == 0 {
+		nanos = lr.GetObservedTimeUnixNano()
+	}
+	ts := time.Now().UTC()
+	if nanos != 0 && nanos <= math.MaxInt64 {
+		ts = time.Unix(0, int64(nanos)).UTC()
+	}
+
+	fields := make(map[string]any, len(resourceFields)+len(lr.GetAttributes())+2)
+	for k, v := range resourceFields {
+		fields[k] = v
+	}
+	for _, kv := range lr.GetAttributes() {
+		fields[kv.GetKey()] = otlpValue(kv.GetValue())
+	}
+	if id := lr.GetTraceId(); len(id) > 0 {
+		fields["trace_id"] = hex.EncodeToString(id)
+	}
+	if id := lr.GetSpanId(); len(id) > 0 {
+		fields["span_id"] = hex.EncodeToString(id)
+	}
+
+	message := ""
+	switch v := otlpValue(lr.GetBody()).(type) {
+	case nil:
+	case string:
+		message = v
+	default:
+		data, _ := json.Marshal(v)
+		message = string(data)
+	}
+
+	return model.EventPayload{
+		Timestamp: ts.Format(time.RFC3339Nano),
+		Level:     string(otlpLevel(lr.GetSeverityNumber(), lr.GetSeverityText())),
+		Message:   message,
+		App:       app,
+		Fields:    fields,
+	}
+}
+
+// otlpLevel maps an OTLP severity number to a level: TRACE and DEBUG to debug,
+// INFO to info, WARN to warn, ERROR and FATAL to error. Without a severity number
+// the severity text is parsed, and anything else is info.
+func otlpLevel(num logspb.SeverityNumber, text string) model.LogLevel {
+	switch {
+	case num >= logspb.SeverityNumber_SEVERITY_NUMBER_ERROR:
+		return model.LevelError
+	case num >= logspb.SeverityNumber_SEVERITY_NUMBER_WARN:
+		return model.LevelWarn
+	case num >= logspb.SeverityNumber_SEVERITY_NUMBER_INFO:
+		return model.LevelInfo
+	case num >= logspb.SeverityNumber_SEVERITY_NUMBER_TRACE:
+		return model.LevelDebug
+	}
+	if level, ok := ingest.ParseLevel(text); ok {
+		return level
+	}
+	return model.LevelInfo
+}
+
+// otlpValue converts an AnyValue to the equivalent JSON value. Bytes are base64.
+func otlpValue(v *commonpb.AnyValue) any {
+	switch v := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return v.BoolValue
+	case *commonpb.AnyValue_IntValue:
+		return v.IntValue
+	case *commonpb.AnyValue_DoubleValue:
+		return v.DoubleValue
+	case *commonpb.AnyValue_BytesValue:
+		return base64.StdEncoding.EncodeToString(v.BytesValue)
+	case *commonpb.AnyValue_ArrayValue:
+		out := make([]any, len(v.ArrayValue.GetValues()))
+		for i, item := range v.ArrayValue.GetValues() {
+			out[i] = otlpValue(item)
+		}
+		return out
+	case *commonpb.AnyValue_KvlistValue:
+		out := make(map[string]any, len(v.KvlistValue.GetValues()))
+		for _, kv := range v.KvlistValue.GetValues() {
+			out[kv.GetKey()] = otlpValue(kv.GetValue())
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+// writeOTLP writes an OTLP message in the encoding of the request.
+func writeOTLP(w http.ResponseWriter, isJSON bool, status int, msg proto.Message) {
+	var data []byte
+	var err error
+	if isJSON {
+		w.Header().Set("Content-Type", otlpJSONContentType)
+		data, err = protojson.Marshal(msg)
+	} else {
+		w.Header().Set("Content-Type", otlpProtobufContentType)
+		data, err = proto.Marshal(msg)
+	}
+	if err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
+
+// writeOTLPError writes a google.rpc.Status, as OTLP/HTTP specifies for failures.
+func writeOTLPError(w http.ResponseWriter, isJSON bool, code int, message string) {
+	writeOTLP(w, isJSON, code, &status.Status{Code: int32(otlpStatusCode(code)), Message: message})
+}
+
+// otlpStatusCode maps an HTTP status to the closest gRPC status code.
+func otlpStatusCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest, http.StatusUnsupportedMediaType, http.StatusRequestEntityTooLarge:
+		return codes.InvalidArgument
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusInsufficientStorage:
+		return codes.ResourceExhausted
+	default:
+		return codes.Internal
+	}
+}
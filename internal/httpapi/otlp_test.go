@@ -0,0 +1,221 @@
+package httpapi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"logger/internal/format"
+)
+
+func otlpString(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+func otlpRequest(records ...*logspb.LogRecord) *collogspb.ExportLogsServiceRequest {
+	return &collogspb.ExportLogsServiceRequest{ResourceLogs: []*logspb.ResourceLogs{{
+		Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{
+			otlpString("service.name", "checkout"),
+			otlpString("host.name", "web-1"),
+		}},
+		ScopeLogs: []*logspb.ScopeLogs{{LogRecords: records}},
+	}}}
+}
+
+func postOTLP(t *testing.T, h *LoggerHandler, contentType string, body []byte, gzipped bool) *httptest.ResponseRecorder {
+	t.Helper()
+	if gzipped {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(body)
+		gz.Close()
+		body = buf.Bytes()
+	}
+	req := httptest.NewRequest(http.MethodPost, "/v1/logs", bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	if gzipped {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	rr := httptest.NewRecorder()
+	h.PostOTLPLogs(rr, req)
+	return rr
+}
+
+// gzipBomb returns a gzip body that decompresses to one byte more than maxBodyBytes.
+// It holds newlines, so line-oriented endpoints read it to the limit too.
+var gzipBomb = sync.OnceValue(func() []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(bytes.Repeat([]byte{'\n'}, maxBodyBytes+1))
+	gz.Close()
+	return buf.Bytes()
+})
+
+func TestPostOTLPLogs_BodyTooLarge(t *testing.T) {
+	fs := &fakeSink{}
+	h := NewLoggerHandler(fs)
+	req := httptest.NewRequest(http.MethodPost, "/v1/logs", bytes.NewReader(gzipBomb()))
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	h.PostOTLPLogs(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(fs.lines) != 0 {
+		t.Fatalf("expected nothing written, got %q", fs.lines)
+	}
+}
+
+func TestPostOTLPLogs_ProtobufPartialSuccess(t *testing.T) {
+	fs := &fakeSink{}
+	h := NewLoggerHandlerWithFormat(fs, format.JSONFormatter{})
+
+	now := uint64(time.Now().UnixNano())
+	body, err := proto.Marshal(otlpRequest(
+		&logspb.LogRecord{
+			TimeUnixNano:   now,
+			SeverityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_WARN2,
+			Body:           &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "card declined"}},
+			Attributes:     []*commonpb.KeyValue{otlpString("host.name", "override")},
+			TraceId:        []byte{0x5b, 0x8e, 0xff, 0xf7, 0x98, 0x03, 0x81, 0x03, 0xd2, 0x69, 0xb6, 0x33, 0x81, 0x3f, 0xc6, 0x0c},
+			SpanId:         []byte{0xee, 0xe1, 0x9b, 0x7e, 0xc3, 0xc1, 0xb1, 0x74},
+		},
+		&logspb.LogRecord{
+			TimeUnixNano:   uint64(time.Now().AddDate(0, 0, -5).UnixNano()),
+			SeverityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_INFO,
+			Body:           &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "stale"}},
+		},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, gzipped := range []bool{false, true} {
+		fs.lines = nil
+		rr := postOTLP(t, h, "application/x-protobuf", body, gzipped)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var resp collogspb.ExportLogsServiceResponse
+		if err := proto.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid response: %v", err)
+		}
+		if resp.GetPartialSuccess().GetRejectedLogRecords() != 1 || !strings.Contains(resp.GetPartialSuccess().GetErrorMessage(), "log record 1: timestamp outside 3-day window") {
+			t.Fatalf("unexpected partial success: %v", resp.GetPartialSuccess())
+		}
+
+		if len(fs.lines) != 1 {
+			t.Fatalf("expected 1 line, got %q", fs.lines)
+		}
+		for _, want := range []string{
+			`"level":"warn"`, `"app":"checkout"`, `"message":"card declined"`, `"host.name":"override"`,
+			`"trace_id":"5b8efff798038103d269b633813fc60c"`, `"span_id":"eee19b7ec3c1b174"`,
+		} {
+			if !strings.Contains(fs.lines[0], want) {
+				t.Fatalf("expected %s in %s", want, fs.lines[0])
+			}
+		}
+	}
+}
+
+func TestPostOTLPLogs_JSON(t *testing.T) {
+	fs := &fakeSink{}
+	h := NewLoggerHandlerWithFormat(fs, format.JSONFormatter{})
+
+	body := fmt.Sprintf(`{"resourceLogs":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"billing"}}]},
+		"scopeLogs":[{"scope":{"name":"app"},"logRecords":[
+			{"timeUnixNano":"%d","severityNumber":17,"severityText":"ERROR","traceId":"5b8efff798038103d269b633813fc60c","spanId":"eee19b7ec3c1b174",
+			 "body":{"kvlistValue":{"values":[{"key":"code","value":{"intValue":"42"}}]}},
+			 "attributes":[{"key":"retry","value":{"boolValue":true}}]},
+			{"observedTimeUnixNano":"%d","severityText":"debug","body":{"stringValue":"by text"}}
+		]}]}]}`, time.Now().UnixNano(), time.Now().UnixNano())
+
+	rr := postOTLP(t, h, "application/json", []byte(body), false)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("expected a JSON response, got %q", ct)
+	}
+	var resp collogspb.ExportLogsServiceResponse
+	if err := protojson.Unmarshal(rr.Body.Bytes(), &resp); err != nil || resp.PartialSuccess != nil {
+		t.Fatalf("expected full success, got %s (%v)", rr.Body.String(), err)
+	}
+
+	if len(fs.lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", fs.lines)
+	}
+	for _, want := range []string{`"level":"error"`, `"app":"billing"`, `"message":"{\"code\":42}"`, `"retry":true`, `"trace_id":"5b8efff798038103d269b633813fc60c"`} {
+		if !strings.Contains(fs.lines[0], want) {
+			t.Fatalf("expected %s in %s", want, fs.lines[0])
+		}
+	}
+	if !strings.Contains(fs.lines[1], `"level":"debug"`) {
+		t.Fatalf("expected the severity text to be used, got %s", fs.lines[1])
+	}
+}
+
+func TestPostOTLPLogs_JSONKeepsLargeNumbers(t *testing.T) {
+	fs := &fakeSink{}
+	h := NewLoggerHandlerWithFormat(fs, format.JSONFormatter{})
+
+	// Both numbers are unquoted and above 2^53, so a float64 would round them.
+	ts := time.Now().Truncate(time.Second).Add(123456789)
+	body := fmt.Sprintf(`{"resourceLogs":[{"scopeLogs":[{"logRecords":[
+		{"timeUnixNano":%d,"body":{"kvlistValue":{"values":[{"key":"id","value":{"intValue":9007199254740993}}]}}}
+	]}]}]}`, ts.UnixNano())
+
+	rr := postOTLP(t, h, "application/json", []byte(body), false)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(fs.lines) != 1 {
+		t.Fatalf("expected 1 line, got %q", fs.lines)
+	}
+	for _, want := range []string{`"timestamp":"` + ts.UTC().Format(time.RFC3339Nano) + `"`, `"message":"{\"id\":9007199254740993}"`} {
+		if !strings.Contains(fs.lines[0], want) {
+			t.Fatalf("expected %s in %s", want, fs.lines[0])
+		}
+	}
+
+	if rr := postOTLP(t, h, "application/json", []byte(`{"resourceLogs":[]} {}`), false); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for trailing data, got %d", rr.Code)
+	}
+}
+
+func TestPostOTLPLogs_Errors(t *testing.T) {
+	h := NewLoggerHandler(&fakeSink{})
+
+	if rr := postOTLP(t, h, "text/plain", []byte("x"), false); rr.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415, got %d", rr.Code)
+	}
+	if rr := postOTLP(t, h, "application/x-protobuf", []byte{0xff, 0xff}, false); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rr.Code)
+	}
+	if rr := postOTLP(t, h, "application/json", []byte(`{"resourceLogs":[{"scopeLogs":[{"logRecords":[{"traceId":"zz"}]}]}]}`), false); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a non-hex trace ID, got %d", rr.Code)
+	}
+
+	h = NewLoggerHandler(&fakeSink{err: fmt.Errorf("disk on fire")})
+	body, _ := proto.Marshal(otlpRequest(&logspb.LogRecord{
+		TimeUnixNano: uint64(time.Now().UnixNano()),
+		Body:         &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "x"}},
+	}))
+	if rr := postOTLP(t, h, "application/x-protobuf", body, false); rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rr.Code)
+	}
+}
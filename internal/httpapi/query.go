@@ -0,0 +1,140 @@
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"logger/internal/model"
+	"logger/internal/query"
+)
+
+const (
+	defaultQueryLimit = 100
+	maxQueryLimit     = 1000
+)
+
+// QueryHandler serves read access to the dated log files.
+type QueryHandler struct {
+	Reader *query.Reader
+}
+
+// NewQueryHandler constructs a QueryHandler.
+func NewQueryHandler(r *query.Reader) *QueryHandler {
+	return &QueryHandler{Reader: r}
+}
+
+// queryResult is the response body for GET /logs.
+type queryResult struct {
+	Events     []model.EventPayload `json:"events"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+}
+
+// GetLogs handles GET /logs.
+//
+// Query parameters: from, to (RFC3339), level (minimum level), app, user,
+// q (message substring), regex (message pattern), field.<key>=<value> (field
+// equality), limit (default 100, max 1000) and cursor (from a previous response).
+func (h *QueryHandler) GetLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	filter, err := parseFilter(params)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	limit := defaultQueryLimit
+	if v := strings.TrimSpace(params.Get("limit")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxQueryLimit {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxQueryLimit))
+			return
+		}
+		limit = n
+	}
+
+	page, err := h.Reader.Query(r.Context(), filter, params.Get("cursor"), limit)
+	if err != nil {
+		if errors.Is(err, query.ErrInvalidCursor) {
+			writeJSONError(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to read logs")
+		return
+	}
+
+	result := queryResult{Events: make([]model.EventPayload, 0, len(page.Events)), NextCursor: page.NextCursor}
+	for _, ev := range page.Events {
+		result.Events = append(result.Events, model.EventPayload{
+			Timestamp: ev.Timestamp.Format(time.RFC3339),
+			Level:     string(ev.Level),
+			Message:   ev.Message,
+			User:      ev.User,
+			App:       ev.App,
+			Fields:    ev.Fields,
+		})
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// parseFilter builds a query.Filter from the request's query parameters.
+func parseFilter(params url.Values) (query.Filter, error) {
+	var f query.Filter
+
+	for _, bound := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &f.From}, {"to", &f.To}} {
+		v := strings.TrimSpace(params.Get(bound.name))
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return f, fmt.Errorf("invalid %s: must be RFC3339", bound.name)
+		}
+		*bound.dst = t
+	}
+
+	if v := strings.TrimSpace(params.Get("level")); v != "" {
+		level, err := model.ParseLogLevel(v)
+		if err != nil {
+			return f, err
+		}
+		f.MinLevel = level
+	}
+
+	f.App = strings.TrimSpace(params.Get("app"))
+	f.User = strings.TrimSpace(params.Get("user"))
+	f.Contains = params.Get("q")
+
+	if v := params.Get("regex"); v != "" {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return f, fmt.Errorf("invalid regex: %v", err)
+		}
+		f.Regex = re
+	}
+
+	for key, values := range params {
+		name, ok := strings.CutPrefix(key, "field.")
+		if !ok || name == "" || len(values) == 0 {
+			continue
+		}
+		if f.Fields == nil {
+			f.Fields = make(map[string]string)
+		}
+		f.Fields[name] = values[0]
+	}
+	return f, nil
+}
@@ -0,0 +1,92 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"logger/internal/query"
+)
+
+func TestGetLogs_FiltersAndPaginates(t *testing.T) {
+	dir := t.TempDir()
+	content := "[2026-02-09T10:00:00Z] [INFO]  [api] first | id=1\n" +
+		"[2026-02-09T11:00:00Z] [ERROR] [api] second | id=2\n" +
+		"[2026-02-09T12:00:00Z] [ERROR] [web] third | id=3\n"
+	if err := os.WriteFile(filepath.Join(dir, "2026-02-09.log"), []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write log file: %v", err)
+	}
+	h := NewQueryHandler(query.NewReader(dir))
+
+	req := httptest.NewRequest(http.MethodGet, "/logs?level=warn&limit=1", nil)
+	rr := httptest.NewRecorder()
+	h.GetLogs(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	var result queryResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(result.Events) != 1 || result.Events[0].Message != "second" || result.NextCursor == "" {
+		t.Fatalf("unexpected first page: %+v", result)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/logs?level=warn&limit=1&cursor="+result.NextCursor, nil)
+	rr = httptest.NewRecorder()
+	h.GetLogs(rr, req)
+
+	result = queryResult{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(result.Events) != 1 || result.Events[0].Message != "third" || result.Events[0].App != "web" {
+		t.Fatalf("unexpected second page: %+v", result)
+	}
+}
+
+func TestGetLogs_FieldFilter(t *testing.T) {
+	dir := t.TempDir()
+	content := "[2026-02-09T10:00:00Z] [INFO]  first | id=1\n" +
+		"[2026-02-09T11:00:00Z] [INFO]  second | id=2\n"
+	if err := os.WriteFile(filepath.Join(dir, "2026-02-09.log"), []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write log file: %v", err)
+	}
+	h := NewQueryHandler(query.NewReader(dir))
+
+	req := httptest.NewRequest(http.MethodGet, "/logs?field.id=2", nil)
+	rr := httptest.NewRecorder()
+	h.GetLogs(rr, req)
+
+	var result queryResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(result.Events) != 1 || result.Events[0].Message != "second" {
+		t.Fatalf("unexpected events: %+v", result.Events)
+	}
+}
+
+func TestGetLogs_InvalidParameters(t *testing.T) {
+	h := NewQueryHandler(query.NewReader(t.TempDir()))
+
+	for _, target := range []string{
+		"/logs?from=yesterday",
+		"/logs?level=loud",
+		"/logs?regex=(",
+		"/logs?limit=0",
+		"/logs?cursor=!!",
+	} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rr := httptest.NewRecorder()
+		h.GetLogs(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected status %d, got %d", target, http.StatusBadRequest, rr.Code)
+		}
+	}
+}
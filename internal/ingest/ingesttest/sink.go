@@ -0,0 +1,76 @@
+// Package ingesttest provides a recording sink for the tests of the ingest
+// protocols.
+package ingesttest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"logger/internal/format"
+	"logger/internal/sink"
+)
+
+// Sink is a sink.EventSink that records the events written to it. It is safe for
+// concurrent use.
+type Sink struct {
+	// Err, when set before the sink is used, fails every write.
+	Err error
+
+	mu      sync.Mutex
+	records []sink.EventRecord
+}
+
+// WriteEvents records the events, or returns Err.
+func (s *Sink) WriteEvents(ctx context.Context, records []sink.EventRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return s.Err
+	}
+	s.records = append(s.records, records...)
+	return nil
+}
+
+// Records returns the records written so far.
+func (s *Sink) Records() []sink.EventRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sink.EventRecord(nil), s.records...)
+}
+
+// Lines returns the events written so far in the JSON Lines format.
+func (s *Sink) Lines() []string {
+	var lines []string
+	for _, rec := range s.Records() {
+		line, err := format.JSONFormatter{}.Format(rec.Event)
+		if err != nil {
+			line = "?" + rec.Event.Message
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// Messages returns "level:app:message" for each event written so far.
+func (s *Sink) Messages() []string {
+	var msgs []string
+	for _, rec := range s.Records() {
+		msgs = append(msgs, string(rec.Event.Level)+":"+rec.Event.App+":"+rec.Event.Message)
+	}
+	return msgs
+}
+
+// WaitForMessages waits up to five seconds for n events and returns Messages.
+func (s *Sink) WaitForMessages(t testing.TB, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(s.Messages()) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d messages, got %q", n, s.Messages())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return s.Messages()
+}
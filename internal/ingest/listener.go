@@ -0,0 +1,244 @@
+package ingest
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"logger/internal/model"
+	"logger/internal/sink"
+)
+
+// maxFramedBatch is the most messages of one connection written as one batch.
+const maxFramedBatch = 512
+
+// ErrFrameTooLarge is returned by a FrameReader for a message over its limit. The
+// message was skipped, so the stream can still be read.
+var ErrFrameTooLarge = errors.New("message too large")
+
+// FrameReader reads one message of at most maxBytes from r.
+type FrameReader func(r *bufio.Reader, maxBytes int) ([]byte, error)
+
+// Decoder parses one message, received at now, into an event payload.
+type Decoder func(msg []byte, now time.Time) (model.EventPayload, error)
+
+// Framing describes a TCP stream of self-delimited messages for ServeFramed.
+type Framing struct {
+	Read        FrameReader
+	MaxBytes    int
+	IdleTimeout time.Duration // the connection is closed after this long without data
+	Decode      Decoder
+}
+
+// Listener runs the UDP and TCP listeners of a protocol server and tracks its
+// connections, so that the protocol packages only frame and parse messages.
+type Listener struct {
+	name string
+
+	udp *net.UDPConn
+	tcp net.Listener
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// NewListener creates a Listener whose errors and log messages are prefixed with
+// name, e.g. "syslog".
+func NewListener(name string) *Listener {
+	return &Listener{name: name, conns: make(map[net.Conn]struct{})}
+}
+
+// ListenUDP opens a UDP listener on addr and calls handle with every datagram,
+// truncated to maxBytes, from a single background goroutine. The datagram is
+// only valid until handle returns.
+func (l *Listener) ListenUDP(addr string, maxBytes int, handle func(data []byte)) error {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return fmt.Errorf("%s udp address: %w", l.name, err)
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return fmt.Errorf("%s udp listener: %w", l.name, err)
+	}
+	l.udp = conn
+	l.wg.Add(1)
+	go l.serveUDP(maxBytes, handle)
+	return nil
+}
+
+// ListenTCP opens a TCP listener on addr and calls handle with every accepted
+// connection, each from its own goroutine. The connection is closed when handle
+// returns, or when the Listener is closed.
+func (l *Listener) ListenTCP(addr string, handle func(conn net.Conn)) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("%s tcp listener: %w", l.name, err)
+	}
+	l.tcp = ln
+	l.wg.Add(1)
+	go l.serveTCP(handle)
+	return nil
+}
+
+// UDPAddr returns the address of the UDP listener, or nil when it is not open.
+func (l *Listener) UDPAddr() net.Addr {
+	if l.udp == nil {
+		return nil
+	}
+	return l.udp.LocalAddr()
+}
+
+// TCPAddr returns the address of the TCP listener, or nil when it is not open.
+func (l *Listener) TCPAddr() net.Addr {
+	if l.tcp == nil {
+		return nil
+	}
+	return l.tcp.Addr()
+}
+
+func (l *Listener) serveUDP(maxBytes int, handle func([]byte)) {
+	defer l.wg.Done()
+	buf := make([]byte, maxBytes)
+	for {
+		n, _, err := l.udp.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("%s: udp read: %v", l.name, err)
+			continue
+		}
+		handle(buf[:n])
+	}
+}
+
+func (l *Listener) serveTCP(handle func(net.Conn)) {
+	defer l.wg.Done()
+	for {
+		conn, err := l.tcp.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("%s: tcp accept: %v", l.name, err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		l.mu.Lock()
+		if l.closed {
+			l.mu.Unlock()
+			conn.Close()
+			return
+		}
+		l.conns[conn] = struct{}{}
+		l.wg.Add(1)
+		l.mu.Unlock()
+		go l.handleConn(conn, handle)
+	}
+}
+
+func (l *Listener) handleConn(conn net.Conn, handle func(net.Conn)) {
+	defer l.wg.Done()
+	defer func() {
+		l.mu.Lock()
+		delete(l.conns, conn)
+		l.mu.Unlock()
+		conn.Close()
+	}()
+	handle(conn)
+}
+
+// ServeFramed reads messages from conn as f describes until the connection ends,
+// and writes them through p. Messages already buffered are written together, so a
+// busy connection is written in batches. Messages that are too long or fail to
+// decode or validate are logged and dropped: these protocols cannot report them
+// to the sender.
+func (l *Listener) ServeFramed(conn net.Conn, p *Pipeline, f Framing) {
+	r := bufio.NewReaderSize(conn, 64<<10)
+	var batch []sink.EventRecord
+	for {
+		if len(batch) > 0 && (r.Buffered() == 0 || len(batch) >= maxFramedBatch) {
+			l.write(p, batch)
+			batch = batch[:0]
+		}
+		conn.SetReadDeadline(time.Now().Add(f.IdleTimeout))
+		msg, err := f.Read(r, f.MaxBytes)
+		if errors.Is(err, ErrFrameTooLarge) {
+			log.Printf("%s: dropped message over %d bytes from %s", l.name, f.MaxBytes, conn.RemoteAddr())
+			continue
+		}
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				log.Printf("%s: tcp connection from %s: %v", l.name, conn.RemoteAddr(), err)
+			}
+			l.write(p, batch)
+			return
+		}
+		if len(msg) == 0 {
+			continue
+		}
+		if rec, ok := l.record(p, msg, "tcp", f.Decode); ok {
+			batch = append(batch, rec)
+		}
+	}
+}
+
+// WriteMessage decodes one message received over transport, such as a UDP
+// datagram, and writes it through p on its own. Failures are logged as in
+// ServeFramed.
+func (l *Listener) WriteMessage(p *Pipeline, msg []byte, transport string, decode Decoder) {
+	if rec, ok := l.record(p, msg, transport, decode); ok {
+		l.write(p, []sink.EventRecord{rec})
+	}
+}
+
+func (l *Listener) record(p *Pipeline, msg []byte, transport string, decode Decoder) (sink.EventRecord, bool) {
+	payload, err := decode(msg, time.Now())
+	if err == nil {
+		var rec sink.EventRecord
+		if rec, err = p.Record(payload); err == nil {
+			return rec, true
+		}
+	}
+	log.Printf("%s: dropped %s message: %v", l.name, transport, err)
+	return sink.EventRecord{}, false
+}
+
+func (l *Listener) write(p *Pipeline, records []sink.EventRecord) {
+	if err := p.Write(context.Background(), records); err != nil {
+		log.Printf("%s: failed to write %d messages: %v", l.name, len(records), err)
+	}
+}
+
+// Close stops the listeners, closes open connections and waits for the handlers
+// to return, so messages being handled are written first.
+func (l *Listener) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	var errs []error
+	if l.udp != nil {
+		errs = append(errs, l.udp.Close())
+	}
+	if l.tcp != nil {
+		errs = append(errs, l.tcp.Close())
+	}
+	for conn := range l.conns {
+		conn.Close()
+	}
+	l.mu.Unlock()
+
+	l.wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,146 @@
+package ingest
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"logger/internal/format"
+	"logger/internal/ingest/ingesttest"
+	"logger/internal/model"
+)
+
+func TestListener_UDP(t *testing.T) {
+	l := NewListener("test")
+	got := make(chan string, 2)
+	if err := l.ListenUDP("127.0.0.1:0", 4, func(data []byte) { got <- string(data) }); err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	defer l.Close()
+	if l.TCPAddr() != nil {
+		t.Fatalf("expected no TCP address, got %v", l.TCPAddr())
+	}
+
+	conn, err := net.Dial("udp", l.UDPAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("ab"))
+	conn.Write([]byte("truncated"))
+	for _, want := range []string{"ab", "trun"} {
+		select {
+		case data := <-got:
+			if data != want {
+				t.Fatalf("expected %q, got %q", want, data)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+}
+
+func TestListener_CloseEndsOpenConnections(t *testing.T) {
+	l := NewListener("test")
+	handled := make(chan struct{})
+	if err := l.ListenTCP("127.0.0.1:0", func(conn net.Conn) {
+		io.Copy(io.Discard, conn)
+		close(handled)
+	}); err != nil {
+		t.Fatalf("ListenTCP failed: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", l.TCPAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("hello"))
+	// Wait for the connection to be accepted before closing.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		l.mu.Lock()
+		n := len(l.conns)
+		l.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the connection")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	// Close waits for the handler, which ends once its connection is closed.
+	select {
+	case <-handled:
+	default:
+		t.Fatal("expected Close to wait for the handler")
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("second Close failed: %v", err)
+	}
+}
+
+// readTestLine is a FrameReader for newline-terminated messages.
+func readTestLine(r *bufio.Reader, maxBytes int) ([]byte, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) > maxBytes+1 {
+		return nil, ErrFrameTooLarge
+	}
+	return []byte(strings.TrimSuffix(line, "\n")), nil
+}
+
+func TestListener_ServeFramed(t *testing.T) {
+	fs := &ingesttest.Sink{}
+	p := &Pipeline{Sink: fs, Formatter: format.TextFormatter{}}
+	decode := func(msg []byte, now time.Time) (model.EventPayload, error) {
+		if string(msg) == "bad" {
+			return model.EventPayload{}, errors.New("unparseable")
+		}
+		return model.EventPayload{Timestamp: now.UTC().Format(time.RFC3339), Level: "info", Message: string(msg)}, nil
+	}
+
+	l := NewListener("test")
+	defer l.Close()
+	served := make(chan struct{})
+	if err := l.ListenTCP("127.0.0.1:0", func(conn net.Conn) {
+		l.ServeFramed(conn, p, Framing{Read: readTestLine, MaxBytes: 8, IdleTimeout: time.Minute, Decode: decode})
+		close(served)
+	}); err != nil {
+		t.Fatalf("ListenTCP failed: %v", err)
+	}
+	conn, err := net.Dial("tcp", l.TCPAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("one\n\nbad\nfar too long\ntwo\n"))
+	conn.Close()
+
+	// ServeFramed writes what it read before returning at the end of the stream.
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the connection to be served")
+	}
+	if got := fs.Messages(); len(got) != 2 || got[0] != "info::one" || got[1] != "info::two" {
+		t.Fatalf("expected one and two, got %q", got)
+	}
+
+	l = NewListener("test")
+	l.WriteMessage(p, []byte("three"), "udp", decode)
+	l.WriteMessage(p, []byte("bad"), "udp", decode)
+	if got := fs.Messages(); len(got) != 3 || got[2] != "info::three" {
+		t.Fatalf("expected three to be written on its own, got %q", got)
+	}
+}
@@ -0,0 +1,76 @@
+// Package ingest holds what every ingest protocol shares with POST /logs: payload
+// validation, pre-rendering in the server's format and writing to the sink. It also
+// holds the UDP and TCP listeners of the socket protocols (Listener), including the
+// batching reader of message-per-frame TCP streams (Listener.ServeFramed).
+package ingest
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"logger/internal/format"
+	"logger/internal/model"
+	"logger/internal/sink"
+)
+
+// ErrFormat is returned by Record when a valid event cannot be rendered.
+var ErrFormat = errors.New("failed to format event")
+
+// Pipeline validates payloads, pre-renders them and writes them to a sink.
+type Pipeline struct {
+	Sink sink.EventSink
+	// Formatter pre-renders accepted events, as LoggerHandler.Formatter does. The
+	// line is only a cache: sinks formatting with the same formatter reuse it.
+	Formatter format.Formatter
+}
+
+// NewPipeline constructs a Pipeline writing to s, pre-rendering events with f (the
+// text format when nil). Line-based sinks are wrapped with sink.AsEventSink, so
+// they write f's format.
+func NewPipeline(s sink.Sink, f format.Formatter) *Pipeline {
+	if f == nil {
+		f = format.TextFormatter{}
+	}
+	return &Pipeline{Sink: sink.AsEventSink(s, f), Formatter: f}
+}
+
+// Record validates payload with ToEvent and pairs the event with its pre-rendered
+// line. Validation errors are returned as is, for reporting to the sender.
+func (p *Pipeline) Record(payload model.EventPayload) (sink.EventRecord, error) {
+	ev, err := payload.ToEvent()
+	if err != nil {
+		return sink.EventRecord{}, err
+	}
+	line, err := p.Formatter.Format(ev)
+	if err != nil {
+		return sink.EventRecord{}, ErrFormat
+	}
+	return sink.EventRecord{Event: ev, Rendered: []byte(line), RenderedBy: p.Formatter}, nil
+}
+
+// Write writes records to the sink in one call.
+func (p *Pipeline) Write(ctx context.Context, records []sink.EventRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	return p.Sink.WriteEvents(ctx, records)
+}
+
+// ParseLevel reads the level names of other logging systems: besides debug, info,
+// warn and error it accepts trace, warning, notice, fatal, critical and the syslog
+// keywords, in any case. It reports false for anything else.
+func ParseLevel(s string) (model.LogLevel, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "trace", "debug", "dbug":
+		return model.LevelDebug, true
+	case "info", "information", "informational", "notice":
+		return model.LevelInfo, true
+	case "warn", "warning":
+		return model.LevelWarn, true
+	case "error", "err", "eror", "fatal", "critical", "crit", "alert", "emerg", "emergency", "panic":
+		return model.LevelError, true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,60 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"logger/internal/format"
+	"logger/internal/ingest/ingesttest"
+	"logger/internal/model"
+	"logger/internal/sink"
+)
+
+// failingFormatter fails on every event.
+type failingFormatter struct{ format.JSONFormatter }
+
+func (failingFormatter) Format(model.Event) (string, error) { return "", errors.New("boom") }
+
+func TestPipeline_RecordValidatesAndRenders(t *testing.T) {
+	fs := &ingesttest.Sink{}
+	p := &Pipeline{Sink: fs, Formatter: format.JSONFormatter{}}
+
+	rec, err := p.Record(model.EventPayload{Timestamp: time.Now().UTC().Format(time.RFC3339), Level: "WARN", Message: " hi "})
+	if err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	if rec.Event.Level != model.LevelWarn || rec.Event.Message != "hi" || !strings.Contains(string(rec.Rendered), `"message":"hi"`) || rec.RenderedBy != (format.JSONFormatter{}) {
+		t.Fatalf("unexpected record: %+v %s", rec.Event, rec.Rendered)
+	}
+	if err := p.Write(context.Background(), []sink.EventRecord{rec}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if got := fs.Records(); len(got) != 1 || string(got[0].Rendered) != string(rec.Rendered) {
+		t.Fatalf("expected the pre-rendered record, got %+v", got)
+	}
+
+	if _, err := p.Record(model.EventPayload{Timestamp: time.Now().UTC().Format(time.RFC3339), Level: "info"}); err == nil || err.Error() != "missing field: message" {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	p.Formatter = failingFormatter{}
+	if _, err := p.Record(model.EventPayload{Timestamp: time.Now().UTC().Format(time.RFC3339), Level: "info", Message: "x"}); !errors.Is(err, ErrFormat) {
+		t.Fatalf("expected ErrFormat, got %v", err)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for in, want := range map[string]model.LogLevel{
+		"TRACE": model.LevelDebug, "debug": model.LevelDebug, "Notice": model.LevelInfo, "info": model.LevelInfo,
+		"warning": model.LevelWarn, "WARN": model.LevelWarn, "err": model.LevelError, "fatal": model.LevelError, "critical": model.LevelError,
+	} {
+		if got, ok := ParseLevel(in); !ok || got != want {
+			t.Errorf("ParseLevel(%q) = %q, %v; want %q", in, got, ok, want)
+		}
+	}
+	if _, ok := ParseLevel("loud"); ok {
+		t.Errorf("expected an unknown level to be rejected")
+	}
+}
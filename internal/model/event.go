@@ -33,6 +33,23 @@ func ParseLogLevel(s string) (LogLevel, error) {
 	}
 }
 
+// Severity orders levels from least (debug) to most (error) severe.
+// Unknown levels have severity 0, below debug.
+func (l LogLevel) Severity() int {
+	switch l {
+	case LevelDebug:
+		return 1
+	case LevelInfo:
+		return 2
+	case LevelWarn:
+		return 3
+	case LevelError:
+		return 4
+	default:
+		return 0
+	}
+}
+
 // EventPayload is the JSON payload as received over HTTP.
 type EventPayload struct {
 	Timestamp string         `json:"timestamp"`
@@ -109,3 +126,16 @@ func (p *EventPayload) ToEvent() (Event, error) {
 	return ev, nil
 }
 
+
+// Payload converts the event back into its JSON payload, for relaying it to another
+// logger-server. The timestamp keeps its sub-second precision.
+func (e Event) Payload() EventPayload {
+	return EventPayload{
+		Timestamp: e.Timestamp.Format(time.RFC3339Nano),
+		Level:     string(e.Level),
+		Message:   e.Message,
+		User:      e.User,
+		App:       e.App,
+		Fields:    e.Fields,
+	}
+}
@@ -134,3 +134,15 @@ func TestToEvent_3DayWindowValidation_Reject_InTwoDays(t *testing.T) {
 	}
 }
 
+
+func TestLogLevel_Severity(t *testing.T) {
+	ordered := []LogLevel{LevelDebug, LevelInfo, LevelWarn, LevelError}
+	for i := 1; i < len(ordered); i++ {
+		if ordered[i].Severity() <= ordered[i-1].Severity() {
+			t.Fatalf("expected %s to be more severe than %s", ordered[i], ordered[i-1])
+		}
+	}
+	if LogLevel("trace").Severity() >= LevelDebug.Severity() {
+		t.Fatalf("expected unknown level to be less severe than debug")
+	}
+}
@@ -0,0 +1,318 @@
+package query
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"logger/internal/format"
+	"logger/internal/model"
+	"logger/internal/sink"
+)
+
+// dateLayout is the layout of the dates in log file paths.
+const dateLayout = "2006-01-02"
+
+// ErrInvalidCursor is returned when a cursor was not produced by this package.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Filter selects events. Zero-valued fields do not filter.
+type Filter struct {
+	From     time.Time      // inclusive lower bound on the event timestamp
+	To       time.Time      // inclusive upper bound on the event timestamp
+	MinLevel model.LogLevel // only events at least this severe
+	App      string
+	User     string
+	Contains string            // substring of the message
+	Regex    *regexp.Regexp    // pattern matched against the message
+	Fields   map[string]string // field values, compared in their formatted form
+}
+
+// Match reports whether ev satisfies every condition of the filter.
+func (f Filter) Match(ev model.Event) bool {
+	if !f.From.IsZero() && ev.Timestamp.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && ev.Timestamp.After(f.To) {
+		return false
+	}
+	if f.MinLevel != "" && ev.Level.Severity() < f.MinLevel.Severity() {
+		return false
+	}
+	if f.App != "" && ev.App != f.App {
+		return false
+	}
+	if f.User != "" && ev.User != f.User {
+		return false
+	}
+	if f.Contains != "" && !strings.Contains(ev.Message, f.Contains) {
+		return false
+	}
+	if f.Regex != nil && !f.Regex.MatchString(ev.Message) {
+		return false
+	}
+	for k, want := range f.Fields {
+		v, ok := ev.Fields[k]
+		if !ok || format.FieldString(v) != want {
+			return false
+		}
+	}
+	return true
+}
+
+// Page is one page of query results.
+type Page struct {
+	Events []model.Event
+	// NextCursor resumes the query after the last returned event; empty when exhausted.
+	NextCursor string
+}
+
+// cursor is a position in the log files: the next line to read is at Offset in
+// File (relative to the log directory, "/"-separated), which holds events of Date.
+type cursor struct {
+	Date   string
+	File   string
+	Offset int64
+}
+
+func (c cursor) encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.Date + ":" + strconv.FormatInt(c.Offset, 10) + ":" + c.File))
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	date, rest, ok := strings.Cut(string(data), ":")
+	if !ok {
+		return c, ErrInvalidCursor
+	}
+	off, file, ok := strings.Cut(rest, ":")
+	if !ok || file == "" {
+		return c, ErrInvalidCursor
+	}
+	if _, err := time.Parse(dateLayout, date); err != nil {
+		return c, ErrInvalidCursor
+	}
+	offset, err := strconv.ParseInt(off, 10, 64)
+	if err != nil || offset < 0 {
+		return c, ErrInvalidCursor
+	}
+	return cursor{Date: date, File: file, Offset: offset}, nil
+}
+
+// Reader queries the log files written by sink.FileSink.
+type Reader struct {
+	logDir    string
+	formatter format.Formatter
+	paths     *sink.PathTemplate
+}
+
+// ReaderOptions configures a Reader. The zero value reads text-format daily files.
+type ReaderOptions struct {
+	// Formatter parses the lines (default text).
+	Formatter format.Formatter
+	// Paths is the layout the files were written with (default one file per day,
+	// named after the date with the formatter's extension).
+	Paths *sink.PathTemplate
+}
+
+// NewReader creates a Reader over the text-format log files in the given directory.
+func NewReader(logDir string) *Reader {
+	return NewReaderWithOptions(logDir, ReaderOptions{})
+}
+
+// NewReaderWithFormat creates a Reader over daily files written with f, using its
+// extension to find them and its parser to read them.
+func NewReaderWithFormat(logDir string, f format.Formatter) *Reader {
+	return NewReaderWithOptions(logDir, ReaderOptions{Formatter: f})
+}
+
+// NewReaderWithOptions creates a Reader with the given options.
+func NewReaderWithOptions(logDir string, opts ReaderOptions) *Reader {
+	r := &Reader{logDir: logDir, formatter: opts.Formatter, paths: opts.Paths}
+	if r.formatter == nil {
+		r.formatter = format.TextFormatter{}
+	}
+	if r.paths == nil {
+		r.paths = sink.DefaultPathTemplate(r.formatter.Extension())
+	}
+	return r
+}
+
+// Query returns up to limit events matching f, starting at the position encoded in
+// after (or at the beginning when empty). Only files whose date falls within the
+// filter's time range (and, when the path layout names them, whose app and level
+// can match) are scanned, oldest date first. Lines that cannot be parsed are skipped.
+func (r *Reader) Query(ctx context.Context, f Filter, after string, limit int) (Page, error) {
+	var page Page
+
+	start := cursor{}
+	var startFile logFile
+	if after != "" {
+		c, err := decodeCursor(after)
+		if err != nil {
+			return page, err
+		}
+		info, ok := r.paths.Match(c.File)
+		if !ok || info.Date != c.Date {
+			return page, ErrInvalidCursor
+		}
+		start, startFile = c, newLogFile(c.File, info)
+	}
+
+	files, err := r.files(f)
+	if err != nil {
+		return page, err
+	}
+
+	for _, file := range files {
+		if after != "" && file.less(startFile) {
+			continue
+		}
+		offset := int64(0)
+		if file.rel == start.File {
+			offset = start.Offset
+		}
+
+		next, err := r.scanFile(ctx, file.path, offset, f, limit, &page)
+		if err != nil {
+			return page, err
+		}
+		if len(page.Events) >= limit {
+			page.NextCursor = cursor{Date: file.date, File: file.rel, Offset: next}.encode()
+			return page, nil
+		}
+	}
+	return page, nil
+}
+
+// logFile is a log file found under the log directory.
+type logFile struct {
+	date string
+	base string // path of the file's first rotation part
+	part int
+	rel  string // relative to the log directory, "/"-separated, without compression suffix
+	path string // path on disk; may point to the compressed copy
+}
+
+func newLogFile(rel string, info sink.PathInfo) logFile {
+	return logFile{date: info.Date, base: info.Base, part: info.Part, rel: rel}
+}
+
+// less orders files by date, then path, with rotation parts in order.
+func (f logFile) less(o logFile) bool {
+	if f.date != o.date {
+		return f.date < o.date
+	}
+	if f.base != o.base {
+		return f.base < o.base
+	}
+	return f.part < o.part
+}
+
+// files lists the log files that may hold events matching f, ordered by date and
+// path, with the rotation parts of a file in order. A file being compacted is
+// listed once, preferring the plain copy.
+func (r *Reader) files(f Filter) ([]logFile, error) {
+	var from, to string
+	if !f.From.IsZero() {
+		from = f.From.UTC().Format(dateLayout)
+	}
+	if !f.To.IsZero() {
+		to = f.To.UTC().Format(dateLayout)
+	}
+
+	byRel := make(map[string]logFile)
+	err := sink.WalkLogFiles(r.logDir, r.paths, func(lf sink.LogFile) error {
+		if _, err := time.Parse(dateLayout, lf.Date); err != nil {
+			return nil
+		}
+		if (from != "" && lf.Date < from) || (to != "" && lf.Date > to) {
+			return nil
+		}
+		if f.App != "" && lf.App != "" && lf.App != sink.PathSegment(f.App) {
+			return nil
+		}
+		if f.MinLevel != "" && lf.Level != "" && model.LogLevel(lf.Level).Severity() < f.MinLevel.Severity() {
+			return nil
+		}
+		if _, dup := byRel[lf.Rel]; dup && lf.Compression != "" {
+			return nil
+		}
+		file := newLogFile(lf.Rel, lf.PathInfo)
+		file.path = lf.Path
+		byRel[lf.Rel] = file
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list log files: %w", err)
+	}
+
+	files := make([]logFile, 0, len(byRel))
+	for _, file := range byRel {
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].less(files[j]) })
+	return files, nil
+}
+
+// scanFile appends matching events from one file to page, starting at offset, until
+// the page holds limit events. It returns the offset just past the last line consumed.
+// A trailing line without a newline is still being written and is left for later.
+// Offsets in compressed files count uncompressed bytes, so a cursor stays valid
+// when its file is compacted between pages.
+func (r *Reader) scanFile(ctx context.Context, path string, offset int64, f Filter, limit int, page *Page) (int64, error) {
+	file, err := sink.OpenLogFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return offset, nil
+		}
+		return offset, fmt.Errorf("open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	if seeker, ok := file.(io.Seeker); ok {
+		if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+			return offset, fmt.Errorf("seek %s: %w", path, err)
+		}
+	} else if _, err := io.CopyN(io.Discard, file, offset); err != nil && err != io.EOF {
+		return offset, fmt.Errorf("skip to offset in %s: %w", path, err)
+	}
+
+	br := bufio.NewReader(file)
+	for len(page.Events) < limit {
+		if err := ctx.Err(); err != nil {
+			return offset, err
+		}
+
+		line, err := br.ReadString('\n')
+		if err == io.EOF {
+			return offset, nil
+		}
+		if err != nil {
+			return offset, fmt.Errorf("read %s: %w", path, err)
+		}
+		offset += int64(len(line))
+
+		ev, err := r.formatter.Parse(strings.TrimSuffix(line, "\n"))
+		if err != nil {
+			continue
+		}
+		if f.Match(ev) {
+			page.Events = append(page.Events, ev)
+		}
+	}
+	return offset, nil
+}
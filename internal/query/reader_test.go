@@ -0,0 +1,277 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"logger/internal/format"
+	"logger/internal/model"
+	"logger/internal/sink"
+)
+
+func writeLogFile(t *testing.T, dir, date string, lines ...string) {
+	t.Helper()
+	content := strings.Join(lines, "\n") + "\n"
+	if err := os.WriteFile(filepath.Join(dir, date+".log"), []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write log file: %v", err)
+	}
+}
+
+func messages(events []model.Event) []string {
+	out := make([]string, len(events))
+	for i, ev := range events {
+		out[i] = ev.Message
+	}
+	return out
+}
+
+func TestReader_FiltersEvents(t *testing.T) {
+	dir := t.TempDir()
+	writeLogFile(t, dir, "2026-02-09",
+		"[2026-02-09T10:00:00Z] [DEBUG] [api] noisy detail",
+		"[2026-02-09T11:00:00Z] [WARN]  [api] [alice] disk almost full | disk=sda pct=91",
+		"not a log line",
+		"[2026-02-09T12:00:00Z] [ERROR] [web] [bob] request failed | status=500",
+	)
+
+	r := NewReader(dir)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"all", Filter{}, []string{"noisy detail", "disk almost full", "request failed"}},
+		{"min level", Filter{MinLevel: model.LevelWarn}, []string{"disk almost full", "request failed"}},
+		{"app", Filter{App: "api"}, []string{"noisy detail", "disk almost full"}},
+		{"user", Filter{User: "bob"}, []string{"request failed"}},
+		{"substring", Filter{Contains: "full"}, []string{"disk almost full"}},
+		{"regex", Filter{Regex: regexp.MustCompile(`^(noisy|request)`)}, []string{"noisy detail", "request failed"}},
+		{"field", Filter{Fields: map[string]string{"status": "500"}}, []string{"request failed"}},
+		{"time range", Filter{
+			From: time.Date(2026, 2, 9, 10, 30, 0, 0, time.UTC),
+			To:   time.Date(2026, 2, 9, 11, 30, 0, 0, time.UTC),
+		}, []string{"disk almost full"}},
+	}
+
+	for _, tt := range tests {
+		page, err := r.Query(ctx, tt.filter, "", 100)
+		if err != nil {
+			t.Fatalf("%s: Query failed: %v", tt.name, err)
+		}
+		got := messages(page.Events)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Fatalf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+		if page.NextCursor != "" {
+			t.Fatalf("%s: expected no next cursor, got %q", tt.name, page.NextCursor)
+		}
+	}
+}
+
+func TestReader_ScansOnlyFilesInRange(t *testing.T) {
+	dir := t.TempDir()
+	writeLogFile(t, dir, "2026-02-08", "[2026-02-08T10:00:00Z] [INFO]  day eight")
+	writeLogFile(t, dir, "2026-02-09", "[2026-02-09T10:00:00Z] [INFO]  day nine")
+	writeLogFile(t, dir, "2026-02-10", "[2026-02-10T10:00:00Z] [INFO]  day ten")
+
+	r := NewReader(dir)
+	files, err := r.files(Filter{From: time.Date(2026, 2, 9, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatalf("files failed: %v", err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.rel)
+	}
+	if strings.Join(names, ",") != "2026-02-09.log,2026-02-10.log" {
+		t.Fatalf("unexpected files: %v", names)
+	}
+}
+
+func TestReader_CursorPagination(t *testing.T) {
+	dir := t.TempDir()
+	writeLogFile(t, dir, "2026-02-08",
+		"[2026-02-08T10:00:00Z] [INFO]  one",
+		"[2026-02-08T11:00:00Z] [INFO]  two",
+	)
+	writeLogFile(t, dir, "2026-02-09",
+		"[2026-02-09T10:00:00Z] [INFO]  three",
+	)
+
+	r := NewReader(dir)
+	ctx := context.Background()
+
+	var got []string
+	after := ""
+	for i := 0; i < 5; i++ {
+		page, err := r.Query(ctx, Filter{}, after, 2)
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		got = append(got, messages(page.Events)...)
+		if page.NextCursor == "" {
+			break
+		}
+		after = page.NextCursor
+	}
+
+	if strings.Join(got, ",") != "one,two,three" {
+		t.Fatalf("expected all events exactly once across pages, got %q", got)
+	}
+}
+
+func TestReader_InvalidCursor(t *testing.T) {
+	r := NewReader(t.TempDir())
+	if _, err := r.Query(context.Background(), Filter{}, "!!", 10); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestReader_JSONFormat(t *testing.T) {
+	dir := t.TempDir()
+	writeLogFile(t, dir, "2026-02-09", "[2026-02-09T10:00:00Z] [INFO]  text file is ignored")
+	content := `{"timestamp":"2026-02-09T11:00:00Z","level":"error","message":"failed","fields":{"status":500}}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "2026-02-09.jsonl"), []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write log file: %v", err)
+	}
+
+	r := NewReaderWithFormat(dir, format.JSONFormatter{})
+	page, err := r.Query(context.Background(), Filter{Fields: map[string]string{"status": "500"}}, "", 10)
+	if err != nil {
+		t.Fatalf("Query returned error: %v", err)
+	}
+	if got := messages(page.Events); len(got) != 1 || got[0] != "failed" {
+		t.Fatalf("expected [failed], got %v", got)
+	}
+}
+
+func TestReader_PathTemplate(t *testing.T) {
+	dir := t.TempDir()
+	paths, err := sink.ParsePathTemplate("{app}/{yyyy}/{mm}/{dd}/{level}.log")
+	if err != nil {
+		t.Fatalf("ParsePathTemplate failed: %v", err)
+	}
+	write := func(rel, line string) {
+		p := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatalf("mkdir failed: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(line+"\n"), 0o644); err != nil {
+			t.Fatalf("failed to write log file: %v", err)
+		}
+	}
+	write("api/2026/02/09/info.log", "[2026-02-09T10:00:00Z] [INFO]  [api] api info")
+	write("api/2026/02/09/error.log", "[2026-02-09T11:00:00Z] [ERROR] [api] api error")
+	write("web/2026/02/08/warn.log", "[2026-02-08T09:00:00Z] [WARN]  [web] web warn")
+	write("web/2026/02/09/notes.txt", "not a log file")
+
+	r := NewReaderWithOptions(dir, ReaderOptions{Paths: paths})
+
+	files, err := r.files(Filter{App: "api", MinLevel: model.LevelWarn})
+	if err != nil {
+		t.Fatalf("files failed: %v", err)
+	}
+	if len(files) != 1 || files[0].rel != "api/2026/02/09/error.log" {
+		t.Fatalf("expected only the api error file, got %v", files)
+	}
+
+	var got []string
+	after := ""
+	for i := 0; i < 5; i++ {
+		page, err := r.Query(context.Background(), Filter{}, after, 1)
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		got = append(got, messages(page.Events)...)
+		if page.NextCursor == "" {
+			break
+		}
+		after = page.NextCursor
+	}
+	if strings.Join(got, ",") != "web warn,api error,api info" {
+		t.Fatalf("expected events by date then path, got %q", got)
+	}
+}
+
+func TestReader_RotatedPartsInOrder(t *testing.T) {
+	dir := t.TempDir()
+	for name, msg := range map[string]string{
+		"2026-02-09.log":    "part 0",
+		"2026-02-09.1.log":  "part 1",
+		"2026-02-09.2.log":  "part 2",
+		"2026-02-09.10.log": "part 10",
+		"2026-02-08.1.log":  "earlier day",
+	} {
+		line := "[2026-02-09T10:00:00Z] [INFO]  " + msg + "\n"
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(line), 0o644); err != nil {
+			t.Fatalf("failed to write log file: %v", err)
+		}
+	}
+
+	r := NewReader(dir)
+	var got []string
+	after := ""
+	for i := 0; i < 10; i++ {
+		page, err := r.Query(context.Background(), Filter{}, after, 2)
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		got = append(got, messages(page.Events)...)
+		if page.NextCursor == "" {
+			break
+		}
+		after = page.NextCursor
+	}
+	if strings.Join(got, ",") != "earlier day,part 0,part 1,part 2,part 10" {
+		t.Fatalf("expected parts in order, got %q", got)
+	}
+}
+
+func TestReader_CompressedFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeLogFile(t, dir, "2026-02-08",
+		"[2026-02-08T10:00:00Z] [INFO]  one",
+		"[2026-02-08T11:00:00Z] [INFO]  two",
+		"[2026-02-08T12:00:00Z] [INFO]  three",
+	)
+	writeLogFile(t, dir, "2026-02-09",
+		"[2026-02-09T10:00:00Z] [INFO]  four",
+	)
+	old := time.Now().Add(-48 * time.Hour)
+	for _, date := range []string{"2026-02-08", "2026-02-09"} {
+		if err := os.Chtimes(filepath.Join(dir, date+".log"), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := NewReader(dir)
+	ctx := context.Background()
+	page, err := r.Query(ctx, Filter{}, "", 2)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	got := messages(page.Events)
+
+	// Compact between pages: the cursor must resume at the same event.
+	c := sink.NewCompactor(dir, sink.CompactorConfig{Compression: sink.Zstd})
+	if n, err := c.CompactOnce(ctx); err != nil || n != 2 {
+		t.Fatalf("CompactOnce: compacted %d, err %v", n, err)
+	}
+	page, err = r.Query(ctx, Filter{}, page.NextCursor, 10)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	got = append(got, messages(page.Events)...)
+
+	if strings.Join(got, ",") != "one,two,three,four" {
+		t.Fatalf("expected all events exactly once across compaction, got %q", got)
+	}
+}
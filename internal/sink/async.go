@@ -0,0 +1,353 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrQueueFull is returned by an AsyncSink using RejectWhenFull when its queue has no room.
+var ErrQueueFull = errors.New("sink queue is full")
+
+// ErrSinkClosed is returned when writing to a sink that has been closed.
+var ErrSinkClosed = errors.New("sink is closed")
+
+// OverflowPolicy decides what an AsyncSink does when its queue is full.
+type OverflowPolicy int
+
+const (
+	// BlockWhenFull makes writers wait for queue space (or their context to end).
+	BlockWhenFull OverflowPolicy = iota
+	// RejectWhenFull makes writers fail immediately with ErrQueueFull.
+	RejectWhenFull
+)
+
+// AsyncConfig configures an AsyncSink. Zero values select the defaults.
+type AsyncConfig struct {
+	// QueueSize bounds the number of lines waiting to be written (default 4096).
+	QueueSize int
+	// MaxBatch is the most lines written and synced as one group commit (default 512).
+	MaxBatch int
+	// FlushInterval is how long the writer waits for more lines before committing
+	// a batch that is not yet full. Zero commits as soon as the queue is drained.
+	FlushInterval time.Duration
+	// WaitForSync makes writes block until their batch has been synced to disk.
+	// It can be overridden per call with WithSyncWait.
+	WaitForSync bool
+	// OnFull selects the backpressure behavior when the queue is full.
+	OnFull OverflowPolicy
+}
+
+const (
+	defaultQueueSize = 4096
+	defaultMaxBatch  = 512
+)
+
+type syncWaitKey struct{}
+
+// WithSyncWait returns a context that overrides AsyncConfig.WaitForSync for writes made with it.
+func WithSyncWait(ctx context.Context, wait bool) context.Context {
+	return context.WithValue(ctx, syncWaitKey{}, wait)
+}
+
+type durableKey struct{}
+
+// WithDurableWrite returns a context for writes that the caller acknowledges to a
+// client, which may then discard its copy. Such writes return once the lines are
+// durable: as soon as they are journaled, or else once their batch has been synced.
+func WithDurableWrite(ctx context.Context) context.Context {
+	return context.WithValue(ctx, durableKey{}, true)
+}
+
+// queuedEntry is a line waiting in the queue; done is nil when nobody waits for the sync.
+// seq is the line's journal sequence number, or zero when the journal is disabled.
+type queuedEntry struct {
+	entry Entry
+	seq   uint64
+	done  chan error
+}
+
+// AsyncSink queues lines in memory and writes them to a FileSink from a single
+// goroutine, syncing once per batch instead of once per line.
+//
+// The lines of one WriteLines call are queued together: queue space for all of
+// them is reserved first, so a call that fails or is cancelled queues none of them.
+type AsyncSink struct {
+	fs  *FileSink
+	cfg AsyncConfig
+
+	mu     sync.Mutex // guards closed, queued and freed, and sends on queue
+	closed bool
+	queued int                // lines reserved or waiting in queue
+	freed  chan struct{}      // closed when the writer takes lines off the queue
+	queue  chan []queuedEntry // the lines of one WriteLines call per element
+	done   chan struct{}
+}
+
+// NewAsyncSink starts an AsyncSink writing to fs. The AsyncSink takes ownership of fs
+// and closes it from Close.
+func NewAsyncSink(fs *FileSink, cfg AsyncConfig) *AsyncSink {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+	if cfg.MaxBatch <= 0 {
+		cfg.MaxBatch = defaultMaxBatch
+	}
+
+	as := newAsyncSink(fs, cfg)
+	go as.run()
+	return as
+}
+
+// newAsyncSink builds an AsyncSink without starting its writer.
+func newAsyncSink(fs *FileSink, cfg AsyncConfig) *AsyncSink {
+	return &AsyncSink{
+		fs:  fs,
+		cfg: cfg,
+		// Every element holds at least one line, so sends within the reserved
+		// space never block.
+		queue: make(chan []queuedEntry, cfg.QueueSize),
+		freed: make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+// WriteLine queues a single line. See WriteLines.
+func (as *AsyncSink) WriteLine(ctx context.Context, line string, timestamp time.Time) error {
+	return as.WriteLines(ctx, []Entry{{Line: line, Timestamp: timestamp}})
+}
+
+// WriteLines queues entries in order. When waiting for sync is enabled (by config or
+// WithSyncWait) it returns once every entry has been written and synced; otherwise it
+// returns as soon as the entries are queued, or, for a write made with WithDurableWrite,
+// journaled.
+func (as *AsyncSink) WriteLines(ctx context.Context, entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	wait := as.cfg.WaitForSync
+	if v, ok := ctx.Value(syncWaitKey{}).(bool); ok {
+		wait = v
+	}
+	durable, _ := ctx.Value(durableKey{}).(bool)
+
+	var waiters []chan error
+	if err := as.enqueue(ctx, entries, wait, durable, &waiters); err != nil {
+		return err
+	}
+
+	for _, ch := range waiters {
+		select {
+		case err := <-ch:
+			if err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (as *AsyncSink) enqueue(ctx context.Context, entries []Entry, wait, durable bool, waiters *[]chan error) error {
+	if err := as.reserve(ctx, len(entries)); err != nil {
+		return err
+	}
+
+	// With the journal enabled, lines are durable before they are queued.
+	seqs, err := as.fs.journalAppend(entries)
+	if err == nil && as.fs.rejectsWrites() {
+		// The writer would reject these lines after the caller has been told they
+		// were accepted, so refuse them now.
+		if seqs != nil {
+			_ = as.fs.journal.Commit(seqs)
+		}
+		err = ErrDiskFull
+	}
+	if err != nil {
+		as.release(len(entries))
+		return err
+	}
+	// Lines that could not be journaled are only durable once written and synced.
+	wait = wait || (durable && seqs == nil)
+
+	unit := make([]queuedEntry, len(entries))
+	for i, e := range entries {
+		unit[i] = queuedEntry{entry: e}
+		if seqs != nil {
+			unit[i].seq = seqs[i]
+		}
+		if wait {
+			unit[i].done = make(chan error, 1)
+			*waiters = append(*waiters, unit[i].done)
+		}
+	}
+
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	if as.closed {
+		// The caller is told the lines failed, so they must not be replayed either.
+		if seqs != nil {
+			_ = as.fs.journal.Commit(seqs)
+		}
+		return ErrSinkClosed
+	}
+	as.queue <- unit
+	return nil
+}
+
+// reserve claims queue space for n lines, waiting for it under BlockWhenFull. A
+// call with more lines than the queue holds is let in once the queue is empty.
+func (as *AsyncSink) reserve(ctx context.Context, n int) error {
+	for {
+		as.mu.Lock()
+		if as.closed {
+			as.mu.Unlock()
+			return ErrSinkClosed
+		}
+		if as.queued == 0 || as.queued+n <= as.cfg.QueueSize {
+			as.queued += n
+			as.mu.Unlock()
+			return nil
+		}
+		freed := as.freed
+		as.mu.Unlock()
+
+		if as.cfg.OnFull == RejectWhenFull {
+			return ErrQueueFull
+		}
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release returns queue space for n lines and wakes writers waiting for it.
+func (as *AsyncSink) release(n int) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	as.queued -= n
+	close(as.freed)
+	as.freed = make(chan struct{})
+}
+
+// run is the writer goroutine. It exits once the queue is closed and drained.
+func (as *AsyncSink) run() {
+	defer close(as.done)
+
+	// pending holds lines taken off the queue but not yet written; a call with
+	// more than MaxBatch lines is written over several batches.
+	var pending []queuedEntry
+	open := true
+	for open || len(pending) > 0 {
+		if len(pending) == 0 {
+			unit, ok := <-as.queue
+			if !ok {
+				return
+			}
+			as.release(len(unit))
+			pending = unit
+		}
+		open = as.fill(&pending)
+		n := min(len(pending), as.cfg.MaxBatch)
+		as.commit(pending[:n])
+		pending = pending[n:]
+	}
+}
+
+// fill adds queued lines to pending until it holds a full batch, the queue is
+// drained (after lingering up to FlushInterval), or the queue is closed. It
+// reports whether the queue is still open.
+func (as *AsyncSink) fill(pending *[]queuedEntry) bool {
+	var linger <-chan time.Time
+	if as.cfg.FlushInterval > 0 {
+		timer := time.NewTimer(as.cfg.FlushInterval)
+		defer timer.Stop()
+		linger = timer.C
+	}
+
+	take := func(unit []queuedEntry, ok bool) bool {
+		if ok {
+			as.release(len(unit))
+			*pending = append(*pending, unit...)
+		}
+		return ok
+	}
+	for len(*pending) < as.cfg.MaxBatch {
+		select {
+		case unit, ok := <-as.queue:
+			if !take(unit, ok) {
+				return false
+			}
+			continue
+		default:
+		}
+
+		if linger == nil {
+			return true
+		}
+		select {
+		case unit, ok := <-as.queue:
+			if !take(unit, ok) {
+				return false
+			}
+		case <-linger:
+			return true
+		}
+	}
+	return true
+}
+
+// commit writes and syncs one batch and notifies any waiting writers.
+func (as *AsyncSink) commit(batch []queuedEntry) {
+	entries := make([]Entry, len(batch))
+	var seqs []uint64
+	for i, qe := range batch {
+		entries[i] = qe.entry
+		if qe.seq != 0 {
+			seqs = append(seqs, qe.seq)
+		}
+	}
+
+	var err error
+	if len(seqs) == len(entries) {
+		err = as.fs.writeJournaled(entries, seqs)
+	} else {
+		err = as.fs.WriteLines(context.Background(), entries)
+	}
+	if err != nil {
+		if len(seqs) == len(entries) {
+			log.Printf("async sink: failed to write batch of %d lines, keeping them in the journal for replay on restart: %v", len(entries), err)
+		} else {
+			log.Printf("async sink: failed to write batch of %d lines: %v", len(entries), err)
+		}
+	}
+	for _, qe := range batch {
+		if qe.done != nil {
+			qe.done <- err
+		}
+	}
+}
+
+// Close stops accepting new lines, drains and commits everything already queued,
+// and then closes the underlying FileSink.
+func (as *AsyncSink) Close() error {
+	as.mu.Lock()
+	if as.closed {
+		as.mu.Unlock()
+		return nil
+	}
+	as.closed = true
+	close(as.queue)
+	// Wake writers waiting for queue space; they see closed and give up.
+	close(as.freed)
+	as.freed = make(chan struct{})
+	as.mu.Unlock()
+
+	<-as.done
+	return as.fs.Close()
+}
@@ -0,0 +1,215 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAsyncSink_DrainsQueueOnClose(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs, err := NewFileSink(tmpDir)
+	if err != nil {
+		t.Fatalf("NewFileSink failed: %v", err)
+	}
+	as := NewAsyncSink(fs, AsyncConfig{MaxBatch: 8, FlushInterval: 50 * time.Millisecond})
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	for i := 0; i < 100; i++ {
+		if err := as.WriteLine(ctx, "queued line", now); err != nil {
+			t.Fatalf("WriteLine failed: %v", err)
+		}
+	}
+	if err := as.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	content, err := os.ReadFile(dateFilePath(tmpDir, todayDateString()))
+	if err != nil {
+		t.Fatalf("failed to read today's log file: %v", err)
+	}
+	if n := strings.Count(string(content), "queued line\n"); n != 100 {
+		t.Fatalf("expected 100 lines after drain, got %d", n)
+	}
+
+	if err := as.WriteLine(ctx, "late line", now); !errors.Is(err, ErrSinkClosed) {
+		t.Fatalf("expected ErrSinkClosed after Close, got %v", err)
+	}
+}
+
+func TestAsyncSink_WaitForSync(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs, err := NewFileSink(tmpDir)
+	if err != nil {
+		t.Fatalf("NewFileSink failed: %v", err)
+	}
+	as := NewAsyncSink(fs, AsyncConfig{FlushInterval: 5 * time.Millisecond})
+	defer as.Close()
+
+	ctx := WithSyncWait(context.Background(), true)
+	now := time.Now().UTC()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := as.WriteLine(ctx, "durable line", now); err != nil {
+				t.Errorf("WriteLine failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Every write has returned, so every line must already be on disk.
+	content, err := os.ReadFile(dateFilePath(tmpDir, todayDateString()))
+	if err != nil {
+		t.Fatalf("failed to read today's log file: %v", err)
+	}
+	if n := strings.Count(string(content), "durable line\n"); n != 10 {
+		t.Fatalf("expected 10 synced lines, got %d", n)
+	}
+}
+
+func TestAsyncSink_DurableWrite(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs, err := NewFileSink(tmpDir)
+	if err != nil {
+		t.Fatalf("NewFileSink failed: %v", err)
+	}
+	as := NewAsyncSink(fs, AsyncConfig{FlushInterval: 5 * time.Millisecond})
+	defer as.Close()
+
+	// Without a journal, a durable write waits for its batch to be synced.
+	if err := as.WriteLine(WithDurableWrite(context.Background()), "durable line", time.Now().UTC()); err != nil {
+		t.Fatalf("WriteLine failed: %v", err)
+	}
+	content, err := os.ReadFile(dateFilePath(tmpDir, todayDateString()))
+	if err != nil || string(content) != "durable line\n" {
+		t.Fatalf("expected the line on disk, got %q, %v", content, err)
+	}
+
+	// With the journal, it returns once journaled, even though nothing drains the queue.
+	fs, err = NewFileSinkWithOptions(t.TempDir(), FileSinkOptions{Journal: true})
+	if err != nil {
+		t.Fatalf("NewFileSinkWithOptions failed: %v", err)
+	}
+	defer fs.Close()
+	journaled := newAsyncSink(fs, AsyncConfig{QueueSize: 1, MaxBatch: 1})
+	ctx, cancel := context.WithTimeout(WithDurableWrite(context.Background()), time.Second)
+	defer cancel()
+	if err := journaled.WriteLine(ctx, "journaled line", time.Now().UTC()); err != nil {
+		t.Fatalf("WriteLine failed: %v", err)
+	}
+}
+
+func TestAsyncSink_RejectWhenFull(t *testing.T) {
+	// Build the sink without its writer goroutine so the queue never drains.
+	as := newAsyncSink(&FileSink{disk: newDiskGuard("", 0)}, AsyncConfig{QueueSize: 1, MaxBatch: 1, OnFull: RejectWhenFull})
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	if err := as.WriteLine(ctx, "fits", now); err != nil {
+		t.Fatalf("first WriteLine failed: %v", err)
+	}
+	if err := as.WriteLine(ctx, "overflow", now); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+}
+
+func TestAsyncSink_BlockWhenFullHonoursContext(t *testing.T) {
+	as := newAsyncSink(&FileSink{disk: newDiskGuard("", 0)}, AsyncConfig{QueueSize: 1, MaxBatch: 1, OnFull: BlockWhenFull})
+
+	now := time.Now().UTC()
+	if err := as.WriteLine(context.Background(), "fits", now); err != nil {
+		t.Fatalf("first WriteLine failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := as.WriteLine(ctx, "blocked", now); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context deadline error, got %v", err)
+	}
+}
+
+func TestAsyncSink_CancelledBatchQueuesNothing(t *testing.T) {
+	as := newAsyncSink(&FileSink{disk: newDiskGuard("", 0)}, AsyncConfig{QueueSize: 3, MaxBatch: 3, OnFull: BlockWhenFull})
+
+	now := time.Now().UTC()
+	if err := as.WriteLine(context.Background(), "fits", now); err != nil {
+		t.Fatalf("first WriteLine failed: %v", err)
+	}
+
+	// Two of the three lines would fit; none may be queued when the wait is cancelled.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	batch := []Entry{{Line: "a", Timestamp: now}, {Line: "b", Timestamp: now}, {Line: "c", Timestamp: now}}
+	if err := as.WriteLines(ctx, batch); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context deadline error, got %v", err)
+	}
+	if len(as.queue) != 1 || as.queued != 1 {
+		t.Fatalf("expected only the first line queued, got %d calls and %d lines", len(as.queue), as.queued)
+	}
+}
+
+func TestAsyncSink_SplitsLargeCallsIntoBatches(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs, err := NewFileSink(tmpDir)
+	if err != nil {
+		t.Fatalf("NewFileSink failed: %v", err)
+	}
+	as := NewAsyncSink(fs, AsyncConfig{QueueSize: 4, MaxBatch: 3})
+
+	// More lines than the queue holds are let in as a whole once it is empty.
+	now := time.Now().UTC()
+	entries := make([]Entry, 10)
+	for i := range entries {
+		entries[i] = Entry{Line: "line", Timestamp: now}
+	}
+	if err := as.WriteLines(WithSyncWait(context.Background(), true), entries); err != nil {
+		t.Fatalf("WriteLines failed: %v", err)
+	}
+	if err := as.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	content, _ := os.ReadFile(dateFilePath(tmpDir, todayDateString()))
+	if n := strings.Count(string(content), "line\n"); n != 10 {
+		t.Fatalf("expected 10 lines, got %d", n)
+	}
+}
+
+func TestAsyncSink_RejectsWhileDiskIsFull(t *testing.T) {
+	dir := t.TempDir()
+	fs, err := NewFileSinkWithOptions(dir, FileSinkOptions{Journal: true, MinFreeBytes: 100})
+	if err != nil {
+		t.Fatalf("NewFileSinkWithOptions failed: %v", err)
+	}
+	fs.disk.interval = time.Hour
+	fs.disk.free = func(string) (int64, error) { return 50, nil }
+	as := NewAsyncSink(fs, AsyncConfig{})
+
+	// Accepted before the disk was known to be full: the writer fails the line.
+	now := time.Now().UTC()
+	if err := as.WriteLine(WithSyncWait(context.Background(), true), "accepted", now); !errors.Is(err, ErrDiskFull) {
+		t.Fatalf("expected the writer to fail with ErrDiskFull, got %v", err)
+	}
+	// From now on the disk is known to be full, so lines are refused up front.
+	if err := as.WriteLine(context.Background(), "refused", now); !errors.Is(err, ErrDiskFull) {
+		t.Fatalf("expected ErrDiskFull, got %v", err)
+	}
+	if err := as.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// The accepted line stays in the journal and is written on restart.
+	fs = newJournaledSink(t, dir, 0)
+	fs.Close()
+	if got := readToday(t, dir); got != "accepted\n" {
+		t.Fatalf("unexpected log content %q", got)
+	}
+}
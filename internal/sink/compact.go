@@ -0,0 +1,416 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CompactorConfig configures a Compactor. Zero values select the defaults.
+type CompactorConfig struct {
+	// Compression is the codec of compacted files (default gzip).
+	Compression Compression
+	// Paths is the layout of the log files (default one ".log" file per day).
+	Paths *PathTemplate
+	// Interval is how often the log directory is scanned (default one hour).
+	Interval time.Duration
+	// MinIdle is how long a file must go unmodified before it is compacted
+	// (default one hour), so late writes racing a day change are never lost.
+	MinIdle time.Duration
+}
+
+const (
+	defaultCompactInterval = time.Hour
+	defaultCompactMinIdle  = time.Hour
+)
+
+// compactTmpSuffix marks a compressed file that has not been verified yet.
+const compactTmpSuffix = ".tmp"
+
+// compactMarkerSuffix names the sidecar of a file being compacted. It records the
+// archive's size before the file was added and which file was added, so that a
+// later run can tell whether an interrupted run finished the archive.
+const compactMarkerSuffix = ".compacting"
+
+// compactMarker is the content of a compaction sidecar.
+type compactMarker struct {
+	ArchiveSize   int64     `json:"archive_size"` // -1 when there was no archive
+	SourceSize    int64     `json:"source_size"`
+	SourceModTime time.Time `json:"source_mod_time"`
+}
+
+// Compactor compresses the files of closed days: days before yesterday, which the
+// API no longer accepts events for. A file is written to a temporary name, synced,
+// verified by decompressing it and comparing it with the original, renamed into
+// place and only then is the original removed, so a crash at any point loses
+// nothing and the next run picks up where the last one stopped. Lines written to a
+// day after it was compacted are appended to its archive the same way. A sidecar
+// marker written before the archive changes tells the next run whether an
+// interrupted run already added the file.
+type Compactor struct {
+	logDir string
+	cfg    CompactorConfig
+	now    func() time.Time
+
+	mu   sync.Mutex // serialises runs
+	loop *periodic
+}
+
+// NewCompactor creates a Compactor over logDir. Call Start to run it periodically,
+// or CompactOnce to run it once.
+func NewCompactor(logDir string, cfg CompactorConfig) *Compactor {
+	if cfg.Compression == "" {
+		cfg.Compression = Gzip
+	}
+	if cfg.Paths == nil {
+		cfg.Paths = DefaultPathTemplate(defaultExtension)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultCompactInterval
+	}
+	if cfg.MinIdle <= 0 {
+		cfg.MinIdle = defaultCompactMinIdle
+	}
+	return &Compactor{
+		logDir: logDir,
+		cfg:    cfg,
+		now:    time.Now,
+		loop:   newPeriodic(),
+	}
+}
+
+// Start compacts once immediately and then every Interval until Close.
+func (c *Compactor) Start() {
+	c.loop.start(c.cfg.Interval, func() {
+		if _, err := c.CompactOnce(context.Background()); err != nil {
+			log.Printf("compactor: %v", err)
+		}
+	})
+}
+
+// Close stops a started Compactor, waiting for a run in progress to finish.
+func (c *Compactor) Close() error {
+	c.loop.close()
+	return nil
+}
+
+// CompactOnce compresses every closed-day file not compressed yet and returns how
+// many were compressed. Leftovers of an interrupted run are cleaned up first.
+// Failures to compact one file are logged and do not stop the others.
+func (c *Compactor) CompactOnce(ctx context.Context) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.removeTempFiles(); err != nil {
+		return 0, err
+	}
+
+	cutoff := c.now().UTC().AddDate(0, 0, -1).Format("2006-01-02")
+	var candidates []string
+	err := WalkLogFiles(c.logDir, c.cfg.Paths, func(lf LogFile) error {
+		if lf.Compression == "" && lf.Date < cutoff {
+			candidates = append(candidates, lf.Path)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("list log files: %w", err)
+	}
+
+	n := 0
+	for _, path := range candidates {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		info, err := os.Stat(path)
+		if err != nil || c.now().Sub(info.ModTime()) < c.cfg.MinIdle {
+			continue
+		}
+		if err := c.compactFile(path); err != nil {
+			log.Printf("compactor: %v", err)
+			continue
+		}
+		n++
+	}
+	return n, nil
+}
+
+// removeTempFiles deletes compressed files left unverified by an interrupted run,
+// and markers whose file is gone.
+func (c *Compactor) removeTempFiles() error {
+	err := filepath.WalkDir(c.logDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == c.logDir && os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			if p != c.logDir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if plain, ok := strings.CutSuffix(p, compactMarkerSuffix); ok {
+			if _, err := os.Stat(plain); !os.IsNotExist(err) {
+				return nil
+			}
+			return removeSynced(p)
+		}
+		name, ok := strings.CutSuffix(d.Name(), compactTmpSuffix)
+		if !ok {
+			return nil
+		}
+		if _, comp := splitCompressed(name); comp == "" {
+			return nil
+		}
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove %s: %w", p, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("remove unfinished compressed files: %w", err)
+	}
+	return nil
+}
+
+// compactFile replaces the file at path with a verified compressed copy. When
+// the day already has an archive, because lines were written to it again after
+// it was compacted (journal replay, a late write), the file is added to the end
+// of the archive instead; an existing archive is never removed.
+func (c *Compactor) compactFile(path string) error {
+	dst := path + c.cfg.Compression.Ext()
+	marker := path + compactMarkerSuffix
+	if done, err := compactedBefore(marker, path, dst); err != nil {
+		return err
+	} else if done {
+		// An interrupted run added the file to the archive but did not remove it.
+		if err := removeSynced(path); err != nil {
+			return err
+		}
+		return removeSynced(marker)
+	}
+
+	head := ""
+	if _, err := os.Stat(dst); err == nil {
+		head = dst
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("stat %s: %w", dst, err)
+	}
+	if err := writeCompactMarker(marker, path, dst); err != nil {
+		return err
+	}
+
+	tmp := dst + compactTmpSuffix
+	// Until the rename the archive is unchanged, so a failure drops the marker too.
+	abort := func(err error) error {
+		_ = os.Remove(tmp)
+		_ = os.Remove(marker)
+		return err
+	}
+	if err := compressFile(head, path, tmp, c.cfg.Compression); err != nil {
+		return abort(err)
+	}
+	if err := verifyCompressed(head, path, tmp, c.cfg.Compression); err != nil {
+		return abort(err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return abort(fmt.Errorf("rename %s: %w", tmp, err))
+	}
+	if err := syncDir(filepath.Dir(dst)); err != nil {
+		return err
+	}
+	if err := removeSynced(path); err != nil {
+		return err
+	}
+	return removeSynced(marker)
+}
+
+// writeCompactMarker records, before src is added to the archive dst, the size of
+// dst and the identity of src in the sidecar marker, and syncs it.
+func writeCompactMarker(marker, src, dst string) error {
+	m := compactMarker{ArchiveSize: -1}
+	if info, err := os.Stat(dst); err == nil {
+		m.ArchiveSize = info.Size()
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("stat %s: %w", dst, err)
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("stat %s: %w", src, err)
+	}
+	m.SourceSize, m.SourceModTime = info.Size(), info.ModTime()
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(marker, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", marker, err)
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("write %s: %w", marker, err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("sync %s: %w", marker, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close %s: %w", marker, err)
+	}
+	return syncDir(filepath.Dir(marker))
+}
+
+// compactedBefore reports whether the marker left by an interrupted run shows that
+// src was already added to the archive dst: dst grew past the recorded size, which
+// only the rename of a verified archive does, and src is still the recorded file.
+// A file that differs, such as one written again after the original was removed,
+// is compacted as usual.
+func compactedBefore(marker, src, dst string) (bool, error) {
+	data, err := os.ReadFile(marker)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("read %s: %w", marker, err)
+	}
+	var m compactMarker
+	if err := json.Unmarshal(data, &m); err != nil {
+		// A marker torn by a crash was written before the archive changed.
+		return false, nil
+	}
+	info, err := os.Stat(dst)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("stat %s: %w", dst, err)
+	}
+	if info.Size() <= m.ArchiveSize {
+		return false, nil
+	}
+	info, err = os.Stat(src)
+	if err != nil {
+		return false, fmt.Errorf("stat %s: %w", src, err)
+	}
+	return info.Size() == m.SourceSize && info.ModTime().Equal(m.SourceModTime), nil
+}
+
+// compressFile writes a compressed copy of src to dst and syncs it. If head is
+// not empty, dst starts with a byte-for-byte copy of that compressed file and src
+// follows as a new gzip member or zstd frame, which readers decompress as one
+// stream.
+func compressFile(head, src, dst string, codec Compression) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", src, err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", dst, err)
+	}
+	defer out.Close()
+
+	if head != "" {
+		if err := copyFile(out, head); err != nil {
+			return err
+		}
+	}
+	w, err := codec.newWriter(out)
+	if err != nil {
+		return fmt.Errorf("compress %s: %w", src, err)
+	}
+	if _, err := io.Copy(w, in); err != nil {
+		_ = w.Close()
+		return fmt.Errorf("compress %s: %w", src, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("compress %s: %w", src, err)
+	}
+	if err := out.Sync(); err != nil {
+		return fmt.Errorf("sync %s: %w", dst, err)
+	}
+	return out.Close()
+}
+
+// copyFile appends the contents of the file at path to w.
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("copy %s: %w", path, err)
+	}
+	return nil
+}
+
+// verifyCompressed checks that comp decompresses to exactly the contents of orig,
+// preceded by the decompressed contents of head if head is not empty.
+func verifyCompressed(head, orig, comp string, codec Compression) error {
+	h := sha256.New()
+	if head != "" {
+		if err := hashFile(h, head, codec.newReader); err != nil {
+			return err
+		}
+	}
+	if err := hashFile(h, orig, plainReader); err != nil {
+		return err
+	}
+	want := h.Sum(nil)
+
+	h = sha256.New()
+	if err := hashFile(h, comp, codec.newReader); err != nil {
+		return err
+	}
+	if !bytes.Equal(want, h.Sum(nil)) {
+		return fmt.Errorf("verify %s: contents differ from %s", comp, orig)
+	}
+	return nil
+}
+
+// plainReader reads a file as it is.
+func plainReader(r io.Reader) (io.ReadCloser, error) { return io.NopCloser(r), nil }
+
+// hashFile writes the file at path, as read through wrap, to h.
+func hashFile(h io.Writer, path string, wrap func(io.Reader) (io.ReadCloser, error)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	r, err := wrap(f)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+	defer r.Close()
+
+	if _, err := io.Copy(h, r); err != nil {
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+	return nil
+}
+
+// removeSynced removes path and syncs its directory.
+func removeSynced(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove %s: %w", path, err)
+	}
+	return syncDir(filepath.Dir(path))
+}
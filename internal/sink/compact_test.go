@@ -0,0 +1,220 @@
+package sink
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeOld writes a file and backdates its modification time past MinIdle.
+func writeOld(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readLogFile(t *testing.T, path string) string {
+	t.Helper()
+	r, err := OpenLogFile(path)
+	if err != nil {
+		t.Fatalf("OpenLogFile(%s): %v", path, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestCompactor_CompressesClosedDaysOnly(t *testing.T) {
+	for _, codec := range []Compression{Gzip, Zstd} {
+		dir := t.TempDir()
+		now := time.Now().UTC()
+		closed := now.AddDate(0, 0, -2).Format("2006-01-02")
+		yesterday := now.AddDate(0, 0, -1).Format("2006-01-02")
+		today := now.Format("2006-01-02")
+		for _, date := range []string{closed, yesterday, today} {
+			writeOld(t, dateFilePath(dir, date), "line of "+date+"\n")
+		}
+		writeOld(t, filepath.Join(dir, closed+".1.log"), "second part\n")
+
+		c := NewCompactor(dir, CompactorConfig{Compression: codec})
+		n, err := c.CompactOnce(context.Background())
+		if err != nil {
+			t.Fatalf("%s: CompactOnce failed: %v", codec, err)
+		}
+		if n != 2 {
+			t.Fatalf("%s: expected 2 files compacted, got %d", codec, n)
+		}
+
+		for _, name := range []string{closed + ".log", closed + ".1.log"} {
+			if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+				t.Fatalf("%s: expected %s to be removed, got %v", codec, name, err)
+			}
+		}
+		if got := readLogFile(t, filepath.Join(dir, closed+".log"+codec.Ext())); got != "line of "+closed+"\n" {
+			t.Fatalf("%s: unexpected decompressed content %q", codec, got)
+		}
+		if got := readLogFile(t, filepath.Join(dir, closed+".1.log")); got != "second part\n" {
+			t.Fatalf("%s: expected fallback to compressed part, got %q", codec, got)
+		}
+		for _, date := range []string{yesterday, today} {
+			if _, err := os.Stat(dateFilePath(dir, date)); err != nil {
+				t.Fatalf("%s: file of %s must not be compacted: %v", codec, date, err)
+			}
+		}
+	}
+}
+
+func TestCompactor_SkipsRecentlyModifiedFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := dateFilePath(dir, "2026-02-08")
+	if err := os.WriteFile(path, []byte("late write\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := NewCompactor(dir, CompactorConfig{}).CompactOnce(context.Background())
+	if err != nil {
+		t.Fatalf("CompactOnce failed: %v", err)
+	}
+	if n != 0 {
+		t.Fatalf("expected no files compacted, got %d", n)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("recently modified file must be kept: %v", err)
+	}
+}
+
+func TestCompactor_RecoversInterruptedRuns(t *testing.T) {
+	dir := t.TempDir()
+
+	// Crashed after renaming a verified copy into place, before removing the original.
+	done := dateFilePath(dir, "2026-02-06")
+	writeOld(t, done, "done\n")
+	if err := writeCompactMarker(done+compactMarkerSuffix, done, done+".gz"); err != nil {
+		t.Fatal(err)
+	}
+	if err := compressFile("", done, done+".gz", Gzip); err != nil {
+		t.Fatal(err)
+	}
+	// Crashed after writing the marker, before the archive was replaced.
+	started := dateFilePath(dir, "2026-02-05")
+	writeOld(t, started, "started\n")
+	if err := writeCompactMarker(started+compactMarkerSuffix, started, started+".gz"); err != nil {
+		t.Fatal(err)
+	}
+	// Crashed after removing the original, before removing the marker.
+	writeOld(t, dateFilePath(dir, "2026-02-04")+compactMarkerSuffix, "{}")
+	// Crashed while writing the temporary file.
+	unfinished := dateFilePath(dir, "2026-02-07")
+	writeOld(t, unfinished, "unfinished\n")
+	writeOld(t, unfinished+".gz"+compactTmpSuffix, "garbage")
+	// An archive that cannot be read is left alone, and so is the file.
+	corrupt := dateFilePath(dir, "2026-02-08")
+	writeOld(t, corrupt, "corrupt\n")
+	writeOld(t, corrupt+".gz", "not gzip")
+
+	n, err := NewCompactor(dir, CompactorConfig{}).CompactOnce(context.Background())
+	if err != nil {
+		t.Fatalf("CompactOnce failed: %v", err)
+	}
+	if n != 3 {
+		t.Fatalf("expected 3 files compacted, got %d", n)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	want := []string{"2026-02-05.log.gz", "2026-02-06.log.gz", "2026-02-07.log.gz", "2026-02-08.log", "2026-02-08.log.gz"}
+	if len(names) != len(want) {
+		t.Fatalf("expected %v, got %v", want, names)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, names)
+		}
+	}
+	for path, content := range map[string]string{started: "started\n", done: "done\n", unfinished: "unfinished\n"} {
+		if got := readLogFile(t, path+".gz"); got != content {
+			t.Fatalf("%s: expected %q, got %q", path, content, got)
+		}
+	}
+	if got, err := os.ReadFile(corrupt + ".gz"); err != nil || string(got) != "not gzip" {
+		t.Fatalf("unreadable archive must be kept as is, got %q, %v", got, err)
+	}
+}
+
+func TestCompactor_AppendsToExistingArchive(t *testing.T) {
+	for _, codec := range []Compression{Gzip, Zstd} {
+		t.Run(string(codec), func(t *testing.T) {
+			dir := t.TempDir()
+			path := dateFilePath(dir, "2026-02-06")
+			writeOld(t, path, "first\n")
+			c := NewCompactor(dir, CompactorConfig{Compression: codec})
+			if n, err := c.CompactOnce(context.Background()); err != nil || n != 1 {
+				t.Fatalf("CompactOnce: expected 1 file compacted, got %d, %v", n, err)
+			}
+
+			// The day's file comes back, e.g. from journal replay, with new lines.
+			writeOld(t, path, "second\nthird\n")
+			if n, err := c.CompactOnce(context.Background()); err != nil || n != 1 {
+				t.Fatalf("CompactOnce: expected 1 file compacted, got %d, %v", n, err)
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Fatalf("expected the plain file to be removed, got %v", err)
+			}
+			if got, want := readLogFile(t, path+codec.Ext()), "first\nsecond\nthird\n"; got != want {
+				t.Fatalf("expected %q, got %q", want, got)
+			}
+
+			// A late file repeating the archive's last lines is appended too.
+			writeOld(t, path, "third\n")
+			if n, err := c.CompactOnce(context.Background()); err != nil || n != 1 {
+				t.Fatalf("CompactOnce: expected 1 file compacted, got %d, %v", n, err)
+			}
+			if got, want := readLogFile(t, path+codec.Ext()), "first\nsecond\nthird\nthird\n"; got != want {
+				t.Fatalf("expected %q, got %q", want, got)
+			}
+
+			// Crashed after the archive was replaced, before the file was removed.
+			writeOld(t, path, "fourth\n")
+			if err := writeCompactMarker(path+compactMarkerSuffix, path, path+codec.Ext()); err != nil {
+				t.Fatal(err)
+			}
+			if err := compressFile(path+codec.Ext(), path, path+codec.Ext()+compactTmpSuffix, codec); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Rename(path+codec.Ext()+compactTmpSuffix, path+codec.Ext()); err != nil {
+				t.Fatal(err)
+			}
+			if n, err := c.CompactOnce(context.Background()); err != nil || n != 1 {
+				t.Fatalf("CompactOnce: expected 1 file compacted, got %d, %v", n, err)
+			}
+			if got, want := readLogFile(t, path+codec.Ext()), "first\nsecond\nthird\nthird\nfourth\n"; got != want {
+				t.Fatalf("expected the lines once, got %q", got)
+			}
+			for _, p := range []string{path, path + compactMarkerSuffix} {
+				if _, err := os.Stat(p); !os.IsNotExist(err) {
+					t.Fatalf("expected %s to be removed, got %v", p, err)
+				}
+			}
+		})
+	}
+}
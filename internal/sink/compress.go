@@ -0,0 +1,123 @@
+package sink
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression selects the codec of compacted log files.
+type Compression string
+
+const (
+	Gzip Compression = "gzip"
+	Zstd Compression = "zstd"
+)
+
+// compressedExts maps file name suffixes to the compression they denote.
+var compressedExts = map[string]Compression{".gz": Gzip, ".zst": Zstd}
+
+// ParseCompression parses "gzip" or "zstd".
+func ParseCompression(s string) (Compression, error) {
+	switch c := Compression(strings.ToLower(strings.TrimSpace(s))); c {
+	case Gzip, Zstd:
+		return c, nil
+	default:
+		return "", fmt.Errorf("unknown compression %q: must be gzip or zstd", s)
+	}
+}
+
+// Ext returns the suffix appended to compressed files (".gz" or ".zst").
+func (c Compression) Ext() string {
+	for ext, codec := range compressedExts {
+		if codec == c {
+			return ext
+		}
+	}
+	return ""
+}
+
+// newWriter returns a compressing writer on w.
+func (c Compression) newWriter(w io.Writer) (io.WriteCloser, error) {
+	switch c {
+	case Gzip:
+		return gzip.NewWriterLevel(w, gzip.BestCompression)
+	case Zstd:
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	default:
+		return nil, fmt.Errorf("unknown compression %q", c)
+	}
+}
+
+// newReader returns a decompressing reader on r.
+func (c Compression) newReader(r io.Reader) (io.ReadCloser, error) {
+	switch c {
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zstd:
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unknown compression %q", c)
+	}
+}
+
+// splitCompressed returns name without its compression suffix and the compression
+// it denotes, or name unchanged and "" for plain files.
+func splitCompressed(name string) (string, Compression) {
+	for ext, c := range compressedExts {
+		if base, ok := strings.CutSuffix(name, ext); ok {
+			return base, c
+		}
+	}
+	return name, ""
+}
+
+// OpenLogFile opens a log file for reading. Files ending in ".gz" or ".zst" are
+// decompressed transparently. When a plain file no longer exists because it has
+// been compacted in the meantime, its compressed copy is opened instead.
+func OpenLogFile(path string) (io.ReadCloser, error) {
+	_, c := splitCompressed(path)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) && c == "" {
+		for ext, codec := range compressedExts {
+			if cf, cerr := os.Open(path + ext); cerr == nil {
+				f, err, c = cf, nil, codec
+				break
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c == "" {
+		return f, nil
+	}
+	r, err := c.newReader(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	return &decompressedFile{ReadCloser: r, f: f}, nil
+}
+
+// decompressedFile closes both the decompressor and the underlying file.
+type decompressedFile struct {
+	io.ReadCloser
+	f *os.File
+}
+
+func (d *decompressedFile) Close() error {
+	err := d.ReadCloser.Close()
+	if ferr := d.f.Close(); err == nil {
+		err = ferr
+	}
+	return err
+}
@@ -0,0 +1,17 @@
+//go:build !(linux || darwin || freebsd)
+
+package sink
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// freeBytes is not implemented on this platform; free-space limits are ignored.
+func freeBytes(dir string) (int64, error) {
+	return 0, fmt.Errorf("free space of %s: %w", dir, errors.ErrUnsupported)
+}
+
+// diskFullErrnos are the errors meaning no space is left for the log files.
+var diskFullErrnos = []error{syscall.ENOSPC}
@@ -0,0 +1,21 @@
+//go:build linux || darwin || freebsd
+
+package sink
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// freeBytes returns the space available to unprivileged users on the file system
+// holding dir.
+func freeBytes(dir string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, fmt.Errorf("statfs %s: %w", dir, err)
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
+
+// diskFullErrnos are the errors meaning no space is left for the log files.
+var diskFullErrnos = []error{syscall.ENOSPC, syscall.EDQUOT}
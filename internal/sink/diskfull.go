@@ -0,0 +1,376 @@
+package sink
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"logger/internal/model"
+)
+
+// ErrDiskFull is returned when a line cannot be stored because the disk is full or
+// below its free-space threshold.
+var ErrDiskFull = errors.New("log disk is full")
+
+// DiskFullPolicy decides what a FileSink does while its disk is full.
+type DiskFullPolicy int
+
+const (
+	// RejectWhenDiskFull fails writes with ErrDiskFull.
+	RejectWhenDiskFull DiskFullPolicy = iota
+	// DropLowWhenDiskFull drops debug and info lines and keeps writing warn, error
+	// and unlevelled lines as long as they fit.
+	DropLowWhenDiskFull
+	// SpillWhenDiskFull writes to FileSinkOptions.SpillDir, laid out like the log
+	// directory, instead, and moves the lines back once the disk has room again.
+	SpillWhenDiskFull
+)
+
+// diskCheckInterval is how often free space is checked, both to switch to the
+// disk-full policy ahead of time and to recover from it.
+const diskCheckInterval = time.Second
+
+// diskGuard tracks whether the log directory's disk is full. The disk counts as
+// full once a write fails with ENOSPC or free space drops below minFree. While
+// full, one write per interval is let through to the disk (once free space is back
+// above minFree, when set), and the first one that succeeds ends the disk-full state.
+type diskGuard struct {
+	dir      string
+	minFree  int64
+	interval time.Duration
+	free     func(dir string) (int64, error)
+	now      func() time.Time
+
+	mu        sync.Mutex
+	full      bool
+	checkedAt time.Time
+	dropped   int64 // lines dropped since the disk became full
+}
+
+func newDiskGuard(dir string, minFree int64) *diskGuard {
+	return &diskGuard{dir: dir, minFree: minFree, interval: diskCheckInterval, free: freeBytes, now: time.Now}
+}
+
+// isFull reports whether the next write should go to the disk-full policy.
+func (g *diskGuard) isFull() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.now().Sub(g.checkedAt) < g.interval {
+		return g.full
+	}
+	if !g.full && g.minFree <= 0 {
+		return false
+	}
+	g.checkedAt = g.now()
+
+	if g.minFree > 0 {
+		free, err := g.free(g.dir)
+		if err != nil {
+			// Without a reading, keep the current state.
+			return g.full
+		}
+		if free < g.minFree {
+			if !g.full {
+				log.Printf("file sink: %s has %d bytes free, below %d", g.dir, free, g.minFree)
+				g.full, g.dropped = true, 0
+			}
+			return true
+		}
+	}
+	// Let this write try the disk; writeOK ends the disk-full state if it succeeds.
+	return false
+}
+
+// knownFull reports whether the disk is full and the next write would not be let
+// through to try it. Unlike isFull it does not use up that attempt.
+func (g *diskGuard) knownFull() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.full && g.now().Sub(g.checkedAt) < g.interval
+}
+
+// markFull records that a write failed because the disk is full.
+func (g *diskGuard) markFull(cause error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.full {
+		log.Printf("file sink: %s is full: %v", g.dir, cause)
+		g.full, g.dropped = true, 0
+	}
+	g.checkedAt = g.now()
+}
+
+// writeOK records a successful write to the disk.
+func (g *diskGuard) writeOK() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.full {
+		return
+	}
+	if g.dropped > 0 {
+		log.Printf("file sink: disk space recovered in %s, writing again (%d debug/info lines dropped)", g.dir, g.dropped)
+	} else {
+		log.Printf("file sink: disk space recovered in %s, writing again", g.dir)
+	}
+	g.full = false
+}
+
+// drop counts lines dropped by DropLowWhenDiskFull.
+func (g *diskGuard) drop(n int) {
+	g.mu.Lock()
+	g.dropped += int64(n)
+	g.mu.Unlock()
+}
+
+// isDiskFullError reports whether err means the disk (or quota) is exhausted.
+func isDiskFullError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrDiskFull) {
+		return true
+	}
+	for _, errno := range diskFullErrnos {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// keepsWhenDiskFull reports whether DropLowWhenDiskFull still writes e.
+func keepsWhenDiskFull(e Entry) bool {
+	sev := model.LogLevel(strings.ToLower(e.Level)).Severity()
+	return sev == 0 || sev >= model.LevelWarn.Severity()
+}
+
+// rejectsWrites reports whether the disk is known to be full and its policy
+// rejects lines, so writers that answer before the lines are written can refuse
+// them up front.
+func (fs *FileSink) rejectsWrites() bool {
+	return fs.onDiskFull == RejectWhenDiskFull && fs.disk.knownFull()
+}
+
+// mergeChunkLines bounds the spilled lines merged back while holding the sink's
+// lock, so writers wait for at most one chunk.
+const mergeChunkLines = 1024
+
+// startMerge starts merging the spill directory back into the log directory in
+// the background; fs.mu must be held.
+func (fs *FileSink) startMerge() {
+	fs.spillPending, fs.merging = false, true
+	fs.closeSpill()
+	fs.merges.Add(1)
+	go fs.mergeSpill()
+}
+
+// closeSpill closes the spill sink, which is opened again by the next spill;
+// fs.mu must be held.
+func (fs *FileSink) closeSpill() {
+	if fs.spill == nil {
+		return
+	}
+	if err := fs.spill.Close(); err != nil {
+		log.Printf("file sink: close spill directory %s: %v", fs.spillDir, err)
+	}
+	fs.spill = nil
+}
+
+// mergeSpill appends the files in the spill directory to their counterparts in
+// the log directory and removes them. It holds fs.mu for one chunk of lines at a
+// time, so writes carry on in between and spilled lines follow the lines written
+// since the disk recovered. A crash while a file is being merged merges that file
+// again on the next run.
+func (fs *FileSink) mergeSpill() {
+	defer fs.merges.Done()
+	defer func() {
+		fs.mu.Lock()
+		fs.merging = false
+		fs.mu.Unlock()
+	}()
+
+	var files []LogFile
+	err := WalkLogFiles(fs.spillDir, fs.paths, func(lf LogFile) error {
+		if lf.Compression == "" {
+			files = append(files, lf)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("file sink: list spill directory %s: %v", fs.spillDir, err)
+		return
+	}
+	slices.SortFunc(files, func(a, b LogFile) int {
+		if c := cmp.Compare(a.Base, b.Base); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Part, b.Part)
+	})
+
+	merged := 0
+	for _, lf := range files {
+		n, err := fs.mergeSpillFile(lf)
+		merged += n
+		if errors.Is(err, ErrSinkClosed) {
+			break
+		}
+		if err != nil {
+			// Lines spilled from now on set spillPending again; otherwise the
+			// rest is merged on the next start.
+			if isDiskFullError(err) {
+				fs.disk.markFull(err)
+			}
+			log.Printf("file sink: merge %s back into %s: %v", lf.Path, fs.logDir, err)
+			break
+		}
+	}
+	if merged > 0 {
+		log.Printf("file sink: merged %d spilled lines from %s back into %s", merged, fs.spillDir, fs.logDir)
+	}
+}
+
+// mergeSpillFile appends one spill file to the same file in the log directory,
+// chunk by chunk, and removes it. It returns the number of lines merged.
+func (fs *FileSink) mergeSpillFile(lf LogFile) (int, error) {
+	in, err := os.Open(lf.Path)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	r := bufio.NewReader(in)
+	var off int64
+	merged := 0
+	for {
+		n, size, done, err := fs.mergeSpillChunk(lf, r, off)
+		merged += n
+		if err != nil || done {
+			return merged, err
+		}
+		off += size
+	}
+}
+
+// mergeSpillChunk appends up to mergeChunkLines lines from r, which reads the spill
+// file lf from offset off, rotating as usual. The spill file is removed once it is
+// read to the end. If appending fails, the chunk is cut off again and the spill
+// file is cut down to the lines not merged yet. It returns the number of lines and
+// bytes merged, and whether the file is done.
+func (fs *FileSink) mergeSpillChunk(lf LogFile, r *bufio.Reader, off int64) (int, int64, bool, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.closed {
+		return 0, 0, false, ErrSinkClosed
+	}
+
+	base := filepath.Join(fs.logDir, filepath.FromSlash(lf.Base))
+	var pf *partFile
+	var err error
+	if lf.Date == fs.currentDayStr {
+		pf, err = fs.open.get(base)
+	} else {
+		if pf, err = openPartFile(base, fs.paths, fs.rotation); err == nil {
+			defer pf.Close()
+		}
+	}
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("open dated file %s: %w", base, err)
+	}
+
+	intents := []journalIntent{{Path: pf.path(pf.part), Offset: pf.size}}
+	fail := func(err error) (int, int64, bool, error) {
+		fs.rollback(intents)
+		fs.keepUnmerged(lf.Path, off)
+		return 0, 0, false, err
+	}
+	n, size, done := 0, int64(0), false
+	for n < mergeChunkLines {
+		line, rerr := r.ReadString('\n')
+		if line != "" {
+			size += int64(len(line))
+			line = strings.TrimSuffix(line, "\n")
+			if fs.rotation.full(pf.size, pf.lines, line) {
+				if err := pf.rotate(pf.part+1, fs.rotation); err != nil {
+					return fail(err)
+				}
+				intents = append(intents, journalIntent{Path: pf.path(pf.part)})
+			}
+			if err := pf.write(line); err != nil {
+				return fail(fmt.Errorf("write to dated file %s: %w", pf.f.Name(), err))
+			}
+			n++
+		}
+		if rerr == io.EOF {
+			done = true
+			break
+		}
+		if rerr != nil {
+			return fail(fmt.Errorf("read %s: %w", lf.Path, rerr))
+		}
+	}
+	if err := pf.f.Sync(); err != nil {
+		return fail(fmt.Errorf("sync dated file %s: %w", pf.f.Name(), err))
+	}
+	if !done {
+		return n, size, false, nil
+	}
+	// Spills write under fs.mu too, so nothing was added after the end was read;
+	// the spill sink must just not keep writing to the removed file.
+	fs.closeSpill()
+	return n, size, true, removeSynced(lf.Path)
+}
+
+// keepUnmerged cuts the spill file at path down to its bytes from off on, the
+// lines not merged yet, so a later merge does not write the others twice; fs.mu
+// must be held.
+func (fs *FileSink) keepUnmerged(path string, off int64) {
+	if off == 0 {
+		return
+	}
+	fs.closeSpill()
+	if err := copyTail(path, off); err != nil {
+		log.Printf("file sink: cut merged lines from %s: %v", path, err)
+	}
+}
+
+// copyTail replaces the file at path with its bytes from off on.
+func copyTail(path string, off int64) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if _, err := in.Seek(off, io.SeekStart); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, in); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
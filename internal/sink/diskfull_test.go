@@ -0,0 +1,256 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withFreeSpace makes fs see free bytes of free space, checked on every write.
+func withFreeSpace(fs *FileSink, free *int64) {
+	fs.disk.interval = 0
+	fs.disk.free = func(string) (int64, error) { return *free, nil }
+}
+
+func TestFileSink_RejectsBelowMinFree(t *testing.T) {
+	dir := t.TempDir()
+	fs, err := NewFileSinkWithOptions(dir, FileSinkOptions{MinFreeBytes: 100})
+	if err != nil {
+		t.Fatalf("NewFileSinkWithOptions failed: %v", err)
+	}
+	defer fs.Close()
+	free := int64(50)
+	withFreeSpace(fs, &free)
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	if err := fs.WriteLine(ctx, "rejected", now); !errors.Is(err, ErrDiskFull) {
+		t.Fatalf("expected ErrDiskFull, got %v", err)
+	}
+
+	free = 500
+	if err := fs.WriteLine(ctx, "accepted", now); err != nil {
+		t.Fatalf("expected recovery once space is free, got %v", err)
+	}
+	if got := readToday(t, dir); got != "accepted\n" {
+		t.Fatalf("unexpected file content %q", got)
+	}
+}
+
+func TestFileSink_DropsLowLevelsWhenDiskFull(t *testing.T) {
+	dir := t.TempDir()
+	fs, err := NewFileSinkWithOptions(dir, FileSinkOptions{MinFreeBytes: 100, OnDiskFull: DropLowWhenDiskFull})
+	if err != nil {
+		t.Fatalf("NewFileSinkWithOptions failed: %v", err)
+	}
+	defer fs.Close()
+	free := int64(50)
+	withFreeSpace(fs, &free)
+
+	now := time.Now().UTC()
+	var entries []Entry
+	for _, level := range []string{"debug", "info", "warn", "error", ""} {
+		entries = append(entries, Entry{Line: "line " + level, Timestamp: now, Level: level})
+	}
+	if err := fs.WriteLines(context.Background(), entries); err != nil {
+		t.Fatalf("WriteLines failed: %v", err)
+	}
+	if got := readToday(t, dir); got != "line warn\nline error\nline \n" {
+		t.Fatalf("expected only warn, error and unlevelled lines, got %q", got)
+	}
+}
+
+func TestFileSink_DropLowWithJournalIsNotReplayed(t *testing.T) {
+	dir := t.TempDir()
+	fs, err := NewFileSinkWithOptions(dir, FileSinkOptions{Journal: true, MinFreeBytes: 100, OnDiskFull: DropLowWhenDiskFull})
+	if err != nil {
+		t.Fatalf("NewFileSinkWithOptions failed: %v", err)
+	}
+	free := int64(50)
+	withFreeSpace(fs, &free)
+
+	now := time.Now().UTC()
+	entries := []Entry{
+		{Line: "line debug", Timestamp: now, Level: "debug"},
+		{Line: "line error", Timestamp: now, Level: "error"},
+	}
+	if err := fs.WriteLines(context.Background(), entries); err != nil {
+		t.Fatalf("WriteLines failed: %v", err)
+	}
+	crash(fs)
+
+	// The dropped line is committed and the kept one is written once.
+	fs = newJournaledSink(t, dir, 0)
+	defer fs.Close()
+	if got := readToday(t, dir); got != "line error\n" {
+		t.Fatalf("expected only the kept line, once, got %q", got)
+	}
+}
+
+func TestFileSink_SpillsBelowMinFreeAndRecovers(t *testing.T) {
+	dir := t.TempDir()
+	spillDir := t.TempDir()
+	fs, err := NewFileSinkWithOptions(dir, FileSinkOptions{MinFreeBytes: 100, OnDiskFull: SpillWhenDiskFull, SpillDir: spillDir})
+	if err != nil {
+		t.Fatalf("NewFileSinkWithOptions failed: %v", err)
+	}
+	defer fs.Close()
+	free := int64(50)
+	withFreeSpace(fs, &free)
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	if err := fs.WriteLine(ctx, "spilled", now); err != nil {
+		t.Fatalf("WriteLine failed: %v", err)
+	}
+	free = 500
+	if err := fs.WriteLine(ctx, "back", now); err != nil {
+		t.Fatalf("WriteLine failed: %v", err)
+	}
+	fs.merges.Wait()
+
+	// Spilled lines are moved back once the disk has room.
+	if got := readToday(t, dir); got != "back\nspilled\n" {
+		t.Fatalf("unexpected log content %q", got)
+	}
+	if _, err := os.Stat(dateFilePath(spillDir, todayDateString())); !os.IsNotExist(err) {
+		t.Fatalf("expected the spill file to be removed, got %v", err)
+	}
+}
+
+func TestFileSink_MergesSpillLeftByEarlierRun(t *testing.T) {
+	dir := t.TempDir()
+	spillDir := t.TempDir()
+	yesterday := time.Now().UTC().AddDate(0, 0, -1)
+	spilled := dateFilePath(spillDir, yesterday.Format("2006-01-02"))
+	if err := os.WriteFile(spilled, []byte("one\ntwo\nthree\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	logged := dateFilePath(dir, yesterday.Format("2006-01-02"))
+	if err := os.WriteFile(logged, []byte("before\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fs, err := NewFileSinkWithOptions(dir, FileSinkOptions{OnDiskFull: SpillWhenDiskFull, SpillDir: spillDir, MaxFileLines: 3})
+	if err != nil {
+		t.Fatalf("NewFileSinkWithOptions failed: %v", err)
+	}
+	defer fs.Close()
+	if err := fs.WriteLine(context.Background(), "today", time.Now().UTC()); err != nil {
+		t.Fatalf("WriteLine failed: %v", err)
+	}
+	fs.merges.Wait()
+
+	for path, want := range map[string]string{logged: "before\none\ntwo\n", fs.paths.PartPath(logged, 1): "three\n"} {
+		if got, err := os.ReadFile(path); err != nil || string(got) != want {
+			t.Fatalf("%s: expected %q, got %q, %v", filepath.Base(path), want, got, err)
+		}
+	}
+	if _, err := os.Stat(spilled); !os.IsNotExist(err) {
+		t.Fatalf("expected the spill file to be removed, got %v", err)
+	}
+}
+
+func TestFileSink_MergesSpillInChunks(t *testing.T) {
+	dir := t.TempDir()
+	spillDir := t.TempDir()
+	var spilled strings.Builder
+	for i := 0; i < 2*mergeChunkLines+1; i++ {
+		fmt.Fprintf(&spilled, "spilled %d\n", i)
+	}
+	if err := os.WriteFile(dateFilePath(spillDir, todayDateString()), []byte(spilled.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fs, err := NewFileSinkWithOptions(dir, FileSinkOptions{OnDiskFull: SpillWhenDiskFull, SpillDir: spillDir})
+	if err != nil {
+		t.Fatalf("NewFileSinkWithOptions failed: %v", err)
+	}
+	defer fs.Close()
+	ctx := context.Background()
+	now := time.Now().UTC()
+	if err := fs.WriteLine(ctx, "first", now); err != nil {
+		t.Fatalf("WriteLine failed: %v", err)
+	}
+	// Writes go on while the merge runs; each lands between two chunks.
+	for i := 0; i < 10; i++ {
+		if err := fs.WriteLine(ctx, "during", now); err != nil {
+			t.Fatalf("WriteLine failed: %v", err)
+		}
+	}
+	fs.merges.Wait()
+
+	got := readToday(t, dir)
+	if n := strings.Count(got, "during\n"); n != 10 {
+		t.Fatalf("expected 10 lines written during the merge, got %d", n)
+	}
+	if merged := strings.ReplaceAll(strings.TrimPrefix(got, "first\n"), "during\n", ""); merged != spilled.String() {
+		t.Fatalf("expected every spilled line once and in order, got %d bytes", len(merged))
+	}
+	if _, err := os.Stat(dateFilePath(spillDir, todayDateString())); !os.IsNotExist(err) {
+		t.Fatalf("expected the spill file to be removed, got %v", err)
+	}
+}
+
+func TestFileSink_SpillRequiresDirectory(t *testing.T) {
+	if _, err := NewFileSinkWithOptions(t.TempDir(), FileSinkOptions{OnDiskFull: SpillWhenDiskFull}); err == nil {
+		t.Fatalf("expected an error without SpillDir")
+	}
+}
+
+// fullTodayFile points today's file at /dev/full, where every write fails with ENOSPC.
+func fullTodayFile(t *testing.T, dir string) {
+	t.Helper()
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("/dev/full is not available")
+	}
+	if err := os.Symlink("/dev/full", dateFilePath(dir, todayDateString())); err != nil {
+		t.Skipf("cannot create symlink: %v", err)
+	}
+}
+
+func TestFileSink_DetectsENOSPC(t *testing.T) {
+	for _, policy := range []DiskFullPolicy{RejectWhenDiskFull, SpillWhenDiskFull} {
+		dir := t.TempDir()
+		spillDir := t.TempDir()
+		fullTodayFile(t, dir)
+
+		fs, err := NewFileSinkWithOptions(dir, FileSinkOptions{Journal: true, OnDiskFull: policy, SpillDir: spillDir})
+		if err != nil {
+			t.Fatalf("NewFileSinkWithOptions failed: %v", err)
+		}
+		err = fs.WriteLine(context.Background(), "no room", time.Now().UTC())
+		switch policy {
+		case RejectWhenDiskFull:
+			if !errors.Is(err, ErrDiskFull) {
+				t.Fatalf("expected ErrDiskFull, got %v", err)
+			}
+		case SpillWhenDiskFull:
+			if err != nil {
+				t.Fatalf("expected the line to be spilled, got %v", err)
+			}
+			if got := readToday(t, spillDir); got != "no room\n" {
+				t.Fatalf("unexpected spill content %q", got)
+			}
+		}
+		if err := fs.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+
+		// Rejected lines the caller was told about and spilled lines are committed,
+		// so restarting does not replay them.
+		if err := os.Remove(dateFilePath(dir, todayDateString())); err != nil {
+			t.Fatal(err)
+		}
+		fs = newJournaledSink(t, dir, 0)
+		fs.Close()
+		if got := readToday(t, dir); strings.Contains(got, "no room") {
+			t.Fatalf("line was replayed into %s: %q", filepath.Base(dir), got)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package sink
+
+import (
+	"context"
+	"io"
+	"reflect"
+
+	"logger/internal/format"
+	"logger/internal/model"
+)
+
+// EventSink is a destination that receives structured events rather than lines,
+// so it can route, filter, index or format them by their attributes.
+type EventSink interface {
+	WriteEvents(ctx context.Context, records []EventRecord) error
+}
+
+// EventRecord is an event on its way to an EventSink. Rendered optionally caches
+// the event as formatted by RenderedBy (without trailing newline): a sink writing
+// lines with that same formatter uses it instead of formatting the event again, and
+// every other sink ignores it.
+type EventRecord struct {
+	Event      model.Event
+	Rendered   []byte
+	RenderedBy format.Formatter
+}
+
+// AsEventSink returns s itself when it accepts events, or s behind a LineAdapter
+// formatting with f otherwise.
+func AsEventSink(s Sink, f format.Formatter) EventSink {
+	if es, ok := s.(EventSink); ok {
+		return es
+	}
+	return NewLineAdapter(s, f)
+}
+
+// LineAdapter lets a line-based Sink, such as FileSink or AsyncSink, receive events.
+// Each event is formatted with the adapter's formatter, the text format when it
+// has none.
+type LineAdapter struct {
+	Sink      Sink
+	Formatter format.Formatter // optional
+}
+
+// NewLineAdapter wraps s, formatting events with f (which may be nil).
+func NewLineAdapter(s Sink, f format.Formatter) *LineAdapter {
+	return &LineAdapter{Sink: s, Formatter: f}
+}
+
+// WriteEvents formats records and writes them as one batch, routed by their
+// timestamp, app and level.
+func (a *LineAdapter) WriteEvents(ctx context.Context, records []EventRecord) error {
+	entries := make([]Entry, len(records))
+	for i, rec := range records {
+		line, err := renderRecord(rec, a.Formatter)
+		if err != nil {
+			return err
+		}
+		entries[i] = eventEntry(rec.Event, line)
+	}
+	return WriteEntries(ctx, a.Sink, entries)
+}
+
+// Close closes the wrapped sink if it can be closed.
+func (a *LineAdapter) Close() error {
+	if c, ok := a.Sink.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// renderRecord returns the line for rec in the format of f, or of the text format
+// when f is nil, reusing the pre-rendered line when it was rendered the same way.
+func renderRecord(rec EventRecord, f format.Formatter) (string, error) {
+	if f == nil {
+		f = format.TextFormatter{}
+	}
+	if rec.Rendered != nil && sameFormatter(rec.RenderedBy, f) {
+		return string(rec.Rendered), nil
+	}
+	return f.Format(rec.Event)
+}
+
+// sameFormatter reports whether a and b are the same formatter. Formatters of a
+// type that cannot be compared are never the same.
+func sameFormatter(a, b format.Formatter) bool {
+	if a == nil || reflect.TypeOf(a) != reflect.TypeOf(b) || !reflect.TypeOf(a).Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// eventEntry pairs a line with the event attributes sinks route and filter by.
+func eventEntry(ev model.Event, line string) Entry {
+	return Entry{Line: line, Timestamp: ev.Timestamp, App: ev.App, Level: string(ev.Level), Fields: ev.Fields}
+}
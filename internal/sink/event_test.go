@@ -0,0 +1,132 @@
+package sink
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"logger/internal/format"
+	"logger/internal/model"
+)
+
+// eventRecorder is an EventSink (and line Sink) that keeps what it receives.
+type eventRecorder struct {
+	memorySink
+	events []model.Event
+}
+
+func (r *eventRecorder) WriteEvents(ctx context.Context, records []EventRecord) error {
+	for _, rec := range records {
+		r.events = append(r.events, rec.Event)
+	}
+	return nil
+}
+
+func testEvent(level model.LogLevel, msg string) model.Event {
+	return model.Event{
+		Timestamp: time.Date(2026, 2, 9, 10, 0, 0, 0, time.UTC),
+		Level:     level,
+		App:       "api",
+		Message:   msg,
+	}
+}
+
+func TestLineAdapter_Formatting(t *testing.T) {
+	ev := testEvent(model.LevelInfo, "hello")
+	ctx := context.Background()
+
+	// The adapter's own formatter wins over the pre-rendered line.
+	lines := &memorySink{}
+	if err := NewLineAdapter(lines, format.JSONFormatter{}).WriteEvents(ctx, []EventRecord{{Event: ev, Rendered: []byte("pre")}}); err != nil {
+		t.Fatalf("WriteEvents failed: %v", err)
+	}
+	if !strings.HasPrefix(lines.got(), `{"timestamp":`) {
+		t.Fatalf("expected JSON line, got %q", lines.got())
+	}
+
+	// A line pre-rendered with the adapter's formatter is reused as is.
+	lines = &memorySink{}
+	if err := NewLineAdapter(lines, format.JSONFormatter{}).WriteEvents(ctx, []EventRecord{{Event: ev, Rendered: []byte("pre"), RenderedBy: format.JSONFormatter{}}}); err != nil {
+		t.Fatalf("WriteEvents failed: %v", err)
+	}
+	if lines.got() != "pre" {
+		t.Fatalf("expected pre-rendered line, got %q", lines.got())
+	}
+
+	// Without a formatter the text format is used, whatever was pre-rendered.
+	want, _ := format.TextFormatter{}.Format(ev)
+	for _, rec := range []EventRecord{{Event: ev}, {Event: ev, Rendered: []byte("pre"), RenderedBy: format.JSONFormatter{}}} {
+		lines = &memorySink{}
+		if err := NewLineAdapter(lines, nil).WriteEvents(ctx, []EventRecord{rec}); err != nil {
+			t.Fatalf("WriteEvents failed: %v", err)
+		}
+		if lines.got() != want {
+			t.Fatalf("expected %q, got %q", want, lines.got())
+		}
+	}
+}
+
+func TestLineAdapter_RoutesFileSinkByEvent(t *testing.T) {
+	dir := t.TempDir()
+	paths, err := ParsePathTemplate("{app}/{date}-{level}.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, err := NewFileSinkWithOptions(dir, FileSinkOptions{Paths: paths})
+	if err != nil {
+		t.Fatalf("NewFileSinkWithOptions failed: %v", err)
+	}
+	a := NewLineAdapter(fs, nil)
+	defer a.Close()
+
+	ev := testEvent(model.LevelWarn, "routed")
+	ev.Timestamp = time.Now().UTC()
+	if err := a.WriteEvents(context.Background(), []EventRecord{{Event: ev, Rendered: []byte("routed"), RenderedBy: format.TextFormatter{}}}); err != nil {
+		t.Fatalf("WriteEvents failed: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "api", todayDateString()+"-warn.log"))
+	if err != nil || string(content) != "routed\n" {
+		t.Fatalf("expected line in app/level file, got %q (%v)", content, err)
+	}
+}
+
+func TestAsEventSink(t *testing.T) {
+	rec := &eventRecorder{}
+	if AsEventSink(rec, format.JSONFormatter{}) != EventSink(rec) {
+		t.Fatalf("expected an EventSink to be used as is")
+	}
+	if a, ok := AsEventSink(&memorySink{}, format.JSONFormatter{}).(*LineAdapter); !ok || a.Formatter != (format.JSONFormatter{}) {
+		t.Fatalf("expected a line sink to be adapted with the formatter")
+	}
+}
+
+func TestMultiSink_WriteEventsFormatsPerChild(t *testing.T) {
+	text, jsonl, events := &memorySink{}, &memorySink{}, &eventRecorder{}
+	ms := NewMultiSink(
+		Child{Name: "text", Sink: text},
+		Child{Name: "json", Sink: jsonl, Formatter: format.JSONFormatter{}, Filter: EntryFilter{MinLevel: model.LevelWarn}},
+		Child{Name: "events", Sink: events},
+	)
+	defer ms.Close()
+
+	records := []EventRecord{
+		{Event: testEvent(model.LevelInfo, "one"), Rendered: []byte("one"), RenderedBy: format.TextFormatter{}},
+		{Event: testEvent(model.LevelError, "two"), Rendered: []byte("two"), RenderedBy: format.TextFormatter{}},
+	}
+	if err := ms.WriteEvents(context.Background(), records); err != nil {
+		t.Fatalf("WriteEvents failed: %v", err)
+	}
+
+	if text.got() != "one,two" {
+		t.Fatalf("expected pre-rendered lines, got %q", text.got())
+	}
+	if !strings.Contains(jsonl.got(), `"message":"two"`) || strings.Contains(jsonl.got(), `"one"`) {
+		t.Fatalf("expected only the error event as JSON, got %q", jsonl.got())
+	}
+	if len(events.events) != 2 || events.events[1].Message != "two" || events.got() != "" {
+		t.Fatalf("expected the event sink to receive events, got %+v (lines %q)", events.events, events.got())
+	}
+}
@@ -0,0 +1,91 @@
+package sink
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// defaultMaxOpenFiles bounds the current-day file handles a FileSink keeps open.
+const defaultMaxOpenFiles = 64
+
+// fileCache keeps files open for appending, closing the least recently used beyond
+// max. Files are keyed by the path of their first part. It is not safe for
+// concurrent use; FileSink guards it with its mutex.
+type fileCache struct {
+	max   int
+	open  func(base string) (*partFile, error)
+	order *list.List // *partFile, most recently used first
+	files map[string]*list.Element
+}
+
+func newFileCache(max int, open func(base string) (*partFile, error)) *fileCache {
+	if max <= 0 {
+		max = defaultMaxOpenFiles
+	}
+	return &fileCache{max: max, open: open, order: list.New(), files: make(map[string]*list.Element)}
+}
+
+// get returns the open file for base, opening (and creating) it if needed.
+// Files are not evicted until trim, so every file returned during a batch stays
+// valid until the batch is done.
+func (c *fileCache) get(base string) (*partFile, error) {
+	if el, ok := c.files[base]; ok {
+		c.order.MoveToFront(el)
+		return el.Value.(*partFile), nil
+	}
+	pf, err := c.open(base)
+	if err != nil {
+		return nil, err
+	}
+	c.files[base] = c.order.PushFront(pf)
+	return pf, nil
+}
+
+// len returns the number of open handles.
+func (c *fileCache) len() int { return c.order.Len() }
+
+// trim closes the least recently used handles until at most max remain open.
+func (c *fileCache) trim() {
+	for c.order.Len() > c.max {
+		el := c.order.Back()
+		pf := c.order.Remove(el).(*partFile)
+		delete(c.files, pf.base)
+		_ = pf.Close()
+	}
+}
+
+// closeAll closes every handle and returns the first error.
+func (c *fileCache) closeAll() error {
+	var first error
+	for el := c.order.Front(); el != nil; el = el.Next() {
+		if err := el.Value.(*partFile).Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	c.order.Init()
+	c.files = make(map[string]*list.Element)
+	return first
+}
+
+// openAppend opens path for appending, creating it and its directories if needed.
+func openAppend(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create directory for %s: %w", path, err)
+	}
+	return os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+}
+
+// syncDir syncs a directory so that renames and removals in it are durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("open directory %s: %w", dir, err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("sync directory %s: %w", dir, err)
+	}
+	return nil
+}
@@ -2,9 +2,11 @@ package sink
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"sync"
 	"time"
 )
@@ -14,42 +16,223 @@ type Sink interface {
 	WriteLine(ctx context.Context, line string, timestamp time.Time) error
 }
 
-// FileSink maintains date-based log files with current-day file handle optimization.
+// Entry is a formatted log line together with the timestamp used to route it.
+// App and Level are only used to route the line when the sink's path template
+// contains {app} or {level}. Fields are only read by MultiSink filters.
+type Entry struct {
+	Line      string
+	Timestamp time.Time
+	App       string
+	Level     string
+	Fields    map[string]any
+}
+
+// BatchSink is implemented by sinks that can write several lines in a single pass.
+type BatchSink interface {
+	Sink
+	WriteLines(ctx context.Context, entries []Entry) error
+}
+
+// WriteEntries writes entries to s, using a single WriteLines call when s is a BatchSink
+// and falling back to one WriteLine call per entry otherwise.
+func WriteEntries(ctx context.Context, s Sink, entries []Entry) error {
+	if bs, ok := s.(BatchSink); ok {
+		return bs.WriteLines(ctx, entries)
+	}
+	for _, e := range entries {
+		if err := s.WriteLine(ctx, e.Line, e.Timestamp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FileSink maintains date-based log files. Files of the current day are kept open
+// in a cache of up to MaxOpenFiles handles; files of other days are opened for one
+// batch and closed again.
 type FileSink struct {
-	mu              sync.Mutex
-	logDir          string
-	currentDayStr   string   // Format: YYYY-MM-DD
-	currentDayFile  *os.File // Always-open file handle for the current day
+	mu            sync.Mutex
+	logDir        string
+	paths         *PathTemplate
+	rotation      rotation
+	currentDayStr string     // Format: YYYY-MM-DD
+	open          *fileCache // Open handles of current-day files
+	closed        bool
+	journal       *Journal // Optional write-ahead journal; nil when disabled
+
+	disk       *diskGuard
+	onDiskFull DiskFullPolicy
+	spillDir   string
+	spill      *FileSink // opened on first spill
+	// spillPending is set while the spill directory may hold lines that have not
+	// been merged back into the log directory.
+	spillPending bool
+	merging      bool           // set while mergeSpill runs
+	merges       sync.WaitGroup // the running mergeSpill, for Close
+}
+
+// FileSinkOptions configures optional FileSink behavior. The zero value matches NewFileSink.
+type FileSinkOptions struct {
+	// Journal enables the write-ahead journal in JournalDir (default <logDir>/.journal).
+	// Uncommitted journal entries from a previous run are replayed on startup.
+	Journal    bool
+	JournalDir string
+	// JournalSegmentBytes is the size after which a new journal segment is started.
+	JournalSegmentBytes int64
+	// Extension is the extension of dated files, including the dot (default ".log").
+	// It is only used when Paths is nil.
+	Extension string
+	// Paths lays out files under the log directory (default "{date}" plus Extension).
+	Paths *PathTemplate
+	// MaxOpenFiles caps the current-day file handles kept open (default 64).
+	MaxOpenFiles int
+	// MaxFileBytes and MaxFileLines rotate a file into its next part (YYYY-MM-DD.1.log,
+	// YYYY-MM-DD.2.log, ...) once the next line would exceed them. Zero disables a limit.
+	MaxFileBytes int64
+	MaxFileLines int64
+	// OnDiskFull selects what happens while the disk is full: a write failed with
+	// ENOSPC, or free space is below MinFreeBytes (zero disables the check). The
+	// sink returns to the log directory once space is available again, and merges
+	// spilled lines back into it.
+	OnDiskFull   DiskFullPolicy
+	MinFreeBytes int64
+	// SpillDir receives lines under SpillWhenDiskFull. It should be on another disk.
+	SpillDir string
 }
 
 // NewFileSink creates a FileSink for the given log directory.
 // It'll manage date-based log files (YYYY-MM-DD.log) and keep only today's file open.
 func NewFileSink(logDir string) (*FileSink, error) {
+	return NewFileSinkWithOptions(logDir, FileSinkOptions{})
+}
+
+// NewFileSinkWithOptions creates a FileSink with optional features enabled.
+// When the journal is enabled, lines accepted but not committed before a crash are
+// written to their dated files before the sink is returned.
+func NewFileSinkWithOptions(logDir string, opts FileSinkOptions) (*FileSink, error) {
 	if err := os.MkdirAll(logDir, 0o755); err != nil {
 		return nil, fmt.Errorf("create log directory: %w", err)
 	}
 
+	if opts.OnDiskFull == SpillWhenDiskFull && opts.SpillDir == "" {
+		return nil, fmt.Errorf("spilling when the disk is full requires a spill directory")
+	}
+
 	fs := &FileSink{
-		logDir: logDir,
+		logDir:     logDir,
+		paths:      opts.Paths,
+		rotation:   rotation{maxBytes: opts.MaxFileBytes, maxLines: opts.MaxFileLines},
+		disk:       newDiskGuard(logDir, opts.MinFreeBytes),
+		onDiskFull: opts.OnDiskFull,
+		spillDir:   opts.SpillDir,
+		// Lines spilled before a restart are merged back with the first write.
+		spillPending: opts.OnDiskFull == SpillWhenDiskFull,
+	}
+	if fs.paths == nil {
+		ext := opts.Extension
+		if ext == "" {
+			ext = defaultExtension
+		}
+		fs.paths = DefaultPathTemplate(ext)
 	}
+	fs.open = newFileCache(opts.MaxOpenFiles, func(base string) (*partFile, error) {
+		return openPartFile(base, fs.paths, fs.rotation)
+	})
 
 	// Initialise the current day file handle
-	today := todayDateString()
-	todayPath := dateFilePath(logDir, today)
-	f, err := os.OpenFile(todayPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
-	if err != nil {
-		return nil, fmt.Errorf("open today's log file: %w", err)
+	fs.currentDayStr = todayDateString()
+	if err := fs.openToday(); err != nil {
+		return nil, err
 	}
 
-	fs.currentDayStr = today
-	fs.currentDayFile = f
+	if opts.Journal {
+		dir := opts.JournalDir
+		if dir == "" {
+			dir = filepath.Join(logDir, ".journal")
+		}
+		j, state, err := openJournal(dir, opts.JournalSegmentBytes)
+		if err != nil {
+			_ = fs.open.closeAll()
+			return nil, err
+		}
+		fs.journal = j
+		if err := fs.recover(state); err != nil {
+			_ = fs.Close()
+			return nil, fmt.Errorf("replay journal: %w", err)
+		}
+	}
 	return fs, nil
 }
 
+// recover rewrites uncommitted journal entries. Each file touched by an uncommitted
+// batch is first truncated back to where that batch started, so lines that reached
+// the file before the crash are not duplicated.
+func (fs *FileSink) recover(state journalState) error {
+	truncated := make(map[string]bool)
+	for _, in := range state.intents {
+		if truncated[in.Path] {
+			continue
+		}
+		truncated[in.Path] = true
+
+		path := in.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(fs.logDir, path)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		if info.Size() > in.Offset {
+			if err := os.Truncate(path, in.Offset); err != nil {
+				return fmt.Errorf("truncate %s: %w", path, err)
+			}
+		}
+	}
+	// Open files have stale sizes and line counts after truncation.
+	if len(state.intents) > 0 {
+		_ = fs.open.closeAll()
+		if err := fs.openToday(); err != nil {
+			return err
+		}
+	}
+
+	if len(state.pending) == 0 {
+		return nil
+	}
+
+	entries := make([]Entry, len(state.pending))
+	seqs := make([]uint64, len(state.pending))
+	for i, rec := range state.pending {
+		ts, err := time.Parse(time.RFC3339Nano, rec.TS)
+		if err != nil {
+			return fmt.Errorf("journal entry %d: invalid timestamp: %w", rec.Seq, err)
+		}
+		entries[i] = Entry{Line: rec.Line, Timestamp: ts, App: rec.App, Level: rec.Level}
+		seqs[i] = rec.Seq
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.writeLocked(entries, seqs)
+}
+
 // WriteLine writes a log line to the appropriate dated file based on the message's timestamp.
 // For the current day, the always-open file handle is used.
 // For adjacent days, the file is opened, written to, and immediately closed (no caching).
+// Lines written this way carry no app or level, which paths containing {app} or
+// {level} file under "default"; use WriteLines to route them.
 func (fs *FileSink) WriteLine(ctx context.Context, line string, timestamp time.Time) error {
+	return fs.WriteLines(ctx, []Entry{{Line: line, Timestamp: timestamp}})
+}
+
+// WriteLines writes all entries while holding the sink's lock once, so lines from
+// one batch are never interleaved with other writers. Each touched file is synced
+// once after all of its lines have been written.
+func (fs *FileSink) WriteLines(ctx context.Context, entries []Entry) error {
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
@@ -59,69 +242,312 @@ func (fs *FileSink) WriteLine(ctx context.Context, line string, timestamp time.T
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
 
-	if fs.currentDayFile == nil {
+	if fs.closed {
 		return fmt.Errorf("file sink is closed")
 	}
 
-	// Extract the UTC date from the timestamp
-	targetDate := extractDateString(timestamp)
+	seqs, err := fs.journalAppend(entries)
+	if err != nil {
+		return err
+	}
+	err = fs.writeLocked(entries, seqs)
+	if seqs != nil && errors.Is(err, ErrDiskFull) {
+		// The caller is told the lines were rejected, so they must not be replayed
+		// either. The journal shares the full disk, so this is best effort.
+		_ = fs.journal.Commit(seqs)
+	}
+	return err
+}
 
+// journalAppend records entries in the journal ahead of a write. It returns nil
+// sequence numbers when the journal is disabled, or when the disk is too full to
+// journal them, in which case the lines are left to the disk-full policy.
+func (fs *FileSink) journalAppend(entries []Entry) ([]uint64, error) {
+	if fs.journal == nil {
+		return nil, nil
+	}
+	seqs, err := fs.journal.Append(entries)
+	if isDiskFullError(err) {
+		fs.disk.markFull(err)
+		return nil, nil
+	}
+	return seqs, err
+}
+
+// writeJournaled writes entries that were already recorded by journalAppend.
+func (fs *FileSink) writeJournaled(entries []Entry, seqs []uint64) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.closed {
+		return fmt.Errorf("file sink is closed")
+	}
+	return fs.writeLocked(entries, seqs)
+}
+
+// writeLocked routes and writes entries; fs.mu must be held. seqs holds the journal
+// sequence numbers of entries, or is nil when the journal is disabled.
+// While the disk is full, entries are handled by the disk-full policy instead.
+func (fs *FileSink) writeLocked(entries []Entry, seqs []uint64) error {
 	// Check if server date has changed
 	today := todayDateString()
 	if today != fs.currentDayStr {
-		// Close the old current-day file
-		_ = fs.currentDayFile.Close()
+		// Close the old current-day files and open the new day's file
+		_ = fs.open.closeAll()
+		fs.currentDayStr = today
+		if err := fs.openToday(); err != nil && !isDiskFullError(err) {
+			return err
+		}
+	}
 
-		// Open a new file for the new current day
-		newPath := dateFilePath(fs.logDir, today)
-		newFile, err := os.OpenFile(newPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
-		if err != nil {
-			fs.currentDayFile = nil
-			return fmt.Errorf("open new current day file: %w", err)
+	if !fs.disk.isFull() {
+		err := fs.writeFiles(entries, seqs)
+		if err == nil {
+			fs.disk.writeOK()
+			if fs.spillPending && !fs.merging {
+				fs.startMerge()
+			}
+		}
+		if !isDiskFullError(err) {
+			return err
 		}
+		fs.disk.markFull(err)
+	}
 
-		fs.currentDayStr = today
-		fs.currentDayFile = newFile
+	return fs.writeDiskFull(entries, seqs)
+}
+
+// writeDiskFull applies the disk-full policy to entries, whose journal sequence
+// numbers are seqs (nil when the journal is disabled). Spilled and dropped lines
+// are committed, so they are not replayed into the log directory; the journal
+// shares the full disk, so this is best effort. Rejected lines stay in the
+// journal: WriteLines commits them once it has told its caller, while lines
+// AsyncSink accepted earlier are replayed on restart.
+func (fs *FileSink) writeDiskFull(entries []Entry, seqs []uint64) error {
+	switch fs.onDiskFull {
+	case DropLowWhenDiskFull:
+		keep := make([]Entry, 0, len(entries))
+		var keepSeqs, dropSeqs []uint64
+		for i, e := range entries {
+			if keepsWhenDiskFull(e) {
+				keep = append(keep, e)
+				if seqs != nil {
+					keepSeqs = append(keepSeqs, seqs[i])
+				}
+			} else if seqs != nil {
+				dropSeqs = append(dropSeqs, seqs[i])
+			}
+		}
+		fs.disk.drop(len(entries) - len(keep))
+		// Dropped lines are committed before the kept ones are written, so a crash
+		// in between does not bring them back.
+		if len(dropSeqs) > 0 {
+			_ = fs.journal.Commit(dropSeqs)
+		}
+		if len(keep) == 0 {
+			return nil
+		}
+		// The kept lines are written with their intents and committed by writeFiles.
+		if err := fs.writeFiles(keep, keepSeqs); err != nil {
+			if isDiskFullError(err) {
+				return ErrDiskFull
+			}
+			return err
+		}
+		return nil
+	case SpillWhenDiskFull:
+		if fs.spill == nil {
+			spill, err := NewFileSinkWithOptions(fs.spillDir, FileSinkOptions{
+				Paths:        fs.paths,
+				MaxOpenFiles: fs.open.max,
+				MaxFileBytes: fs.rotation.maxBytes,
+				MaxFileLines: fs.rotation.maxLines,
+			})
+			if err != nil {
+				if isDiskFullError(err) {
+					return ErrDiskFull
+				}
+				return fmt.Errorf("open spill directory: %w", err)
+			}
+			fs.spill = spill
+		}
+		fs.spillPending = true
+		if err := fs.spill.WriteLines(context.Background(), entries); err != nil {
+			return err
+		}
+		if seqs != nil {
+			_ = fs.journal.Commit(seqs)
+		}
+		return nil
+	default:
+		return ErrDiskFull
 	}
+}
 
-	// Route to the appropriate file
-	if targetDate == fs.currentDayStr {
-		// Use the always-open current-day file handle
-		if _, err := fs.currentDayFile.WriteString(line + "\n"); err != nil {
-			return fmt.Errorf("write to current day file: %w", err)
+// writeFiles writes entries to their files in the log directory and commits them
+// in the journal. If a write fails, the lines of this batch that did reach the
+// files are cut off again, so the batch can be retried or redirected as a whole.
+func (fs *FileSink) writeFiles(entries []Entry, seqs []uint64) error {
+	// Adjacent-day files opened for this batch; closed once the batch is done.
+	adjacent := make(map[string]*partFile)
+	defer func() {
+		for _, pf := range adjacent {
+			_ = pf.Close()
 		}
-		if err := fs.currentDayFile.Sync(); err != nil {
-			return fmt.Errorf("sync current day file: %w", err)
+	}()
+	// Handles opened by this batch may exceed the cap until the batch is done.
+	defer fs.open.trim()
+
+	// Resolve the target file and part of every entry before writing anything, so
+	// the journal can record where the batch starts in each file it will touch,
+	// including parts that rotation will create.
+	type target struct {
+		pf   *partFile
+		part int
+	}
+	type planned struct {
+		part        int
+		size, lines int64
+	}
+	plan := make(map[*partFile]*planned)
+	targets := make([]target, len(entries))
+	var touched []target
+	for i, e := range entries {
+		// Extract the UTC date from the timestamp
+		targetDate := extractDateString(e.Timestamp)
+		targetPath := filepath.Join(fs.logDir, fs.paths.Path(targetDate, e.App, e.Level))
+
+		// Route to the appropriate file
+		var pf *partFile
+		if targetDate == fs.currentDayStr {
+			// Use the cached current-day file handle
+			var err error
+			if pf, err = fs.open.get(targetPath); err != nil {
+				return fmt.Errorf("open dated file %s: %w", targetPath, err)
+			}
+		} else {
+			// Open-write-close for adjacent days (no caching, expected to be rare)
+			var ok bool
+			if pf, ok = adjacent[targetPath]; !ok {
+				var err error
+				if pf, err = openPartFile(targetPath, fs.paths, fs.rotation); err != nil {
+					return fmt.Errorf("open dated file %s: %w", targetPath, err)
+				}
+				adjacent[targetPath] = pf
+			}
 		}
-	} else {
-		// Open-write-close for adjacent days (no caching, expected to be rare)
-		targetPath := dateFilePath(fs.logDir, targetDate)
-		f, err := os.OpenFile(targetPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
-		if err != nil {
-			return fmt.Errorf("open dated file %s: %w", targetPath, err)
+
+		p, ok := plan[pf]
+		if !ok {
+			p = &planned{part: pf.part, size: pf.size, lines: pf.lines}
+			plan[pf] = p
+		}
+		if fs.rotation.full(p.size, p.lines, e.Line) {
+			p.part, p.size, p.lines = p.part+1, 0, 0
 		}
-		defer f.Close()
+		p.size += int64(len(e.Line)) + 1
+		p.lines++
 
-		if _, err := f.WriteString(line + "\n"); err != nil {
-			return fmt.Errorf("write to dated file %s: %w", targetPath, err)
+		targets[i] = target{pf: pf, part: p.part}
+		if !slices.Contains(touched, targets[i]) {
+			touched = append(touched, targets[i])
 		}
-		if err := f.Sync(); err != nil {
-			return fmt.Errorf("sync dated file %s: %w", targetPath, err)
+	}
+
+	intents := make([]journalIntent, 0, len(touched))
+	for _, t := range touched {
+		// Parts created by rotation start empty.
+		offset := int64(0)
+		if t.part == t.pf.part {
+			offset = t.pf.size
+		}
+		intents = append(intents, journalIntent{Path: t.pf.path(t.part), Offset: offset})
+	}
+	if seqs != nil {
+		recorded := make([]journalIntent, len(intents))
+		for i, in := range intents {
+			recorded[i] = journalIntent{Path: relPath(fs.logDir, in.Path), Offset: in.Offset, Seq: seqs[0]}
+		}
+		if err := fs.journal.Intend(recorded); err != nil {
+			return err
+		}
+	}
+
+	for i, e := range entries {
+		t := targets[i]
+		if t.part != t.pf.part {
+			if err := t.pf.rotate(t.part, fs.rotation); err != nil {
+				fs.rollback(intents)
+				return err
+			}
+		}
+		if err := t.pf.write(e.Line); err != nil {
+			fs.rollback(intents)
+			return fmt.Errorf("write to dated file %s: %w", t.pf.f.Name(), err)
+		}
+	}
+	// Parts rotated away were synced when they were closed.
+	for pf := range plan {
+		if err := pf.f.Sync(); err != nil {
+			fs.rollback(intents)
+			return fmt.Errorf("sync dated file %s: %w", pf.f.Name(), err)
+		}
+	}
+
+	if seqs != nil {
+		return fs.journal.Commit(seqs)
+	}
+	return nil
+}
+
+// rollback truncates the files of a failed batch back to where the batch started
+// and closes the cached handles, whose sizes are stale afterwards. It is best
+// effort: what cannot be cut off stays in the file.
+func (fs *FileSink) rollback(intents []journalIntent) {
+	for _, in := range intents {
+		if info, err := os.Stat(in.Path); err == nil && info.Mode().IsRegular() && info.Size() > in.Offset {
+			_ = os.Truncate(in.Path, in.Offset)
 		}
 	}
+	_ = fs.open.closeAll()
+}
 
+// openToday opens the current day's file ahead of the first write when the path
+// does not depend on the events, so the file exists as soon as the day starts.
+func (fs *FileSink) openToday() error {
+	if fs.paths.perEvent {
+		return nil
+	}
+	path := filepath.Join(fs.logDir, fs.paths.Path(fs.currentDayStr, "", ""))
+	if _, err := fs.open.get(path); err != nil {
+		return fmt.Errorf("open today's log file: %w", err)
+	}
 	return nil
 }
 
-// Close closes the current-day file handle.
+// Close closes the current-day file handles and the journal, if enabled.
 func (fs *FileSink) Close() error {
 	fs.mu.Lock()
-	defer fs.mu.Unlock()
-	if fs.currentDayFile == nil {
+	if fs.closed {
+		fs.mu.Unlock()
 		return nil
 	}
-	err := fs.currentDayFile.Close()
-	fs.currentDayFile = nil
+	fs.closed = true
+	err := fs.open.closeAll()
+	if fs.spill != nil {
+		if serr := fs.spill.Close(); err == nil {
+			err = serr
+		}
+	}
+	if fs.journal != nil {
+		if jerr := fs.journal.Close(); err == nil {
+			err = jerr
+		}
+	}
+	fs.mu.Unlock()
+
+	// A merge in progress stops before its next chunk.
+	fs.merges.Wait()
 	return err
 }
 
@@ -135,9 +561,10 @@ func extractDateString(t time.Time) string {
 	return t.UTC().Format("2006-01-02")
 }
 
+// defaultExtension is the extension of dated files unless FileSinkOptions.Extension is set.
+const defaultExtension = ".log"
+
 // dateFilePath constructs the full path to a dated log file.
 func dateFilePath(dir string, dateStr string) string {
-	return filepath.Join(dir, dateStr+".log")
+	return filepath.Join(dir, dateStr+defaultExtension)
 }
-
-
@@ -2,8 +2,10 @@ package sink
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -130,6 +132,36 @@ func TestFileSink_ContextCancellation(t *testing.T) {
 	}
 }
 
+func TestFileSink_WriteLinesBatch(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs, err := NewFileSink(tmpDir)
+	if err != nil {
+		t.Fatalf("NewFileSink failed: %v", err)
+	}
+	defer fs.Close()
+
+	now := time.Now().UTC()
+	yesterday := now.AddDate(0, 0, -1)
+	entries := []Entry{
+		{Line: "batch line 1", Timestamp: now},
+		{Line: "batch yesterday", Timestamp: yesterday},
+		{Line: "batch line 2", Timestamp: now},
+	}
+	if err := fs.WriteLines(context.Background(), entries); err != nil {
+		t.Fatalf("WriteLines failed: %v", err)
+	}
+
+	todayContent, _ := os.ReadFile(dateFilePath(tmpDir, extractDateString(now)))
+	if string(todayContent) != "batch line 1\nbatch line 2\n" {
+		t.Fatalf("unexpected today's content: %q", todayContent)
+	}
+
+	yesterdayContent, _ := os.ReadFile(dateFilePath(tmpDir, extractDateString(yesterday)))
+	if string(yesterdayContent) != "batch yesterday\n" {
+		t.Fatalf("unexpected yesterday's content: %q", yesterdayContent)
+	}
+}
+
 func contains(s, substr string) bool {
 	for i := 0; i <= len(s)-len(substr); i++ {
 		if s[i:i+len(substr)] == substr {
@@ -138,3 +170,218 @@ func contains(s, substr string) bool {
 	}
 	return false
 }
+
+func TestFileSink_Extension(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs, err := NewFileSinkWithOptions(tmpDir, FileSinkOptions{Extension: ".jsonl"})
+	if err != nil {
+		t.Fatalf("NewFileSinkWithOptions failed: %v", err)
+	}
+	defer fs.Close()
+
+	if err := fs.WriteLine(context.Background(), `{"message":"x"}`, time.Now().UTC()); err != nil {
+		t.Fatalf("WriteLine failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, todayDateString()+".jsonl"))
+	if err != nil {
+		t.Fatalf("failed to read today's .jsonl file: %v", err)
+	}
+	if string(content) != "{\"message\":\"x\"}\n" {
+		t.Fatalf("unexpected content: %q", content)
+	}
+	if _, err := os.Stat(dateFilePath(tmpDir, todayDateString())); !os.IsNotExist(err) {
+		t.Fatalf("expected no .log file, got err=%v", err)
+	}
+}
+
+func TestFileSink_PathTemplateRoutesByAppAndLevel(t *testing.T) {
+	tmpDir := t.TempDir()
+	paths, err := ParsePathTemplate("{app}/{yyyy}/{mm}/{dd}/{level}.log")
+	if err != nil {
+		t.Fatalf("ParsePathTemplate failed: %v", err)
+	}
+	fs, err := NewFileSinkWithOptions(tmpDir, FileSinkOptions{Paths: paths})
+	if err != nil {
+		t.Fatalf("NewFileSinkWithOptions failed: %v", err)
+	}
+	defer fs.Close()
+
+	now := time.Now().UTC()
+	entries := []Entry{
+		{Line: "api info", Timestamp: now, App: "api", Level: "info"},
+		{Line: "api error", Timestamp: now, App: "api", Level: "error"},
+		{Line: "escape", Timestamp: now, App: "../..", Level: "info"},
+		{Line: "no app", Timestamp: now, Level: "info"},
+	}
+	if err := fs.WriteLines(context.Background(), entries); err != nil {
+		t.Fatalf("WriteLines failed: %v", err)
+	}
+
+	day := now.Format("2006/01/02")
+	want := map[string]string{
+		"api/" + day + "/info.log":       "api info\n",
+		"api/" + day + "/error.log":      "api error\n",
+		"%2E.%2F../" + day + "/info.log": "escape\n",
+		"default/" + day + "/info.log":   "no app\n",
+	}
+	for rel, content := range want {
+		got, err := os.ReadFile(filepath.Join(tmpDir, filepath.FromSlash(rel)))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", rel, err)
+		}
+		if string(got) != content {
+			t.Fatalf("%s: expected %q, got %q", rel, content, got)
+		}
+	}
+}
+
+func TestFileSink_CapsOpenFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	paths, err := ParsePathTemplate("{app}-{date}.log")
+	if err != nil {
+		t.Fatalf("ParsePathTemplate failed: %v", err)
+	}
+	fs, err := NewFileSinkWithOptions(tmpDir, FileSinkOptions{Paths: paths, MaxOpenFiles: 2})
+	if err != nil {
+		t.Fatalf("NewFileSinkWithOptions failed: %v", err)
+	}
+	defer fs.Close()
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	// A batch may touch more files than the cap; the excess is closed afterwards.
+	apps := []string{"a", "b", "c", "a", "d", "a"}
+	var batch []Entry
+	for _, app := range apps {
+		batch = append(batch, Entry{Line: app, Timestamp: now, App: app})
+	}
+	if err := fs.WriteLines(ctx, batch); err != nil {
+		t.Fatalf("WriteLines failed: %v", err)
+	}
+	if n := fs.open.len(); n != 2 {
+		t.Fatalf("expected 2 open handles, got %d", n)
+	}
+	// Evicted files are reopened on demand.
+	for _, app := range apps {
+		if err := fs.WriteLines(ctx, []Entry{{Line: app, Timestamp: now, App: app}}); err != nil {
+			t.Fatalf("WriteLines failed: %v", err)
+		}
+	}
+	if n := fs.open.len(); n != 2 {
+		t.Fatalf("expected 2 open handles, got %d", n)
+	}
+
+	content, _ := os.ReadFile(filepath.Join(tmpDir, "a-"+todayDateString()+".log"))
+	if string(content) != "a\na\na\na\na\na\n" {
+		t.Fatalf("unexpected content for app a: %q", content)
+	}
+}
+
+func readParts(t *testing.T, dir, date string) []string {
+	t.Helper()
+	var parts []string
+	for n := 0; ; n++ {
+		name := date + ".log"
+		if n > 0 {
+			name = fmt.Sprintf("%s.%d.log", date, n)
+		}
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			return parts
+		}
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		parts = append(parts, string(content))
+	}
+}
+
+func TestFileSink_RotatesBySize(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs, err := NewFileSinkWithOptions(tmpDir, FileSinkOptions{MaxFileBytes: 10})
+	if err != nil {
+		t.Fatalf("NewFileSinkWithOptions failed: %v", err)
+	}
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	yesterday := now.AddDate(0, 0, -1)
+	// "aaaa\n" is 5 bytes, so two lines fit in each part; an oversized line gets its own part.
+	batch := []Entry{
+		{Line: "aaaa", Timestamp: now},
+		{Line: "bbbb", Timestamp: now},
+		{Line: "cccc", Timestamp: now},
+		{Line: "yyyy", Timestamp: yesterday},
+		{Line: "zzzz", Timestamp: yesterday},
+		{Line: "wwww", Timestamp: yesterday},
+	}
+	if err := fs.WriteLines(ctx, batch); err != nil {
+		t.Fatalf("WriteLines failed: %v", err)
+	}
+	if err := fs.WriteLine(ctx, "a line longer than the limit", now); err != nil {
+		t.Fatalf("WriteLine failed: %v", err)
+	}
+	if err := fs.WriteLine(ctx, "dddd", now); err != nil {
+		t.Fatalf("WriteLine failed: %v", err)
+	}
+	if err := fs.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	today := readParts(t, tmpDir, todayDateString())
+	want := []string{"aaaa\nbbbb\n", "cccc\n", "a line longer than the limit\n", "dddd\n"}
+	if strings.Join(today, "|") != strings.Join(want, "|") {
+		t.Fatalf("expected today's parts %q, got %q", want, today)
+	}
+	if got := readParts(t, tmpDir, extractDateString(yesterday)); strings.Join(got, "|") != "yyyy\nzzzz\n|wwww\n" {
+		t.Fatalf("unexpected yesterday's parts %q", got)
+	}
+
+	// A new sink continues in the newest part.
+	fs, err = NewFileSinkWithOptions(tmpDir, FileSinkOptions{MaxFileBytes: 10})
+	if err != nil {
+		t.Fatalf("NewFileSinkWithOptions failed: %v", err)
+	}
+	defer fs.Close()
+	if err := fs.WriteLine(ctx, "eeee", now); err != nil {
+		t.Fatalf("WriteLine failed: %v", err)
+	}
+	today = readParts(t, tmpDir, todayDateString())
+	if len(today) != 4 || today[3] != "dddd\neeee\n" {
+		t.Fatalf("expected eeee appended to the last part, got %q", today)
+	}
+}
+
+func TestFileSink_RotatesByLines(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs, err := NewFileSinkWithOptions(tmpDir, FileSinkOptions{MaxFileLines: 2})
+	if err != nil {
+		t.Fatalf("NewFileSinkWithOptions failed: %v", err)
+	}
+	ctx := context.Background()
+	now := time.Now().UTC()
+	for _, line := range []string{"1", "2", "3"} {
+		if err := fs.WriteLine(ctx, line, now); err != nil {
+			t.Fatalf("WriteLine failed: %v", err)
+		}
+	}
+	fs.Close()
+
+	// Reopening counts the lines already in the newest part.
+	fs, err = NewFileSinkWithOptions(tmpDir, FileSinkOptions{MaxFileLines: 2})
+	if err != nil {
+		t.Fatalf("NewFileSinkWithOptions failed: %v", err)
+	}
+	defer fs.Close()
+	for _, line := range []string{"4", "5"} {
+		if err := fs.WriteLine(ctx, line, now); err != nil {
+			t.Fatalf("WriteLine failed: %v", err)
+		}
+	}
+
+	got := readParts(t, tmpDir, todayDateString())
+	if strings.Join(got, "|") != "1\n2\n|3\n4\n|5\n" {
+		t.Fatalf("unexpected parts %q", got)
+	}
+}
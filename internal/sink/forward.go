@@ -0,0 +1,409 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"logger/internal/model"
+)
+
+// ForwardConfig configures a ForwardSink. Zero values select the defaults.
+type ForwardConfig struct {
+	// URL is the upstream endpoint: another logger-server's /logs/batch, where
+	// batches are sent as a JSON array, or its /logs, where they are sent as NDJSON.
+	URL string
+	// BufferDir holds events until the upstream has accepted them (required).
+	BufferDir string
+	// MaxBufferBytes bounds the events in the buffer that the upstream has not
+	// accepted yet; writes fail with ErrQueueFull once it is reached. Zero means
+	// no limit.
+	MaxBufferBytes int64
+	// MaxBatch is the most events sent in one request (default 500).
+	MaxBatch int
+	// FlushInterval is how long the sender waits for more events before sending a
+	// batch that is not yet full. Zero sends as soon as the buffer is drained.
+	FlushInterval time.Duration
+	// Timeout bounds each request (default 10s).
+	Timeout time.Duration
+	// MinBackoff and MaxBackoff bound the wait between attempts, which doubles
+	// after every failure (defaults 100ms and 30s).
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Client sends the requests (default http.DefaultClient).
+	Client *http.Client
+}
+
+const (
+	defaultForwardMaxBatch = 500
+	defaultForwardTimeout  = 10 * time.Second
+)
+
+// forwardRejectedFile is the dead-letter file, in the buffer directory, holding the
+// events the upstream rejected.
+const forwardRejectedFile = "rejected.jsonl"
+
+// rejectedEvent is one line of the dead-letter file.
+type rejectedEvent struct {
+	Error string             `json:"error"`
+	Event model.EventPayload `json:"event"`
+}
+
+// ForwardSink relays events to an upstream logger-server.
+//
+// Every write is appended to a buffer on disk and synced before it returns. A
+// background sender reads the buffer in order, posts it in batches and retries with
+// exponential backoff until the upstream answers; only then is the batch removed
+// from the buffer. Events survive upstream outages and restarts, and are delivered
+// at least once: a batch whose response was lost is sent again. Events the upstream
+// rejects as invalid (a 207 entry, or a 4xx other than 408 and 429 for the whole
+// request) are not retried; they are appended to the dead-letter file
+// forwardRejectedFile in the buffer directory, with the upstream's error, before
+// the batch is acknowledged. The upstream only accepts events from yesterday to
+// tomorrow, so this is where events buffered through a long outage end up.
+type ForwardSink struct {
+	cfg    ForwardConfig
+	ndjson bool
+	buf    *forwardBuffer
+
+	mu     sync.Mutex // guards closed; held while appending so Close waits for writes
+	closed bool
+	wake   chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewForwardSink opens the buffer in cfg.BufferDir and starts sending to cfg.URL,
+// beginning with any events left in the buffer by a previous run.
+func NewForwardSink(cfg ForwardConfig) (*ForwardSink, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("forward sink requires a URL")
+	}
+	if cfg.BufferDir == "" {
+		return nil, errors.New("forward sink requires a buffer directory")
+	}
+	if cfg.MaxBatch <= 0 {
+		cfg.MaxBatch = defaultForwardMaxBatch
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultForwardTimeout
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = defaultRetryMinBackoff
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = max(defaultRetryMaxBackoff, cfg.MinBackoff)
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+
+	buf, err := openForwardBuffer(cfg.BufferDir, 0, cfg.MaxBufferBytes)
+	if err != nil {
+		return nil, err
+	}
+	f := &ForwardSink{
+		cfg:    cfg,
+		ndjson: !strings.HasSuffix(strings.TrimRight(cfg.URL, "/"), "/batch"),
+		buf:    buf,
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go f.run()
+	return f, nil
+}
+
+// WriteLine buffers a single line. See WriteLines.
+func (f *ForwardSink) WriteLine(ctx context.Context, line string, timestamp time.Time) error {
+	return f.WriteLines(ctx, []Entry{{Line: line, Timestamp: timestamp}})
+}
+
+// WriteLines buffers entries for forwarding, each line becoming the message of an
+// event. Entries without a level are sent as info.
+func (f *ForwardSink) WriteLines(ctx context.Context, entries []Entry) error {
+	events := make([]model.EventPayload, len(entries))
+	for i, e := range entries {
+		level := strings.ToLower(e.Level)
+		if level == "" {
+			level = string(model.LevelInfo)
+		}
+		events[i] = model.EventPayload{
+			Timestamp: e.Timestamp.Format(time.RFC3339Nano),
+			Level:     level,
+			Message:   e.Line,
+			App:       e.App,
+			Fields:    e.Fields,
+		}
+	}
+	return f.enqueue(events)
+}
+
+// WriteEvents buffers records for forwarding. Pre-rendered lines are not sent;
+// the upstream formats events itself.
+func (f *ForwardSink) WriteEvents(ctx context.Context, records []EventRecord) error {
+	events := make([]model.EventPayload, len(records))
+	for i, rec := range records {
+		events[i] = rec.Event.Payload()
+	}
+	return f.enqueue(events)
+}
+
+func (f *ForwardSink) enqueue(events []model.EventPayload) error {
+	if len(events) == 0 {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return ErrSinkClosed
+	}
+	if err := f.buf.append(events); err != nil {
+		return err
+	}
+	select {
+	case f.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Pending returns the number of buffered events the upstream has not accepted yet.
+func (f *ForwardSink) Pending() int {
+	return f.buf.pending()
+}
+
+// run is the sender goroutine. After Close it keeps sending while the upstream
+// accepts batches, and exits once the buffer is drained or a send fails.
+func (f *ForwardSink) run() {
+	defer close(f.done)
+
+	stopping := false
+	wait := func(d time.Duration) {
+		if stopping {
+			return
+		}
+		select {
+		case <-time.After(d):
+		case <-f.stop:
+			stopping = true
+		}
+	}
+
+	backoff := f.cfg.MinBackoff
+	for {
+		batch, err := f.fill(&stopping)
+		if err != nil {
+			log.Printf("forward sink: %v", err)
+		}
+		if len(batch) == 0 {
+			if stopping {
+				return
+			}
+			if err != nil {
+				wait(backoff)
+			}
+			continue
+		}
+
+		for {
+			err := f.send(batch)
+			if err == nil {
+				break
+			}
+			if stopping {
+				log.Printf("forward sink: stopping with %d events buffered: %v", f.Pending(), err)
+				return
+			}
+			log.Printf("forward sink: failed to send %d events, retrying in %s: %v", len(batch), backoff, err)
+			wait(backoff)
+			backoff = min(backoff*2, f.cfg.MaxBackoff)
+		}
+		backoff = f.cfg.MinBackoff
+		if err := f.buf.ack(batch[len(batch)-1].Seq); err != nil {
+			log.Printf("forward sink: %v", err)
+		}
+	}
+}
+
+// fill reads the next batch from the buffer, waiting for events to arrive and then
+// lingering up to FlushInterval for a full batch. It returns an empty batch when
+// stopping with nothing left to send.
+func (f *ForwardSink) fill(stopping *bool) ([]bufferedEvent, error) {
+	var linger <-chan time.Time
+	var batch []bufferedEvent
+	for {
+		more, err := f.buf.next(f.cfg.MaxBatch - len(batch))
+		batch = append(batch, more...)
+		if err != nil || len(batch) == f.cfg.MaxBatch {
+			return batch, err
+		}
+		if len(batch) > 0 && (*stopping || f.cfg.FlushInterval <= 0) {
+			return batch, nil
+		}
+		if *stopping {
+			return nil, nil
+		}
+		if len(batch) > 0 && linger == nil {
+			timer := time.NewTimer(f.cfg.FlushInterval)
+			defer timer.Stop()
+			linger = timer.C
+		}
+
+		select {
+		case <-f.wake:
+		case <-linger:
+			return batch, nil
+		case <-f.stop:
+			*stopping = true
+		}
+	}
+}
+
+// forwardResult is the part of the upstream's batch or stream summary the sender
+// reads. Batch errors carry the 0-based index of the event, stream errors its
+// 1-based line.
+type forwardResult struct {
+	Rejected int `json:"rejected"`
+	Errors   []struct {
+		Index *int   `json:"index"`
+		Line  int    `json:"line"`
+		Error string `json:"error"`
+	} `json:"errors"`
+}
+
+// send posts batch once. It returns nil when the batch is done with: the upstream
+// accepted it, or rejected (part of) it for good and the rejected events were
+// written to the dead-letter file.
+func (f *ForwardSink) send(batch []bufferedEvent) error {
+	var body bytes.Buffer
+	contentType := "application/json"
+	if f.ndjson {
+		contentType = "application/x-ndjson"
+		enc := json.NewEncoder(&body)
+		for _, rec := range batch {
+			if err := enc.Encode(rec.Event); err != nil {
+				return fmt.Errorf("encode events: %w", err)
+			}
+		}
+	} else {
+		events := make([]model.EventPayload, len(batch))
+		for i, rec := range batch {
+			events[i] = rec.Event
+		}
+		if err := json.NewEncoder(&body).Encode(events); err != nil {
+			return fmt.Errorf("encode events: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), f.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.cfg.URL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := f.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+
+	switch {
+	case resp.StatusCode == http.StatusMultiStatus:
+		var result forwardResult
+		if err := json.Unmarshal(data, &result); err != nil {
+			// Which events were rejected is unknown, so keep them all.
+			return f.deadLetter(rejectAll(batch, fmt.Sprintf("unreadable %s answer from upstream: %v", resp.Status, err)))
+		}
+		var rejected []rejectedEvent
+		for _, e := range result.Errors {
+			i := e.Line - 1
+			if e.Index != nil {
+				i = *e.Index
+			}
+			if i < 0 || i >= len(batch) {
+				continue
+			}
+			rejected = append(rejected, rejectedEvent{Error: e.Error, Event: batch[i].Event})
+		}
+		if len(rejected) < result.Rejected {
+			log.Printf("forward sink: upstream rejected %d of %d events but named %d of them", result.Rejected, len(batch), len(rejected))
+		}
+		return f.deadLetter(rejected)
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return fmt.Errorf("upstream answered %s: %s", resp.Status, bytes.TrimSpace(data))
+	default:
+		return f.deadLetter(rejectAll(batch, fmt.Sprintf("upstream answered %s: %s", resp.Status, bytes.TrimSpace(data))))
+	}
+}
+
+// rejectAll pairs every event of batch with reason.
+func rejectAll(batch []bufferedEvent, reason string) []rejectedEvent {
+	rejected := make([]rejectedEvent, len(batch))
+	for i, rec := range batch {
+		rejected[i] = rejectedEvent{Error: reason, Event: rec.Event}
+	}
+	return rejected
+}
+
+// deadLetter appends events the upstream rejected to the dead-letter file and
+// syncs it. An error keeps the batch in the buffer, to be sent again.
+func (f *ForwardSink) deadLetter(rejected []rejectedEvent) error {
+	if len(rejected) == 0 {
+		return nil
+	}
+	var buf []byte
+	for _, r := range rejected {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("encode rejected event: %w", err)
+		}
+		buf = append(buf, data...)
+		buf = append(buf, '\n')
+	}
+
+	path := filepath.Join(f.cfg.BufferDir, forwardRejectedFile)
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open dead-letter file: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(buf); err != nil {
+		return fmt.Errorf("write dead-letter file: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("sync dead-letter file: %w", err)
+	}
+	log.Printf("forward sink: upstream rejected %d events, kept in %s: %s", len(rejected), path, rejected[0].Error)
+	return file.Close()
+}
+
+// Close stops accepting events, sends what is buffered while the upstream accepts
+// it, and closes the buffer. Events still buffered are sent after the next start.
+func (f *ForwardSink) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil
+	}
+	f.closed = true
+	close(f.stop)
+	f.mu.Unlock()
+
+	<-f.done
+	return f.buf.close()
+}
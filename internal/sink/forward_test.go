@@ -0,0 +1,238 @@
+package sink_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"logger/internal/format"
+	"logger/internal/httpapi"
+	"logger/internal/model"
+	"logger/internal/sink"
+)
+
+// upstream is an in-process logger-server that keeps the lines it accepts and can
+// be taken down.
+type upstream struct {
+	*httptest.Server
+	down     atomic.Bool
+	requests atomic.Int64
+
+	mu    sync.Mutex
+	lines []string
+}
+
+func (u *upstream) WriteLine(ctx context.Context, line string, timestamp time.Time) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.lines = append(u.lines, line)
+	return nil
+}
+
+func (u *upstream) got() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]string(nil), u.lines...)
+}
+
+func newUpstream(t *testing.T) *upstream {
+	t.Helper()
+	u := &upstream{}
+	h := httpapi.NewLoggerHandlerWithFormat(u, format.JSONFormatter{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/logs", h.PostLog)
+	mux.HandleFunc("/logs/batch", h.PostLogBatch)
+	u.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u.requests.Add(1)
+		if u.down.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(u.Close)
+	return u
+}
+
+func newForwardSink(t *testing.T, url, dir string) *sink.ForwardSink {
+	t.Helper()
+	fwd, err := sink.NewForwardSink(sink.ForwardConfig{
+		URL:        url,
+		BufferDir:  dir,
+		MaxBatch:   3,
+		MinBackoff: 5 * time.Millisecond,
+		MaxBackoff: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewForwardSink failed: %v", err)
+	}
+	return fwd
+}
+
+func forwardEvents(t *testing.T, fwd *sink.ForwardSink, msgs ...string) {
+	t.Helper()
+	records := make([]sink.EventRecord, len(msgs))
+	for i, msg := range msgs {
+		records[i] = sink.EventRecord{Event: model.Event{
+			Timestamp: time.Now().UTC(),
+			Level:     model.LevelInfo,
+			App:       "edge",
+			Message:   msg,
+			Fields:    map[string]any{"n": i},
+		}}
+	}
+	if err := fwd.WriteEvents(context.Background(), records); err != nil {
+		t.Fatalf("WriteEvents failed: %v", err)
+	}
+}
+
+// messages extracts the message of every JSON line, in order.
+func messages(lines []string) string {
+	var msgs []string
+	for _, line := range lines {
+		ev, err := format.JSONFormatter{}.Parse(line)
+		if err != nil {
+			msgs = append(msgs, "?"+line)
+			continue
+		}
+		msgs = append(msgs, ev.Message)
+	}
+	return strings.Join(msgs, ",")
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestForwardSink_RelaysToUpstream(t *testing.T) {
+	for _, endpoint := range []string{"/logs/batch", "/logs"} {
+		u := newUpstream(t)
+		fwd := newForwardSink(t, u.URL+endpoint, t.TempDir())
+		forwardEvents(t, fwd, "a", "b", "c", "d", "e")
+		waitFor(t, func() bool { return fwd.Pending() == 0 })
+		if err := fwd.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+
+		if got := messages(u.got()); got != "a,b,c,d,e" {
+			t.Fatalf("%s: unexpected upstream events %q", endpoint, got)
+		}
+		if !strings.Contains(u.got()[0], `"app":"edge"`) || !strings.Contains(u.got()[1], `"n":1`) {
+			t.Fatalf("%s: expected app and fields to be relayed, got %q", endpoint, u.got()[:2])
+		}
+	}
+}
+
+func TestForwardSink_BuffersWhileUpstreamIsDown(t *testing.T) {
+	u := newUpstream(t)
+	u.down.Store(true)
+	fwd := newForwardSink(t, u.URL+"/logs/batch", t.TempDir())
+	defer fwd.Close()
+
+	forwardEvents(t, fwd, "a", "b", "c", "d")
+	waitFor(t, func() bool { return u.requests.Load() >= 3 })
+	if len(u.got()) != 0 || fwd.Pending() != 4 {
+		t.Fatalf("expected events to stay buffered, got %q (pending %d)", u.got(), fwd.Pending())
+	}
+
+	u.down.Store(false)
+	forwardEvents(t, fwd, "e")
+	waitFor(t, func() bool { return fwd.Pending() == 0 })
+	if got := messages(u.got()); got != "a,b,c,d,e" {
+		t.Fatalf("unexpected upstream events %q", got)
+	}
+}
+
+func TestForwardSink_ResumesAfterRestart(t *testing.T) {
+	u := newUpstream(t)
+	u.down.Store(true)
+	dir := t.TempDir()
+
+	fwd := newForwardSink(t, u.URL+"/logs/batch", dir)
+	forwardEvents(t, fwd, "a", "b")
+	if err := fwd.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	u.down.Store(false)
+	fwd = newForwardSink(t, u.URL+"/logs/batch", dir)
+	forwardEvents(t, fwd, "c")
+	waitFor(t, func() bool { return fwd.Pending() == 0 })
+	fwd.Close()
+
+	// Nothing is sent twice once acknowledged.
+	fwd = newForwardSink(t, u.URL+"/logs/batch", dir)
+	fwd.Close()
+	if got := messages(u.got()); got != "a,b,c" {
+		t.Fatalf("unexpected upstream events %q", got)
+	}
+}
+
+func TestForwardSink_DeadLettersEventsTheUpstreamRejects(t *testing.T) {
+	for _, path := range []string{"/logs/batch", "/logs"} {
+		t.Run(path, func(t *testing.T) {
+			u := newUpstream(t)
+			dir := t.TempDir()
+			fwd := newForwardSink(t, u.URL+path, dir)
+			defer fwd.Close()
+
+			stale := sink.EventRecord{Event: model.Event{
+				Timestamp: time.Now().UTC().AddDate(0, 0, -10),
+				Level:     model.LevelInfo,
+				Message:   "stale",
+			}}
+			forwardEvents(t, fwd, "a")
+			if err := fwd.WriteEvents(context.Background(), []sink.EventRecord{stale}); err != nil {
+				t.Fatalf("WriteEvents failed: %v", err)
+			}
+			forwardEvents(t, fwd, "b")
+			waitFor(t, func() bool { return fwd.Pending() == 0 })
+			if got := messages(u.got()); got != "a,b" {
+				t.Fatalf("unexpected upstream events %q", got)
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, "rejected.jsonl"))
+			if err != nil {
+				t.Fatalf("expected a dead-letter file: %v", err)
+			}
+			var rejected struct {
+				Error string             `json:"error"`
+				Event model.EventPayload `json:"event"`
+			}
+			if err := json.Unmarshal(data, &rejected); err != nil || rejected.Event.Message != "stale" || !strings.Contains(rejected.Error, "3-day window") {
+				t.Fatalf("unexpected dead-letter file %q (%v)", data, err)
+			}
+		})
+	}
+}
+
+func TestForwardSink_BoundedBuffer(t *testing.T) {
+	u := newUpstream(t)
+	u.down.Store(true)
+	fwd, err := sink.NewForwardSink(sink.ForwardConfig{URL: u.URL + "/logs/batch", BufferDir: t.TempDir(), MaxBufferBytes: 300})
+	if err != nil {
+		t.Fatalf("NewForwardSink failed: %v", err)
+	}
+	defer fwd.Close()
+
+	forwardEvents(t, fwd, "fits")
+	records := []sink.EventRecord{{Event: model.Event{Timestamp: time.Now(), Level: model.LevelInfo, Message: strings.Repeat("x", 300)}}}
+	if err := fwd.WriteEvents(context.Background(), records); err != sink.ErrQueueFull {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+}
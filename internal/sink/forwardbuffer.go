@@ -0,0 +1,413 @@
+package sink
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"logger/internal/model"
+)
+
+// defaultForwardSegmentBytes is the size after which the forward buffer starts a new segment.
+const defaultForwardSegmentBytes = 16 << 20
+
+// forwardAckedFile holds the sequence number of the last event the upstream accepted.
+const forwardAckedFile = "acked"
+
+// bufferedEvent is one JSON line in a forward buffer segment.
+type bufferedEvent struct {
+	Seq   uint64             `json:"seq"`
+	Event model.EventPayload `json:"event"`
+}
+
+// bufferSegment is a forward buffer file; segments are named after their first sequence number.
+type bufferSegment struct {
+	path  string
+	first uint64
+	size  int64
+}
+
+// readMark is where the last event of one read ends: its sequence number, the
+// segment holding it and the offset just past its line.
+type readMark struct {
+	seq uint64
+	seg uint64
+	off int64
+}
+
+// forwardBuffer is a durable FIFO of events waiting to be forwarded.
+//
+// Events are appended (and synced) to segment files before a write returns. The
+// sender reads them back in order, and once the upstream has accepted a batch its
+// last sequence number is stored in the acked file. Segments whose events are all
+// acknowledged are removed. Losing an ack (say, in a crash) only means the events
+// are sent again, so delivery is at least once.
+//
+// Only events not acknowledged yet count against maxBytes. After pruning, the
+// acknowledged events still on disk are a prefix of the oldest segment, whose
+// length ackedOff tracks.
+type forwardBuffer struct {
+	dir          string
+	segmentBytes int64
+	maxBytes     int64
+
+	mu       sync.Mutex
+	segments []bufferSegment // oldest first; events are appended to the last one
+	w        *os.File
+	nextSeq  uint64
+	acked    uint64
+	ackedOff int64      // bytes of segments[0] holding acknowledged events
+	read     uint64     // sequence number of the last event handed to the sender
+	marks    []readMark // ends of reads not acknowledged yet, oldest first
+
+	r      *os.File // segment being read, nil until the first read
+	rFirst uint64   // first sequence number of that segment
+	rBuf   *bufio.Reader
+	rOff   int64 // offset of the first unread line in r
+}
+
+// openForwardBuffer opens (or creates) the buffer in dir. Events appended but not
+// acknowledged before the last shutdown are read again.
+func openForwardBuffer(dir string, segmentBytes, maxBytes int64) (*forwardBuffer, error) {
+	if segmentBytes <= 0 {
+		segmentBytes = defaultForwardSegmentBytes
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create forward buffer directory: %w", err)
+	}
+
+	b := &forwardBuffer{dir: dir, segmentBytes: segmentBytes, maxBytes: maxBytes}
+	data, err := os.ReadFile(filepath.Join(dir, forwardAckedFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read forward buffer ack: %w", err)
+	}
+	if len(data) > 0 {
+		if b.acked, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64); err != nil {
+			return nil, fmt.Errorf("parse forward buffer ack: %w", err)
+		}
+	}
+	b.read = b.acked
+	b.nextSeq = b.acked + 1
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.fwd"))
+	if err != nil {
+		return nil, fmt.Errorf("list forward buffer segments: %w", err)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		var first uint64
+		if _, err := fmt.Sscanf(filepath.Base(path), "%020d.fwd", &first); err != nil {
+			return nil, fmt.Errorf("unexpected forward buffer segment %s", path)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("stat forward buffer segment: %w", err)
+		}
+		b.segments = append(b.segments, bufferSegment{path: path, first: first, size: info.Size()})
+		b.nextSeq = max(b.nextSeq, first)
+	}
+
+	n := len(b.segments)
+	if n > 0 {
+		last, err := recoverBufferSegment(&b.segments[n-1])
+		if err != nil {
+			return nil, err
+		}
+		b.nextSeq = max(b.nextSeq, last+1)
+	}
+	// A segment whose events are all acknowledged is not appended to, so that
+	// pruning can remove it.
+	if n > 0 && (b.segments[n-1].size == 0 || b.acked+1 < b.nextSeq) {
+		f, err := os.OpenFile(b.segments[n-1].path, os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("open forward buffer segment: %w", err)
+		}
+		b.w = f
+	} else if err := b.startSegment(); err != nil {
+		return nil, err
+	}
+	if err := b.pruneLocked(); err != nil {
+		b.close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// recoverBufferSegment cuts a torn final line (from a crash mid-append) off seg and
+// returns the last sequence number in it, or zero if it is empty.
+func recoverBufferSegment(seg *bufferSegment) (uint64, error) {
+	data, err := os.ReadFile(seg.path)
+	if err != nil {
+		return 0, fmt.Errorf("read forward buffer segment: %w", err)
+	}
+	if end := int64(bytes.LastIndexByte(data, '\n') + 1); end < int64(len(data)) {
+		if err := os.Truncate(seg.path, end); err != nil {
+			return 0, fmt.Errorf("truncate forward buffer segment: %w", err)
+		}
+		data, seg.size = data[:end], end
+	}
+
+	var last uint64
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		var rec bufferedEvent
+		if json.Unmarshal(line, &rec) == nil && rec.Seq > last {
+			last = rec.Seq
+		}
+	}
+	return last, nil
+}
+
+// startSegment closes the segment being appended to (if any) and starts a new one
+// named after nextSeq.
+func (b *forwardBuffer) startSegment() error {
+	if b.w != nil {
+		if err := b.w.Close(); err != nil {
+			return fmt.Errorf("close forward buffer segment: %w", err)
+		}
+		b.w = nil
+	}
+	path := filepath.Join(b.dir, fmt.Sprintf("%020d.fwd", b.nextSeq))
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open forward buffer segment: %w", err)
+	}
+	b.w = f
+	b.segments = append(b.segments, bufferSegment{path: path, first: b.nextSeq})
+	return nil
+}
+
+// size returns the bytes held by events not acknowledged yet.
+func (b *forwardBuffer) size() int64 {
+	var n int64
+	for _, seg := range b.segments {
+		n += seg.size
+	}
+	return n - b.ackedOff
+}
+
+// append durably adds events to the end of the buffer. It fails with ErrQueueFull
+// when they would take the buffer past maxBytes.
+func (b *forwardBuffer) append(events []model.EventPayload) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var buf []byte
+	for i, ev := range events {
+		data, err := json.Marshal(bufferedEvent{Seq: b.nextSeq + uint64(i), Event: ev})
+		if err != nil {
+			return fmt.Errorf("encode forwarded event: %w", err)
+		}
+		buf = append(buf, data...)
+		buf = append(buf, '\n')
+	}
+	if b.maxBytes > 0 && b.size()+int64(len(buf)) > b.maxBytes {
+		return ErrQueueFull
+	}
+
+	seg := &b.segments[len(b.segments)-1]
+	if seg.size > 0 && seg.size+int64(len(buf)) > b.segmentBytes {
+		if err := b.startSegment(); err != nil {
+			return err
+		}
+		seg = &b.segments[len(b.segments)-1]
+	}
+	if _, err := b.w.Write(buf); err != nil {
+		// Cut off a partial write so later events stay readable.
+		_ = b.w.Truncate(seg.size)
+		return fmt.Errorf("write forward buffer: %w", err)
+	}
+	if err := b.w.Sync(); err != nil {
+		_ = b.w.Truncate(seg.size)
+		return fmt.Errorf("sync forward buffer: %w", err)
+	}
+	seg.size += int64(len(buf))
+	b.nextSeq += uint64(len(events))
+	return nil
+}
+
+// next returns up to n events following the last one returned, in order.
+func (b *forwardBuffer) next(n int) ([]bufferedEvent, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var out []bufferedEvent
+	var mark readMark
+	defer func() {
+		if len(out) > 0 {
+			b.marks = append(b.marks, mark)
+		}
+	}()
+	for len(out) < n && b.read+1 < b.nextSeq {
+		if b.r == nil {
+			if err := b.openReader(b.segmentFor(b.read + 1)); err != nil {
+				return out, err
+			}
+		}
+		line, err := b.rBuf.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				// Not a whole line yet; read it again from its start next time.
+				if _, err := b.r.Seek(b.rOff, io.SeekStart); err != nil {
+					return out, fmt.Errorf("read forward buffer: %w", err)
+				}
+				b.rBuf.Reset(b.r)
+			}
+			seg, ok := b.segmentAfter(b.rFirst)
+			if !ok {
+				break
+			}
+			if err := b.openReader(seg); err != nil {
+				return out, err
+			}
+			continue
+		}
+		if err != nil {
+			return out, fmt.Errorf("read forward buffer: %w", err)
+		}
+		b.rOff += int64(len(line))
+
+		var rec bufferedEvent
+		if err := json.Unmarshal(line, &rec); err != nil {
+			log.Printf("forward sink: skipping unreadable event in %s: %v", b.r.Name(), err)
+			continue
+		}
+		if rec.Seq <= b.read {
+			// Acknowledged before a restart; the ack did not record where it ended.
+			if rec.Seq <= b.acked && b.rFirst == b.segments[0].first {
+				b.ackedOff = b.rOff
+			}
+			continue
+		}
+		b.read = rec.Seq
+		out = append(out, rec)
+		mark = readMark{seq: rec.Seq, seg: b.rFirst, off: b.rOff}
+	}
+	return out, nil
+}
+
+// segmentFor returns the segment holding seq.
+func (b *forwardBuffer) segmentFor(seq uint64) bufferSegment {
+	seg := b.segments[0]
+	for _, s := range b.segments[1:] {
+		if s.first > seq {
+			break
+		}
+		seg = s
+	}
+	return seg
+}
+
+// segmentAfter returns the segment following the one starting at first.
+func (b *forwardBuffer) segmentAfter(first uint64) (bufferSegment, bool) {
+	for _, s := range b.segments {
+		if s.first > first {
+			return s, true
+		}
+	}
+	return bufferSegment{}, false
+}
+
+func (b *forwardBuffer) openReader(seg bufferSegment) error {
+	if b.r != nil {
+		b.r.Close()
+		b.r = nil
+	}
+	f, err := os.Open(seg.path)
+	if err != nil {
+		return fmt.Errorf("open forward buffer segment: %w", err)
+	}
+	b.r, b.rFirst, b.rOff = f, seg.first, 0
+	if b.rBuf == nil {
+		b.rBuf = bufio.NewReaderSize(f, 64*1024)
+	} else {
+		b.rBuf.Reset(f)
+	}
+	return nil
+}
+
+// ack records that every event up to seq was accepted by the upstream and removes
+// the segments that are no longer needed.
+func (b *forwardBuffer) ack(seq uint64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if seq <= b.acked {
+		return nil
+	}
+	tmp := filepath.Join(b.dir, forwardAckedFile+".tmp")
+	if err := os.WriteFile(tmp, []byte(strconv.FormatUint(seq, 10)+"\n"), 0o644); err != nil {
+		return fmt.Errorf("write forward buffer ack: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(b.dir, forwardAckedFile)); err != nil {
+		return fmt.Errorf("write forward buffer ack: %w", err)
+	}
+	b.acked = seq
+
+	var end readMark
+	for len(b.marks) > 0 && b.marks[0].seq <= seq {
+		end, b.marks = b.marks[0], b.marks[1:]
+	}
+
+	// Once everything is acknowledged, a full segment can go as well.
+	if last := b.segments[len(b.segments)-1]; b.acked+1 == b.nextSeq && last.size >= b.segmentBytes {
+		if err := b.startSegment(); err != nil {
+			return err
+		}
+	}
+	if err := b.pruneLocked(); err != nil {
+		return err
+	}
+	if end.seq == seq && end.seg == b.segments[0].first {
+		b.ackedOff = end.off
+	}
+	return nil
+}
+
+// pruneLocked removes segments, other than the one being appended to, whose events
+// are all acknowledged.
+func (b *forwardBuffer) pruneLocked() error {
+	for len(b.segments) > 1 && b.segments[1].first <= b.acked+1 {
+		seg := b.segments[0]
+		if b.r != nil && b.rFirst == seg.first {
+			b.r.Close()
+			b.r = nil
+		}
+		if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove forward buffer segment: %w", err)
+		}
+		b.segments = b.segments[1:]
+		b.ackedOff = 0
+	}
+	return nil
+}
+
+// pending returns the number of events not yet acknowledged.
+func (b *forwardBuffer) pending() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return int(b.nextSeq - 1 - b.acked)
+}
+
+func (b *forwardBuffer) close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.r != nil {
+		b.r.Close()
+		b.r = nil
+	}
+	if b.w == nil {
+		return nil
+	}
+	err := b.w.Close()
+	b.w = nil
+	return err
+}
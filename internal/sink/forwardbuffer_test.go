@@ -0,0 +1,157 @@
+package sink
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"logger/internal/model"
+)
+
+func bufferPayloads(msgs ...string) []model.EventPayload {
+	out := make([]model.EventPayload, len(msgs))
+	for i, msg := range msgs {
+		out[i] = model.EventPayload{Level: "info", Message: msg}
+	}
+	return out
+}
+
+func readBuffered(t *testing.T, b *forwardBuffer, n int) string {
+	t.Helper()
+	recs, err := b.next(n)
+	if err != nil {
+		t.Fatalf("next failed: %v", err)
+	}
+	var msgs []string
+	for _, rec := range recs {
+		msgs = append(msgs, rec.Event.Message)
+	}
+	return strings.Join(msgs, ",")
+}
+
+func TestForwardBuffer_SegmentsAndAcks(t *testing.T) {
+	dir := t.TempDir()
+	b, err := openForwardBuffer(dir, 200, 0)
+	if err != nil {
+		t.Fatalf("openForwardBuffer failed: %v", err)
+	}
+	for _, msg := range []string{"a", "b", "c", "d", "e"} {
+		if err := b.append(bufferPayloads(msg)); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+	if segs, _ := filepath.Glob(filepath.Join(dir, "*.fwd")); len(segs) < 2 {
+		t.Fatalf("expected several segments, got %v", segs)
+	}
+
+	if got := readBuffered(t, b, 3); got != "a,b,c" {
+		t.Fatalf("unexpected first batch %q", got)
+	}
+	if err := b.ack(3); err != nil {
+		t.Fatalf("ack failed: %v", err)
+	}
+	if got := readBuffered(t, b, 3); got != "d,e" {
+		t.Fatalf("unexpected second batch %q", got)
+	}
+	b.close()
+
+	// Unacknowledged events are read again after reopening.
+	b, err = openForwardBuffer(dir, 200, 0)
+	if err != nil {
+		t.Fatalf("openForwardBuffer failed: %v", err)
+	}
+	if got := readBuffered(t, b, 10); got != "d,e" || b.pending() != 2 {
+		t.Fatalf("expected d,e to be pending, got %q (pending %d)", got, b.pending())
+	}
+	if err := b.ack(5); err != nil {
+		t.Fatalf("ack failed: %v", err)
+	}
+	if segs, _ := filepath.Glob(filepath.Join(dir, "*.fwd")); len(segs) != 1 {
+		t.Fatalf("expected acknowledged segments to be removed, got %v", segs)
+	}
+	b.close()
+}
+
+func TestForwardBuffer_DropsTornTail(t *testing.T) {
+	dir := t.TempDir()
+	b, err := openForwardBuffer(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("openForwardBuffer failed: %v", err)
+	}
+	if err := b.append(bufferPayloads("a")); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	seg := b.segments[0].path
+	b.close()
+
+	// A crash mid-append leaves half a record behind.
+	f, err := os.OpenFile(seg, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"seq":2,"event":{"mess`)
+	f.Close()
+
+	b, err = openForwardBuffer(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("openForwardBuffer failed: %v", err)
+	}
+	defer b.close()
+	if err := b.append(bufferPayloads("b")); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	if got := readBuffered(t, b, 10); got != "a,b" {
+		t.Fatalf("unexpected events %q", got)
+	}
+}
+
+func TestForwardBuffer_OnlyUnackedEventsCountAgainstTheLimit(t *testing.T) {
+	dir := t.TempDir()
+	// Segments are far larger than the limit, so acknowledged events stay on disk.
+	b, err := openForwardBuffer(dir, 0, 300)
+	if err != nil {
+		t.Fatalf("openForwardBuffer failed: %v", err)
+	}
+	appended := 0
+	for ; appended < 100; appended++ {
+		if err := b.append(bufferPayloads("event")); err == ErrQueueFull {
+			break
+		} else if err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+	if appended == 0 || appended == 100 {
+		t.Fatalf("expected the buffer to fill up, appended %d events", appended)
+	}
+
+	// Acknowledging one event makes room for one more.
+	readBuffered(t, b, 1)
+	if err := b.ack(1); err != nil {
+		t.Fatalf("ack failed: %v", err)
+	}
+	if err := b.append(bufferPayloads("event")); err != nil {
+		t.Fatalf("expected room after an ack, got %v", err)
+	}
+	if err := b.append(bufferPayloads("event")); err != ErrQueueFull {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+
+	// A restart does not count the acknowledged events either.
+	b.close()
+	if b, err = openForwardBuffer(dir, 0, 300); err != nil {
+		t.Fatalf("openForwardBuffer failed: %v", err)
+	}
+	defer b.close()
+	if got := readBuffered(t, b, 100); strings.Count(got, "event") != appended {
+		t.Fatalf("expected %d pending events, got %q", appended, got)
+	}
+	if err := b.ack(uint64(appended + 1)); err != nil {
+		t.Fatalf("ack failed: %v", err)
+	}
+	for i := 0; i < appended; i++ {
+		if err := b.append(bufferPayloads("event")); err != nil {
+			t.Fatalf("expected room after acknowledging everything, got %v", err)
+		}
+	}
+}
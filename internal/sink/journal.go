@@ -0,0 +1,469 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultJournalSegmentBytes is the size after which the journal starts a new segment.
+const defaultJournalSegmentBytes = 64 << 20
+
+// Journal record operations.
+const (
+	opAppend = "append" // an accepted line, identified by its sequence number
+	opIntent = "intent" // a batch starting at Seq is about to be written to Path at Offset
+	opCommit = "commit" // the lines in Ranges, and every line up to Seq, are durably in their files
+)
+
+// journalRecord is one JSON line in a journal segment.
+type journalRecord struct {
+	Op     string `json:"op"`
+	Seq    uint64 `json:"seq"`
+	TS     string `json:"ts,omitempty"`
+	Line   string `json:"line,omitempty"`
+	App    string `json:"app,omitempty"`
+	Level  string `json:"level,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Offset int64  `json:"off,omitempty"`
+	// Ranges lists the committed sequence numbers of a commit record as inclusive
+	// [first, last] pairs. Records written before ranges existed only carry Seq.
+	Ranges []seqRange `json:"ranges,omitempty"`
+}
+
+// seqRange is an inclusive range of sequence numbers, encoded as [first, last].
+type seqRange [2]uint64
+
+// journalIntent records where a batch was about to be written in one file.
+type journalIntent struct {
+	Path   string // relative to the log directory
+	Offset int64
+	Seq    uint64 // sequence number of the first line in the batch
+}
+
+// journalSegment is a journal file; segments are named after their first sequence number.
+type journalSegment struct {
+	path    string
+	lastSeq uint64
+}
+
+// Journal is a segmented write-ahead log of accepted lines.
+//
+// Lines are appended (and synced) before they are written to their dated file.
+// Before a batch is written, an intent records the size of every file it touches;
+// after the files are synced, a commit records the sequence numbers written.
+// Commits name exact ranges rather than a high-water mark: a batch that fails stays
+// uncommitted, and is replayed on the next start, even when later batches succeed.
+// On recovery, uncommitted lines are rewritten after truncating each file back to
+// its earliest uncommitted intent, so a replay never duplicates a line.
+type Journal struct {
+	mu           sync.Mutex
+	syncMu       sync.Mutex // serialises fsyncs; taken before mu
+	dir          string
+	segmentBytes int64
+
+	seg      *os.File
+	segSize  int64
+	segments []journalSegment // closed segments, oldest first
+	written  uint64           // number of writeRecords calls so far
+	synced   uint64           // written as of the last completed fsync
+
+	nextSeq   uint64
+	committed uint64     // every line up to and including committed is committed
+	done      []seqRange // committed ranges above committed+1, sorted and disjoint
+}
+
+// journalState is what recovery needs from the journal on startup.
+type journalState struct {
+	pending []journalRecord // uncommitted append records in sequence order
+	intents []journalIntent // uncommitted intents in journal order
+}
+
+// openJournal opens (or creates) the journal in dir and reads back its uncommitted state.
+func openJournal(dir string, segmentBytes int64) (*Journal, journalState, error) {
+	var state journalState
+	if segmentBytes <= 0 {
+		segmentBytes = defaultJournalSegmentBytes
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, state, fmt.Errorf("create journal directory: %w", err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.wal"))
+	if err != nil {
+		return nil, state, fmt.Errorf("list journal segments: %w", err)
+	}
+	sort.Strings(paths)
+
+	j := &Journal{dir: dir, segmentBytes: segmentBytes, nextSeq: 1}
+	var appends []journalRecord
+	var intents []journalIntent
+	var commits []journalRecord
+
+	for i, path := range paths {
+		var first uint64
+		if _, err := fmt.Sscanf(filepath.Base(path), "%020d.wal", &first); err != nil {
+			return nil, state, fmt.Errorf("unexpected journal segment %s", path)
+		}
+		// Segments older than the first one were removed because they were fully committed.
+		if i == 0 && first > 0 && first-1 > j.committed {
+			j.committed = first - 1
+		}
+		if first > j.nextSeq {
+			j.nextSeq = first
+		}
+
+		seg := journalSegment{path: path}
+		if err := readJournalSegment(path, func(rec journalRecord) {
+			switch rec.Op {
+			case opAppend:
+				appends = append(appends, rec)
+				seg.lastSeq = rec.Seq
+				if rec.Seq >= j.nextSeq {
+					j.nextSeq = rec.Seq + 1
+				}
+			case opIntent:
+				intents = append(intents, journalIntent{Path: rec.Path, Offset: rec.Offset, Seq: rec.Seq})
+			case opCommit:
+				commits = append(commits, rec)
+			}
+		}); err != nil {
+			return nil, state, err
+		}
+		j.segments = append(j.segments, seg)
+	}
+
+	for _, rec := range commits {
+		for _, r := range rec.Ranges {
+			j.markDone(r)
+		}
+		if rec.Seq > j.committed {
+			j.markDone(seqRange{1, rec.Seq})
+		}
+	}
+
+	for _, rec := range appends {
+		if !j.isDone(rec.Seq) {
+			state.pending = append(state.pending, rec)
+		}
+	}
+	state.intents = uncommittedIntents(intents, j.isDone)
+
+	if err := j.startSegment(); err != nil {
+		return nil, state, err
+	}
+	return j, state, nil
+}
+
+// uncommittedIntents returns the intents of uncommitted batches that recovery must
+// truncate back to, in journal order. A failed batch is rolled back before anything
+// else is written, so an uncommitted intent followed by a committed one for the same
+// file is stale: truncating to it would cut off the committed lines after it.
+func uncommittedIntents(intents []journalIntent, committed func(seq uint64) bool) []journalIntent {
+	lastCommitted := make(map[string]int)
+	for i, in := range intents {
+		if committed(in.Seq) {
+			lastCommitted[in.Path] = i
+		}
+	}
+	var out []journalIntent
+	for i, in := range intents {
+		if last, ok := lastCommitted[in.Path]; committed(in.Seq) || (ok && i < last) {
+			continue
+		}
+		out = append(out, in)
+	}
+	return out
+}
+
+// readJournalSegment calls fn for every record in a segment. A torn final record
+// (from a crash mid-append) is ignored: it was never acknowledged to a client.
+func readJournalSegment(path string, fn func(journalRecord)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open journal segment %s: %w", path, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for scanner.Scan() {
+		var rec journalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue
+		}
+		fn(rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read journal segment %s: %w", path, err)
+	}
+	return nil
+}
+
+// startSegment closes the current segment (if any) and opens a new one named after nextSeq.
+// The new segment starts with a commit record so it is self-describing.
+func (j *Journal) startSegment() error {
+	if j.seg != nil {
+		// Appends may still be waiting for their fsync, which this one covers.
+		if err := j.seg.Sync(); err != nil {
+			return fmt.Errorf("sync journal segment: %w", err)
+		}
+		j.synced = j.written
+		if err := j.seg.Close(); err != nil {
+			return fmt.Errorf("close journal segment: %w", err)
+		}
+		j.segments = append(j.segments, journalSegment{path: j.seg.Name(), lastSeq: j.nextSeq - 1})
+	}
+
+	path := filepath.Join(j.dir, fmt.Sprintf("%020d.wal", j.nextSeq))
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open journal segment: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("stat journal segment: %w", err)
+	}
+	// Reopening the segment we just read (same first sequence) continues it.
+	if n := len(j.segments); n > 0 && j.segments[n-1].path == path {
+		j.segments = j.segments[:n-1]
+	}
+	j.seg = f
+	j.segSize = info.Size()
+	return j.writeRecords([]journalRecord{{Op: opCommit, Seq: j.committed, Ranges: j.done}})
+}
+
+// writeRecords appends records to the current segment without syncing.
+func (j *Journal) writeRecords(recs []journalRecord) error {
+	var buf []byte
+	for _, rec := range recs {
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return fmt.Errorf("encode journal record: %w", err)
+		}
+		buf = append(buf, data...)
+		buf = append(buf, '\n')
+	}
+	n, err := j.seg.Write(buf)
+	if err != nil {
+		// Cut off a torn record (say, on a full disk) so later records stay readable.
+		if terr := j.seg.Truncate(j.segSize); terr != nil {
+			j.segSize += int64(n)
+		}
+		return fmt.Errorf("write journal: %w", err)
+	}
+	j.segSize += int64(n)
+	j.written++
+	return nil
+}
+
+// sync makes the records of write number upTo and before durable. It is called
+// without mu held, so writers keep appending during an fsync; concurrent callers
+// share one fsync when it covers their records (group commit).
+func (j *Journal) sync(upTo uint64) error {
+	j.syncMu.Lock()
+	defer j.syncMu.Unlock()
+
+	j.mu.Lock()
+	if j.synced >= upTo {
+		j.mu.Unlock()
+		return nil
+	}
+	seg, written := j.seg, j.written
+	j.mu.Unlock()
+
+	err := seg.Sync()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.synced >= upTo {
+		// A new segment was started meanwhile, syncing and closing seg first.
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("sync journal: %w", err)
+	}
+	j.synced = written
+	return nil
+}
+
+// Append durably records entries and returns their sequence numbers.
+func (j *Journal) Append(entries []Entry) ([]uint64, error) {
+	j.mu.Lock()
+
+	seqs := make([]uint64, len(entries))
+	recs := make([]journalRecord, len(entries))
+	for i, e := range entries {
+		seqs[i] = j.nextSeq + uint64(i)
+		recs[i] = journalRecord{
+			Op:    opAppend,
+			Seq:   seqs[i],
+			TS:    e.Timestamp.Format(time.RFC3339Nano),
+			Line:  e.Line,
+			App:   e.App,
+			Level: e.Level,
+		}
+	}
+	if err := j.writeRecords(recs); err != nil {
+		j.mu.Unlock()
+		return nil, err
+	}
+	j.nextSeq += uint64(len(entries))
+	written := j.written
+	j.mu.Unlock()
+
+	if err := j.sync(written); err != nil {
+		return nil, err
+	}
+	return seqs, nil
+}
+
+// Intend durably records where the next batch will be written before any of it is.
+func (j *Journal) Intend(intents []journalIntent) error {
+	j.mu.Lock()
+	recs := make([]journalRecord, len(intents))
+	for i, in := range intents {
+		recs[i] = journalRecord{Op: opIntent, Seq: in.Seq, Path: in.Path, Offset: in.Offset}
+	}
+	if err := j.writeRecords(recs); err != nil {
+		j.mu.Unlock()
+		return err
+	}
+	written := j.written
+	j.mu.Unlock()
+
+	return j.sync(written)
+}
+
+// Commit records that the lines with sequence numbers seqs are in their files.
+// Lines not named stay uncommitted, whatever their sequence number. The record is
+// not synced on its own: if it is lost, recovery truncates to the batch's intent
+// and rewrites it, which gives the same result.
+func (j *Journal) Commit(seqs []uint64) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	ranges := toRanges(seqs)
+	for _, r := range ranges {
+		j.markDone(r)
+	}
+	if err := j.writeRecords([]journalRecord{{Op: opCommit, Seq: j.committed, Ranges: ranges}}); err != nil {
+		return err
+	}
+
+	if j.segSize >= j.segmentBytes {
+		if err := j.startSegment(); err != nil {
+			return err
+		}
+	}
+	return j.pruneLocked()
+}
+
+// toRanges sorts seqs into inclusive ranges of consecutive sequence numbers.
+func toRanges(seqs []uint64) []seqRange {
+	sorted := slices.Clone(seqs)
+	slices.Sort(sorted)
+	var ranges []seqRange
+	for _, seq := range sorted {
+		if n := len(ranges); n > 0 && seq <= ranges[n-1][1]+1 {
+			ranges[n-1][1] = max(ranges[n-1][1], seq)
+			continue
+		}
+		ranges = append(ranges, seqRange{seq, seq})
+	}
+	return ranges
+}
+
+// markDone adds r to the committed lines, advancing committed over every range
+// that has become contiguous with it.
+func (j *Journal) markDone(r seqRange) {
+	if r[1] <= j.committed {
+		return
+	}
+	r[0] = max(r[0], j.committed+1)
+
+	// Merge r with the ranges it overlaps or touches.
+	merged := make([]seqRange, 0, len(j.done)+1)
+	for _, d := range j.done {
+		switch {
+		case d[1]+1 < r[0]:
+			merged = append(merged, d)
+		case r[1]+1 < d[0]:
+			merged = append(merged, r)
+			r = d
+		default:
+			r = seqRange{min(r[0], d[0]), max(r[1], d[1])}
+		}
+	}
+	merged = append(merged, r)
+
+	if merged[0][0] == j.committed+1 {
+		j.committed = merged[0][1]
+		merged = merged[1:]
+	}
+	j.done = merged
+}
+
+// isDone reports whether the line with sequence number seq is committed.
+func (j *Journal) isDone(seq uint64) bool {
+	if seq <= j.committed {
+		return true
+	}
+	for _, d := range j.done {
+		if seq >= d[0] && seq <= d[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneLocked removes closed segments whose lines are all committed.
+func (j *Journal) pruneLocked() error {
+	keep := j.segments[:0]
+	for i, seg := range j.segments {
+		if seg.lastSeq > j.committed {
+			keep = append(keep, j.segments[i:]...)
+			break
+		}
+		if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+			keep = append(keep, j.segments[i:]...)
+			j.segments = keep
+			return fmt.Errorf("remove journal segment: %w", err)
+		}
+	}
+	j.segments = keep
+	return nil
+}
+
+// Close syncs and closes the current segment.
+func (j *Journal) Close() error {
+	j.syncMu.Lock()
+	defer j.syncMu.Unlock()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.seg == nil {
+		return nil
+	}
+	err := j.seg.Sync()
+	if cerr := j.seg.Close(); err == nil {
+		err = cerr
+	}
+	j.seg = nil
+	return err
+}
+
+// relPath returns path relative to dir for storing in intents.
+func relPath(dir, path string) string {
+	if rel, err := filepath.Rel(dir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
@@ -0,0 +1,326 @@
+package sink
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newJournaledSink(t *testing.T, dir string, segmentBytes int64) *FileSink {
+	t.Helper()
+	fs, err := NewFileSinkWithOptions(dir, FileSinkOptions{Journal: true, JournalSegmentBytes: segmentBytes})
+	if err != nil {
+		t.Fatalf("NewFileSinkWithOptions failed: %v", err)
+	}
+	return fs
+}
+
+// crash releases the sink's handles without committing anything further.
+func crash(fs *FileSink) {
+	_ = fs.journal.Close()
+	_ = fs.open.closeAll()
+	fs.closed = true
+}
+
+func readToday(t *testing.T, dir string) string {
+	t.Helper()
+	content, err := os.ReadFile(dateFilePath(dir, todayDateString()))
+	if err != nil {
+		t.Fatalf("failed to read today's log file: %v", err)
+	}
+	return string(content)
+}
+
+func TestJournal_CommittedLinesAreNotReplayed(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs := newJournaledSink(t, tmpDir, 0)
+
+	now := time.Now().UTC()
+	if err := fs.WriteLine(context.Background(), "committed line", now); err != nil {
+		t.Fatalf("WriteLine failed: %v", err)
+	}
+	crash(fs)
+
+	fs = newJournaledSink(t, tmpDir, 0)
+	defer fs.Close()
+
+	if got := readToday(t, tmpDir); got != "committed line\n" {
+		t.Fatalf("expected exactly one committed line, got %q", got)
+	}
+}
+
+func TestJournal_ReplaysUnwrittenLines(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs := newJournaledSink(t, tmpDir, 0)
+
+	now := time.Now().UTC()
+	yesterday := now.AddDate(0, 0, -1)
+	// Accepted into the journal, but the process dies before the write.
+	if _, err := fs.journal.Append([]Entry{
+		{Line: "lost today", Timestamp: now},
+		{Line: "lost yesterday", Timestamp: yesterday},
+	}); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	crash(fs)
+
+	fs = newJournaledSink(t, tmpDir, 0)
+	defer fs.Close()
+
+	if got := readToday(t, tmpDir); got != "lost today\n" {
+		t.Fatalf("expected replayed line in today's file, got %q", got)
+	}
+	content, _ := os.ReadFile(dateFilePath(tmpDir, extractDateString(yesterday)))
+	if string(content) != "lost yesterday\n" {
+		t.Fatalf("expected replayed line in yesterday's file, got %q", content)
+	}
+}
+
+func TestJournal_ReplayDoesNotDuplicatePartialWrites(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs := newJournaledSink(t, tmpDir, 0)
+
+	now := time.Now().UTC()
+	if err := fs.WriteLine(context.Background(), "before crash", now); err != nil {
+		t.Fatalf("WriteLine failed: %v", err)
+	}
+
+	entries := []Entry{
+		{Line: "in flight 1", Timestamp: now},
+		{Line: "in flight 2", Timestamp: now},
+	}
+	seqs, err := fs.journal.Append(entries)
+	if err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	pf, err := fs.open.get(dateFilePath(tmpDir, todayDateString()))
+	if err != nil {
+		t.Fatalf("failed to get today's file: %v", err)
+	}
+	todayFile := pf.f
+	info, _ := todayFile.Stat()
+	if err := fs.journal.Intend([]journalIntent{{
+		Path:   relPath(tmpDir, todayFile.Name()),
+		Offset: info.Size(),
+		Seq:    seqs[0],
+	}}); err != nil {
+		t.Fatalf("Intend failed: %v", err)
+	}
+	// The first line and half of the second reach the file, then the process dies.
+	if _, err := todayFile.WriteString("in flight 1\nin fl"); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	crash(fs)
+
+	fs = newJournaledSink(t, tmpDir, 0)
+	defer fs.Close()
+
+	want := "before crash\nin flight 1\nin flight 2\n"
+	if got := readToday(t, tmpDir); got != want {
+		t.Fatalf("expected %q after replay, got %q", want, got)
+	}
+}
+
+func TestJournal_PrunesCommittedSegments(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs := newJournaledSink(t, tmpDir, 256)
+	defer fs.Close()
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	for i := 0; i < 50; i++ {
+		if err := fs.WriteLine(ctx, strings.Repeat("x", 40), now); err != nil {
+			t.Fatalf("WriteLine failed: %v", err)
+		}
+	}
+
+	segments, _ := filepath.Glob(filepath.Join(tmpDir, ".journal", "*.wal"))
+	if len(segments) > 2 {
+		t.Fatalf("expected committed segments to be pruned, found %d", len(segments))
+	}
+}
+
+func TestAsyncSink_JournalsBeforeQueueing(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs := newJournaledSink(t, tmpDir, 0)
+
+	// Build the sink without its writer goroutine: the line is queued but never written.
+	as := newAsyncSink(fs, AsyncConfig{QueueSize: 4, MaxBatch: 4})
+	if err := as.WriteLine(context.Background(), "queued only", time.Now().UTC()); err != nil {
+		t.Fatalf("WriteLine failed: %v", err)
+	}
+	crash(fs)
+
+	fs = newJournaledSink(t, tmpDir, 0)
+	defer fs.Close()
+
+	if got := readToday(t, tmpDir); got != "queued only\n" {
+		t.Fatalf("expected queued line to be replayed, got %q", got)
+	}
+}
+
+func TestJournal_ReplayKeepsRouting(t *testing.T) {
+	tmpDir := t.TempDir()
+	paths, err := ParsePathTemplate("{app}/{date}.log")
+	if err != nil {
+		t.Fatalf("ParsePathTemplate failed: %v", err)
+	}
+	open := func() *FileSink {
+		fs, err := NewFileSinkWithOptions(tmpDir, FileSinkOptions{Journal: true, Paths: paths})
+		if err != nil {
+			t.Fatalf("NewFileSinkWithOptions failed: %v", err)
+		}
+		return fs
+	}
+
+	fs := open()
+	if _, err := fs.journal.Append([]Entry{{Line: "lost", Timestamp: time.Now().UTC(), App: "billing"}}); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	crash(fs)
+
+	fs = open()
+	defer fs.Close()
+
+	content, _ := os.ReadFile(filepath.Join(tmpDir, "billing", todayDateString()+".log"))
+	if string(content) != "lost\n" {
+		t.Fatalf("expected replayed line in the app's file, got %q", content)
+	}
+}
+
+func TestJournal_ReplayAcrossRotation(t *testing.T) {
+	tmpDir := t.TempDir()
+	open := func() *FileSink {
+		fs, err := NewFileSinkWithOptions(tmpDir, FileSinkOptions{Journal: true, MaxFileLines: 2})
+		if err != nil {
+			t.Fatalf("NewFileSinkWithOptions failed: %v", err)
+		}
+		return fs
+	}
+
+	fs := open()
+	now := time.Now().UTC()
+	if err := fs.WriteLine(context.Background(), "before crash", now); err != nil {
+		t.Fatalf("WriteLine failed: %v", err)
+	}
+	// The batch spans two parts; only part of it reaches the disk before the crash.
+	entries := []Entry{
+		{Line: "in flight 1", Timestamp: now},
+		{Line: "in flight 2", Timestamp: now},
+		{Line: "in flight 3", Timestamp: now},
+	}
+	seqs, err := fs.journal.Append(entries)
+	if err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	base := dateFilePath(tmpDir, todayDateString())
+	part1 := fs.paths.PartPath(base, 1)
+	if err := fs.journal.Intend([]journalIntent{
+		{Path: relPath(tmpDir, base), Offset: int64(len("before crash\n")), Seq: seqs[0]},
+		{Path: relPath(tmpDir, part1), Offset: 0, Seq: seqs[0]},
+	}); err != nil {
+		t.Fatalf("Intend failed: %v", err)
+	}
+	if err := os.WriteFile(base, []byte("before crash\nin flight 1\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if err := os.WriteFile(part1, []byte("in flight 2\nin fl"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	crash(fs)
+
+	fs = open()
+	defer fs.Close()
+
+	var all string
+	for _, part := range readParts(t, tmpDir, todayDateString()) {
+		all += part
+	}
+	want := "before crash\nin flight 1\nin flight 2\nin flight 3\n"
+	if all != want {
+		t.Fatalf("expected %q across parts after replay, got %q", want, all)
+	}
+}
+
+func TestJournal_FailedBatchIsReplayedAfterLaterCommits(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs := newJournaledSink(t, tmpDir, 0)
+
+	now := time.Now().UTC()
+	// A batch is journaled and its intent recorded, but its write fails and is
+	// rolled back (as in the async writer). A later batch then commits.
+	seqs, err := fs.journal.Append([]Entry{{Line: "failed", Timestamp: now}})
+	if err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if err := fs.journal.Intend([]journalIntent{{
+		Path:   relPath(tmpDir, dateFilePath(tmpDir, todayDateString())),
+		Offset: 0,
+		Seq:    seqs[0],
+	}}); err != nil {
+		t.Fatalf("Intend failed: %v", err)
+	}
+	if err := fs.WriteLine(context.Background(), "later", now); err != nil {
+		t.Fatalf("WriteLine failed: %v", err)
+	}
+	crash(fs)
+
+	fs = newJournaledSink(t, tmpDir, 0)
+	defer fs.Close()
+
+	// The failed line is replayed, and the stale intent does not cut off the later one.
+	if got := readToday(t, tmpDir); got != "later\nfailed\n" {
+		t.Fatalf("expected the failed line to be replayed after the later one, got %q", got)
+	}
+	if !fs.journal.isDone(seqs[0]) || len(fs.journal.done) != 0 {
+		t.Fatalf("expected every line committed after replay, committed=%d done=%v", fs.journal.committed, fs.journal.done)
+	}
+}
+
+func TestJournal_CommitRanges(t *testing.T) {
+	j := &Journal{}
+	for _, r := range []seqRange{{5, 6}, {2, 2}, {9, 9}, {7, 7}} {
+		j.markDone(r)
+	}
+	if j.committed != 0 || len(j.done) != 3 || j.done[0] != (seqRange{2, 2}) || j.done[1] != (seqRange{5, 7}) {
+		t.Fatalf("unexpected state committed=%d done=%v", j.committed, j.done)
+	}
+	j.markDone(seqRange{1, 1})
+	j.markDone(seqRange{3, 4})
+	if j.committed != 7 || len(j.done) != 1 || j.isDone(8) || !j.isDone(9) {
+		t.Fatalf("unexpected state committed=%d done=%v", j.committed, j.done)
+	}
+
+	if got := toRanges([]uint64{4, 1, 2, 7, 3, 3}); len(got) != 2 || got[0] != (seqRange{1, 4}) || got[1] != (seqRange{7, 7}) {
+		t.Fatalf("unexpected ranges %v", got)
+	}
+}
+
+func TestJournal_ConcurrentAppendsShareSyncs(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs := newJournaledSink(t, tmpDir, 512)
+
+	now := time.Now().UTC()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := fs.journal.Append([]Entry{{Line: "accepted", Timestamp: now}}); err != nil {
+				t.Errorf("Append failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	crash(fs)
+
+	fs = newJournaledSink(t, tmpDir, 512)
+	defer fs.Close()
+	if n := strings.Count(readToday(t, tmpDir), "accepted\n"); n != 20 {
+		t.Fatalf("expected 20 replayed lines, got %d", n)
+	}
+}
@@ -0,0 +1,49 @@
+package sink
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// LogFile is a file under the log directory laid out by a PathTemplate.
+type LogFile struct {
+	PathInfo
+	Path        string      // full path on disk
+	Rel         string      // relative to the log directory, "/"-separated, without compression suffix
+	Compression Compression // "" for plain files
+}
+
+// WalkLogFiles calls fn for every file under logDir whose path matches paths,
+// compressed or not. Hidden directories (such as the journal) are skipped. While a
+// file is being compacted, both its plain and compressed copies are reported.
+func WalkLogFiles(logDir string, paths *PathTemplate, fn func(LogFile) error) error {
+	return filepath.WalkDir(logDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == logDir && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			if p != logDir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(logDir, p)
+		if err != nil {
+			return nil
+		}
+		rel, c := splitCompressed(filepath.ToSlash(rel))
+		info, ok := paths.Match(rel)
+		if !ok {
+			return nil
+		}
+		return fn(LogFile{PathInfo: info, Path: p, Rel: rel, Compression: c})
+	})
+}
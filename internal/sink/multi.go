@@ -0,0 +1,496 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"logger/internal/format"
+	"logger/internal/model"
+)
+
+// FailurePolicy decides what a MultiSink does when one of its children fails.
+type FailurePolicy int
+
+const (
+	// FailOnError fails the write with the child's error.
+	FailOnError FailurePolicy = iota
+	// BestEffort logs the error and counts the lines as failed; the write succeeds.
+	BestEffort
+	// RetryInBackground queues the lines and retries them with backoff from a
+	// background goroutine; the write succeeds. Later lines for the child queue
+	// behind them, so the child still receives lines in order.
+	RetryInBackground
+)
+
+// EntryFilter selects the entries a child receives. Zero-valued fields do not filter.
+type EntryFilter struct {
+	MinLevel model.LogLevel // only entries at least this severe
+	Apps     []string       // only entries of these apps
+	// Fields requires each field to be present with the given value, compared in
+	// its formatted form (strings as is, other values as JSON).
+	Fields map[string]string
+	// Where is an arbitrary predicate on the entry.
+	Where func(Entry) bool
+}
+
+// Match reports whether e satisfies every condition of the filter.
+func (f EntryFilter) Match(e Entry) bool {
+	if f.MinLevel != "" && model.LogLevel(strings.ToLower(e.Level)).Severity() < f.MinLevel.Severity() {
+		return false
+	}
+	if len(f.Apps) > 0 && !slices.Contains(f.Apps, e.App) {
+		return false
+	}
+	for k, want := range f.Fields {
+		v, ok := e.Fields[k]
+		if !ok || format.FieldString(v) != want {
+			return false
+		}
+	}
+	return f.Where == nil || f.Where(e)
+}
+
+// RetryConfig configures RetryInBackground. Zero values select the defaults.
+type RetryConfig struct {
+	// MaxPending bounds the lines waiting for a retry (default 10000). When it is
+	// exceeded the oldest lines are dropped.
+	MaxPending int
+	// MinBackoff and MaxBackoff bound the wait between attempts, which doubles
+	// after every failure (defaults 100ms and 30s).
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+const (
+	defaultRetryMaxPending = 10000
+	defaultRetryMinBackoff = 100 * time.Millisecond
+	defaultRetryMaxBackoff = 30 * time.Second
+)
+
+// Child is a destination of a MultiSink. When the MultiSink receives events, a child
+// whose Sink is also an EventSink receives them as they are; other children
+// receive lines formatted with Formatter, the text format when it is nil.
+type Child struct {
+	Name      string // identifies the child in errors, logs and stats
+	Sink      Sink
+	Formatter format.Formatter
+	Filter    EntryFilter
+	OnFailure FailurePolicy
+	Retry     RetryConfig // used with RetryInBackground
+}
+
+// ChildError is the failure of one child of a MultiSink.
+type ChildError struct {
+	Child string
+	Err   error
+}
+
+func (e ChildError) Error() string { return e.Child + ": " + e.Err.Error() }
+
+func (e ChildError) Unwrap() error { return e.Err }
+
+// MultiError holds the failures of the FailOnError children of one write.
+// errors.Is and errors.As see through it to each child's error.
+type MultiError struct {
+	Errors []ChildError
+}
+
+func (e *MultiError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, ce := range e.Errors {
+		msgs[i] = ce.Error()
+	}
+	return "sink write failed: " + strings.Join(msgs, "; ")
+}
+
+func (e *MultiError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, ce := range e.Errors {
+		errs[i] = ce
+	}
+	return errs
+}
+
+// ChildStats counts the lines a child has handled.
+type ChildStats struct {
+	Name      string
+	Written   int64 // lines written, including retried ones
+	Failed    int64 // lines in failed writes, counted again for every failed retry
+	Dropped   int64 // lines dropped from a full retry queue or at Close
+	Pending   int   // lines waiting for a retry
+	LastError error
+}
+
+// MultiSink fans every entry out to the children whose filter it matches. Children
+// are written concurrently; a write returns once every child has been written or
+// has failed according to its policy.
+type MultiSink struct {
+	children []*multiChild
+}
+
+type multiChild struct {
+	Child
+	retry *retrier // nil unless OnFailure is RetryInBackground
+
+	mu    sync.Mutex
+	stats ChildStats
+}
+
+// NewMultiSink creates a MultiSink over children. The MultiSink takes ownership of
+// the children and closes those that implement io.Closer from Close.
+func NewMultiSink(children ...Child) *MultiSink {
+	ms := &MultiSink{}
+	for _, c := range children {
+		mc := &multiChild{Child: c, stats: ChildStats{Name: c.Name}}
+		if c.OnFailure == RetryInBackground {
+			mc.retry = newRetrier(mc)
+		}
+		ms.children = append(ms.children, mc)
+	}
+	return ms
+}
+
+// WriteLine writes a single line. See WriteLines.
+func (ms *MultiSink) WriteLine(ctx context.Context, line string, timestamp time.Time) error {
+	return ms.WriteLines(ctx, []Entry{{Line: line, Timestamp: timestamp}})
+}
+
+// fanItem is one entry on its way to a child, with the event it was rendered from
+// when the MultiSink received events.
+type fanItem struct {
+	entry Entry
+	rec   *EventRecord
+}
+
+// WriteLines writes entries to every child whose filter they match. It returns a
+// *MultiError listing the FailOnError children that failed, or nil.
+func (ms *MultiSink) WriteLines(ctx context.Context, entries []Entry) error {
+	return ms.fanOut(ctx, func(c *multiChild) ([]fanItem, error) {
+		var items []fanItem
+		for _, e := range entries {
+			if c.Filter.Match(e) {
+				items = append(items, fanItem{entry: e})
+			}
+		}
+		return items, nil
+	})
+}
+
+// WriteEvents writes records to every child whose filter they match, formatting
+// them per child. It returns a *MultiError listing the FailOnError children that
+// failed, or nil.
+func (ms *MultiSink) WriteEvents(ctx context.Context, records []EventRecord) error {
+	return ms.fanOut(ctx, func(c *multiChild) ([]fanItem, error) {
+		_, wantsEvents := c.Sink.(EventSink)
+		var items []fanItem
+		for _, rec := range records {
+			e := eventEntry(rec.Event, "")
+			if !c.Filter.Match(e) {
+				continue
+			}
+			if !wantsEvents {
+				line, err := renderRecord(rec, c.Formatter)
+				if err != nil {
+					return nil, fmt.Errorf("format event: %w", err)
+				}
+				e.Line = line
+			}
+			items = append(items, fanItem{entry: e, rec: &rec})
+		}
+		return items, nil
+	})
+}
+
+// fanOut writes the items selected for each child concurrently.
+func (ms *MultiSink) fanOut(ctx context.Context, selectFor func(*multiChild) ([]fanItem, error)) error {
+	errs := make([]error, len(ms.children))
+	var wg sync.WaitGroup
+	for i, c := range ms.children {
+		items, err := selectFor(c)
+		if err != nil {
+			errs[i] = c.fail(err, nil)
+			continue
+		}
+		if len(items) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = c.write(ctx, items)
+		}()
+	}
+	wg.Wait()
+
+	var me MultiError
+	for i, err := range errs {
+		if err != nil {
+			me.Errors = append(me.Errors, ChildError{Child: ms.children[i].Name, Err: err})
+		}
+	}
+	if len(me.Errors) > 0 {
+		return &me
+	}
+	return nil
+}
+
+// write writes items to the child and applies its failure policy. It returns an
+// error only for FailOnError children.
+func (c *multiChild) write(ctx context.Context, items []fanItem) error {
+	if c.retry != nil && c.retry.enqueueIfPending(items) {
+		return nil
+	}
+	err := c.deliver(ctx, items)
+	c.record(len(items), err)
+	if err == nil {
+		return nil
+	}
+	return c.fail(err, items)
+}
+
+// fail applies the failure policy to items the child could not take (or, for a
+// formatting error, items is nil).
+func (c *multiChild) fail(err error, items []fanItem) error {
+	switch c.OnFailure {
+	case BestEffort:
+		log.Printf("multi sink: %s: dropped %d lines: %v", c.Name, len(items), err)
+		return nil
+	case RetryInBackground:
+		if len(items) == 0 {
+			log.Printf("multi sink: %s: %v", c.Name, err)
+			return nil
+		}
+		log.Printf("multi sink: %s: retrying %d lines in the background: %v", c.Name, len(items), err)
+		c.retry.enqueue(items)
+		return nil
+	default:
+		return err
+	}
+}
+
+// deliver writes items in one call: as events when the child accepts them and
+// every item carries one, as lines otherwise.
+func (c *multiChild) deliver(ctx context.Context, items []fanItem) error {
+	if es, ok := c.Sink.(EventSink); ok && items[0].rec != nil {
+		records := make([]EventRecord, 0, len(items))
+		for _, it := range items {
+			if it.rec == nil {
+				break
+			}
+			records = append(records, *it.rec)
+		}
+		if len(records) == len(items) {
+			return es.WriteEvents(ctx, records)
+		}
+	}
+	entries := make([]Entry, len(items))
+	for i, it := range items {
+		entries[i] = it.entry
+	}
+	return WriteEntries(ctx, c.Sink, entries)
+}
+
+// record counts the outcome of writing n lines.
+func (c *multiChild) record(n int, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.stats.Failed += int64(n)
+		c.stats.LastError = err
+	} else {
+		c.stats.Written += int64(n)
+	}
+}
+
+// Stats returns the counters of every child, in the order they were given.
+func (ms *MultiSink) Stats() []ChildStats {
+	out := make([]ChildStats, len(ms.children))
+	for i, c := range ms.children {
+		c.mu.Lock()
+		out[i] = c.stats
+		c.mu.Unlock()
+		if c.retry != nil {
+			out[i].Pending = c.retry.pending()
+		}
+	}
+	return out
+}
+
+// Close stops the background retries, making one last attempt for pending lines,
+// and closes the children. It returns the children's close errors.
+func (ms *MultiSink) Close() error {
+	var errs []error
+	for _, c := range ms.children {
+		if c.retry != nil {
+			c.retry.close()
+		}
+		if closer, ok := c.Sink.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, ChildError{Child: c.Name, Err: err})
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// retrier retries the failed lines of one child in order.
+type retrier struct {
+	c   *multiChild
+	cfg RetryConfig
+
+	mu      sync.Mutex
+	queue   []fanItem
+	trimmed int // lines dropped from the front of queue so far
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	stopped bool
+}
+
+func newRetrier(c *multiChild) *retrier {
+	cfg := c.Retry
+	if cfg.MaxPending <= 0 {
+		cfg.MaxPending = defaultRetryMaxPending
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = defaultRetryMinBackoff
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = max(defaultRetryMaxBackoff, cfg.MinBackoff)
+	}
+	r := &retrier{
+		c:    c,
+		cfg:  cfg,
+		wake: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// enqueueIfPending queues entries behind lines already waiting, so they are not
+// written ahead of them. It reports whether it queued them.
+func (r *retrier) enqueueIfPending(items []fanItem) bool {
+	r.mu.Lock()
+	pending := len(r.queue) > 0
+	r.mu.Unlock()
+	if pending {
+		r.enqueue(items)
+	}
+	return pending
+}
+
+// enqueue queues items for a retry, dropping the oldest beyond MaxPending.
+func (r *retrier) enqueue(items []fanItem) {
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		r.c.drop(len(items))
+		return
+	}
+	r.queue = append(r.queue, items...)
+	var dropped int
+	if over := len(r.queue) - r.cfg.MaxPending; over > 0 {
+		r.queue = slices.Delete(r.queue, 0, over)
+		r.trimmed += over
+		dropped = over
+	}
+	r.mu.Unlock()
+
+	if dropped > 0 {
+		log.Printf("multi sink: %s: retry queue full, dropped %d oldest lines", r.c.Name, dropped)
+		r.c.drop(dropped)
+	}
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (r *retrier) pending() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.queue)
+}
+
+// run retries queued lines until the queue is empty, backing off after failures.
+func (r *retrier) run() {
+	defer close(r.done)
+	backoff := r.cfg.MinBackoff
+	for {
+		select {
+		case <-r.wake:
+		case <-r.stop:
+			return
+		}
+		for r.attempt() != nil {
+			select {
+			case <-time.After(backoff):
+			case <-r.stop:
+				return
+			}
+			backoff = min(backoff*2, r.cfg.MaxBackoff)
+		}
+		backoff = r.cfg.MinBackoff
+	}
+}
+
+// attempt writes the queued lines once and removes them from the queue if the
+// write succeeded.
+func (r *retrier) attempt() error {
+	r.mu.Lock()
+	batch := slices.Clone(r.queue)
+	trimmed := r.trimmed
+	r.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	err := r.c.deliver(context.Background(), batch)
+	r.c.record(len(batch), err)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	// Lines may have been dropped from the front, or added at the back, meanwhile.
+	written := len(batch) - (r.trimmed - trimmed)
+	r.queue = r.queue[min(max(written, 0), len(r.queue)):]
+	r.mu.Unlock()
+	return nil
+}
+
+// close stops retrying after one last attempt and drops what is left.
+func (r *retrier) close() {
+	r.mu.Lock()
+	r.stopped = true
+	r.mu.Unlock()
+	close(r.stop)
+	<-r.done
+
+	if err := r.attempt(); err != nil {
+		log.Printf("multi sink: %s: giving up on retries: %v", r.c.Name, err)
+	}
+	r.mu.Lock()
+	left := len(r.queue)
+	r.queue = nil
+	r.mu.Unlock()
+	r.c.drop(left)
+}
+
+// drop counts lines that will never be written.
+func (c *multiChild) drop(n int) {
+	if n == 0 {
+		return
+	}
+	c.mu.Lock()
+	c.stats.Dropped += int64(n)
+	c.mu.Unlock()
+}
@@ -0,0 +1,194 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"logger/internal/model"
+)
+
+// memorySink records lines and fails while err is set.
+type memorySink struct {
+	mu    sync.Mutex
+	lines []string
+	err   error
+}
+
+func (m *memorySink) WriteLine(ctx context.Context, line string, timestamp time.Time) error {
+	return m.WriteLines(ctx, []Entry{{Line: line, Timestamp: timestamp}})
+}
+
+func (m *memorySink) WriteLines(ctx context.Context, entries []Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	for _, e := range entries {
+		m.lines = append(m.lines, e.Line)
+	}
+	return nil
+}
+
+func (m *memorySink) setErr(err error) {
+	m.mu.Lock()
+	m.err = err
+	m.mu.Unlock()
+}
+
+func (m *memorySink) got() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return strings.Join(m.lines, ",")
+}
+
+func TestEntryFilter_Match(t *testing.T) {
+	e := Entry{Line: "x", App: "billing", Level: "warn", Fields: map[string]any{"region": "eu", "status": 500}}
+	tests := []struct {
+		name   string
+		filter EntryFilter
+		want   bool
+	}{
+		{"empty", EntryFilter{}, true},
+		{"level below", EntryFilter{MinLevel: model.LevelError}, false},
+		{"level at", EntryFilter{MinLevel: model.LevelWarn}, true},
+		{"app", EntryFilter{Apps: []string{"api", "billing"}}, true},
+		{"other app", EntryFilter{Apps: []string{"api"}}, false},
+		{"string field", EntryFilter{Fields: map[string]string{"region": "eu"}}, true},
+		{"number field", EntryFilter{Fields: map[string]string{"status": "500"}}, true},
+		{"missing field", EntryFilter{Fields: map[string]string{"user": "x"}}, false},
+		{"predicate", EntryFilter{Where: func(e Entry) bool { return e.App == "api" }}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Match(e); got != tt.want {
+			t.Errorf("%s: Match = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMultiSink_FansOutByFilter(t *testing.T) {
+	file, stdout := &memorySink{}, &memorySink{}
+	ms := NewMultiSink(
+		Child{Name: "file", Sink: file},
+		Child{Name: "stdout", Sink: stdout, Filter: EntryFilter{MinLevel: model.LevelWarn}},
+	)
+	defer ms.Close()
+
+	now := time.Now().UTC()
+	err := ms.WriteLines(context.Background(), []Entry{
+		{Line: "a", Timestamp: now, Level: "info"},
+		{Line: "b", Timestamp: now, Level: "error"},
+	})
+	if err != nil {
+		t.Fatalf("WriteLines failed: %v", err)
+	}
+	if file.got() != "a,b" || stdout.got() != "b" {
+		t.Fatalf("unexpected fan-out: file %q, stdout %q", file.got(), stdout.got())
+	}
+}
+
+func TestMultiSink_FailurePolicies(t *testing.T) {
+	failing := errors.New("boom")
+	strict, lax := &memorySink{err: ErrDiskFull}, &memorySink{err: failing}
+	ok := &memorySink{}
+	ms := NewMultiSink(
+		Child{Name: "strict", Sink: strict},
+		Child{Name: "lax", Sink: lax, OnFailure: BestEffort},
+		Child{Name: "ok", Sink: ok},
+	)
+	defer ms.Close()
+
+	err := ms.WriteLine(context.Background(), "a", time.Now())
+	var me *MultiError
+	if !errors.As(err, &me) {
+		t.Fatalf("expected *MultiError, got %v", err)
+	}
+	if len(me.Errors) != 1 || me.Errors[0].Child != "strict" {
+		t.Fatalf("expected only the strict child to fail the write, got %v", me.Errors)
+	}
+	if !errors.Is(err, ErrDiskFull) {
+		t.Fatalf("expected the child's error to be visible through errors.Is")
+	}
+	if ok.got() != "a" {
+		t.Fatalf("healthy child did not receive the line")
+	}
+
+	stats := ms.Stats()
+	if stats[1].Failed != 1 || !errors.Is(stats[1].LastError, failing) || stats[2].Written != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestMultiSink_RetriesInBackgroundInOrder(t *testing.T) {
+	remote := &memorySink{err: errors.New("unreachable")}
+	ms := NewMultiSink(Child{
+		Name:      "remote",
+		Sink:      remote,
+		OnFailure: RetryInBackground,
+		Retry:     RetryConfig{MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond},
+	})
+	defer ms.Close()
+
+	ctx := context.Background()
+	if err := ms.WriteLine(ctx, "a", time.Now()); err != nil {
+		t.Fatalf("expected retried write to succeed, got %v", err)
+	}
+	remote.setErr(nil)
+	if err := ms.WriteLine(ctx, "b", time.Now()); err != nil {
+		t.Fatalf("WriteLine failed: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for remote.got() != "a,b" {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected lines in order after retry, got %q", remote.got())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if stats := ms.Stats(); stats[0].Pending != 0 || stats[0].Written != 2 {
+		t.Fatalf("unexpected stats: %+v", stats[0])
+	}
+}
+
+func TestMultiSink_RetryQueueDropsOldest(t *testing.T) {
+	remote := &memorySink{err: errors.New("unreachable")}
+	ms := NewMultiSink(Child{
+		Name:      "remote",
+		Sink:      remote,
+		OnFailure: RetryInBackground,
+		Retry:     RetryConfig{MaxPending: 2, MinBackoff: time.Hour},
+	})
+	for _, line := range []string{"a", "b", "c"} {
+		if err := ms.WriteLine(context.Background(), line, time.Now()); err != nil {
+			t.Fatalf("WriteLine failed: %v", err)
+		}
+	}
+	if stats := ms.Stats(); stats[0].Pending != 2 || stats[0].Dropped != 1 {
+		t.Fatalf("unexpected stats: %+v", stats[0])
+	}
+
+	// Close makes one last attempt.
+	remote.setErr(nil)
+	if err := ms.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if remote.got() != "b,c" {
+		t.Fatalf("expected the newest lines to be delivered on close, got %q", remote.got())
+	}
+}
+
+func TestWriterSink(t *testing.T) {
+	var buf bytes.Buffer
+	ws := NewWriterSink(&buf)
+	if err := ws.WriteLines(context.Background(), []Entry{{Line: "a"}, {Line: "b"}}); err != nil {
+		t.Fatalf("WriteLines failed: %v", err)
+	}
+	if buf.String() != "a\nb\n" {
+		t.Fatalf("unexpected output %q", buf.String())
+	}
+}
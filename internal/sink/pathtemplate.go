@@ -0,0 +1,262 @@
+package sink
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxPathSegment bounds the length of an app or level name used in a path.
+const maxPathSegment = 128
+
+// PathTemplate lays out log files under the log directory, for example
+// "{app}/{yyyy}/{mm}/{dd}/{level}.log". Placeholders:
+//
+//	{date}              YYYY-MM-DD
+//	{yyyy} {mm} {dd}    year, month and day
+//	{app} {level}       the event's app and level, escaped with PathSegment
+//
+// Templates use "/" as separator, must be relative, must not contain ".." and must
+// include the date, either as {date} or as all of {yyyy}, {mm} and {dd}.
+//
+// When a file is rotated, later parts insert their number before the extension of
+// the file name: YYYY-MM-DD.log is followed by YYYY-MM-DD.1.log, YYYY-MM-DD.2.log.
+type PathTemplate struct {
+	template string
+	ext      string // extension of the file name, including the dot; may be empty
+	re       *regexp.Regexp
+	groups   []string // placeholder names in capture order; the part number comes last
+	perEvent bool     // the path depends on app or level
+}
+
+// PathInfo is what a file path reveals about the events in it.
+type PathInfo struct {
+	Date  string // YYYY-MM-DD
+	App   string // escaped app, empty when the template has no {app}
+	Level string // escaped level, empty when the template has no {level}
+	Base  string // path of the first part, "/"-separated
+	Part  int    // rotation part; 0 for the first file
+}
+
+var pathPlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// ParsePathTemplate validates a path template.
+func ParsePathTemplate(template string) (*PathTemplate, error) {
+	if template == "" {
+		return nil, fmt.Errorf("path template is empty")
+	}
+	if strings.HasPrefix(template, "/") || filepath.IsAbs(template) {
+		return nil, fmt.Errorf("path template %q must be relative", template)
+	}
+	for _, seg := range strings.Split(template, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return nil, fmt.Errorf("path template %q has an empty, %q or %q segment", template, ".", "..")
+		}
+	}
+
+	pt := &PathTemplate{template: template, ext: templateExt(template)}
+	stem := strings.TrimSuffix(template, pt.ext)
+	seen := make(map[string]bool)
+	var pattern strings.Builder
+	last := 0
+	for _, loc := range pathPlaceholder.FindAllStringIndex(stem, -1) {
+		pattern.WriteString(regexp.QuoteMeta(stem[last:loc[0]]))
+		last = loc[1]
+
+		name := stem[loc[0]+1 : loc[1]-1]
+		var group string
+		switch name {
+		case "date":
+			group = `(\d{4}-\d{2}-\d{2})`
+		case "yyyy":
+			group = `(\d{4})`
+		case "mm", "dd":
+			group = `(\d{2})`
+		case "app", "level":
+			// Lazy, so a trailing ".N" is read as the part number.
+			group = `([^/]+?)`
+			pt.perEvent = true
+		default:
+			return nil, fmt.Errorf("path template %q: unknown placeholder {%s}", template, name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("path template %q: placeholder {%s} used more than once", template, name)
+		}
+		seen[name] = true
+		pt.groups = append(pt.groups, name)
+		pattern.WriteString(group)
+	}
+	rest := stem[last:]
+	if strings.ContainsAny(rest+pt.ext, "{}") {
+		return nil, fmt.Errorf("path template %q has an unterminated placeholder", template)
+	}
+	pattern.WriteString(regexp.QuoteMeta(rest))
+	pattern.WriteString(`(?:\.(\d+))?` + regexp.QuoteMeta(pt.ext))
+	pt.groups = append(pt.groups, "part")
+
+	if !seen["date"] && !(seen["yyyy"] && seen["mm"] && seen["dd"]) {
+		return nil, fmt.Errorf("path template %q must contain {date} or {yyyy}, {mm} and {dd}", template)
+	}
+
+	re, err := regexp.Compile("^" + pattern.String() + "$")
+	if err != nil {
+		return nil, fmt.Errorf("path template %q: %w", template, err)
+	}
+	pt.re = re
+	return pt, nil
+}
+
+// templateExt returns the extension of the template's file name: the text from the
+// last "." after the last placeholder of the final segment, or "" if there is none.
+func templateExt(template string) string {
+	name := template[strings.LastIndex(template, "/")+1:]
+	if locs := pathPlaceholder.FindAllStringIndex(name, -1); len(locs) > 0 {
+		name = name[locs[len(locs)-1][1]:]
+	}
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name[i:]
+	}
+	return ""
+}
+
+// DefaultPathTemplate is the layout used when none is configured: one file per day
+// directly in the log directory, named YYYY-MM-DD plus ext.
+func DefaultPathTemplate(ext string) *PathTemplate {
+	pt, err := ParsePathTemplate("{date}" + ext)
+	if err != nil {
+		panic(err)
+	}
+	return pt
+}
+
+// Path returns the file path, relative to the log directory, for events of the
+// given date (YYYY-MM-DD), app and level.
+func (pt *PathTemplate) Path(date, app, level string) string {
+	yyyy, mm, dd := date[0:4], date[5:7], date[8:10]
+	p := pathPlaceholder.ReplaceAllStringFunc(pt.template, func(ph string) string {
+		switch ph {
+		case "{date}":
+			return date
+		case "{yyyy}":
+			return yyyy
+		case "{mm}":
+			return mm
+		case "{dd}":
+			return dd
+		case "{app}":
+			return PathSegment(app)
+		case "{level}":
+			return PathSegment(level)
+		}
+		return ph
+	})
+	return filepath.FromSlash(p)
+}
+
+// Match reports whether rel, a path relative to the log directory, was laid out by
+// this template and returns what the path says about its events.
+func (pt *PathTemplate) Match(rel string) (PathInfo, bool) {
+	var info PathInfo
+	rel = path.Clean(filepath.ToSlash(rel))
+	m := pt.re.FindStringSubmatch(rel)
+	if m == nil {
+		return info, false
+	}
+	info.Base = rel
+	var yyyy, mm, dd string
+	for i, name := range pt.groups {
+		switch v := m[i+1]; name {
+		case "date":
+			info.Date = v
+		case "yyyy":
+			yyyy = v
+		case "mm":
+			mm = v
+		case "dd":
+			dd = v
+		case "app":
+			info.App = v
+		case "level":
+			info.Level = v
+		case "part":
+			if v == "" {
+				continue
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || strconv.Itoa(n) != v {
+				return info, false
+			}
+			info.Part = n
+			info.Base = strings.TrimSuffix(rel, "."+v+pt.ext) + pt.ext
+		}
+	}
+	if info.Date == "" {
+		info.Date = yyyy + "-" + mm + "-" + dd
+	}
+	return info, true
+}
+
+// PartPath returns the path of rotation part n of the file at base, which must
+// have been produced by Path.
+func (pt *PathTemplate) PartPath(base string, n int) string {
+	if n == 0 {
+		return base
+	}
+	return strings.TrimSuffix(base, pt.ext) + "." + strconv.Itoa(n) + pt.ext
+}
+
+// String returns the template text.
+func (pt *PathTemplate) String() string { return pt.template }
+
+// PathSegment returns name as it appears in file paths. ASCII letters, digits, "-"
+// and "_" are kept, and so is "." unless it leads the name (which would hide the
+// file or escape its directory) or comes before trailing digits (which would read
+// as a rotation part, "v1.2"). Every other byte is written as "%XX" in upper-case
+// hex, so distinct names never share a path: "a/b" is "a%2Fb", "a b" is "a%20b".
+// An empty name becomes "default" and the name "default" itself "%64efault".
+// Names whose escaped form is longer than maxPathSegment are cut short and end in
+// "~" and a hash of the full name.
+func PathSegment(name string) string {
+	switch name {
+	case "":
+		return "default"
+	case "default":
+		return "%64efault"
+	}
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		switch c := name[i]; {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+			b.WriteByte(c)
+		case c == '.' && i > 0 && !isDigits(name[i+1:]):
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	seg := b.String()
+	if len(seg) > maxPathSegment {
+		sum := sha256.Sum256([]byte(name))
+		suffix := "~" + hex.EncodeToString(sum[:8])
+		seg = seg[:maxPathSegment-len(suffix)] + suffix
+	}
+	return seg
+}
+
+// isDigits reports whether s is a non-empty run of ASCII digits.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package sink
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParsePathTemplate_Invalid(t *testing.T) {
+	tests := []struct {
+		template string
+		errPart  string
+	}{
+		{"", "empty"},
+		{"/var/log/{date}.log", "relative"},
+		{"../{date}.log", `".."`},
+		{"{app}//{date}.log", "empty"},
+		{"{app}/{level}.log", "must contain {date}"},
+		{"{yyyy}/{mm}.log", "must contain {date}"},
+		{"{date}/{host}.log", "unknown placeholder {host}"},
+		{"{date}/{date}.log", "more than once"},
+		{"{date}/{app.log", "unterminated"},
+	}
+	for _, tt := range tests {
+		_, err := ParsePathTemplate(tt.template)
+		if err == nil || !strings.Contains(err.Error(), tt.errPart) {
+			t.Fatalf("ParsePathTemplate(%q): expected error containing %q, got %v", tt.template, tt.errPart, err)
+		}
+	}
+}
+
+func TestPathTemplate_PathAndMatch(t *testing.T) {
+	pt, err := ParsePathTemplate("{app}/{yyyy}/{mm}/{dd}/{level}.log")
+	if err != nil {
+		t.Fatalf("ParsePathTemplate failed: %v", err)
+	}
+
+	rel := pt.Path("2026-02-09", "../../etc/passwd", "error")
+	if want := filepath.FromSlash("%2E.%2F..%2Fetc%2Fpasswd/2026/02/09/error.log"); rel != want {
+		t.Fatalf("expected %q, got %q", want, rel)
+	}
+
+	info, ok := pt.Match(rel)
+	if !ok {
+		t.Fatalf("expected %q to match", rel)
+	}
+	if info != (PathInfo{Date: "2026-02-09", App: "%2E.%2F..%2Fetc%2Fpasswd", Level: "error", Base: "%2E.%2F..%2Fetc%2Fpasswd/2026/02/09/error.log"}) {
+		t.Fatalf("unexpected path info: %+v", info)
+	}
+
+	for _, other := range []string{"2026-02-09.log", "api/2026/02/09/info.txt", "api/x/2026/02/09/info.log"} {
+		if _, ok := pt.Match(other); ok {
+			t.Fatalf("expected %q not to match", other)
+		}
+	}
+}
+
+func TestPathSegment(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"billing-api_v2", "billing-api_v2"},
+		{"", "default"},
+		{"default", "%64efault"},
+		{".", "%2E"},
+		{"..", "%2E."},
+		{".hidden", "%2Ehidden"},
+		{"a/b\\c d", "a%2Fb%5Cc%20d"},
+		{"a_b", "a_b"},
+		{"100%", "100%25"},
+		{"v1.2", "v1%2E2"},
+		{"v1.2x", "v1.2x"},
+		{"ünï", "%C3%BCn%C3%AF"},
+	}
+	for _, tt := range tests {
+		if got := PathSegment(tt.in); got != tt.out {
+			t.Fatalf("PathSegment(%q): expected %q, got %q", tt.in, tt.out, got)
+		}
+	}
+
+	long := PathSegment(strings.Repeat("x", 200))
+	if len(long) != maxPathSegment || !strings.HasPrefix(long, "xxxx") || long == PathSegment(strings.Repeat("x", 201)) {
+		t.Fatalf("unexpected segment for a long name: %q", long)
+	}
+
+	seen := make(map[string]string)
+	for _, name := range []string{"", "default", "a/b", "a b", "a_b", "a%2Fb", "a%252Fb", "ü", "u", "v1.2", "v1_2", "v1%2E2", ".x", "%2Ex"} {
+		seg := PathSegment(name)
+		if other, dup := seen[seg]; dup {
+			t.Fatalf("PathSegment(%q) and PathSegment(%q) are both %q", name, other, seg)
+		}
+		seen[seg] = name
+	}
+}
+
+func TestPathTemplate_Parts(t *testing.T) {
+	tests := []struct {
+		template string
+		base     string
+		part2    string
+	}{
+		{"{date}.log", "2026-02-09.log", "2026-02-09.2.log"},
+		{"{app}/{date}/{level}.log", "api/2026-02-09/info.log", "api/2026-02-09/info.2.log"},
+		{"{date}/app.log.txt", "2026-02-09/app.log.txt", "2026-02-09/app.log.2.txt"},
+		{"{yyyy}/{mm}/{dd}", "2026/02/09", "2026/02/09.2"},
+	}
+	for _, tt := range tests {
+		pt, err := ParsePathTemplate(tt.template)
+		if err != nil {
+			t.Fatalf("ParsePathTemplate(%q) failed: %v", tt.template, err)
+		}
+		base := filepath.ToSlash(pt.Path("2026-02-09", "api", "info"))
+		if base != tt.base {
+			t.Fatalf("%s: expected base %q, got %q", tt.template, tt.base, base)
+		}
+		if got := pt.PartPath(base, 2); got != tt.part2 {
+			t.Fatalf("%s: expected part 2 %q, got %q", tt.template, tt.part2, got)
+		}
+		info, ok := pt.Match(tt.part2)
+		if !ok || info.Part != 2 || info.Base != base || info.Date != "2026-02-09" {
+			t.Fatalf("%s: Match(%q) returned %+v, %v", tt.template, tt.part2, info, ok)
+		}
+	}
+
+	pt, _ := ParsePathTemplate("{date}.log")
+	for _, name := range []string{"2026-02-09.0.log", "2026-02-09.01.log", "2026-02-09.x.log"} {
+		if _, ok := pt.Match(name); ok {
+			t.Fatalf("expected %q not to match", name)
+		}
+	}
+}
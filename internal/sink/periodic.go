@@ -0,0 +1,50 @@
+package sink
+
+import (
+	"sync"
+	"time"
+)
+
+// periodic runs a job in the background, once at start and then every interval,
+// until it is closed. It backs the Compactor and Retention.
+type periodic struct {
+	started bool
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+func newPeriodic() *periodic {
+	return &periodic{stop: make(chan struct{}), done: make(chan struct{})}
+}
+
+// start runs job now and then on every tick of interval.
+func (p *periodic) start(interval time.Duration, job func()) {
+	p.started = true
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			default:
+			}
+			job()
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// close stops the loop, waiting for a job in progress to finish.
+func (p *periodic) close() {
+	p.once.Do(func() { close(p.stop) })
+	if p.started {
+		<-p.done
+	}
+}
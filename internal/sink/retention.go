@@ -0,0 +1,474 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RetentionRule limits the dated files matching Glob. Zero limits are disabled; at
+// least one must be set.
+type RetentionRule struct {
+	// Glob selects files by their path relative to the log directory, "/"-separated
+	// and without compression suffix. A pattern without "/" matches the file name
+	// only; a "**" segment matches any number of directories.
+	Glob string
+	// MaxAge removes files of days that started more than MaxAge ago.
+	MaxAge time.Duration
+	// MaxTotalBytes removes the oldest files while the matching files together
+	// take more than this many bytes.
+	MaxTotalBytes int64
+	// MinFreeBytes removes the oldest files while the file system holding the log
+	// directory has less than this many bytes available.
+	MinFreeBytes int64
+	// ArchiveDir, when set, receives removed files under their relative path
+	// instead of deleting them.
+	ArchiveDir string
+}
+
+// RetentionConfig configures Retention. Zero values select the defaults.
+type RetentionConfig struct {
+	// Rules are tried in order; the first rule whose glob matches a file applies
+	// to it. Files matching no rule are kept.
+	Rules []RetentionRule
+	// Paths is the layout of the log files (default one ".log" file per day).
+	Paths *PathTemplate
+	// Interval is how often the rules are applied (default ten minutes).
+	Interval time.Duration
+}
+
+const defaultRetentionInterval = 10 * time.Minute
+
+// Removal reasons reported by Retention.
+const (
+	ReasonMaxAge    = "max age"
+	ReasonMaxTotal  = "max total size"
+	ReasonFreeSpace = "min free space"
+)
+
+// Removal describes one file deleted or archived by Retention.
+type Removal struct {
+	Path       string // relative to the log directory, "/"-separated
+	Reason     string
+	Bytes      int64
+	ArchivedTo string // path in the archive; empty when the file was deleted
+}
+
+// Retention deletes or archives dated files that pass the limits of their rule,
+// oldest first. Files of yesterday, today and tomorrow, which the API still
+// writes to, are never touched, even if that leaves a limit exceeded.
+type Retention struct {
+	logDir string
+	cfg    RetentionConfig
+	now    func() time.Time
+	free   func(dir string) (int64, error)
+
+	mu   sync.Mutex // serialises runs
+	loop *periodic
+}
+
+// NewRetention validates the rules and creates a Retention over logDir. Call Start
+// to apply it periodically, or Apply to apply it once.
+func NewRetention(logDir string, cfg RetentionConfig) (*Retention, error) {
+	for _, rule := range cfg.Rules {
+		if err := rule.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Paths == nil {
+		cfg.Paths = DefaultPathTemplate(defaultExtension)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultRetentionInterval
+	}
+	return &Retention{
+		logDir: logDir,
+		cfg:    cfg,
+		now:    time.Now,
+		free:   freeBytes,
+		loop:   newPeriodic(),
+	}, nil
+}
+
+func (r RetentionRule) validate() error {
+	if err := validateGlob(r.Glob); err != nil {
+		return err
+	}
+	if r.MaxAge < 0 || r.MaxTotalBytes < 0 || r.MinFreeBytes < 0 {
+		return fmt.Errorf("retention rule %q: limits must not be negative", r.Glob)
+	}
+	if r.MaxAge == 0 && r.MaxTotalBytes == 0 && r.MinFreeBytes == 0 {
+		return fmt.Errorf("retention rule %q sets no limit", r.Glob)
+	}
+	return nil
+}
+
+// Start applies the rules once immediately and then every Interval until Close.
+func (rt *Retention) Start() {
+	rt.loop.start(rt.cfg.Interval, func() {
+		if _, err := rt.Apply(context.Background()); err != nil {
+			log.Printf("retention: %v", err)
+		}
+	})
+}
+
+// Close stops a started Retention, waiting for a run in progress to finish.
+func (rt *Retention) Close() error {
+	rt.loop.close()
+	return nil
+}
+
+// retainedFile is a log file considered by Retention.
+type retainedFile struct {
+	LogFile
+	rel  string // on-disk path relative to the log directory, "/"-separated
+	size int64
+}
+
+// Apply applies every rule once and returns the files it removed. Each removal is
+// logged. Failing to remove one file does not stop the others; the errors are
+// returned together.
+func (rt *Retention) Apply(ctx context.Context) ([]Removal, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	groups := make([][]retainedFile, len(rt.cfg.Rules))
+	err := WalkLogFiles(rt.logDir, rt.cfg.Paths, func(lf LogFile) error {
+		i := rt.ruleFor(lf.Rel)
+		if i < 0 {
+			return nil
+		}
+		info, err := os.Stat(lf.Path)
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(rt.logDir, lf.Path)
+		if err != nil {
+			return nil
+		}
+		groups[i] = append(groups[i], retainedFile{LogFile: lf, rel: filepath.ToSlash(rel), size: info.Size()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list log files: %w", err)
+	}
+
+	now := rt.now().UTC()
+	protectFrom := now.AddDate(0, 0, -1).Format("2006-01-02")
+
+	var removals []Removal
+	var errs []error
+	for i, rule := range rt.cfg.Rules {
+		files := groups[i]
+		sort.Slice(files, func(a, b int) bool {
+			fa, fb := files[a], files[b]
+			if fa.Date != fb.Date {
+				return fa.Date < fb.Date
+			}
+			if fa.Base != fb.Base {
+				return fa.Base < fb.Base
+			}
+			if fa.Part != fb.Part {
+				return fa.Part < fb.Part
+			}
+			return fa.rel < fb.rel
+		})
+
+		var total int64
+		var candidates []retainedFile
+		for _, f := range files {
+			total += f.size
+			if f.Date < protectFrom {
+				candidates = append(candidates, f)
+			}
+		}
+
+		remove := func(f retainedFile, reason string) bool {
+			if err := ctx.Err(); err != nil {
+				errs = append(errs, err)
+				return false
+			}
+			rm, err := rt.remove(f, rule, reason)
+			if err != nil {
+				errs = append(errs, err)
+				return true
+			}
+			removals = append(removals, rm)
+			total -= f.size
+			return true
+		}
+
+		if rule.MaxAge > 0 {
+			ageCutoff := now.Add(-rule.MaxAge).Format("2006-01-02")
+			kept := candidates[:0]
+			for _, f := range candidates {
+				if f.Date < ageCutoff {
+					if !remove(f, ReasonMaxAge) {
+						return removals, errors.Join(errs...)
+					}
+					continue
+				}
+				kept = append(kept, f)
+			}
+			candidates = kept
+		}
+
+		if rule.MaxTotalBytes > 0 {
+			for len(candidates) > 0 && total > rule.MaxTotalBytes {
+				if !remove(candidates[0], ReasonMaxTotal) {
+					return removals, errors.Join(errs...)
+				}
+				candidates = candidates[1:]
+			}
+		}
+
+		if rule.MinFreeBytes > 0 {
+			for len(candidates) > 0 {
+				free, err := rt.free(rt.logDir)
+				if err != nil {
+					errs = append(errs, err)
+					break
+				}
+				if free >= rule.MinFreeBytes {
+					break
+				}
+				if !remove(candidates[0], ReasonFreeSpace) {
+					return removals, errors.Join(errs...)
+				}
+				candidates = candidates[1:]
+			}
+		}
+	}
+	return removals, errors.Join(errs...)
+}
+
+// ruleFor returns the index of the first rule matching rel, or -1.
+func (rt *Retention) ruleFor(rel string) int {
+	for i, rule := range rt.cfg.Rules {
+		if matchGlob(rule.Glob, rel) {
+			return i
+		}
+	}
+	return -1
+}
+
+// remove deletes or archives one file and logs it.
+func (rt *Retention) remove(f retainedFile, rule RetentionRule, reason string) (Removal, error) {
+	rm := Removal{Path: f.rel, Reason: reason, Bytes: f.size}
+	if rule.ArchiveDir != "" {
+		dst := filepath.Join(rule.ArchiveDir, filepath.FromSlash(f.rel))
+		if err := moveFile(f.Path, dst); err != nil {
+			return rm, fmt.Errorf("archive %s: %w", f.rel, err)
+		}
+		rm.ArchivedTo = dst
+		log.Printf("retention: archived %s to %s (%s, %d bytes)", f.rel, dst, reason, f.size)
+	} else {
+		if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+			return rm, fmt.Errorf("remove %s: %w", f.rel, err)
+		}
+		log.Printf("retention: removed %s (%s, %d bytes)", f.rel, reason, f.size)
+	}
+	removeEmptyDirs(rt.logDir, filepath.Dir(f.Path))
+	return rm, nil
+}
+
+// removeEmptyDirs removes dir and its parents up to (not including) root while
+// they are empty.
+func removeEmptyDirs(root, dir string) {
+	root = filepath.Clean(root)
+	for dir = filepath.Clean(dir); dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+// moveFile moves src to dst, creating dst's directory. Across file systems the file
+// is copied and synced before src is removed.
+func moveFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return fmt.Errorf("create directory for %s: %w", dst, err)
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := dst + compactTmpSuffix
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		_ = out.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// validateGlob checks that every segment of a retention glob is a valid pattern.
+func validateGlob(glob string) error {
+	if glob == "" {
+		return fmt.Errorf("retention rule has an empty glob")
+	}
+	for _, seg := range strings.Split(glob, "/") {
+		if seg == "**" {
+			continue
+		}
+		if _, err := path.Match(seg, ""); err != nil {
+			return fmt.Errorf("retention glob %q: %w", glob, err)
+		}
+	}
+	return nil
+}
+
+// matchGlob reports whether rel matches a retention glob (see RetentionRule.Glob).
+func matchGlob(glob, rel string) bool {
+	if !strings.Contains(glob, "/") {
+		ok, _ := path.Match(glob, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(glob, "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(pattern, segs []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segs); i++ {
+				if matchSegments(pattern[1:], segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segs[0]); !ok {
+			return false
+		}
+		pattern, segs = pattern[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
+
+// ParseRetentionRules parses rules separated by ";", each written as
+// GLOB:key=value,... with the keys
+//
+//	max_age    e.g. 30d or 12h
+//	max_total  e.g. 10GB (units B, KB, MB, GB, TB are powers of 1024)
+//	min_free   e.g. 5GB
+//	archive    directory receiving removed files instead of deleting them
+//
+// For example "billing/**:max_age=90d,archive=/mnt/archive; *:max_age=14d,max_total=50GB".
+func ParseRetentionRules(s string) ([]RetentionRule, error) {
+	var rules []RetentionRule
+	for _, spec := range strings.Split(s, ";") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		glob, opts, ok := strings.Cut(spec, ":")
+		if !ok {
+			return nil, fmt.Errorf("retention rule %q: expected GLOB:key=value,...", spec)
+		}
+		rule := RetentionRule{Glob: strings.TrimSpace(glob)}
+		for _, opt := range strings.Split(opts, ",") {
+			key, value, ok := strings.Cut(strings.TrimSpace(opt), "=")
+			if !ok {
+				return nil, fmt.Errorf("retention rule %q: expected key=value, got %q", spec, opt)
+			}
+			var err error
+			switch value = strings.TrimSpace(value); strings.TrimSpace(key) {
+			case "max_age":
+				rule.MaxAge, err = parseAge(value)
+			case "max_total":
+				rule.MaxTotalBytes, err = ParseBytes(value)
+			case "min_free":
+				rule.MinFreeBytes, err = ParseBytes(value)
+			case "archive":
+				rule.ArchiveDir = value
+			default:
+				err = fmt.Errorf("unknown key %q", key)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("retention rule %q: %w", spec, err)
+			}
+		}
+		if err := rule.validate(); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// parseAge parses a duration, also accepting whole days such as "30d".
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+	return d, nil
+}
+
+// byteUnits are the size suffixes accepted by ParseBytes, longest first.
+var byteUnits = []struct {
+	suffix string
+	mult   int64
+}{
+	{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+	{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1},
+}
+
+// ParseBytes parses a size such as "512MB" or "10GB"; units are powers of 1024 and
+// a plain number is a count of bytes.
+func ParseBytes(s string) (int64, error) {
+	num, mult := strings.ToUpper(strings.TrimSpace(s)), int64(1)
+	for _, u := range byteUnits {
+		if n, ok := strings.CutSuffix(num, u.suffix); ok {
+			num, mult = strings.TrimSpace(n), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 || n > (1<<63-1)/mult {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * mult, nil
+}
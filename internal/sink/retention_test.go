@@ -0,0 +1,213 @@
+package sink
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixedRetention returns a Retention whose clock is pinned to now.
+func fixedRetention(t *testing.T, dir string, now time.Time, cfg RetentionConfig) *Retention {
+	t.Helper()
+	rt, err := NewRetention(dir, cfg)
+	if err != nil {
+		t.Fatalf("NewRetention failed: %v", err)
+	}
+	rt.now = func() time.Time { return now }
+	return rt
+}
+
+func writeSized(t *testing.T, dir, rel string, size int) {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(strings.Repeat("x", size)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func removedPaths(removals []Removal) string {
+	var paths []string
+	for _, rm := range removals {
+		paths = append(paths, rm.Path)
+	}
+	return strings.Join(paths, ",")
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestRetention_MaxAgeNeverTouchesAdjacentDays(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 2, 10, 12, 0, 0, 0, time.UTC)
+	for _, date := range []string{"2026-02-01", "2026-02-07", "2026-02-08", "2026-02-09", "2026-02-10", "2026-02-11"} {
+		writeSized(t, dir, date+".log", 10)
+	}
+	writeSized(t, dir, "2026-02-02.log.gz", 10)
+
+	rt := fixedRetention(t, dir, now, RetentionConfig{Rules: []RetentionRule{{Glob: "*", MaxAge: time.Hour}}})
+	removals, err := rt.Apply(context.Background())
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if got := removedPaths(removals); got != "2026-02-01.log,2026-02-02.log.gz,2026-02-07.log,2026-02-08.log" {
+		t.Fatalf("unexpected removals: %s", got)
+	}
+	for _, date := range []string{"2026-02-09", "2026-02-10", "2026-02-11"} {
+		if !exists(filepath.Join(dir, date+".log")) {
+			t.Fatalf("%s must be kept", date)
+		}
+	}
+}
+
+func TestRetention_MaxTotalRemovesOldestFirst(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 2, 10, 12, 0, 0, 0, time.UTC)
+	writeSized(t, dir, "2026-02-05.log", 100)
+	writeSized(t, dir, "2026-02-06.log", 100)
+	writeSized(t, dir, "2026-02-06.1.log", 100)
+	writeSized(t, dir, "2026-02-07.log", 100)
+	writeSized(t, dir, "2026-02-10.log", 100)
+
+	rt := fixedRetention(t, dir, now, RetentionConfig{Rules: []RetentionRule{{Glob: "*", MaxTotalBytes: 250}}})
+	removals, err := rt.Apply(context.Background())
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if got := removedPaths(removals); got != "2026-02-05.log,2026-02-06.log,2026-02-06.1.log" {
+		t.Fatalf("unexpected removals: %s", got)
+	}
+	if removals[0].Reason != ReasonMaxTotal || removals[0].Bytes != 100 {
+		t.Fatalf("unexpected removal: %+v", removals[0])
+	}
+}
+
+func TestRetention_MinFreeSpace(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 2, 10, 12, 0, 0, 0, time.UTC)
+	writeSized(t, dir, "2026-02-05.log", 100)
+	writeSized(t, dir, "2026-02-06.log", 100)
+	writeSized(t, dir, "2026-02-07.log", 100)
+
+	rt := fixedRetention(t, dir, now, RetentionConfig{Rules: []RetentionRule{{Glob: "*", MinFreeBytes: 1000}}})
+	free := int64(850)
+	rt.free = func(string) (int64, error) {
+		var size int64
+		for _, date := range []string{"2026-02-05", "2026-02-06", "2026-02-07"} {
+			if !exists(filepath.Join(dir, date+".log")) {
+				size += 100
+			}
+		}
+		return free + size, nil
+	}
+	removals, err := rt.Apply(context.Background())
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if got := removedPaths(removals); got != "2026-02-05.log,2026-02-06.log" {
+		t.Fatalf("unexpected removals: %s", got)
+	}
+}
+
+func TestRetention_RulesScopedByGlob(t *testing.T) {
+	dir := t.TempDir()
+	archive := t.TempDir()
+	now := time.Date(2026, 2, 10, 12, 0, 0, 0, time.UTC)
+	paths, err := ParsePathTemplate("{app}/{yyyy}/{mm}/{dd}/{level}.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeSized(t, dir, "billing/2026/01/01/error.log", 10)
+	writeSized(t, dir, "billing/2026/02/01/error.log", 10)
+	writeSized(t, dir, "api/2026/02/01/info.log", 10)
+	writeSized(t, dir, "api/2026/02/05/info.log", 10)
+	writeSized(t, dir, "api/2026/02/05/error.log", 10)
+
+	rt := fixedRetention(t, dir, now, RetentionConfig{
+		Paths: paths,
+		Rules: []RetentionRule{
+			{Glob: "billing/**", MaxAge: 30 * 24 * time.Hour, ArchiveDir: archive},
+			{Glob: "info.log", MaxAge: 2 * 24 * time.Hour},
+		},
+	})
+	removals, err := rt.Apply(context.Background())
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if got := removedPaths(removals); got != "billing/2026/01/01/error.log,api/2026/02/01/info.log,api/2026/02/05/info.log" {
+		t.Fatalf("unexpected removals: %s", got)
+	}
+	if !exists(filepath.Join(archive, "billing", "2026", "01", "01", "error.log")) {
+		t.Fatalf("expected billing file to be archived")
+	}
+	if exists(filepath.Join(dir, "billing", "2026", "01")) {
+		t.Fatalf("expected empty directories to be removed")
+	}
+	for _, rel := range []string{"billing/2026/02/01/error.log", "api/2026/02/05/error.log"} {
+		if !exists(filepath.Join(dir, filepath.FromSlash(rel))) {
+			t.Fatalf("%s must be kept", rel)
+		}
+	}
+}
+
+func TestParseRetentionRules(t *testing.T) {
+	rules, err := ParseRetentionRules("billing/**:max_age=90d,archive=/mnt/archive; *:max_age=12h,max_total=50GB,min_free=512MB")
+	if err != nil {
+		t.Fatalf("ParseRetentionRules failed: %v", err)
+	}
+	want := []RetentionRule{
+		{Glob: "billing/**", MaxAge: 90 * 24 * time.Hour, ArchiveDir: "/mnt/archive"},
+		{Glob: "*", MaxAge: 12 * time.Hour, MaxTotalBytes: 50 << 30, MinFreeBytes: 512 << 20},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("expected %d rules, got %+v", len(want), rules)
+	}
+	for i := range want {
+		if rules[i] != want[i] {
+			t.Fatalf("rule %d: expected %+v, got %+v", i, want[i], rules[i])
+		}
+	}
+
+	for _, bad := range []string{
+		"*",
+		"*:max_age=forever",
+		"*:max_total=lots",
+		"*:colour=red",
+		"*:archive=/tmp",
+		"[:max_age=1d",
+		":max_age=1d",
+	} {
+		if _, err := ParseRetentionRules(bad); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		glob, rel string
+		want      bool
+	}{
+		{"*.log", "2026-02-09.log", true},
+		{"*.log", "api/2026/02/09/info.log", true},
+		{"error.*", "api/2026/02/09/info.log", false},
+		{"api/**", "api/2026/02/09/info.log", true},
+		{"api/**", "billing/2026/02/09/info.log", false},
+		{"**/error.log", "api/2026/02/09/error.log", true},
+		{"**/error.log", "error.log", true},
+		{"*/2026/*/*/*.log", "api/2026/02/09/info.log", true},
+		{"*/2026/*/*.log", "api/2026/02/09/info.log", false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.glob, tt.rel); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.glob, tt.rel, got, tt.want)
+		}
+	}
+}
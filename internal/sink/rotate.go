@@ -0,0 +1,155 @@
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// rotation holds the limits after which a file continues in its next part.
+// Zero limits are disabled.
+type rotation struct {
+	maxBytes int64
+	maxLines int64
+}
+
+// full reports whether line must go to a new part of a file that already holds
+// size bytes in lines lines. A line longer than maxBytes still goes to an empty part.
+func (r rotation) full(size, lines int64, line string) bool {
+	if r.maxBytes > 0 && size > 0 && size+int64(len(line))+1 > r.maxBytes {
+		return true
+	}
+	return r.maxLines > 0 && lines >= r.maxLines
+}
+
+// partFile is the newest part of a possibly rotated file, open for appending.
+type partFile struct {
+	base  string // path of part 0
+	paths *PathTemplate
+	part  int
+	f     *os.File
+	size  int64
+	lines int64 // only counted when the sink has a line limit
+}
+
+// openPartFile opens the newest existing part of the file at base (or base itself).
+func openPartFile(base string, paths *PathTemplate, rot rotation) (*partFile, error) {
+	pf := &partFile{base: base, paths: paths}
+	part, err := pf.latestPart()
+	if err != nil {
+		return nil, err
+	}
+	if err := pf.open(part, rot); err != nil {
+		return nil, err
+	}
+	return pf, nil
+}
+
+// latestPart finds the highest part number present on disk.
+func (pf *partFile) latestPart() (int, error) {
+	entries, err := os.ReadDir(filepath.Dir(pf.base))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("list parts of %s: %w", pf.base, err)
+	}
+	// Part n of base is named stem + "." + n + ext.
+	suffix := pf.paths.ext
+	prefix := strings.TrimSuffix(filepath.Base(pf.base), suffix)
+
+	latest := 0
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, prefix+".") || !strings.HasSuffix(name, suffix) || len(name) <= len(prefix)+1+len(suffix) {
+			continue
+		}
+		digits := name[len(prefix)+1 : len(name)-len(suffix)]
+		n, err := strconv.Atoi(digits)
+		if err != nil || n < 1 || strconv.Itoa(n) != digits {
+			continue
+		}
+		if n > latest {
+			latest = n
+		}
+	}
+	return latest, nil
+}
+
+// path returns the path of part n.
+func (pf *partFile) path(n int) string {
+	return pf.paths.PartPath(pf.base, n)
+}
+
+// open opens part n and reads its size (and line count when rot limits lines).
+func (pf *partFile) open(n int, rot rotation) error {
+	path := pf.path(n)
+	f, err := openAppend(path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("stat %s: %w", path, err)
+	}
+	var lines int64
+	if rot.maxLines > 0 && info.Size() > 0 {
+		if lines, err = countLines(path); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+	pf.part, pf.f, pf.size, pf.lines = n, f, info.Size(), lines
+	return nil
+}
+
+// rotate syncs and closes the current part and opens part n.
+func (pf *partFile) rotate(n int, rot rotation) error {
+	if err := pf.f.Sync(); err != nil {
+		return fmt.Errorf("sync dated file %s: %w", pf.f.Name(), err)
+	}
+	if err := pf.f.Close(); err != nil {
+		return fmt.Errorf("close dated file %s: %w", pf.f.Name(), err)
+	}
+	return pf.open(n, rot)
+}
+
+// write appends one line to the current part.
+func (pf *partFile) write(line string) error {
+	n, err := pf.f.WriteString(line + "\n")
+	pf.size += int64(n)
+	pf.lines++
+	return err
+}
+
+// Close closes the current part.
+func (pf *partFile) Close() error {
+	return pf.f.Close()
+}
+
+// countLines counts the newline-terminated lines in a file.
+func countLines(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var n int64
+	buf := make([]byte, 64*1024)
+	for {
+		k, err := f.Read(buf)
+		n += int64(bytes.Count(buf[:k], []byte{'\n'}))
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("read %s: %w", path, err)
+		}
+	}
+}
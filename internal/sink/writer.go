@@ -0,0 +1,43 @@
+package sink
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WriterSink writes lines to an io.Writer, such as os.Stdout for a container
+// runtime to collect. Each batch is written with a single Write call.
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterSink creates a WriterSink writing to w.
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+// WriteLine writes one line followed by a newline.
+func (ws *WriterSink) WriteLine(ctx context.Context, line string, timestamp time.Time) error {
+	return ws.WriteLines(ctx, []Entry{{Line: line, Timestamp: timestamp}})
+}
+
+// WriteLines writes the lines of entries, each followed by a newline.
+func (ws *WriterSink) WriteLines(ctx context.Context, entries []Entry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var b strings.Builder
+	for _, e := range entries {
+		b.WriteString(e.Line)
+		b.WriteByte('\n')
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	_, err := io.WriteString(ws.w, b.String())
+	return err
+}
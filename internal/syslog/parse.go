@@ -0,0 +1,324 @@
+// Package syslog receives syslog messages (RFC 5424 and BSD RFC 3164) over UDP and
+// TCP and feeds them into the ingest pipeline.
+package syslog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"logger/internal/model"
+)
+
+// Message is a parsed syslog message. Fields the message leaves out are empty.
+type Message struct {
+	Facility  int
+	Severity  int
+	Timestamp time.Time // zero when the message carries none
+	Hostname  string
+	AppName   string
+	ProcID    string
+	MsgID     string
+	// StructuredData maps SD-IDs to their parameters (RFC 5424 only).
+	StructuredData map[string]map[string]string
+	Text           string
+}
+
+// defaultPRI is assumed for messages without a PRI part (user.notice, RFC 3164 4.3.3).
+const defaultPRI = 13
+
+// facilityNames are the RFC 5424 facility keywords, indexed by facility code.
+var facilityNames = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// Level maps the message severity to a log level: emerg, alert, crit and err are
+// error, warning is warn, notice and info are info, debug is debug.
+func (m Message) Level() model.LogLevel {
+	switch {
+	case m.Severity <= 3:
+		return model.LevelError
+	case m.Severity == 4:
+		return model.LevelWarn
+	case m.Severity == 7:
+		return model.LevelDebug
+	default:
+		return model.LevelInfo
+	}
+}
+
+// Payload converts the message into an event payload. App is "hostname/app-name"
+// (or whichever of the two is present); the facility, PROCID, MSGID and every
+// structured-data parameter, keyed "sd-id.name", become fields. Messages without a
+// timestamp are stamped with received.
+func (m Message) Payload(received time.Time) model.EventPayload {
+	ts := m.Timestamp
+	if ts.IsZero() {
+		ts = received
+	}
+
+	var app []string
+	for _, s := range []string{m.Hostname, m.AppName} {
+		if s != "" {
+			app = append(app, s)
+		}
+	}
+
+	fields := map[string]any{}
+	if m.Facility >= 0 && m.Facility < len(facilityNames) {
+		fields["facility"] = facilityNames[m.Facility]
+	}
+	if m.ProcID != "" {
+		fields["procid"] = m.ProcID
+	}
+	if m.MsgID != "" {
+		fields["msgid"] = m.MsgID
+	}
+	for id, params := range m.StructuredData {
+		for name, value := range params {
+			fields[id+"."+name] = value
+		}
+	}
+
+	return model.EventPayload{
+		Timestamp: ts.Format(time.RFC3339Nano),
+		Level:     string(m.Level()),
+		Message:   m.Text,
+		App:       strings.Join(app, "/"),
+		Fields:    fields,
+	}
+}
+
+// Parse reads one syslog message. Messages whose PRI is followed by the version
+// "1" are parsed as RFC 5424, anything else as RFC 3164. RFC 3164 timestamps have
+// neither year nor zone: they are read in loc, in the year that puts them closest
+// to now.
+func Parse(data []byte, now time.Time, loc *time.Location) (Message, error) {
+	data = bytes.TrimRight(data, "\r\n\x00")
+	pri, rest, err := parsePRI(data)
+	if err != nil {
+		return Message{}, err
+	}
+	m := Message{Facility: pri / 8, Severity: pri % 8}
+	if bytes.HasPrefix(rest, []byte("1 ")) {
+		err = parse5424(&m, rest[2:])
+	} else {
+		parse3164(&m, rest, now, loc)
+	}
+	return m, err
+}
+
+// parsePRI reads "<N>" at the start of data. Without one, defaultPRI is assumed.
+func parsePRI(data []byte) (int, []byte, error) {
+	if len(data) == 0 || data[0] != '<' {
+		return defaultPRI, data, nil
+	}
+	end := bytes.IndexByte(data, '>')
+	if end < 2 || end > 4 {
+		return 0, nil, errors.New("invalid PRI")
+	}
+	pri, err := strconv.Atoi(string(data[1:end]))
+	if err != nil || pri < 0 || pri > 191 {
+		return 0, nil, errors.New("invalid PRI")
+	}
+	return pri, data[end+1:], nil
+}
+
+// parse5424 reads "TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD [MSG]".
+func parse5424(m *Message, rest []byte) error {
+	var header [5]string
+	for i := range header {
+		var tok []byte
+		tok, rest = nextToken(rest)
+		if tok == nil {
+			return fmt.Errorf("truncated RFC 5424 header")
+		}
+		if string(tok) != "-" {
+			header[i] = string(tok)
+		}
+	}
+	if header[0] != "" {
+		ts, err := time.Parse(time.RFC3339Nano, header[0])
+		if err != nil {
+			return fmt.Errorf("invalid RFC 5424 timestamp %q", header[0])
+		}
+		m.Timestamp = ts
+	}
+	m.Hostname, m.AppName, m.ProcID, m.MsgID = header[1], header[2], header[3], header[4]
+
+	if len(rest) == 0 {
+		return errors.New("truncated RFC 5424 header")
+	}
+	if rest[0] == '-' {
+		rest = rest[1:]
+	} else {
+		sd, n, err := parseStructuredData(rest)
+		if err != nil {
+			return err
+		}
+		m.StructuredData, rest = sd, rest[n:]
+	}
+	if len(rest) > 0 && rest[0] == ' ' {
+		rest = rest[1:]
+	}
+	m.Text = messageText(bytes.TrimPrefix(rest, []byte("\xef\xbb\xbf")))
+	return nil
+}
+
+// nextToken splits the next space-terminated token off data.
+func nextToken(data []byte) (tok, rest []byte) {
+	i := bytes.IndexByte(data, ' ')
+	if i <= 0 {
+		return nil, data
+	}
+	return data[:i], data[i+1:]
+}
+
+// parseStructuredData reads one or more "[SD-ID name="value" ...]" elements and
+// returns them with the number of bytes consumed.
+func parseStructuredData(data []byte) (map[string]map[string]string, int, error) {
+	sd := map[string]map[string]string{}
+	i := 0
+	for i < len(data) && data[i] == '[' {
+		i++
+		start := i
+		for i < len(data) && data[i] != ' ' && data[i] != ']' {
+			i++
+		}
+		if i == len(data) || i == start {
+			return nil, 0, errors.New("invalid structured data")
+		}
+		params := map[string]string{}
+		sd[string(data[start:i])] = params
+
+		for i < len(data) && data[i] == ' ' {
+			i++
+			start = i
+			for i < len(data) && data[i] != '=' {
+				i++
+			}
+			if i+1 >= len(data) || data[i+1] != '"' || i == start {
+				return nil, 0, errors.New("invalid structured data parameter")
+			}
+			name := string(data[start:i])
+			i += 2
+
+			var value []byte
+			for ; i < len(data) && data[i] != '"'; i++ {
+				// Only '"', '\' and ']' are escaped; other backslashes are literal.
+				if data[i] == '\\' && i+1 < len(data) && bytes.IndexByte([]byte(`"\]`), data[i+1]) >= 0 {
+					i++
+				}
+				value = append(value, data[i])
+			}
+			if i == len(data) {
+				return nil, 0, errors.New("unterminated structured data value")
+			}
+			params[name] = string(value)
+			i++
+		}
+		if i == len(data) || data[i] != ']' {
+			return nil, 0, errors.New("invalid structured data")
+		}
+		i++
+	}
+	return sd, i, nil
+}
+
+// parse3164 reads "TIMESTAMP HOSTNAME TAG[PID]: MSG". Real-world senders leave out
+// parts, so each one is optional: without a timestamp the hostname is not read
+// either, and without a recognisable tag the whole remainder is the message.
+func parse3164(m *Message, rest []byte, now time.Time, loc *time.Location) {
+	if ts, n, ok := parse3164Timestamp(rest, now, loc); ok {
+		m.Timestamp = ts
+		rest = bytes.TrimLeft(rest[n:], " ")
+		if tok, after := nextToken(rest); tok != nil && !isTag(tok) {
+			m.Hostname, rest = string(tok), after
+		}
+	}
+
+	if tag, procID, after, ok := splitTag(rest); ok {
+		m.AppName, m.ProcID, rest = tag, procID, after
+	}
+	m.Text = messageText(rest)
+}
+
+// parse3164Timestamp reads "Mmm dd hh:mm:ss" or, as some daemons send, an RFC 3339
+// timestamp. It returns the number of bytes consumed.
+func parse3164Timestamp(data []byte, now time.Time, loc *time.Location) (time.Time, int, bool) {
+	if len(data) >= len(time.Stamp) {
+		if ts, err := time.ParseInLocation(time.Stamp, string(data[:len(time.Stamp)]), loc); err == nil {
+			return closestYear(ts, now.In(loc)), len(time.Stamp), true
+		}
+	}
+	if tok, _ := nextToken(data); tok != nil {
+		if ts, err := time.Parse(time.RFC3339Nano, string(tok)); err == nil {
+			return ts, len(tok), true
+		}
+	}
+	return time.Time{}, 0, false
+}
+
+// closestYear moves ts, parsed without a year, into the year that puts it closest
+// to now (so a December message received in January is last year's).
+func closestYear(ts, now time.Time) time.Time {
+	best := ts.AddDate(now.Year()-ts.Year(), 0, 0)
+	for _, years := range []int{-1, 1} {
+		if c := best.AddDate(years, 0, 0); c.Sub(now).Abs() < best.Sub(now).Abs() {
+			return c
+		}
+	}
+	return best
+}
+
+// isTag reports whether tok is a TAG rather than a hostname: "app:" or "app[123]:".
+func isTag(tok []byte) bool {
+	return bytes.HasSuffix(tok, []byte(":")) || bytes.IndexByte(tok, '[') > 0
+}
+
+// splitTag reads "TAG: ", "TAG[PID]: " or "TAG[PID] " off the start of data. A TAG
+// is up to 48 letters, digits and "-_./" characters.
+func splitTag(data []byte) (tag, procID string, rest []byte, ok bool) {
+	i := 0
+	for i < len(data) && i <= 48 && isTagByte(data[i]) {
+		i++
+	}
+	if i == 0 || i > 48 || i == len(data) {
+		return "", "", data, false
+	}
+	tag, rest = string(data[:i]), data[i:]
+	if rest[0] == '[' {
+		end := bytes.IndexByte(rest, ']')
+		if end < 0 {
+			return "", "", data, false
+		}
+		procID, rest = string(rest[1:end]), rest[end+1:]
+	} else if rest[0] != ':' {
+		return "", "", data, false
+	}
+	rest = bytes.TrimPrefix(rest, []byte(":"))
+	if len(rest) > 0 && rest[0] != ' ' {
+		return "", "", data, false
+	}
+	return tag, procID, bytes.TrimPrefix(rest, []byte(" ")), true
+}
+
+func isTagByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '-' || c == '_' || c == '.' || c == '/'
+}
+
+// messageText returns the message as valid UTF-8 without surrounding whitespace.
+func messageText(data []byte) string {
+	s := strings.TrimSpace(string(data))
+	if !utf8.ValidString(s) {
+		s = strings.ToValidUTF8(s, "�")
+	}
+	return s
+}
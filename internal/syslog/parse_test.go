@@ -0,0 +1,97 @@
+package syslog
+
+import (
+	"testing"
+	"time"
+
+	"logger/internal/model"
+)
+
+func TestParse_RFC5424(t *testing.T) {
+	data := []byte(`<165>1 2026-02-09T22:14:15.003Z mymachine.example.com evntslog 1234 ID47 [exampleSDID@32473 iut="3" eventSource="Appl\"ication\]"][meta seq="1"] ` + "\xef\xbb\xbf" + `An application event`)
+	m, err := Parse(data, time.Now(), time.UTC)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if m.Facility != 20 || m.Severity != 5 || m.Level() != model.LevelInfo {
+		t.Fatalf("unexpected PRI: facility %d severity %d", m.Facility, m.Severity)
+	}
+	if !m.Timestamp.Equal(time.Date(2026, 2, 9, 22, 14, 15, 3e6, time.UTC)) {
+		t.Fatalf("unexpected timestamp %v", m.Timestamp)
+	}
+	if m.Hostname != "mymachine.example.com" || m.AppName != "evntslog" || m.ProcID != "1234" || m.MsgID != "ID47" {
+		t.Fatalf("unexpected header: %+v", m)
+	}
+	if got := m.StructuredData["exampleSDID@32473"]["eventSource"]; got != `Appl"ication]` {
+		t.Fatalf("unexpected structured data value %q", got)
+	}
+	if m.Text != "An application event" {
+		t.Fatalf("unexpected message %q", m.Text)
+	}
+
+	p := m.Payload(time.Now())
+	if p.App != "mymachine.example.com/evntslog" || p.Level != "info" {
+		t.Fatalf("unexpected payload: %+v", p)
+	}
+	if p.Fields["exampleSDID@32473.iut"] != "3" || p.Fields["meta.seq"] != "1" || p.Fields["facility"] != "local4" || p.Fields["msgid"] != "ID47" {
+		t.Fatalf("unexpected fields: %v", p.Fields)
+	}
+}
+
+func TestParse_RFC5424NilValues(t *testing.T) {
+	received := time.Date(2026, 2, 9, 8, 0, 0, 0, time.UTC)
+	m, err := Parse([]byte("<11>1 - - - - - -"), received, time.UTC)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	p := m.Payload(received)
+	if p.App != "" || p.Level != "error" || p.Timestamp != "2026-02-09T08:00:00Z" || m.Text != "" {
+		t.Fatalf("unexpected payload: %+v", p)
+	}
+
+	for _, bad := range []string{
+		"<11>1 2026-02-09T08:00:00Z host",
+		"<11>1 yesterday host app - - - msg",
+		`<11>1 - host app - - [id x="unterminated] msg`,
+		"<999>1 - - - - - - msg",
+	} {
+		if _, err := Parse([]byte(bad), received, time.UTC); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestParse_RFC3164(t *testing.T) {
+	now := time.Date(2026, 2, 9, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in                      string
+		host, app, procID, text string
+		severity                int
+		ts                      time.Time
+	}{
+		{"<34>Feb  9 10:11:12 mymachine su[230]: 'su root' failed for lonvick on /dev/pts/8",
+			"mymachine", "su", "230", "'su root' failed for lonvick on /dev/pts/8", 2, time.Date(2026, 2, 9, 10, 11, 12, 0, time.UTC)},
+		{"<13>Feb  9 10:11:12 cron: job done",
+			"", "cron", "", "job done", 5, time.Date(2026, 2, 9, 10, 11, 12, 0, time.UTC)},
+		{"<12>Feb  9 10:11:12 10.0.0.99 Use the BFG!",
+			"10.0.0.99", "", "", "Use the BFG!", 4, time.Date(2026, 2, 9, 10, 11, 12, 0, time.UTC)},
+		{"<15>Dec 31 23:59:59 host app: last year",
+			"host", "app", "", "last year", 7, time.Date(2025, 12, 31, 23, 59, 59, 0, time.UTC)},
+		{"<14>2026-02-09T10:11:12.5+01:00 host app[7]: iso",
+			"host", "app", "7", "iso", 6, time.Date(2026, 2, 9, 9, 11, 12, 5e8, time.UTC)},
+		{"no header at all",
+			"", "", "", "no header at all", 5, time.Time{}},
+	}
+	for _, tt := range tests {
+		m, err := Parse([]byte(tt.in), now, time.UTC)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", tt.in, err)
+		}
+		if m.Hostname != tt.host || m.AppName != tt.app || m.ProcID != tt.procID || m.Text != tt.text || m.Severity != tt.severity {
+			t.Errorf("Parse(%q) = %+v", tt.in, m)
+		}
+		if !m.Timestamp.Equal(tt.ts) {
+			t.Errorf("Parse(%q) timestamp = %v, want %v", tt.in, m.Timestamp, tt.ts)
+		}
+	}
+}
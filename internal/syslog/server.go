@@ -0,0 +1,186 @@
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"logger/internal/ingest"
+	"logger/internal/model"
+)
+
+// Config configures a Server. Zero values select the defaults.
+type Config struct {
+	// UDPAddr and TCPAddr are the addresses to listen on, e.g. ":5514". An empty
+	// address disables that transport.
+	UDPAddr string
+	TCPAddr string
+	// MaxMessageBytes bounds a single message (default 64 KiB). Longer UDP
+	// datagrams are truncated; longer TCP messages are discarded.
+	MaxMessageBytes int
+	// Location is the time zone of RFC 3164 timestamps (default time.Local).
+	Location *time.Location
+	// IdleTimeout closes TCP connections that send nothing for this long (default 5m).
+	IdleTimeout time.Duration
+}
+
+const (
+	defaultMaxMessageBytes = 64 << 10
+	defaultIdleTimeout     = 5 * time.Minute
+)
+
+// Server receives syslog messages and writes them through an ingest pipeline.
+// Messages that fail to parse or validate are logged and dropped: syslog has no
+// way to report them to the sender.
+type Server struct {
+	pipeline *ingest.Pipeline
+	cfg      Config
+	ln       *ingest.Listener
+}
+
+// NewServer creates a Server writing to p. Start opens the listeners.
+func NewServer(p *ingest.Pipeline, cfg Config) *Server {
+	if cfg.MaxMessageBytes <= 0 {
+		cfg.MaxMessageBytes = defaultMaxMessageBytes
+	}
+	if cfg.Location == nil {
+		cfg.Location = time.Local
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = defaultIdleTimeout
+	}
+	return &Server{pipeline: p, cfg: cfg, ln: ingest.NewListener("syslog")}
+}
+
+// Start opens the configured listeners and serves them in the background.
+func (s *Server) Start() error {
+	if s.cfg.UDPAddr != "" {
+		if err := s.ln.ListenUDP(s.cfg.UDPAddr, s.cfg.MaxMessageBytes, s.handleDatagram); err != nil {
+			return err
+		}
+	}
+	if s.cfg.TCPAddr != "" {
+		if err := s.ln.ListenTCP(s.cfg.TCPAddr, s.handleConn); err != nil {
+			s.ln.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+// UDPAddr returns the address of the UDP listener, or nil when it is disabled.
+func (s *Server) UDPAddr() net.Addr {
+	return s.ln.UDPAddr()
+}
+
+// TCPAddr returns the address of the TCP listener, or nil when it is disabled.
+func (s *Server) TCPAddr() net.Addr {
+	return s.ln.TCPAddr()
+}
+
+// handleDatagram handles one message per datagram.
+func (s *Server) handleDatagram(data []byte) {
+	s.ln.WriteMessage(s.pipeline, data, "udp", s.decode)
+}
+
+// handleConn reads framed messages until the connection ends.
+func (s *Server) handleConn(conn net.Conn) {
+	s.ln.ServeFramed(conn, s.pipeline, ingest.Framing{
+		Read:        readFrame,
+		MaxBytes:    s.cfg.MaxMessageBytes,
+		IdleTimeout: s.cfg.IdleTimeout,
+		Decode:      s.decode,
+	})
+}
+
+// readFrame reads one message using either framing of RFC 6587, chosen per message:
+// octet counting ("LEN SP MSG") when it starts with a digit, otherwise
+// non-transparent framing terminated by a newline. See ingest.FrameReader.
+func readFrame(r *bufio.Reader, maxBytes int) ([]byte, error) {
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if c >= '1' && c <= '9' {
+			r.UnreadByte()
+			return readOctetCounted(r, maxBytes)
+		}
+		if c == '\n' || c == '\r' || c == 0 {
+			continue // blank line between messages
+		}
+		r.UnreadByte()
+		return readLine(r, maxBytes)
+	}
+}
+
+func readOctetCounted(r *bufio.Reader, maxBytes int) ([]byte, error) {
+	prefix, err := r.ReadSlice(' ')
+	if err != nil {
+		if err == bufio.ErrBufferFull {
+			return nil, errors.New("invalid octet count")
+		}
+		return nil, err
+	}
+	n, err := strconv.Atoi(string(prefix[:len(prefix)-1]))
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("invalid octet count %q", prefix)
+	}
+	if n > maxBytes {
+		if _, err := r.Discard(n); err != nil {
+			return nil, err
+		}
+		return nil, ingest.ErrFrameTooLarge
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func readLine(r *bufio.Reader, maxBytes int) ([]byte, error) {
+	var msg []byte
+	tooLong := false
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if !tooLong {
+			msg = append(msg, chunk...)
+			if len(msg) > maxBytes+1 {
+				msg, tooLong = nil, true
+			}
+		}
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF && len(msg) > 0:
+			return msg, nil // the last message may lack its newline
+		case err != nil:
+			return nil, err
+		case tooLong:
+			return nil, ingest.ErrFrameTooLarge
+		default:
+			return bytes.TrimRight(msg, "\r\n"), nil
+		}
+	}
+}
+
+// decode is the ingest.Decoder of syslog messages.
+func (s *Server) decode(msg []byte, now time.Time) (model.EventPayload, error) {
+	m, err := Parse(msg, now, s.cfg.Location)
+	if err != nil {
+		return model.EventPayload{}, err
+	}
+	return m.Payload(now), nil
+}
+
+// Close stops the listeners, closes open connections and waits for messages being
+// handled to be written.
+func (s *Server) Close() error {
+	return s.ln.Close()
+}
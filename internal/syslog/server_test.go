@@ -0,0 +1,95 @@
+package syslog
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"logger/internal/format"
+	"logger/internal/ingest"
+	"logger/internal/ingest/ingesttest"
+)
+
+func startServer(t *testing.T) (*Server, *ingesttest.Sink) {
+	t.Helper()
+	fs := &ingesttest.Sink{}
+	s := NewServer(&ingest.Pipeline{Sink: fs, Formatter: format.JSONFormatter{}}, Config{UDPAddr: "127.0.0.1:0", TCPAddr: "127.0.0.1:0", MaxMessageBytes: 256})
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, fs
+}
+
+func rfc5424(severity int, app, msg string) string {
+	return fmt.Sprintf("<%d>1 %s host %s - - - %s", 8+severity, time.Now().UTC().Format(time.RFC3339), app, msg)
+}
+
+func TestServer_UDP(t *testing.T) {
+	s, fs := startServer(t)
+	conn, err := net.Dial("udp", s.UDPAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	stamp := time.Now().Format(time.Stamp)
+	for _, msg := range []string{
+		rfc5424(3, "api", "boom"),
+		"<12>" + stamp + " router ifmgr: link down",
+		rfc5424(6, "api", ""), // no message: rejected by validation
+	} {
+		if _, err := conn.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := fs.WaitForMessages(t, 2)
+	if got[0] != "error:host/api:boom" || got[1] != "warn:router/ifmgr:link down" {
+		t.Fatalf("unexpected messages %q", got)
+	}
+}
+
+func TestServer_TCPFraming(t *testing.T) {
+	s, fs := startServer(t)
+	conn, err := net.Dial("tcp", s.TCPAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	octet := func(msg string) string { return fmt.Sprintf("%d %s", len(msg), msg) }
+	stream := octet(rfc5424(6, "a", "one")) +
+		rfc5424(7, "b", "two") + "\n" +
+		octet(rfc5424(4, "c", "three\nwith a newline")) +
+		rfc5424(6, "d", "x"+string(make([]byte, 300))) + "\n" + // too long: skipped
+		octet(rfc5424(6, "e", "y"+string(make([]byte, 300)))) + // too long: skipped
+		rfc5424(6, "f", "last")
+	if _, err := conn.Write([]byte(stream)); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	got := fs.WaitForMessages(t, 4)
+	want := []string{"info:host/a:one", "debug:host/b:two", "warn:host/c:three\nwith a newline", "info:host/f:last"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestServer_CloseEndsOpenConnections(t *testing.T) {
+	s, fs := startServer(t)
+	conn, err := net.Dial("tcp", s.TCPAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(rfc5424(6, "a", "kept") + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	fs.WaitForMessages(t, 1)
+
+	// The client keeps its connection open; Close must not wait for it.
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+}